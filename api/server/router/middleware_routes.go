@@ -58,6 +58,11 @@ func Authentication(o *options.ServerOptions) gin.HandlerFunc {
 		if isPublicPath(c.Request.URL.Path) {
 			return
 		}
+		// plugin 回调接口仅接受任务级的回调 token
+		if isCallbackRoute(c) {
+			authenticateCallback(c, o)
+			return
+		}
 
 		accessKey := c.GetHeader("accessKey")
 		if accessKey != auth.AccessKey {
@@ -83,6 +88,50 @@ func isPublicPath(path string) bool {
 	return strings.HasPrefix(path, "/api/v2/pixiuctls")
 }
 
+// callbackTaskKey 回调 token 所属的任务 ID 在请求上下文中的 key
+const callbackTaskKey = "callbackTaskId"
+
+// callbackRoutes plugin 使用的回调接口
+var callbackRoutes = map[string]bool{
+	http.MethodPut + " /rainbow/tasks/:Id/status":     true,
+	http.MethodPost + " /rainbow/tasks/:Id/messages":  true,
+	http.MethodPost + " /rainbow/tasks/:Id/callbacks": true,
+	http.MethodPut + " /rainbow/tasks/:Id/progress":   true,
+	http.MethodPut + " /rainbow/tasks/:Id/stages":     true,
+	http.MethodPost + " /rainbow/tasks/:Id/export":    true,
+	http.MethodPut + " /rainbow/images/status":        true,
+	http.MethodPost + " /rainbow/images/batches":      true,
+}
+
+func isCallbackRoute(c *gin.Context) bool {
+	return callbackRoutes[c.Request.Method+" "+c.FullPath()]
+}
+
+// authenticateCallback 校验 Authorization 中的回调 token，路径中包含任务 ID 时必须和 token 所属的任务一致
+// 请求体中的任务和镜像由对应的接口通过 callbackTask 校验
+func authenticateCallback(c *gin.Context, o *options.ServerOptions) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	taskId, err := o.Controller.Server().AuthenticateCallback(c, token)
+	if err != nil {
+		httputils.AbortFailedWithCode(c, http.StatusUnauthorized, err)
+		return
+	}
+	if id := c.Param("Id"); len(id) != 0 && id != fmt.Sprintf("%d", taskId) {
+		httputils.AbortFailedWithCode(c, http.StatusForbidden, fmt.Errorf("回调 token 不属于任务 %s", id))
+		return
+	}
+	c.Set(callbackTaskKey, taskId)
+}
+
+// callbackTask 返回回调 token 所属的任务，未通过回调 token 认证时(如 debug 模式)返回 false
+func callbackTask(c *gin.Context) (int64, bool) {
+	v, ok := c.Get(callbackTaskKey)
+	if !ok {
+		return 0, false
+	}
+	return v.(int64), true
+}
+
 func verifyTimeStamp(timestamp string) error {
 	ts, err := strutil.ParseInt64(timestamp)
 	if err != nil {
@@ -44,6 +44,10 @@ func (cr *rainbowRouter) initRoutes(httpEngine *gin.Engine) {
 		taskV2Route := routeV2.Group("/tasks")
 		{
 			taskV2Route.POST("", cr.createTaskV2)
+			taskV2Route.GET("/:Id/progress", cr.getTaskProgress)
+			taskV2Route.GET("/:Id/progress/watch", cr.watchTaskProgress)
+			taskV2Route.GET("/:Id/export", cr.getTaskExport)
+			taskV2Route.GET("/:Id/export/download", cr.downloadTaskExport)
 		}
 
 		// 镜像
@@ -76,6 +80,8 @@ func (cr *rainbowRouter) initRoutes(httpEngine *gin.Engine) {
 	taskRoute := httpEngine.Group("/rainbow/tasks")
 	{
 		taskRoute.POST("", cr.createTask)
+		taskRoute.POST("/files", cr.createTaskFromFile)
+		taskRoute.POST("/imports", cr.importTaskArchive)
 		taskRoute.PUT("/:Id", cr.updateTask)
 		taskRoute.DELETE("/:Id", cr.deleteTask)
 		taskRoute.GET("/:Id", cr.getTask)
@@ -87,6 +93,18 @@ func (cr *rainbowRouter) initRoutes(httpEngine *gin.Engine) {
 
 		taskRoute.POST("/:Id/messages", cr.createTaskMessage)
 		taskRoute.GET(":Id/messages", cr.listTaskMessages)
+
+		taskRoute.POST("/:Id/callbacks", cr.batchCallback)
+		taskRoute.PUT("/:Id/progress", cr.updateImageProgress)
+		taskRoute.GET("/:Id/progress", cr.getTaskProgress)
+		taskRoute.GET("/:Id/progress/watch", cr.watchTaskProgress) // SSE
+		taskRoute.PUT("/:Id/stages", cr.updateImageStage)
+		taskRoute.GET("/:Id/stages", cr.listImageStages)
+
+		// 离线包，由 plugin 上传
+		taskRoute.POST("/:Id/export", cr.uploadTaskExport)
+		taskRoute.GET("/:Id/export", cr.getTaskExport)
+		taskRoute.GET("/:Id/export/download", cr.downloadTaskExport)
 	}
 
 	archRoute := httpEngine.Group("/rainbow/architectures")
@@ -116,6 +134,20 @@ func (cr *rainbowRouter) initRoutes(httpEngine *gin.Engine) {
 		kubernetesVersionRoute.GET("", cr.listKubernetesTags)
 	}
 
+	kubernetesAddonRoute := httpEngine.Group("/rainbow/kubernetes/addons")
+	{
+		kubernetesAddonRoute.GET("", cr.listKubernetesAddons)
+	}
+
+	kubernetesPrefetchRoute := httpEngine.Group("/rainbow/kubernetes/prefetches")
+	{
+		kubernetesPrefetchRoute.POST("", cr.createKubernetesPrefetch)
+		kubernetesPrefetchRoute.PUT("/:Id", cr.updateKubernetesPrefetch)
+		kubernetesPrefetchRoute.DELETE("/:Id", cr.deleteKubernetesPrefetch)
+		kubernetesPrefetchRoute.GET("/:Id", cr.getKubernetesPrefetch)
+		kubernetesPrefetchRoute.GET("", cr.listKubernetesPrefetches)
+	}
+
 	registryRoute := httpEngine.Group("/rainbow/registries")
 	{
 		registryRoute.POST("", cr.createRegistry)
@@ -135,8 +167,38 @@ func (cr *rainbowRouter) initRoutes(httpEngine *gin.Engine) {
 		agentRoute.GET("", cr.listAgents)
 		agentRoute.PUT("/status", cr.updateAgentStatus)
 
+		// 维护 agent，禁止调度和驱逐未开始任务
+		agentRoute.PUT("/:Name/cordon", cr.cordonAgent)
+		agentRoute.PUT("/:Name/uncordon", cr.uncordonAgent)
+		agentRoute.PUT("/:Name/drain", cr.drainAgent)
+
+		// agent 的 github actions 预算和月度开销
+		agentRoute.PUT("/:Name/budget", cr.updateAgentBudget)
+		agentRoute.GET("/usages", cr.listAgentUsages)
+
+		// agent 心跳时序
+		agentRoute.GET("/heartbeats", cr.listAgentHeartbeats)
+
+		// agent 日志和诊断
+		agentRoute.GET("/:Id/logs", cr.getAgentLogs)
+		agentRoute.GET("/:Id/diagnostics", cr.diagnoseAgent)
+
 		// 指定 agent 创建 repo
 		agentRoute.POST("/:Name/repos", cr.createAgentRepo)
+
+		// agent 分批滚动升级
+		agentRoute.POST("/rollouts", cr.createAgentRollout)
+		agentRoute.GET("/rollouts/:Id", cr.getAgentRollout)
+		agentRoute.GET("/rollouts", cr.listAgentRollouts)
+		agentRoute.GET("/rollouts/:Id/messages", cr.listAgentRolloutMessages)
+	}
+
+	// 备用 github 账号池
+	githubAccountRoute := httpEngine.Group("/rainbow/github/accounts")
+	{
+		githubAccountRoute.POST("", cr.createGithubAccount)
+		githubAccountRoute.DELETE("/:Id", cr.deleteGithubAccount)
+		githubAccountRoute.GET("", cr.listGithubAccounts)
 	}
 
 	imageRoute := httpEngine.Group("/rainbow/images")
@@ -153,6 +215,8 @@ func (cr *rainbowRouter) initRoutes(httpEngine *gin.Engine) {
 		imageRoute.GET("/:Id/tags", cr.listImageTags)
 		imageRoute.DELETE("/:Id/tags/:TagId", cr.deleteImageTag)
 		imageRoute.GET("/:Id/tags/:TagId", cr.getImageTag)
+		imageRoute.GET("/:Id/tags/:TagId/platforms", cr.listImageTagPlatforms)
+		imageRoute.GET("/:Id/tags/:TagId/provenances", cr.listImageTagProvenances)
 
 		// 镜像关联 Label API
 		imageRoute.POST("/:Id/labels", cr.bindImageLabels)
@@ -225,6 +289,7 @@ func (cr *rainbowRouter) initRoutes(httpEngine *gin.Engine) {
 	{
 		syncRoute.POST("/users", cr.createOrUpdateUsers)
 		syncRoute.POST("/kubernetes/tags", cr.syncKubernetesTags)
+		syncRoute.POST("/kubernetes/addons", cr.syncKubernetesAddons)
 		syncRoute.POST("/agents/drivers", cr.syncAgentDrivers)
 		syncRoute.POST("/namespaces", cr.syncNamespaces)
 	}
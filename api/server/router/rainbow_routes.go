@@ -1,8 +1,11 @@
 package router
 
 import (
+	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -10,6 +13,9 @@ import (
 	"github.com/caoyingjunz/rainbow/pkg/types"
 )
 
+// progressWatchInterval SSE 推送任务进度的间隔
+const progressWatchInterval = 2 * time.Second
+
 func (cr *rainbowRouter) createLabel(c *gin.Context) {
 	resp := httputils.NewResponse()
 
@@ -145,6 +151,36 @@ func (cr *rainbowRouter) createTask(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
+func (cr *rainbowRouter) createTaskFromFile(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	result, err := cr.c.Server().CreateTaskFromFile(c)
+	if result != nil {
+		resp.Result = result
+	}
+	if err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) importTaskArchive(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	result, err := cr.c.Server().ImportTaskArchive(c)
+	if result != nil {
+		resp.Result = result
+	}
+	if err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
 func (cr *rainbowRouter) createTaskV2(c *gin.Context) {
 	resp := httputils.NewResponse()
 
@@ -563,22 +599,20 @@ func (cr *rainbowRouter) updateAgentStatus(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) createAgentRepo(c *gin.Context) {
+func (cr *rainbowRouter) cordonAgent(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		githubReq types.CallGithubRequest
-		idMeta    struct {
+		idMeta struct {
 			Name string `uri:"Name" binding:"required"`
 		}
 		err error
 	)
-	if err = httputils.ShouldBindAny(c, &githubReq, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	githubReq.ClientId = idMeta.Name
-	if resp.Result, err = cr.c.Server().CreateAgentRepo(c, &githubReq); err != nil {
+	if err = cr.c.Server().CordonAgent(c, idMeta.Name); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -586,18 +620,20 @@ func (cr *rainbowRouter) createAgentRepo(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listAgents(c *gin.Context) {
+func (cr *rainbowRouter) uncordonAgent(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		listOption types.ListOptions
-		err        error
+		idMeta struct {
+			Name string `uri:"Name" binding:"required"`
+		}
+		err error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListAgents(c, listOption); err != nil {
+	if err = cr.c.Server().UncordonAgent(c, idMeta.Name); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -605,19 +641,20 @@ func (cr *rainbowRouter) listAgents(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) createImage(c *gin.Context) {
+func (cr *rainbowRouter) drainAgent(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		req types.CreateImageRequest
+		idMeta struct {
+			Name string `uri:"Name" binding:"required"`
+		}
 		err error
 	)
-	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-
-	if err = cr.c.Server().CreateImage(c, &req); err != nil {
+	if resp.Result, err = cr.c.Server().DrainAgent(c, idMeta.Name); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -625,43 +662,41 @@ func (cr *rainbowRouter) createImage(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) createImages(c *gin.Context) {
-	resp := types.Response{}
+func (cr *rainbowRouter) updateAgentBudget(c *gin.Context) {
+	resp := httputils.NewResponse()
 
 	var (
-		req types.CreateImagesRequest
+		req    types.UpdateAgentBudgetRequest
+		idMeta struct {
+			Name string `uri:"Name" binding:"required"`
+		}
 		err error
 	)
-	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
-		resp.Code = http.StatusBadRequest
-		resp.Message = err.Error()
-		c.JSON(http.StatusOK, resp)
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().CreateImages(c, &req); err != nil {
-		resp.Code = http.StatusBadRequest
-		resp.Message = err.Error()
-		c.JSON(http.StatusOK, resp)
+	req.AgentName = idMeta.Name
+	if err = cr.c.Server().UpdateAgentBudget(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
 		return
 	}
 
-	resp.Code = 200
-	c.JSON(http.StatusOK, resp)
+	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listImagesByIds(c *gin.Context) {
+func (cr *rainbowRouter) listAgentUsages(c *gin.Context) {
 	resp := httputils.NewResponse()
+
 	var (
-		ids struct {
-			Ids []int64 `json:"ids"`
-		}
-		err error
+		listOption types.ListOptions
+		err        error
 	)
-	if err = httputils.ShouldBindAny(c, &ids, nil, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListImagesByIds(c, ids.Ids); err != nil {
+	if resp.Result, err = cr.c.Server().ListAgentUsages(c, listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -669,19 +704,18 @@ func (cr *rainbowRouter) listImagesByIds(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) deleteImagesByIds(c *gin.Context) {
+func (cr *rainbowRouter) listAgentHeartbeats(c *gin.Context) {
 	resp := httputils.NewResponse()
+
 	var (
-		ids struct {
-			Ids []int64 `json:"ids"`
-		}
-		err error
+		listOption types.ListOptions
+		err        error
 	)
-	if err = httputils.ShouldBindAny(c, &ids, nil, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().DeleteImagesByIds(c, ids.Ids); err != nil {
+	if resp.Result, err = cr.c.Server().ListAgentHeartbeats(c, listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -689,20 +723,18 @@ func (cr *rainbowRouter) deleteImagesByIds(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) updateImage(c *gin.Context) {
+func (cr *rainbowRouter) getAgentLogs(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		idMeta types.IdMeta
-		req    types.UpdateImageRequest
-		err    error
+		req types.GetAgentLogsRequest
+		err error
 	)
-	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &req, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	req.Id = idMeta.ID
-	if err = cr.c.Server().UpdateImage(c, &req); err != nil {
+	if resp.Result, err = cr.c.Server().GetAgentLogs(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -710,7 +742,7 @@ func (cr *rainbowRouter) updateImage(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) deleteImage(c *gin.Context) {
+func (cr *rainbowRouter) diagnoseAgent(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
@@ -721,7 +753,7 @@ func (cr *rainbowRouter) deleteImage(c *gin.Context) {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().DeleteImage(c, idMeta.ID); err != nil {
+	if resp.Result, err = cr.c.Server().DiagnoseAgent(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -729,21 +761,18 @@ func (cr *rainbowRouter) deleteImage(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) deleteImageTag(c *gin.Context) {
+func (cr *rainbowRouter) createGithubAccount(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		idMeta struct {
-			ID    int64 `uri:"Id" binding:"required"`
-			TagId int64 `uri:"TagId" binding:"required"`
-		}
+		req types.CreateGithubAccountRequest
 		err error
 	)
-	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().DeleteImageTag(c, idMeta.ID, idMeta.TagId); err != nil {
+	if err = cr.c.Server().CreateGithubAccount(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -751,21 +780,18 @@ func (cr *rainbowRouter) deleteImageTag(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) bindImageLabels(c *gin.Context) {
+func (cr *rainbowRouter) deleteGithubAccount(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		idMeta struct {
-			ID int64 `uri:"Id" binding:"required"`
-		}
-		req types.BindImageLabels
-		err error
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().BindImageLabels(c, idMeta.ID, req); err != nil {
+	if err = cr.c.Server().DeleteGithubAccount(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -773,21 +799,18 @@ func (cr *rainbowRouter) bindImageLabels(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) getImageTag(c *gin.Context) {
+func (cr *rainbowRouter) listGithubAccounts(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		idMeta struct {
-			ID    int64 `uri:"Id" binding:"required"`
-			TagId int64 `uri:"TagId" binding:"required"`
-		}
-		err error
+		listOption types.ListOptions
+		err        error
 	)
-	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().GetImageTag(c, idMeta.ID, idMeta.TagId); err != nil {
+	if resp.Result, err = cr.c.Server().ListGithubAccounts(c, listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -795,21 +818,22 @@ func (cr *rainbowRouter) getImageTag(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listImageLabels(c *gin.Context) {
+func (cr *rainbowRouter) createAgentRepo(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		idMeta struct {
-			ID int64 `uri:"Id" binding:"required"`
+		githubReq types.CallGithubRequest
+		idMeta    struct {
+			Name string `uri:"Name" binding:"required"`
 		}
-		listOption types.ListOptions
-		err        error
+		err error
 	)
-	if err = httputils.ShouldBindAny(c, nil, &idMeta, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, &githubReq, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListImageLabels(c, idMeta.ID, listOption); err != nil {
+	githubReq.ClientId = idMeta.Name
+	if resp.Result, err = cr.c.Server().CreateAgentRepo(c, &githubReq); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -817,21 +841,18 @@ func (cr *rainbowRouter) listImageLabels(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listImageTags(c *gin.Context) {
+func (cr *rainbowRouter) listAgents(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		idMeta struct {
-			ID int64 `uri:"Id" binding:"required"`
-		}
 		listOption types.ListOptions
 		err        error
 	)
-	if err = httputils.ShouldBindAny(c, nil, &idMeta, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListImageTags(c, idMeta.ID, listOption); err != nil {
+	if resp.Result, err = cr.c.Server().ListAgents(c, listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -839,19 +860,18 @@ func (cr *rainbowRouter) listImageTags(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) UpdateImageStatus(c *gin.Context) {
+func (cr *rainbowRouter) createAgentRollout(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		req types.UpdateImageStatusRequest
+		req types.CreateAgentRolloutRequest
 		err error
 	)
 	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-
-	if err = cr.c.Server().UpdateImageStatus(c, &req); err != nil {
+	if err = cr.c.Server().CreateAgentRollout(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -859,7 +879,7 @@ func (cr *rainbowRouter) UpdateImageStatus(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) getImage(c *gin.Context) {
+func (cr *rainbowRouter) getAgentRollout(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
@@ -870,7 +890,7 @@ func (cr *rainbowRouter) getImage(c *gin.Context) {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().GetImage(c, idMeta.ID); err != nil {
+	if resp.Result, err = cr.c.Server().GetAgentRollout(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -878,7 +898,7 @@ func (cr *rainbowRouter) getImage(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) searchRepo(c *gin.Context) {
+func (cr *rainbowRouter) listAgentRollouts(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
@@ -889,7 +909,7 @@ func (cr *rainbowRouter) searchRepo(c *gin.Context) {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().SearchRepo(c, listOption); err != nil {
+	if resp.Result, err = cr.c.Server().ListAgentRollouts(c, listOption); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -897,18 +917,18 @@ func (cr *rainbowRouter) searchRepo(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listImages(c *gin.Context) {
+func (cr *rainbowRouter) listAgentRolloutMessages(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		listOption types.ListOptions
-		err        error
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListImages(c, listOption); err != nil {
+	if resp.Result, err = cr.c.Server().ListAgentRolloutMessages(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -916,18 +936,19 @@ func (cr *rainbowRouter) listImages(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listImagesForClient(c *gin.Context) {
+func (cr *rainbowRouter) createImage(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		listOption types.ListOptions
-		err        error
+		req types.CreateImageRequest
+		err error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListImagesForClient(c, listOption); err != nil {
+
+	if err = cr.c.Server().CreateImage(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -935,39 +956,47 @@ func (cr *rainbowRouter) listImagesForClient(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) getCollections(c *gin.Context) {
-	resp := httputils.NewResponse()
+func (cr *rainbowRouter) createImages(c *gin.Context) {
+	resp := types.Response{}
 
 	var (
-		listOption types.ListOptions
-		err        error
+		req types.CreateImagesRequest
+		err error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
-		httputils.SetFailed(c, resp, err)
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+		resp.Code = http.StatusBadRequest
+		resp.Message = err.Error()
+		c.JSON(http.StatusOK, resp)
 		return
 	}
-	if resp.Result, err = cr.c.Server().GetCollection(c, listOption); err != nil {
-		httputils.SetFailed(c, resp, err)
+	if taskId, ok := callbackTask(c); ok && req.TaskId != taskId {
+		httputils.AbortFailedWithCode(c, http.StatusForbidden, fmt.Errorf("回调 token 不属于任务 %d", req.TaskId))
+		return
+	}
+	if resp.Result, err = cr.c.Server().CreateImages(c, &req); err != nil {
+		resp.Code = http.StatusBadRequest
+		resp.Message = err.Error()
+		c.JSON(http.StatusOK, resp)
 		return
 	}
 
-	httputils.SetSuccess(c, resp)
+	resp.Code = 200
+	c.JSON(http.StatusOK, resp)
 }
 
-func (cr *rainbowRouter) AddDailyReview(c *gin.Context) {
+func (cr *rainbowRouter) listImagesByIds(c *gin.Context) {
 	resp := httputils.NewResponse()
-
 	var (
-		pageOption struct {
-			Page string `json:"page"`
+		ids struct {
+			Ids []int64 `json:"ids"`
 		}
 		err error
 	)
-	if err = httputils.ShouldBindAny(c, &pageOption, nil, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, &ids, nil, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().AddDailyReview(c, pageOption.Page); err != nil {
+	if resp.Result, err = cr.c.Server().ListImagesByIds(c, ids.Ids); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -975,18 +1004,19 @@ func (cr *rainbowRouter) AddDailyReview(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) getDailyMetrics(c *gin.Context) {
+func (cr *rainbowRouter) deleteImagesByIds(c *gin.Context) {
 	resp := httputils.NewResponse()
-
 	var (
-		listOption types.ListOptions
-		err        error
+		ids struct {
+			Ids []int64 `json:"ids"`
+		}
+		err error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, &ids, nil, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListMetrics(c, listOption); err != nil {
+	if err = cr.c.Server().DeleteImagesByIds(c, ids.Ids); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -994,18 +1024,20 @@ func (cr *rainbowRouter) getDailyMetrics(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) getUserInfoByAccessKey(c *gin.Context) {
+func (cr *rainbowRouter) updateImage(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		listOption types.ListOptions
-		err        error
+		idMeta types.IdMeta
+		req    types.UpdateImageRequest
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().GetUserInfoByAccessKey(c, listOption); err != nil {
+	req.Id = idMeta.ID
+	if err = cr.c.Server().UpdateImage(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1013,18 +1045,18 @@ func (cr *rainbowRouter) getUserInfoByAccessKey(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) createLogo(c *gin.Context) {
+func (cr *rainbowRouter) deleteImage(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		req types.CreateLogoRequest
-		err error
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().CreateLogo(c, &req); err != nil {
+	if err = cr.c.Server().DeleteImage(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1032,7 +1064,364 @@ func (cr *rainbowRouter) createLogo(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) deleteLogo(c *gin.Context) {
+func (cr *rainbowRouter) deleteImageTag(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta struct {
+			ID    int64 `uri:"Id" binding:"required"`
+			TagId int64 `uri:"TagId" binding:"required"`
+		}
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if err = cr.c.Server().DeleteImageTag(c, idMeta.ID, idMeta.TagId); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) bindImageLabels(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta struct {
+			ID int64 `uri:"Id" binding:"required"`
+		}
+		req types.BindImageLabels
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if err = cr.c.Server().BindImageLabels(c, idMeta.ID, req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) getImageTag(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta struct {
+			ID    int64 `uri:"Id" binding:"required"`
+			TagId int64 `uri:"TagId" binding:"required"`
+		}
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().GetImageTag(c, idMeta.ID, idMeta.TagId); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listImageTagPlatforms(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta struct {
+			ID    int64 `uri:"Id" binding:"required"`
+			TagId int64 `uri:"TagId" binding:"required"`
+		}
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListImageTagPlatforms(c, idMeta.ID, idMeta.TagId); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listImageTagProvenances(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta struct {
+			ID    int64 `uri:"Id" binding:"required"`
+			TagId int64 `uri:"TagId" binding:"required"`
+		}
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListImageTagProvenances(c, idMeta.ID, idMeta.TagId); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listImageLabels(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta struct {
+			ID int64 `uri:"Id" binding:"required"`
+		}
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListImageLabels(c, idMeta.ID, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listImageTags(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta struct {
+			ID int64 `uri:"Id" binding:"required"`
+		}
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListImageTags(c, idMeta.ID, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) UpdateImageStatus(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		req types.UpdateImageStatusRequest
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if taskId, ok := callbackTask(c); ok {
+		if req.TaskId != taskId {
+			httputils.AbortFailedWithCode(c, http.StatusForbidden, fmt.Errorf("回调 token 不属于任务 %d", req.TaskId))
+			return
+		}
+		if err = cr.c.Server().ValidateCallbackImage(c, taskId, req.ImageId); err != nil {
+			httputils.AbortFailedWithCode(c, http.StatusForbidden, err)
+			return
+		}
+	}
+
+	if err = cr.c.Server().UpdateImageStatus(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) getImage(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta types.IdMeta
+		err    error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().GetImage(c, idMeta.ID); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) searchRepo(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().SearchRepo(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listImages(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListImages(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listImagesForClient(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListImagesForClient(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) getCollections(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().GetCollection(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) AddDailyReview(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		pageOption struct {
+			Page string `json:"page"`
+		}
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, &pageOption, nil, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if err = cr.c.Server().AddDailyReview(c, pageOption.Page); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) getDailyMetrics(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListMetrics(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) getUserInfoByAccessKey(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().GetUserInfoByAccessKey(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) createLogo(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		req types.CreateLogoRequest
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if err = cr.c.Server().CreateLogo(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) deleteLogo(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
@@ -1180,19 +1569,176 @@ func (cr *rainbowRouter) createNamespace(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) updateNamespace(c *gin.Context) {
+func (cr *rainbowRouter) updateNamespace(c *gin.Context) {
+	resp := httputils.NewResponse()
+	var (
+		idMeta types.IdMeta
+		req    types.UpdateNamespaceRequest
+		err    error
+	)
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	req.Id = idMeta.ID
+	if err = cr.c.Server().UpdateNamespace(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) deleteNamespace(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta types.IdMeta
+		err    error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if err = cr.c.Server().DeleteNamespace(c, idMeta.ID); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listNamespaces(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListNamespaces(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) searchRepositories(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		req types.CallSearchRequest
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if resp.Result, err = cr.c.Server().SearchRepositories(c, req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) searchRepositoryTags(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		req types.CallSearchRequest
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if resp.Result, err = cr.c.Server().SearchRepositoryTags(c, req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) getRepositoryTagInfo(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		req      types.CallSearchRequest
+		nameMeta types.NameMeta
+		err      error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &nameMeta, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	req.Repository = nameMeta.Name
+	req.Namespace = nameMeta.Namespace
+	req.Tag = c.Param("tag")
+	if resp.Result, err = cr.c.Server().GetRepositoryTagInfo(c, req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) createSubscribe(c *gin.Context) {
+	resp := httputils.NewResponse()
+	var (
+		req types.CreateSubscribeRequest
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if err = cr.c.Server().CreateSubscribe(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listSubscribes(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListSubscribes(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listSubscribeMessages(c *gin.Context) {
 	resp := httputils.NewResponse()
+
 	var (
 		idMeta types.IdMeta
-		req    types.UpdateNamespaceRequest
 		err    error
 	)
-	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	req.Id = idMeta.ID
-	if err = cr.c.Server().UpdateNamespace(c, &req); err != nil {
+	if resp.Result, err = cr.c.Server().ListSubscribeMessages(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1200,18 +1746,18 @@ func (cr *rainbowRouter) updateNamespace(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) deleteNamespace(c *gin.Context) {
+func (cr *rainbowRouter) runSubscribeNow(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		idMeta types.IdMeta
-		err    error
+		req types.RunSubscribeRequest
+		err error
 	)
-	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().DeleteNamespace(c, idMeta.ID); err != nil {
+	if err = cr.c.Server().RunSubscribe(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1219,18 +1765,20 @@ func (cr *rainbowRouter) deleteNamespace(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listNamespaces(c *gin.Context) {
+func (cr *rainbowRouter) updateSubscribe(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		listOption types.ListOptions
-		err        error
+		idMeta types.IdMeta
+		req    types.UpdateSubscribeRequest
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListNamespaces(c, listOption); err != nil {
+	req.Id = idMeta.ID
+	if err = cr.c.Server().UpdateSubscribe(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1238,19 +1786,18 @@ func (cr *rainbowRouter) listNamespaces(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) searchRepositories(c *gin.Context) {
+func (cr *rainbowRouter) getSubscribe(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		req types.CallSearchRequest
-		err error
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &req); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	req.Query = strings.TrimSpace(req.Query)
-	if resp.Result, err = cr.c.Server().SearchRepositories(c, req); err != nil {
+	if resp.Result, err = cr.c.Server().GetSubscribe(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1258,19 +1805,18 @@ func (cr *rainbowRouter) searchRepositories(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) searchRepositoryTags(c *gin.Context) {
+func (cr *rainbowRouter) deleteSubscribe(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
-		req types.CallSearchRequest
-		err error
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &req); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	req.Query = strings.TrimSpace(req.Query)
-	if resp.Result, err = cr.c.Server().SearchRepositoryTags(c, req); err != nil {
+	if err = cr.c.Server().DeleteSubscribe(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1278,22 +1824,19 @@ func (cr *rainbowRouter) searchRepositoryTags(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) getRepositoryTagInfo(c *gin.Context) {
+func (cr *rainbowRouter) createTaskMessage(c *gin.Context) {
 	resp := httputils.NewResponse()
-
 	var (
-		req      types.CallSearchRequest
-		nameMeta types.NameMeta
-		err      error
+		req    types.CreateTaskMessageRequest
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, nil, &nameMeta, &req); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	req.Repository = nameMeta.Name
-	req.Namespace = nameMeta.Namespace
-	req.Tag = c.Param("tag")
-	if resp.Result, err = cr.c.Server().GetRepositoryTagInfo(c, req); err != nil {
+	req.Id = idMeta.ID
+	if err = cr.c.Server().CreateTaskMessage(c, req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1301,17 +1844,18 @@ func (cr *rainbowRouter) getRepositoryTagInfo(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) createSubscribe(c *gin.Context) {
+func (cr *rainbowRouter) listTaskMessages(c *gin.Context) {
 	resp := httputils.NewResponse()
+
 	var (
-		req types.CreateSubscribeRequest
-		err error
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().CreateSubscribe(c, &req); err != nil {
+	if resp.Result, err = cr.c.Server().ListTaskMessages(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1319,18 +1863,19 @@ func (cr *rainbowRouter) createSubscribe(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listSubscribes(c *gin.Context) {
+func (cr *rainbowRouter) updateImageProgress(c *gin.Context) {
 	resp := httputils.NewResponse()
-
 	var (
-		listOption types.ListOptions
-		err        error
+		req    types.UpdateImageProgressRequest
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListSubscribes(c, listOption); err != nil {
+	req.Id = idMeta.ID
+	if err = cr.c.Server().UpdateImageProgress(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1338,18 +1883,19 @@ func (cr *rainbowRouter) listSubscribes(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listSubscribeMessages(c *gin.Context) {
+func (cr *rainbowRouter) batchCallback(c *gin.Context) {
 	resp := httputils.NewResponse()
-
 	var (
+		req    types.BatchCallbackRequest
 		idMeta types.IdMeta
 		err    error
 	)
-	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListSubscribeMessages(c, idMeta.ID); err != nil {
+	req.Id = idMeta.ID
+	if resp.Result, err = cr.c.Server().BatchCallback(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1357,18 +1903,19 @@ func (cr *rainbowRouter) listSubscribeMessages(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) runSubscribeNow(c *gin.Context) {
+func (cr *rainbowRouter) updateImageStage(c *gin.Context) {
 	resp := httputils.NewResponse()
-
 	var (
-		req types.RunSubscribeRequest
-		err error
+		req    types.UpdateImageStageRequest
+		idMeta types.IdMeta
+		err    error
 	)
-	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().RunSubscribe(c, &req); err != nil {
+	req.Id = idMeta.ID
+	if err = cr.c.Server().UpdateImageStage(c, &req); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1376,20 +1923,17 @@ func (cr *rainbowRouter) runSubscribeNow(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) updateSubscribe(c *gin.Context) {
+func (cr *rainbowRouter) listImageStages(c *gin.Context) {
 	resp := httputils.NewResponse()
-
 	var (
 		idMeta types.IdMeta
-		req    types.UpdateSubscribeRequest
 		err    error
 	)
-	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	req.Id = idMeta.ID
-	if err = cr.c.Server().UpdateSubscribe(c, &req); err != nil {
+	if resp.Result, err = cr.c.Server().ListImageStages(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1397,7 +1941,7 @@ func (cr *rainbowRouter) updateSubscribe(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) getSubscribe(c *gin.Context) {
+func (cr *rainbowRouter) getTaskProgress(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
@@ -1408,7 +1952,7 @@ func (cr *rainbowRouter) getSubscribe(c *gin.Context) {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().GetSubscribe(c, idMeta.ID); err != nil {
+	if resp.Result, err = cr.c.Server().GetTaskProgress(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1416,7 +1960,40 @@ func (cr *rainbowRouter) getSubscribe(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) deleteSubscribe(c *gin.Context) {
+// watchTaskProgress 通过 SSE 定时推送任务的同步进度，任务结束或客户端断开时停止
+func (cr *rainbowRouter) watchTaskProgress(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var idMeta types.IdMeta
+	if err := httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	ticker := time.NewTicker(progressWatchInterval)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		progress, err := cr.c.Server().GetTaskProgress(c, idMeta.ID)
+		if err != nil {
+			c.SSEvent("error", err.Error())
+			return false
+		}
+		c.SSEvent("progress", progress)
+		if progress.Process >= 2 {
+			return false
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+			return true
+		}
+	})
+}
+
+// uploadTaskExport plugin 上传任务的离线包
+func (cr *rainbowRouter) uploadTaskExport(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
@@ -1427,7 +2004,7 @@ func (cr *rainbowRouter) deleteSubscribe(c *gin.Context) {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if err = cr.c.Server().DeleteSubscribe(c, idMeta.ID); err != nil {
+	if err = cr.c.Server().UploadTaskExport(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1435,19 +2012,18 @@ func (cr *rainbowRouter) deleteSubscribe(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) createTaskMessage(c *gin.Context) {
+func (cr *rainbowRouter) getTaskExport(c *gin.Context) {
 	resp := httputils.NewResponse()
+
 	var (
-		req    types.CreateTaskMessageRequest
 		idMeta types.IdMeta
 		err    error
 	)
-	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	req.Id = idMeta.ID
-	if err = cr.c.Server().CreateTaskMessage(c, req); err != nil {
+	if resp.Result, err = cr.c.Server().GetTaskExport(c, idMeta.ID); err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
@@ -1455,7 +2031,8 @@ func (cr *rainbowRouter) createTaskMessage(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
-func (cr *rainbowRouter) listTaskMessages(c *gin.Context) {
+// downloadTaskExport 下载任务的离线包，响应头 X-Checksum-Sha256 为离线包的 sha256
+func (cr *rainbowRouter) downloadTaskExport(c *gin.Context) {
 	resp := httputils.NewResponse()
 
 	var (
@@ -1466,12 +2043,16 @@ func (cr *rainbowRouter) listTaskMessages(c *gin.Context) {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
-	if resp.Result, err = cr.c.Server().ListTaskMessages(c, idMeta.ID); err != nil {
+	fullPath, object, err := cr.c.Server().DownloadTaskExport(c, idMeta.ID)
+	if err != nil {
 		httputils.SetFailed(c, resp, err)
 		return
 	}
 
-	httputils.SetSuccess(c, resp)
+	c.Header("Content-Type", "application/x-tar")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", object.Name))
+	c.Header("X-Checksum-Sha256", object.Sha256)
+	c.File(fullPath)
 }
 
 func (cr *rainbowRouter) listArchitectures(c *gin.Context) {
@@ -1850,6 +2431,139 @@ func (cr *rainbowRouter) syncKubernetesTags(c *gin.Context) {
 	httputils.SetSuccess(c, resp)
 }
 
+func (cr *rainbowRouter) listKubernetesAddons(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		err error
+		req types.ListKubernetesAddonRequest
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListKubernetesAddons(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) syncKubernetesAddons(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		err error
+		req types.CallKubernetesAddonRequest
+	)
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().SyncKubernetesAddons(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) createKubernetesPrefetch(c *gin.Context) {
+	resp := httputils.NewResponse()
+	var (
+		req types.CreateKubernetesPrefetchRequest
+		err error
+	)
+	if err = httputils.ShouldBindAny(c, &req, nil, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if err = cr.c.Server().CreateKubernetesPrefetch(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) updateKubernetesPrefetch(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta types.IdMeta
+		req    types.UpdateKubernetesPrefetchRequest
+		err    error
+	)
+	if err = httputils.ShouldBindAny(c, &req, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	req.Id = idMeta.ID
+	if err = cr.c.Server().UpdateKubernetesPrefetch(c, &req); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) deleteKubernetesPrefetch(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta types.IdMeta
+		err    error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if err = cr.c.Server().DeleteKubernetesPrefetch(c, idMeta.ID); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) getKubernetesPrefetch(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		idMeta types.IdMeta
+		err    error
+	)
+	if err = httputils.ShouldBindAny(c, nil, &idMeta, nil); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().GetKubernetesPrefetch(c, idMeta.ID); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
+func (cr *rainbowRouter) listKubernetesPrefetches(c *gin.Context) {
+	resp := httputils.NewResponse()
+
+	var (
+		listOption types.ListOptions
+		err        error
+	)
+	if err = httputils.ShouldBindAny(c, nil, nil, &listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+	if resp.Result, err = cr.c.Server().ListKubernetesPrefetches(c, listOption); err != nil {
+		httputils.SetFailed(c, resp, err)
+		return
+	}
+
+	httputils.SetSuccess(c, resp)
+}
+
 func (cr *rainbowRouter) syncAgentDrivers(c *gin.Context) {
 	resp := httputils.NewResponse()
 
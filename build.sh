@@ -5,3 +5,9 @@ GOOS=windows GOARCH=amd64 go build -o pixiuctl-windows-amd64 cmd/pixiuctl.go
 GOOS=windows GOARCH=arm64 go build -o pixiuctl-windows-arm64 cmd/pixiuctl.go
 GOOS=darwin GOARCH=amd64 go build -o pixiuctl-darwin-amd64 cmd/pixiuctl.go
 GOOS=darwin GOARCH=arm64 go build -o pixiuctl-darwin-arm64 cmd/pixiuctl.go
+
+# agent 构建时注入版本号，随心跳上报
+VERSION=${VERSION:-$(git describe --tags --always --dirty 2>/dev/null || echo unknown)}
+AGENT_LDFLAGS="-X github.com/caoyingjunz/rainbow/pkg/controller/rainbow.Version=${VERSION}"
+GOOS=linux GOARCH=amd64 go build -ldflags "${AGENT_LDFLAGS}" -o agent cmd/agent.go
+GOOS=linux GOARCH=arm64 go build -ldflags "${AGENT_LDFLAGS}" -o agent-linux-arm64 cmd/agent.go
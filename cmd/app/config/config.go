@@ -1,5 +1,7 @@
 package config
 
+import "github.com/caoyingjunz/rainbow/pkg/util/kubeadm"
+
 const (
 	DefaultNormalRateLimitMaxRequests  = 100
 	DefaultSpecialRateLimitMaxRequests = 50
@@ -10,8 +12,14 @@ const (
 
 	defaultRainbowdTemplateDir = "/data/template"
 	defaultDownloadDir         = "/data/pixiuctl"
+	defaultExportDir           = "/data/exports"
+	defaultMaxImportSize       = "20Gi"
+
+	defaultAgentMonthlyBudget = 16 // github 账号每月开销上限，单位美金
 )
 
+var defaultAgentBudgetThresholds = []int{50, 80, 90}
+
 // SetDefaults 设置配置的默认值
 func (c *Config) SetDefaults() {
 	if c.RateLimit.NormalRateLimit.MaxRequests == 0 {
@@ -35,6 +43,18 @@ func (c *Config) SetDefaults() {
 	if len(c.Server.DownloadDir) == 0 {
 		c.Server.DownloadDir = defaultDownloadDir
 	}
+	if len(c.Server.ExportDir) == 0 {
+		c.Server.ExportDir = defaultExportDir
+	}
+	if len(c.Server.MaxImportSize) == 0 {
+		c.Server.MaxImportSize = defaultMaxImportSize
+	}
+	if c.Rainbowd.Budget.MonthlyBudget == 0 {
+		c.Rainbowd.Budget.MonthlyBudget = defaultAgentMonthlyBudget
+	}
+	if len(c.Rainbowd.Budget.Thresholds) == 0 {
+		c.Rainbowd.Budget.Thresholds = defaultAgentBudgetThresholds
+	}
 }
 
 type Config struct {
@@ -75,6 +95,18 @@ type ServerOption struct {
 	DownloadDir string `yaml:"download_dir"`
 	Auth        Auth   `yaml:"auth"`
 	Harbor      Harbor `yaml:"harbor"`
+
+	// AddonManifest kubernetes 插件清单地址，由 agent 定期拉取，为空时不同步插件目录
+	AddonManifest string `yaml:"addon_manifest"`
+
+	// ExportDir 任务离线包的保存目录
+	ExportDir string `yaml:"export_dir"`
+
+	// MaxImportSize 上传导入的离线包大小上限，格式同 kubernetes 的资源数量，如 20Gi
+	MaxImportSize string `yaml:"max_import_size"`
+
+	// ExecStages 管理员配置的 exec 阶段，任务只能按名称引用，不能自行指定命令
+	ExecStages []Stage `yaml:"exec_stages,omitempty"`
 }
 
 type RainbowdOption struct {
@@ -83,6 +115,14 @@ type RainbowdOption struct {
 	DataDir     string     `yaml:"data_dir"`
 	AgentImage  string     `yaml:"agent_image"`
 	Nodes       []NodeSpec `yaml:"nodes,omitempty"`
+
+	Budget BudgetOption `yaml:"budget"`
+}
+
+// BudgetOption agent github actions 开销预算
+type BudgetOption struct {
+	MonthlyBudget float64 `yaml:"monthly_budget"` // 默认每月预算，agent 未单独设置时使用
+	Thresholds    []int   `yaml:"thresholds"`     // 告警阈值，预算的百分比
 }
 
 type NodeSpec struct {
@@ -123,6 +163,10 @@ type Auth struct {
 
 type KubernetesOption struct {
 	Version string `yaml:"version"`
+	// Components kubeadm 使用的组件版本，由 agent 下发，设置后 plugin 直接生成镜像列表，不再依赖 kubeadm
+	Components *kubeadm.Components `yaml:"components,omitempty"`
+	// AddonImages kubernetes 任务选择的插件展开后的镜像，与 kubeadm 镜像一起同步
+	AddonImages []string `yaml:"addon_images,omitempty"`
 }
 
 type PluginOption struct {
@@ -132,6 +176,62 @@ type PluginOption struct {
 	Synced     bool   `yaml:"synced"`
 	Driver     string `yaml:"driver"`
 	Arch       string `yaml:"arch"`
+	// Platforms 多架构同步的平台列表，all 表示同步全部平台
+	Platforms []string `yaml:"platforms,omitempty"`
+	// Signatures 同步镜像关联的签名、attestation 和 SBOM
+	Signatures bool `yaml:"signatures,omitempty"`
+	// PublicKey 不为空时，推送前使用该公钥校验源镜像的 cosign 签名
+	PublicKey string `yaml:"public_key,omitempty"`
+	// ArtifactKind 制品类型，image 以外的类型按 OCI artifact 原样同步
+	ArtifactKind string `yaml:"artifact_kind,omitempty"`
+	// ImageFile 镜像列表文件，支持每行一个镜像的纯文本(tag 可使用通配符)和 kubernetes YAML 清单
+	ImageFile string `yaml:"image_file,omitempty"`
+	// Retries 单个镜像可重试错误的最大重试次数，为 0 时使用默认值 3，小于 0 时不重试
+	Retries int `yaml:"retries,omitempty"`
+	// BatchCallback 批量上报镜像状态和任务消息，减少 plugin 的回调请求数
+	BatchCallback bool `yaml:"batch_callback,omitempty"`
+	// Token 任务级的回调 token，由 agent 下发，仅能用于回调该任务
+	Token string `yaml:"token,omitempty"`
+	// NameTemplate 和 TagTemplate 目标镜像的名称和版本模板，未启用回调时由 plugin 直接使用
+	NameTemplate string `yaml:"name_template,omitempty"`
+	TagTemplate  string `yaml:"tag_template,omitempty"`
+	// Stages 单个镜像同步时依次执行的阶段，为空时按 PublicKey 和 Signatures 生成默认阶段
+	Stages []Stage `yaml:"stages,omitempty"`
+	// ParallelImages 同时同步的镜像数量，为 0 时使用默认值 5
+	ParallelImages int `yaml:"parallel_images,omitempty"`
+	// ParallelLayers 单个镜像同时复制的层数，native 和 skopeo 驱动支持，为 0 时使用驱动的默认值
+	ParallelLayers int `yaml:"parallel_layers,omitempty"`
+	// BandwidthLimit 同步镜像的总带宽上限，如 10Mi 表示每秒 10MiB
+	// skopeo 驱动通过本地限速代理访问仓库，docker 驱动改为由限速的客户端拉取和推送，镜像仍会导入 docker
+	BandwidthLimit string `yaml:"bandwidth_limit,omitempty"`
+	// Export 同步完成后将镜像导出为离线包的格式，oci 或 docker，为空时不导出
+	Export string `yaml:"export,omitempty"`
+}
+
+// Stage plugin 同步单个镜像的一个阶段
+// Type 支持 validate-source-policy、copy、verify-digest、signatures、exec 和 webhook，必须包含且只能包含一个 copy 阶段
+type Stage struct {
+	Name string `yaml:"name" json:"name"` // 阶段名称，用于展示，为空时使用 Type
+	Type string `yaml:"type" json:"type"`
+	// Optional 阶段失败时仅记录，不影响镜像的同步结果
+	Optional bool `yaml:"optional,omitempty" json:"optional,omitempty"`
+	// AllowedSources validate-source-policy 阶段允许的源镜像，支持通配符，如 docker.io/library/*
+	AllowedSources []string `yaml:"allowed_sources,omitempty" json:"allowed_sources,omitempty"`
+	// Command exec 阶段执行的命令，通过环境变量 SOURCE_IMAGE、TARGET_IMAGE、SOURCE_DIGEST、TARGET_DIGEST 和 TASK_ID 获取镜像信息
+	// 命令不继承 plugin 的环境变量，仅额外设置 PATH；创建任务时不能指定，由 server 按名称从 exec_stages 中获取
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+	// URL webhook 阶段 POST 镜像信息的地址
+	URL string `yaml:"url,omitempty" json:"url,omitempty"`
+	// Timeout exec 和 webhook 阶段的超时时间，单位秒，默认 600
+	Timeout int `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// GetName 返回阶段的展示名称
+func (s Stage) GetName() string {
+	if len(s.Name) != 0 {
+		return s.Name
+	}
+	return s.Type
 }
 
 type BuildOption struct {
@@ -147,6 +247,8 @@ type Registry struct {
 	Namespace  string `yaml:"namespace"`
 	Username   string `yaml:"username"`
 	Password   string `yaml:"password"`
+	// Insecure 仓库仅支持 http 访问，native 和 skopeo 驱动生效
+	Insecure bool `yaml:"insecure,omitempty"`
 }
 
 type MysqlOptions struct {
@@ -168,6 +270,9 @@ type AgentOption struct {
 	Name       string `yaml:"name"`
 	DataDir    string `yaml:"data_dir"`
 	RetainDays int    `yaml:"retain_days"`
+
+	FailedRetainDays int `yaml:"failed_retain_days"` // 失败任务目录的保留天数，便于排查
+	DiskBudget       int `yaml:"disk_budget"`        // 任务目录总大小上限，单位 MiB，为 0 时不限制
 }
 
 type RateLimitOption struct {
@@ -203,16 +308,26 @@ type Image struct {
 	Id   int64    `yaml:"id"`
 	Path string   `yaml:"path"`
 	Tags []string `yaml:"tags"`
+	// Retag 源版本到目标版本的映射，未设置的版本保持不变
+	Retag map[string]string `yaml:"retag,omitempty"`
 }
 
 func (i Image) GetMap(repo, ns string) map[string]string {
 	m := make(map[string]string)
 	for _, tag := range i.Tags {
-		m[i.Path+":"+tag] = repo + "/" + ns + "/" + i.Name + ":" + tag
+		m[i.Path+":"+tag] = repo + "/" + ns + "/" + i.Name + ":" + i.GetTargetTag(tag)
 	}
 	return m
 }
 
+// GetTargetTag 返回源版本在目标仓库中的版本
+func (i Image) GetTargetTag(tag string) string {
+	if target, ok := i.Retag[tag]; ok && len(target) != 0 {
+		return target
+	}
+	return tag
+}
+
 func (i Image) GetId() int64 {
 	return i.Id
 }
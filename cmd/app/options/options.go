@@ -28,6 +28,8 @@ const (
 	defaultListen     = 8090
 	defaultRetainDays = 5
 
+	defaultFailedRetainDays = 15
+
 	maxIdleConns = 10
 	maxOpenConns = 100
 )
@@ -80,6 +82,9 @@ func (o *Options) Complete() error {
 	if o.ComponentConfig.Agent.RetainDays == 0 {
 		o.ComponentConfig.Agent.RetainDays = defaultRetainDays
 	}
+	if o.ComponentConfig.Agent.FailedRetainDays == 0 {
+		o.ComponentConfig.Agent.FailedRetainDays = defaultFailedRetainDays
+	}
 	if o.ComponentConfig.Default.Listen == 0 {
 		o.ComponentConfig.Default.Listen = defaultListen
 	}
@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	rainbowtypes "github.com/caoyingjunz/rainbow/pkg/types"
+)
+
+const (
+	callbackInterval  = 3 * time.Second
+	callbackBatchSize = 100
+	callbackRetries   = 5
+)
+
+// callbackResponse 批量回调的响应，服务端出错时 HTTP 状态码仍为 200，需要检查 Code
+type callbackResponse struct {
+	Code    int                               `json:"code"`
+	Message string                            `json:"message,omitempty"`
+	Result  *rainbowtypes.BatchCallbackResult `json:"result,omitempty"`
+}
+
+// callbackBuffer 缓存镜像状态和任务消息，定期或缓存达到批量大小时批量上报
+// 事件只有在服务端返回成功后才会从缓存中移除，失败时整批重发，服务端按事件 Id 去重
+type callbackBuffer struct {
+	p *PluginController
+
+	prefix string
+	seq    int64
+
+	lock   sync.Mutex
+	events []rainbowtypes.CallbackEvent
+
+	// sendLock 保证同一时间只有一个批量请求，避免事件乱序
+	sendLock sync.Mutex
+
+	notify chan struct{}
+	stopCh chan struct{}
+	doneCh chan struct{}
+	once   sync.Once
+}
+
+func newCallbackBuffer(p *PluginController) *callbackBuffer {
+	b := &callbackBuffer{
+		p:      p,
+		prefix: fmt.Sprintf("%d-%d", p.TaskId, time.Now().UnixNano()),
+		notify: make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// Add 追加回调事件，缓存达到批量大小时提前触发上报
+func (b *callbackBuffer) Add(event rainbowtypes.CallbackEvent) {
+	b.lock.Lock()
+	b.seq++
+	event.Id = fmt.Sprintf("%s-%d", b.prefix, b.seq)
+	b.events = append(b.events, event)
+	full := len(b.events) >= callbackBatchSize
+	b.lock.Unlock()
+
+	if full {
+		select {
+		case b.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *callbackBuffer) loop() {
+	defer close(b.doneCh)
+
+	ticker := time.NewTicker(callbackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.notify:
+		case <-b.stopCh:
+			return
+		}
+		if err := b.flush(); err != nil {
+			klog.Warningf("批量上报任务(%d)回调事件失败 %v，稍后重试", b.p.TaskId, err)
+		}
+	}
+}
+
+// flush 上报缓存中的全部事件，每次最多上报 callbackBatchSize 个
+func (b *callbackBuffer) flush() error {
+	b.sendLock.Lock()
+	defer b.sendLock.Unlock()
+
+	for {
+		b.lock.Lock()
+		n := len(b.events)
+		if n > callbackBatchSize {
+			n = callbackBatchSize
+		}
+		batch := make([]rainbowtypes.CallbackEvent, n)
+		copy(batch, b.events[:n])
+		b.lock.Unlock()
+
+		if n == 0 {
+			return nil
+		}
+		if err := b.send(batch); err != nil {
+			return err
+		}
+
+		b.lock.Lock()
+		b.events = b.events[n:]
+		b.lock.Unlock()
+	}
+}
+
+func (b *callbackBuffer) send(batch []rainbowtypes.CallbackEvent) error {
+	var resp callbackResponse
+	if err := b.p.httpClient.Post(
+		fmt.Sprintf("%s/rainbow/tasks/%d/callbacks", b.p.Callback, b.p.TaskId),
+		&resp,
+		map[string]interface{}{"events": batch}, nil); err != nil {
+		return err
+	}
+	if resp.Code != 200 {
+		return fmt.Errorf("code %d: %s", resp.Code, resp.Message)
+	}
+	// 处理失败的事件已被服务端记录，不再重发
+	if resp.Result != nil && resp.Result.Failed != 0 {
+		klog.Warningf("任务(%d) %d 个回调事件处理失败: %v", b.p.TaskId, resp.Result.Failed, resp.Result.Errors)
+	}
+
+	klog.V(2).Infof("批量上报任务(%d) %d 个回调事件成功", b.p.TaskId, len(batch))
+	return nil
+}
+
+// Flush 同步上报缓存中的事件，失败时重试，任务状态变更前调用，保证任务状态在镜像状态之后到达
+func (b *callbackBuffer) Flush() {
+	var err error
+	for i := 0; i < callbackRetries; i++ {
+		if err = b.flush(); err == nil {
+			return
+		}
+		klog.Errorf("批量上报任务(%d)回调事件失败 %v，尝试重试", b.p.TaskId, err)
+		time.Sleep(time.Second)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	klog.Errorf("批量上报任务(%d)回调事件失败，仍有 %d 个事件未上报: %v", b.p.TaskId, len(b.events), err)
+}
+
+// Stop 停止定期上报，并上报剩余的事件
+func (b *callbackBuffer) Stop() {
+	b.once.Do(func() {
+		close(b.stopCh)
+		<-b.doneCh
+		b.Flush()
+	})
+}
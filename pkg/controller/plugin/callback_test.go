@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	rainbowtypes "github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util"
+)
+
+// fakeCallbackServer 记录收到的批量回调，rejects 大于 0 时按服务端错误拒绝对应次数的请求
+type fakeCallbackServer struct {
+	lock    sync.Mutex
+	batches [][]rainbowtypes.CallbackEvent
+	rejects int
+}
+
+func (f *fakeCallbackServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Events []rainbowtypes.CallbackEvent `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.batches = append(f.batches, req.Events)
+	// 服务端出错时 HTTP 状态码仍为 200
+	if f.rejects > 0 {
+		f.rejects--
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": 400, "message": "database is unavailable"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "result": rainbowtypes.BatchCallbackResult{Processed: len(req.Events)}})
+}
+
+func TestCallbackBuffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		events  int
+		rejects int
+
+		wantBatches []int // 每次请求的事件数
+		wantErr     bool
+		wantRemain  int
+	}{
+		{
+			name:        "split into batches",
+			events:      callbackBatchSize + 20,
+			wantBatches: []int{callbackBatchSize, 20},
+		},
+		{
+			name:        "keep events after rejected batch",
+			events:      3,
+			rejects:     1,
+			wantBatches: []int{3},
+			wantErr:     true,
+			wantRemain:  3,
+		},
+		{
+			name:        "no request without events",
+			wantBatches: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &fakeCallbackServer{rejects: tc.rejects}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			p := &PluginController{TaskId: 1, Callback: ts.URL, httpClient: util.NewHttpClient(5*time.Second, ts.URL)}
+			b := &callbackBuffer{p: p, prefix: "1-test", notify: make(chan struct{}, 1)}
+			for i := 0; i < tc.events; i++ {
+				b.Add(rainbowtypes.CallbackEvent{Type: rainbowtypes.CallbackMessageEvent, Message: fmt.Sprintf("message %d", i)})
+			}
+
+			err := b.flush()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			var sizes []int
+			for _, batch := range server.batches {
+				sizes = append(sizes, len(batch))
+			}
+			if fmt.Sprint(sizes) != fmt.Sprint(tc.wantBatches) {
+				t.Errorf("batch sizes = %v, want %v", sizes, tc.wantBatches)
+			}
+			if len(b.events) != tc.wantRemain {
+				t.Errorf("remaining events = %d, want %d", len(b.events), tc.wantRemain)
+			}
+		})
+	}
+}
+
+// TestCallbackBufferResend 失败后重发的事件 Id 保持不变，服务端据此去重
+func TestCallbackBufferResend(t *testing.T) {
+	server := &fakeCallbackServer{rejects: 1}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	p := &PluginController{TaskId: 1, Callback: ts.URL, httpClient: util.NewHttpClient(5*time.Second, ts.URL)}
+	b := &callbackBuffer{p: p, prefix: "1-test", notify: make(chan struct{}, 1)}
+	b.Add(rainbowtypes.CallbackEvent{Type: rainbowtypes.CallbackMessageEvent, Message: "a"})
+	b.Add(rainbowtypes.CallbackEvent{Type: rainbowtypes.CallbackMessageEvent, Message: "b"})
+
+	if err := b.flush(); err == nil {
+		t.Fatalf("expected first flush to fail")
+	}
+	if err := b.flush(); err != nil {
+		t.Fatalf("expected second flush to succeed, got %v", err)
+	}
+	if len(server.batches) != 2 || len(b.events) != 0 {
+		t.Fatalf("expected 2 requests and empty buffer, got %d requests and %d events", len(server.batches), len(b.events))
+	}
+
+	ids := make(map[string]bool)
+	for i, event := range server.batches[0] {
+		if server.batches[1][i].Id != event.Id {
+			t.Errorf("resent event id %s, want %s", server.batches[1][i].Id, event.Id)
+		}
+		ids[event.Id] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("expected unique event ids, got %v", ids)
+	}
+}
@@ -0,0 +1,170 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	rainbowtypes "github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util"
+)
+
+// exportList 记录同步成功和失败的目标镜像，未启用导出时为 nil
+type exportList struct {
+	lock    sync.Mutex
+	targets []string
+	failed  []string
+}
+
+func (e *exportList) add(target string) {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.targets = append(e.targets, target)
+}
+
+// fail 记录同步失败的目标镜像，存在失败的镜像时不导出离线包
+func (e *exportList) fail(target string) {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.failed = append(e.failed, target)
+}
+
+// list 返回去重并排序后的目标镜像，保证离线包内容的顺序稳定
+func (e *exportList) list() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return uniqueSorted(e.targets)
+}
+
+// missing 返回同步失败、无法写入离线包的目标镜像
+func (e *exportList) missing() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return uniqueSorted(e.failed)
+}
+
+func uniqueSorted(items []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// export 从目标仓库读取同步成功的镜像，导出为离线包后上传到 rainbow server 保存
+// 离线包中记录的镜像名称为目标镜像，导入离线环境后可直接使用
+func (p *PluginController) export() error {
+	// 离线包用于离线环境部署，缺少镜像时导出失败，避免离线包不完整却被当做完整使用
+	if missing := p.exports.missing(); len(missing) != 0 {
+		return fmt.Errorf("镜像 %s 同步失败，离线包缺少 %d 个镜像", strings.Join(missing, ", "), len(missing))
+	}
+	targets := p.exports.list()
+	if len(targets) == 0 {
+		return fmt.Errorf("没有同步成功的镜像")
+	}
+	format := p.Cfg.Plugin.Export
+	opts, err := p.copyOptions()
+	if err != nil {
+		return err
+	}
+	p.CreateTaskMessage(fmt.Sprintf("开始导出 %s 格式的离线包，共 %d 个镜像", format, len(targets)))
+
+	file, err := os.CreateTemp("", fmt.Sprintf("rainbow-export-%d-*.tar", p.TaskId))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	archive, err := p.registry.NewArchive(io.MultiWriter(file, hash), format)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if _, err = archive.Add(context.TODO(), target, target, opts); err != nil {
+			return fmt.Errorf("导出镜像 %s 失败: %v", target, err)
+		}
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+	klog.Infof("离线包 %s 导出完成，大小 %d，sha256 %s", file.Name(), size, digest)
+
+	if !p.Synced {
+		return nil
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err = p.uploadExport(file, format, digest, archive.Images()); err != nil {
+		return fmt.Errorf("上传离线包失败: %v", err)
+	}
+	p.CreateTaskMessage(fmt.Sprintf("离线包导出完成，大小 %d 字节，sha256 %s", size, digest))
+	return nil
+}
+
+// uploadExport 以 multipart 的方式上传离线包，离线包可能较大，不设置超时
+func (p *PluginController) uploadExport(r io.Reader, format string, digest string, images int) error {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		err := func() error {
+			for k, v := range map[string]string{"format": format, "sha256": digest, "images": strconv.Itoa(images)} {
+				if err := mw.WriteField(k, v); err != nil {
+					return err
+				}
+			}
+			part, err := mw.CreateFormFile("file", fmt.Sprintf("task-%d.tar", p.TaskId))
+			if err != nil {
+				return err
+			}
+			if _, err = io.Copy(part, r); err != nil {
+				return err
+			}
+			return mw.Close()
+		}()
+		_ = pw.CloseWithError(err)
+	}()
+
+	headers := map[string]string{"Content-Type": mw.FormDataContentType()}
+	if len(p.Cfg.Plugin.Token) != 0 {
+		headers["Authorization"] = "Bearer " + p.Cfg.Plugin.Token
+	}
+	var resp rainbowtypes.Response
+	client := &util.HttpClientV2{URL: fmt.Sprintf("%s/rainbow/tasks/%d/export", p.Callback, p.TaskId)}
+	if httpErr := client.Method("POST").WithHeader(headers).WithBody(pr).Do(&resp); httpErr != nil {
+		_ = pr.CloseWithError(httpErr)
+		return httpErr
+	}
+	if resp.Code != 200 {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportList(t *testing.T) {
+	tests := []struct {
+		name        string
+		added       []string
+		failed      []string
+		wantList    []string
+		wantMissing []string
+		wantErr     string
+	}{
+		{
+			name:     "deduplicate and sort targets",
+			added:    []string{"harbor.example.com/mirror/b:v1", "harbor.example.com/mirror/a:v1", "harbor.example.com/mirror/b:v1"},
+			wantList: []string{"harbor.example.com/mirror/a:v1", "harbor.example.com/mirror/b:v1"},
+		},
+		{
+			name:        "failed images stop export",
+			added:       []string{"harbor.example.com/mirror/a:v1"},
+			failed:      []string{"harbor.example.com/mirror/c:v1", "harbor.example.com/mirror/b:v1", "harbor.example.com/mirror/c:v1"},
+			wantList:    []string{"harbor.example.com/mirror/a:v1"},
+			wantMissing: []string{"harbor.example.com/mirror/b:v1", "harbor.example.com/mirror/c:v1"},
+			wantErr:     "harbor.example.com/mirror/b:v1, harbor.example.com/mirror/c:v1 同步失败，离线包缺少 2 个镜像",
+		},
+		{
+			name:    "no synced images",
+			wantErr: "没有同步成功的镜像",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &PluginController{exports: &exportList{}}
+			for _, target := range tc.added {
+				p.exports.add(target)
+			}
+			for _, target := range tc.failed {
+				p.exports.fail(target)
+			}
+
+			if got := p.exports.list(); !reflect.DeepEqual(got, tc.wantList) {
+				t.Errorf("expected list %v, got %v", tc.wantList, got)
+			}
+			if got := p.exports.missing(); !reflect.DeepEqual(got, tc.wantMissing) {
+				t.Errorf("expected missing %v, got %v", tc.wantMissing, got)
+			}
+			if len(tc.wantErr) == 0 {
+				return
+			}
+			if err := p.export(); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
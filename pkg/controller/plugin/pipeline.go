@@ -0,0 +1,275 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/cmd/app/config"
+	rainbowtypes "github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
+)
+
+const (
+	defaultStageTimeout = 600 // exec 和 webhook 阶段默认超时时间，单位秒
+	maxStageMessage     = 1024
+
+	// execStagePath exec 阶段命令使用的 PATH，命令不继承 plugin 的环境变量，避免读取回调 token 等敏感信息
+	execStagePath = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// stageContext 单个镜像在各阶段之间传递的同步结果
+type stageContext struct {
+	img    config.Image
+	source string
+	target string
+
+	copyResult   *registry.CopyResult
+	verifyResult *registry.VerifyResult
+}
+
+// stageFunc 执行一个阶段，返回的信息记录在阶段状态中
+type stageFunc func(sc *stageContext, stage config.Stage) (string, error)
+
+// stages 返回同步单个镜像时依次执行的阶段，未配置时按 PublicKey 和 Signatures 生成默认阶段
+// docker 和 skopeo 驱动推送时可能重新压缩层或转换 manifest 格式，digest 与源镜像不一致，默认仅 native 驱动校验 digest
+// 同步签名依赖源镜像和目标镜像的 digest 一致，开启 Signatures 时始终校验
+func (p *PluginController) stages() []config.Stage {
+	if len(p.Cfg.Plugin.Stages) != 0 {
+		return p.Cfg.Plugin.Stages
+	}
+
+	var stages []config.Stage
+	if len(p.Cfg.Plugin.PublicKey) != 0 {
+		stages = append(stages, config.Stage{Type: rainbowtypes.StageValidateSourcePolicy})
+	}
+	stages = append(stages, config.Stage{Type: rainbowtypes.StageCopy})
+	if p.Cfg.Plugin.Driver == NativeDriver || p.Cfg.Plugin.Signatures {
+		stages = append(stages, config.Stage{Type: rainbowtypes.StageVerifyDigest})
+	}
+	if p.Cfg.Plugin.Signatures {
+		stages = append(stages, config.Stage{Type: rainbowtypes.StageSignatures})
+	}
+	return stages
+}
+
+func (p *PluginController) stageFunc(stageType string) (stageFunc, error) {
+	switch stageType {
+	case rainbowtypes.StageValidateSourcePolicy:
+		return p.validateSourcePolicy, nil
+	case rainbowtypes.StageCopy:
+		return p.copyStage, nil
+	case rainbowtypes.StageVerifyDigest:
+		return p.verifyDigest, nil
+	case rainbowtypes.StageSignatures:
+		return p.copySignatures, nil
+	case rainbowtypes.StageExec:
+		return p.execStage, nil
+	case rainbowtypes.StageWebhook:
+		return p.webhookStage, nil
+	default:
+		return nil, fmt.Errorf("不支持的阶段类型 %s", stageType)
+	}
+}
+
+// runPipeline 依次执行各阶段并上报阶段状态，非可选阶段失败时跳过后续阶段
+func (p *PluginController) runPipeline(sc *stageContext) error {
+	stages := p.stages()
+	for i, stage := range stages {
+		name := stage.GetName()
+		fn, err := p.stageFunc(stage.Type)
+		if err != nil {
+			return p.skipStages(sc, stages, i, err)
+		}
+
+		p.SyncImageStage(sc, i, stage, rainbowtypes.SyncImageRunning, "")
+		msg, err := fn(sc, stage)
+		if err == nil {
+			p.SyncImageStage(sc, i, stage, rainbowtypes.SyncImageComplete, msg)
+			continue
+		}
+
+		klog.Errorf("镜像 %s 的 %s 阶段失败 %v", sc.source, name, err)
+		p.SyncImageStage(sc, i, stage, rainbowtypes.SyncImageError, err.Error())
+		if stage.Optional {
+			p.CreateTaskMessage(fmt.Sprintf("镜像 %s 的可选阶段 %s 失败，继续执行，原因: %v", sc.source, name, err))
+			continue
+		}
+		p.CreateTaskMessage(fmt.Sprintf("镜像 %s 的 %s 阶段失败，已跳过后续阶段，原因: %v", sc.source, name, err))
+		return p.skipStages(sc, stages, i+1, stageError(name, err))
+	}
+	return nil
+}
+
+// skipStages 将未执行的阶段标记为跳过
+func (p *PluginController) skipStages(sc *stageContext, stages []config.Stage, from int, err error) error {
+	for i := from; i < len(stages); i++ {
+		p.SyncImageStage(sc, i, stages[i], rainbowtypes.StageSkipped, "")
+	}
+	return err
+}
+
+// stageError 在错误中附加阶段名称，并保留错误的分类
+func stageError(name string, err error) error {
+	var e *syncError
+	if errors.As(err, &e) {
+		return &syncError{err: fmt.Errorf("%s 阶段失败: %w", name, e.err), class: e.class, retries: e.retries}
+	}
+	return newSyncError(fmt.Errorf("%s 阶段失败: %w", name, err))
+}
+
+// validateSourcePolicy 校验源镜像是否在允许的范围内，配置公钥时校验源镜像的 cosign 签名
+func (p *PluginController) validateSourcePolicy(sc *stageContext, stage config.Stage) (string, error) {
+	if len(stage.AllowedSources) != 0 {
+		if !allowedSource(sc.source, stage.AllowedSources) {
+			return "", fmt.Errorf("源镜像 %s 不在允许的范围内 %v", sc.source, stage.AllowedSources)
+		}
+	}
+	if len(p.Cfg.Plugin.PublicKey) == 0 {
+		return "源镜像校验通过", nil
+	}
+
+	if err := p.registry.VerifySignature(context.TODO(), sc.source, []byte(p.Cfg.Plugin.PublicKey)); err != nil {
+		return "", fmt.Errorf("签名校验失败: %w", err)
+	}
+	p.CreateTaskMessage(fmt.Sprintf("镜像 %s 签名校验通过", sc.source))
+	return "签名校验通过", nil
+}
+
+// allowedSource 源镜像(不含版本)或补全仓库后的地址匹配任一规则时允许同步
+func allowedSource(source string, patterns []string) bool {
+	candidates := []string{source}
+	if i := strings.LastIndex(source, ":"); i > strings.LastIndex(source, "/") {
+		candidates = append(candidates, source[:i])
+	}
+	if ref, err := registry.ParseReference(source); err == nil {
+		candidates = append(candidates, ref.Registry+"/"+ref.Repository)
+	}
+
+	for _, pattern := range patterns {
+		for _, candidate := range candidates {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *PluginController) copyStage(sc *stageContext, stage config.Stage) (string, error) {
+	copyResult, err := p.copyWithRetry(sc.source, sc.target, sc.img)
+	if err != nil {
+		return "", err
+	}
+	sc.copyResult = copyResult
+	return "", nil
+}
+
+// verifyDigest 推送完成后校验目标镜像和源镜像的 digest
+func (p *PluginController) verifyDigest(sc *stageContext, stage config.Stage) (string, error) {
+	verifyResult, err := p.registry.Verify(context.TODO(), sc.source, sc.target)
+	if err != nil {
+		klog.Errorf("镜像 %s digest 校验失败 %v", sc.target, err)
+		return "", fmt.Errorf("digest 校验失败: %w", err)
+	}
+	sc.verifyResult = verifyResult
+	return verifyResult.TargetDigest, nil
+}
+
+// copySignatures 同步镜像关联的签名、attestation 和 SBOM
+func (p *PluginController) copySignatures(sc *stageContext, stage config.Stage) (string, error) {
+	if sc.verifyResult == nil {
+		return "", fmt.Errorf("需要在 verify-digest 阶段之后执行")
+	}
+	copied, err := p.registry.CopyReferrers(context.TODO(), sc.source, sc.target, sc.verifyResult.TargetDigest)
+	if err != nil {
+		klog.Errorf("镜像 %s 签名同步失败 %v", sc.target, err)
+		return "", fmt.Errorf("签名同步失败: %w", err)
+	}
+	if len(copied) == 0 {
+		p.CreateTaskMessage(fmt.Sprintf("镜像 %s 不存在关联的签名、attestation 和 SBOM", sc.source))
+		return "不存在关联的签名、attestation 和 SBOM", nil
+	}
+	p.CreateTaskMessage(fmt.Sprintf("镜像 %s 关联的签名、attestation 和 SBOM 同步完成 %v", sc.source, copied))
+	return fmt.Sprintf("已同步 %v", copied), nil
+}
+
+// execStage 执行自定义命令，镜像信息通过环境变量传递，命令的输出记录在阶段信息中
+// 命令仅能获取镜像信息和 PATH，不继承 plugin 进程的环境变量
+func (p *PluginController) execStage(sc *stageContext, stage config.Stage) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), stageTimeout(stage))
+	defer cancel()
+
+	cmd := p.exec.CommandContext(ctx, stage.Command[0], stage.Command[1:]...)
+	cmd.SetEnv(append([]string{execStagePath}, sc.env(p.TaskId)...))
+	out, err := cmd.CombinedOutput()
+	msg := truncateMessage(strings.TrimSpace(string(out)))
+	if err != nil {
+		if len(msg) != 0 {
+			return "", fmt.Errorf("%v: %s", err, msg)
+		}
+		return "", err
+	}
+	return msg, nil
+}
+
+// webhookStage 将镜像信息 POST 到指定地址，不携带回调 token
+func (p *PluginController) webhookStage(sc *stageContext, stage config.Stage) (string, error) {
+	client := util.NewHttpClient(stageTimeout(stage), stage.URL)
+	if err := client.Post(stage.URL, nil, sc.payload(p.TaskId, stage), map[string]string{"Content-Type": "application/json"}); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+func stageTimeout(stage config.Stage) time.Duration {
+	timeout := stage.Timeout
+	if timeout <= 0 {
+		timeout = defaultStageTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+func truncateMessage(msg string) string {
+	if len(msg) > maxStageMessage {
+		return msg[len(msg)-maxStageMessage:]
+	}
+	return msg
+}
+
+func (sc *stageContext) digests() (string, string) {
+	if sc.verifyResult == nil {
+		return "", ""
+	}
+	return sc.verifyResult.SourceDigest, sc.verifyResult.TargetDigest
+}
+
+func (sc *stageContext) env(taskId int64) []string {
+	sourceDigest, targetDigest := sc.digests()
+	return []string{
+		"TASK_ID=" + fmt.Sprintf("%d", taskId),
+		"SOURCE_IMAGE=" + sc.source,
+		"TARGET_IMAGE=" + sc.target,
+		"SOURCE_DIGEST=" + sourceDigest,
+		"TARGET_DIGEST=" + targetDigest,
+	}
+}
+
+func (sc *stageContext) payload(taskId int64, stage config.Stage) map[string]interface{} {
+	sourceDigest, targetDigest := sc.digests()
+	return map[string]interface{}{
+		"task_id":       taskId,
+		"stage":         stage.GetName(),
+		"source":        sc.source,
+		"target":        sc.target,
+		"source_digest": sourceDigest,
+		"target_digest": targetDigest,
+		"manifests":     platformManifests(sc.copyResult),
+	}
+}
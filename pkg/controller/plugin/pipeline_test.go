@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/caoyingjunz/pixiulib/exec"
+
+	"github.com/caoyingjunz/rainbow/cmd/app/config"
+	rainbowtypes "github.com/caoyingjunz/rainbow/pkg/types"
+)
+
+func TestValidateStages(t *testing.T) {
+	tests := []struct {
+		name    string
+		stages  []config.Stage
+		wantErr string
+	}{
+		{
+			name:   "default stages",
+			stages: nil,
+		},
+		{
+			name: "exec stage with command",
+			stages: []config.Stage{
+				{Type: rainbowtypes.StageCopy},
+				{Name: "scan", Type: rainbowtypes.StageExec, Command: []string{"true"}},
+			},
+		},
+		{
+			name: "exec stage without command",
+			stages: []config.Stage{
+				{Type: rainbowtypes.StageCopy},
+				{Name: "scan", Type: rainbowtypes.StageExec},
+			},
+			wantErr: "exec 阶段 scan 未指定命令",
+		},
+		{
+			name:    "missing copy stage",
+			stages:  []config.Stage{{Type: rainbowtypes.StageVerifyDigest}},
+			wantErr: "缺少 copy 阶段",
+		},
+		{
+			name:    "unknown stage type",
+			stages:  []config.Stage{{Type: "unknown"}},
+			wantErr: "不支持的阶段类型",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &PluginController{}
+			p.Cfg.Plugin.Driver = NativeDriver
+			p.Cfg.Plugin.Stages = tc.stages
+
+			err := p.Validate()
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestExecStageEnv(t *testing.T) {
+	t.Setenv("RAINBOW_TEST_SECRET", "secret")
+
+	p := &PluginController{TaskId: 7, exec: exec.New()}
+	sc := &stageContext{source: "docker.io/library/nginx:1.25", target: "harbor.example.com/mirror/nginx:1.25"}
+	out, err := p.execStage(sc, config.Stage{Type: rainbowtypes.StageExec, Command: []string{"env"}})
+	if err != nil {
+		t.Fatalf("exec stage failed: %v", err)
+	}
+
+	for _, want := range []string{"TASK_ID=7", "SOURCE_IMAGE=docker.io/library/nginx:1.25", "TARGET_IMAGE=harbor.example.com/mirror/nginx:1.25", "PATH="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in exec environment, got %q", want, out)
+		}
+	}
+	if strings.Contains(out, "RAINBOW_TEST_SECRET") {
+		t.Errorf("exec stage should not inherit plugin environment, got %q", out)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,12 +15,16 @@ import (
 	"github.com/caoyingjunz/pixiulib/exec"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/klog/v2"
 
 	"github.com/caoyingjunz/rainbow/cmd/app/config"
 	"github.com/caoyingjunz/rainbow/pkg/db/model"
 	rainbowtypes "github.com/caoyingjunz/rainbow/pkg/types"
 	"github.com/caoyingjunz/rainbow/pkg/util"
+	"github.com/caoyingjunz/rainbow/pkg/util/imagelist"
+	"github.com/caoyingjunz/rainbow/pkg/util/naming"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
 )
 
 const (
@@ -27,7 +33,9 @@ const (
 
 	SkopeoDriver = "skopeo"
 	DockerDriver = "docker"
+	NativeDriver = "native"
 
+	// MaxConcurrency 未设置 ParallelImages 时同时同步的镜像数量
 	MaxConcurrency = 5
 )
 
@@ -51,6 +59,14 @@ type PluginController struct {
 	httpClient util.HttpInterface
 	exec       exec.Interface
 	docker     *client.Client
+	registry   *registry.Client
+	// callbacks 启用批量回调时缓存镜像状态和任务消息
+	callbacks *callbackBuffer
+	// exports 同步成功和失败的目标镜像，用于导出离线包
+	exports *exportList
+
+	// proxy 设置带宽上限时 skopeo 使用的本地限速代理
+	proxy *registry.BandwidthProxy
 
 	Cfg      config.Config
 	Registry config.Registry
@@ -96,30 +112,23 @@ func (i *image) GetName() string {
 }
 
 func (i *image) Run() error {
-	var images []string
 	if i.p.Cfg.Default.PushKubernetes {
 		kubeImages, err := i.p.getImages()
 		if err != nil {
 			klog.Errorf("获取 k8s 镜像失败: %v", err)
 			return fmt.Errorf("获取 k8s 镜像失败: %v", err)
 		}
+		if addonImages := i.p.Cfg.Kubernetes.AddonImages; len(addonImages) != 0 {
+			klog.Infof("kubernetes 插件镜像为 %v", addonImages)
+			kubeImages = append(kubeImages, addonImages...)
+		}
 		is, err := i.p.CreateImages(kubeImages)
 		if err != nil {
 			klog.Errorf("回调API创建 kubernetes 镜像失败: %v", err)
 			return err
 		}
 
-		var tplImages []config.Image
-		for _, img := range is {
-			for _, tag := range img.Tags {
-				tplImages = append(tplImages, config.Image{
-					Name: img.Name,
-					Path: tag.Path,
-					Tags: []string{tag.Name},
-					Id:   tag.ImageId,
-				})
-			}
-		}
+		tplImages := makeTemplateImages(is)
 		klog.Infof("已完成 kubernetes 镜像的回调创建，镜像模板为 %v", tplImages)
 		i.p.Images = tplImages
 	}
@@ -127,24 +136,116 @@ func (i *image) Run() error {
 	if i.p.Cfg.Default.PushImages {
 		fileImages, err := i.p.getImagesFromFile()
 		if err != nil {
-			return fmt.Errorf("")
+			klog.Errorf("从镜像列表文件获取镜像失败: %v", err)
+			return fmt.Errorf("从镜像列表文件获取镜像失败: %v", err)
+		}
+		if len(fileImages) == 0 {
+			return nil
+		}
+
+		var tplImages []config.Image
+		if !i.p.Synced {
+			rule := naming.Rule{Name: i.p.Cfg.Plugin.NameTemplate, Tag: i.p.Cfg.Plugin.TagTemplate}
+			if tplImages, err = makeLocalImages(fileImages, rule); err != nil {
+				return err
+			}
+		} else {
+			is, err := i.p.CreateImages(fileImages)
+			if err != nil {
+				klog.Errorf("回调API创建镜像列表文件中的镜像失败: %v", err)
+				return err
+			}
+			tplImages = makeTemplateImages(is)
 		}
-		images = append(images, fileImages...)
+		klog.Infof("已完成镜像列表文件中镜像的创建，镜像模板为 %v", tplImages)
+		i.p.Images = append(i.p.Images, tplImages...)
 	}
 
 	return nil
 }
 
+// makeTemplateImages 将回调创建的镜像转换为推送使用的镜像模板
+func makeTemplateImages(is []model.Image) []config.Image {
+	var tplImages []config.Image
+	for _, img := range is {
+		for _, tag := range img.Tags {
+			tplImages = append(tplImages, config.Image{
+				Name: img.Name,
+				Path: tag.Path,
+				Tags: []string{tag.Name},
+				Id:   tag.ImageId,
+			})
+			if len(tag.MirrorTag) != 0 {
+				tplImages[len(tplImages)-1].Retag = map[string]string{tag.Name: tag.MirrorTag}
+			}
+		}
+	}
+	return tplImages
+}
+
+// makeLocalImages 未启用回调时，由 plugin 按命名规则生成目标镜像，未设置模板时使用镜像地址的最后一段作为镜像名称
+func makeLocalImages(names []string, rule naming.Rule) ([]config.Image, error) {
+	var tplImages []config.Image
+	for _, name := range names {
+		path, tag := name, "latest"
+		if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+			path, tag = name[:i], name[i+1:]
+		}
+		imageName, err := rule.ApplyName(path)
+		if err != nil {
+			return nil, err
+		}
+		targetTag, err := rule.ApplyTag(path, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		img := config.Image{
+			Name: imageName,
+			Path: path,
+			Tags: []string{tag},
+		}
+		if targetTag != tag {
+			img.Retag = map[string]string{tag: targetTag}
+		}
+		tplImages = append(tplImages, img)
+	}
+	return tplImages, nil
+}
+
+// sourceTag 根据目标镜像找到对应的源版本
+func sourceTag(img config.Image, target string) string {
+	targetTag := target[strings.LastIndex(target, ":")+1:]
+	for _, tag := range img.Tags {
+		if img.GetTargetTag(tag) == targetTag {
+			return tag
+		}
+	}
+	return targetTag
+}
+
 func NewPluginController(cfg config.Config) *PluginController {
-	return &PluginController{
+	httpClient := util.NewHttpClient(5*time.Second, cfg.Plugin.Callback)
+	if len(cfg.Plugin.Token) != 0 {
+		httpClient.WithHeaders(map[string]string{"Authorization": "Bearer " + cfg.Plugin.Token})
+	}
+
+	p := &PluginController{
 		Cfg:        cfg,
 		Callback:   cfg.Plugin.Callback,
 		TaskId:     cfg.Plugin.TaskId,
 		RegistryId: cfg.Plugin.RegistryId,
 		Synced:     cfg.Plugin.Synced,
 		Images:     cfg.Images,
-		httpClient: util.NewHttpClient(5*time.Second, cfg.Plugin.Callback),
+		httpClient: httpClient,
 	}
+	if p.Synced && cfg.Plugin.BatchCallback {
+		p.callbacks = newCallbackBuffer(p)
+	}
+	if len(cfg.Plugin.Export) != 0 {
+		p.exports = &exportList{}
+	}
+	return p
 }
 
 func (p *PluginController) Validate() error {
@@ -152,22 +253,58 @@ func (p *PluginController) Validate() error {
 		if len(p.KubernetesVersion) == 0 {
 			return fmt.Errorf("failed to find kubernetes version")
 		}
-		// 检查 kubeadm 的版本是否和 k8s 版本一致
-		kubeadmVersion, err := p.getKubeadmVersion()
-		if err != nil {
-			klog.Error("failed to get kubeadm version: %v", err)
-			return fmt.Errorf("failed to get kubeadm version: %v", err)
+		if p.useComponents() {
+			// 检查下发的组件版本是否和 k8s 版本一致
+			if v := p.Cfg.Kubernetes.Components.Version; v != p.KubernetesVersion {
+				return fmt.Errorf("components version %s not match kubernetes version %s", v, p.KubernetesVersion)
+			}
+		} else {
+			// 检查 kubeadm 的版本是否和 k8s 版本一致
+			kubeadmVersion, err := p.getKubeadmVersion()
+			if err != nil {
+				klog.Errorf("failed to get kubeadm version: %v", err)
+				return fmt.Errorf("failed to get kubeadm version: %v", err)
+			}
+			if kubeadmVersion != p.KubernetesVersion {
+				klog.Errorf("kubeadm version %s not match kubernetes version %s", kubeadmVersion, p.KubernetesVersion)
+				return fmt.Errorf("kubeadm version %s not match kubernetes version %s", kubeadmVersion, p.KubernetesVersion)
+			}
+		}
+	}
+
+	// 检查同步阶段的配置
+	var copied bool
+	for _, stage := range p.stages() {
+		if _, err := p.stageFunc(stage.Type); err != nil {
+			return err
 		}
-		if kubeadmVersion != p.KubernetesVersion {
-			klog.Errorf("kubeadm version %s not match kubernetes version %s", kubeadmVersion, p.KubernetesVersion)
-			return fmt.Errorf("kubeadm version %s not match kubernetes version %s", kubeadmVersion, p.KubernetesVersion)
+		switch stage.Type {
+		case rainbowtypes.StageCopy:
+			copied = true
+		case rainbowtypes.StageExec:
+			if len(stage.Command) == 0 {
+				return fmt.Errorf("exec 阶段 %s 未指定命令", stage.GetName())
+			}
 		}
 	}
+	if !copied {
+		return fmt.Errorf("同步阶段缺少 copy 阶段")
+	}
 
-	// 检查 docker 的客户端是否正常
-	if _, err := p.docker.Ping(context.Background()); err != nil {
-		klog.Errorf("%v", err)
-		return err
+	// 检查驱动是否支持并发设置，docker 驱动的层并发由 docker daemon 控制
+	if p.Cfg.Plugin.ParallelLayers != 0 && p.Cfg.Plugin.Driver == DockerDriver {
+		return fmt.Errorf("docker driver does not support parallel layers")
+	}
+	if len(p.Cfg.Plugin.Export) != 0 && p.Cfg.Plugin.Driver != NativeDriver {
+		return fmt.Errorf("export requires native driver")
+	}
+
+	// 检查 docker 的客户端是否正常，native 驱动不依赖 docker
+	if p.Cfg.Plugin.Driver != NativeDriver {
+		if _, err := p.docker.Ping(context.Background()); err != nil {
+			klog.Errorf("%v", err)
+			return err
+		}
 	}
 
 	klog.Infof("plugin validate completed")
@@ -193,6 +330,32 @@ func (p *PluginController) doComplete() error {
 		}
 	}
 
+	// native 驱动使用该客户端同步镜像，其他驱动使用该客户端在推送后校验 digest
+	bandwidth, err := registry.ParseBandwidth(p.Cfg.Plugin.BandwidthLimit)
+	if err != nil {
+		return err
+	}
+	// 源仓库使用 docker 配置文件中的凭据，与 docker 和 skopeo 驱动拉取镜像时一致
+	opts := []registry.Option{
+		registry.WithAuth(p.Registry.Repository, p.Registry.Username, p.Registry.Password),
+		registry.WithDockerConfig(registry.DefaultDockerConfig()),
+		registry.WithParallelLayers(p.Cfg.Plugin.ParallelLayers),
+		registry.WithBandwidth(bandwidth),
+	}
+	if p.Registry.Insecure {
+		opts = append(opts, registry.WithPlainHTTP(p.Registry.Repository))
+	}
+	p.registry = registry.NewClient(opts...)
+	klog.Infof("同时同步镜像数 %d，同时复制层数 %d，带宽上限 %s", p.parallelImages(), p.Cfg.Plugin.ParallelLayers, p.Cfg.Plugin.BandwidthLimit)
+
+	if p.Cfg.Plugin.Driver == SkopeoDriver && bandwidth > 0 {
+		// skopeo 运行在容器中，通过本地限速代理访问仓库
+		if p.proxy, err = registry.NewBandwidthProxy(bandwidth); err != nil {
+			return err
+		}
+		klog.Infof("skopeo 使用限速代理 %s", p.proxy.URL())
+	}
+
 	if p.Cfg.Plugin.Driver == SkopeoDriver {
 		cmd := []string{"docker", "pull", "pixiuio/skopeo:1.17.0"}
 		klog.Infof("Starting pull skopeo image %s", cmd)
@@ -202,9 +365,13 @@ func (p *PluginController) doComplete() error {
 		}
 	}
 
-	if p.Cfg.Default.PushKubernetes {
+	// 已下发组件版本时直接生成镜像列表，否则下载 kubeadm 获取
+	if p.Cfg.Default.PushKubernetes && p.useComponents() {
+		p.CreateTaskMessage("kubernetes 镜像推送准备完成")
+		klog.Infof("使用组件版本 %+v 生成 kubernetes 镜像列表", *p.Cfg.Kubernetes.Components)
+	} else if p.Cfg.Default.PushKubernetes {
 		//cmd := []string{"sudo", "apt-get", "install", "-y", fmt.Sprintf("kubeadm=%s-00", p.Cfg.Kubernetes.Version[1:])}
-		cmd := []string{"sudo", "curl", "-LO", fmt.Sprintf("https://dl.k8s.io/release/%s/bin/linux/amd64/kubeadm", p.Cfg.Kubernetes.Version)}
+		cmd := []string{"sudo", "curl", "-LO", fmt.Sprintf("https://dl.k8s.io/release/%s/bin/linux/%s/kubeadm", p.Cfg.Kubernetes.Version, runtime.GOARCH)}
 		klog.Infof("Starting install kubeadm %s", cmd)
 		out, err := p.exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
 		if err != nil {
@@ -221,10 +388,11 @@ func (p *PluginController) doComplete() error {
 		klog.Infof("kubeadm 已安装完成")
 	}
 
-	p.Runners = []Runner{
-		&login{name: "Registry登陆", p: p},
-		&image{name: "解析镜像", p: p},
+	// native 驱动直接使用仓库的用户名和密码认证，无需 docker login
+	if p.Cfg.Plugin.Driver != NativeDriver {
+		p.Runners = append(p.Runners, &login{name: "Registry登陆", p: p})
 	}
+	p.Runners = append(p.Runners, &image{name: "解析镜像", p: p})
 	return p.Validate()
 }
 
@@ -247,6 +415,9 @@ func (p *PluginController) Complete() error {
 }
 
 func (p *PluginController) Close() {
+	if p.callbacks != nil {
+		p.callbacks.Stop()
+	}
 	if p.docker != nil {
 		_ = p.docker.Close()
 	}
@@ -292,7 +463,17 @@ func (p *PluginController) cleanImages(in []byte) []byte {
 	return []byte(newInStr)
 }
 
+// useComponents 是否使用下发的组件版本生成 kubernetes 镜像列表
+func (p *PluginController) useComponents() bool {
+	c := p.Cfg.Kubernetes.Components
+	return c != nil && c.Validate() == nil
+}
+
 func (p *PluginController) getImages() ([]string, error) {
+	if p.useComponents() {
+		return p.Cfg.Kubernetes.Components.Images(), nil
+	}
+
 	cmd := []string{Kubeadm, "config", "images", "list", "--kubernetes-version", p.KubernetesVersion, "-o", "json"}
 	out, err := p.exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
 	if err != nil {
@@ -309,20 +490,38 @@ func (p *PluginController) getImages() ([]string, error) {
 	return kubeadmImage.Images, nil
 }
 
-func (p *PluginController) sync(imageToPush string, targetImage string, img config.Image) error {
+func (p *PluginController) sync(imageToPush string, targetImage string, img config.Image) (*registry.CopyResult, error) {
 	klog.Infof("preparing to sync image %s to %s", imageToPush, targetImage)
+	if p.isArtifact() && p.Cfg.Plugin.Driver != NativeDriver {
+		return nil, fmt.Errorf("artifact kind %s requires native driver", p.Cfg.Plugin.ArtifactKind)
+	}
+
+	reporter := p.newProgressReporter(img, targetImage)
+	defer reporter.Flush()
+
 	var cmd []string
 	switch p.Cfg.Plugin.Driver {
 	case SkopeoDriver:
 		klog.Infof("use skopeo to copying image: %s", targetImage)
-		cmd1 := []string{"skopeo", "login", "-u", p.Registry.Username, "-p", p.Registry.Password, p.Registry.Repository, ">", "/dev/null", "2>&1", "&&", "skopeo", "copy", "docker://" + imageToPush, "docker://" + targetImage}
+		cmd1 := []string{"skopeo", "login"}
+		if p.Registry.Insecure {
+			// 关闭 tls 校验后 skopeo 使用 http 访问目标仓库
+			cmd1 = append(cmd1, "--tls-verify=false")
+		}
+		cmd1 = append(cmd1, "-u", p.Registry.Username, "-p", p.Registry.Password, p.Registry.Repository, ">", "/dev/null", "2>&1", "&&", "skopeo", "copy", "docker://"+imageToPush, "docker://"+targetImage)
 
 		// p.Cfg.Plugin.Arch 解析平台架构配置，格式为: 操作系统/架构/变体 (如: linux/amd64/8)
 		// 支持两种格式:
 		//   - 完整格式: linux/amd64/8  → os=linux, arch=amd64, variant=8
 		//   - 简化格式: linux/amd64    → os=linux, arch=amd64
 		parts := strings.Split(p.Cfg.Plugin.Arch, "/")
-		if len(parts) >= 2 {
+		if len(p.Cfg.Plugin.Platforms) != 0 {
+			// skopeo 仅支持同步全部平台
+			if len(p.Cfg.Plugin.Platforms) != 1 || p.Cfg.Plugin.Platforms[0] != rainbowtypes.AllPlatforms {
+				return nil, fmt.Errorf("skopeo driver only supports syncing all platforms, got %v", p.Cfg.Plugin.Platforms)
+			}
+			cmd1 = append(cmd1, "--all")
+		} else if len(parts) >= 2 {
 			targetOS := parts[0]
 			arch := parts[1]
 
@@ -335,60 +534,277 @@ func (p *PluginController) sync(imageToPush string, targetImage string, img conf
 			}
 		}
 
-		cmd = []string{"docker", "run", "--network", "host", "pixiuio/skopeo:1.17.0", "sh", "-c", strings.Join(cmd1, " ")}
+		if p.Cfg.Plugin.ParallelLayers > 0 {
+			cmd1 = append(cmd1, "--image-parallel-copies", strconv.Itoa(p.Cfg.Plugin.ParallelLayers))
+		}
+		if p.Registry.Insecure {
+			cmd1 = append(cmd1, "--dest-tls-verify=false")
+		}
+
+		cmd = []string{"docker", "run", "--network", "host"}
+		if p.proxy != nil {
+			cmd = append(cmd, "-e", "HTTPS_PROXY="+p.proxy.URL(), "-e", "HTTP_PROXY="+p.proxy.URL())
+		}
+		cmd = append(cmd, "pixiuio/skopeo:1.17.0", "sh", "-c", strings.Join(cmd1, " "))
 		klog.Infof("即将执行命令(%s)进行同步", cmd)
 	case DockerDriver:
+		if len(p.Cfg.Plugin.Platforms) != 0 {
+			return nil, fmt.Errorf("docker driver does not support multi-arch sync")
+		}
+		if len(p.Cfg.Plugin.BandwidthLimit) != 0 {
+			return p.dockerLimitedSync(imageToPush, targetImage, reporter.Update)
+		}
 		klog.Infof("Pulling image: %s", imageToPush)
 		reader, err := p.docker.ImagePull(context.TODO(), imageToPush, types.ImagePullOptions{})
 		if err != nil {
 			klog.Errorf("Failed to pull image %s: %v", imageToPush, err)
-			return fmt.Errorf("failed to pull image %s: %v", imageToPush, err)
+			return nil, fmt.Errorf("failed to pull image %s: %v", imageToPush, err)
+		}
+		err = readPullProgress(reader, reporter.Update)
+		reader.Close()
+		if err != nil {
+			klog.Errorf("Failed to pull image %s: %v", imageToPush, err)
+			return nil, fmt.Errorf("failed to pull image %s: %v", imageToPush, err)
 		}
-		io.Copy(os.Stdout, reader)
 
 		klog.Infof("Tagging image from %s to %s", imageToPush, targetImage)
 		if err := p.docker.ImageTag(context.TODO(), imageToPush, targetImage); err != nil {
 			klog.Errorf("Failed to tag image %s to %s: %v", imageToPush, targetImage, err)
-			return fmt.Errorf("failed to tag image %s to %s: %v", imageToPush, targetImage, err)
+			return nil, fmt.Errorf("failed to tag image %s to %s: %v", imageToPush, targetImage, err)
 		}
 
 		cmd = []string{"docker", "push", targetImage}
+	case NativeDriver:
+		return p.nativeSync(imageToPush, targetImage, reporter.Update)
 	default:
-		return fmt.Errorf("unsupported driver: %s", p.Cfg.Plugin.Driver)
+		return nil, fmt.Errorf("unsupported driver: %s", p.Cfg.Plugin.Driver)
 	}
 
 	klog.Infof("syncing image %s to %s", imageToPush, targetImage)
 	out, err := p.exec.Command(cmd[0], cmd[1:]...).CombinedOutput()
 	if err != nil {
 		klog.Errorf("Failed to push image %s: %v, output: %s", targetImage, err, string(out))
-		return fmt.Errorf("failed to push image %s %v %v", targetImage, string(out), err)
+		return nil, fmt.Errorf("failed to push image %s %v %v", targetImage, string(out), err)
 	}
 
 	klog.Infof("Successfully sync image: %s", targetImage)
-	return nil
+	return nil, nil
+}
+
+// nativeSync 使用 OCI distribution 协议直接在仓库之间复制镜像，不依赖 docker 和 skopeo
+func (p *PluginController) nativeSync(imageToPush string, targetImage string, progress registry.ProgressFunc) (*registry.CopyResult, error) {
+	opts, err := p.copyOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Progress = progress
+
+	klog.Infof("use native driver to copying image: %s", targetImage)
+	result, err := p.registry.Copy(context.TODO(), imageToPush, targetImage, opts)
+	if err != nil {
+		klog.Errorf("Failed to copy image %s to %s: %v", imageToPush, targetImage, err)
+		return nil, fmt.Errorf("failed to copy image %s to %s: %v", imageToPush, targetImage, err)
+	}
+
+	klog.Infof("Successfully sync image: %s(%s)", targetImage, result.TargetDigest)
+	return result, nil
+}
+
+// dockerLimitedSync docker daemon 拉取和推送镜像时无法限速，设置带宽上限时使用限速的客户端下载 docker 格式的离线包，
+// 导入 docker 后再从离线包推送到目标仓库
+func (p *PluginController) dockerLimitedSync(imageToPush string, targetImage string, progress registry.ProgressFunc) (*registry.CopyResult, error) {
+	opts, err := p.copyOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts.Progress = progress
+
+	file, err := os.CreateTemp("", "rainbow-docker-*.tar")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	klog.Infof("use docker driver with bandwidth limit to copying image: %s", targetImage)
+	archive, err := p.registry.NewArchive(file, registry.ArchiveDocker)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = archive.Add(context.TODO(), imageToPush, targetImage, opts); err != nil {
+		klog.Errorf("Failed to pull image %s: %v", imageToPush, err)
+		return nil, fmt.Errorf("failed to pull image %s: %v", imageToPush, err)
+	}
+	if err = archive.Close(); err != nil {
+		return nil, err
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	resp, err := p.docker.ImageLoad(context.TODO(), file, true)
+	if err != nil {
+		klog.Errorf("Failed to load image %s: %v", targetImage, err)
+		return nil, fmt.Errorf("failed to load image %s: %v", targetImage, err)
+	}
+	err = readPullProgress(resp.Body, func(registry.Progress) {})
+	resp.Body.Close()
+	if err != nil {
+		klog.Errorf("Failed to load image %s: %v", targetImage, err)
+		return nil, fmt.Errorf("failed to load image %s: %v", targetImage, err)
+	}
+
+	reader, err := registry.OpenArchive(file.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	images := reader.Images()
+	if len(images) != 1 {
+		return nil, fmt.Errorf("离线包中的镜像数量 %d 不正确", len(images))
+	}
+	result, err := p.registry.PushArchiveImage(context.TODO(), reader, images[0], targetImage, nil)
+	if err != nil {
+		klog.Errorf("Failed to push image %s: %v", targetImage, err)
+		return nil, fmt.Errorf("failed to push image %s: %v", targetImage, err)
+	}
+
+	klog.Infof("Successfully sync image: %s(%s)", targetImage, result.TargetDigest)
+	return result, nil
+}
+
+// copyOptions 根据任务的架构配置生成复制选项，指定 Platforms 时同步多架构 index
+func (p *PluginController) copyOptions() (registry.CopyOptions, error) {
+	var opts registry.CopyOptions
+	if p.isArtifact() {
+		opts.Artifact = true
+		return opts, nil
+	}
+	if len(p.Cfg.Plugin.Platforms) != 0 {
+		opts.MultiArch = true
+		for _, s := range p.Cfg.Plugin.Platforms {
+			if s == rainbowtypes.AllPlatforms {
+				opts.Platforms = nil
+				break
+			}
+			platform, err := registry.ParsePlatform(s)
+			if err != nil {
+				return opts, err
+			}
+			opts.Platforms = append(opts.Platforms, platform)
+		}
+		return opts, nil
+	}
+
+	if len(p.Cfg.Plugin.Arch) != 0 {
+		platform, err := registry.ParsePlatform(p.Cfg.Plugin.Arch)
+		if err != nil {
+			return opts, err
+		}
+		opts.Platform = platform
+	}
+	return opts, nil
+}
+
+// isArtifact 任务同步的是否为镜像以外的 OCI artifact
+func (p *PluginController) isArtifact() bool {
+	kind := p.Cfg.Plugin.ArtifactKind
+	return len(kind) != 0 && kind != rainbowtypes.ImageArtifact
 }
 
 func (p *PluginController) doPushImage(img config.Image) error {
 	imageMap := img.GetMap(p.Registry.Repository, p.Registry.Namespace)
 
 	for imageToPush, targetImage := range imageMap {
-		p.SyncImageStatus(targetImage, rainbowtypes.SyncImageRunning, "", img)
-		err := p.sync(imageToPush, targetImage, img)
-		if err != nil {
-			p.SyncImageStatus(targetImage, rainbowtypes.SyncImageError, err.Error(), img)
-			p.CreateTaskMessage(fmt.Sprintf("镜像 %s 同步失败，原因: %v", imageToPush, err))
+		p.SyncImageStatus(targetImage, rainbowtypes.SyncImageRunning, "", img, nil)
+
+		sc := &stageContext{img: img, source: imageToPush, target: targetImage}
+		if err := p.runPipeline(sc); err != nil {
+			p.SyncImageStatus(targetImage, rainbowtypes.SyncImageError, err.Error(), img, nil)
+			p.exports.fail(targetImage)
 			continue
 		}
-		p.SyncImageStatus(targetImage, rainbowtypes.SyncImageComplete, "", img)
-		p.CreateTaskMessage(fmt.Sprintf("镜像 %s 同步完成", imageToPush))
+
+		result := &syncResult{
+			Source:    imageToPush,
+			Manifests: platformManifests(sc.copyResult),
+		}
+		result.SourceDigest, result.TargetDigest = sc.digests()
+		if sc.copyResult != nil {
+			result.MediaType = sc.copyResult.MediaType
+			result.ArtifactType = sc.copyResult.ArtifactType
+		}
+		p.SyncImageStatus(targetImage, rainbowtypes.SyncImageComplete, "", img, result)
+		p.exports.add(targetImage)
+		if len(result.TargetDigest) != 0 {
+			p.CreateTaskMessage(fmt.Sprintf("镜像 %s 同步完成，digest 校验通过(%s)", imageToPush, result.TargetDigest))
+		} else {
+			p.CreateTaskMessage(fmt.Sprintf("镜像 %s 同步完成", imageToPush))
+		}
 	}
 
 	return nil
 }
 
+// syncResult 镜像同步完成后回调的校验信息
+type syncResult struct {
+	Source       string
+	SourceDigest string
+	TargetDigest string
+	Manifests    []rainbowtypes.PlatformManifest
+	MediaType    string
+	ArtifactType string
+}
+
+// platformManifests 多架构同步时，返回各平台的 manifest 用于回调记录
+func platformManifests(result *registry.CopyResult) []rainbowtypes.PlatformManifest {
+	if result == nil {
+		return nil
+	}
+
+	var manifests []rainbowtypes.PlatformManifest
+	for _, m := range result.Manifests {
+		platform := m.Platform.String()
+		if len(platform) == 0 || platform == "unknown/unknown" {
+			// buildx 生成的 attestation manifest
+			platform = m.Annotations["vnd.docker.reference.type"]
+		}
+		manifests = append(manifests, rainbowtypes.PlatformManifest{
+			Platform:  platform,
+			Digest:    m.Digest,
+			MediaType: m.MediaType,
+			Size:      m.Size,
+		})
+	}
+	return manifests
+}
+
+// getImagesFromFile 从镜像列表文件中获取镜像，tag 中含有通配符时通过源仓库的 tag 列表展开
 func (p *PluginController) getImagesFromFile() ([]string, error) {
-	var imgs []string
-	return imgs, nil
+	file := p.Cfg.Plugin.ImageFile
+	if len(file) == 0 {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	entries, lineErrs := imagelist.Parse(file, data)
+	if len(lineErrs) == 0 {
+		var imgs []string
+		imgs, lineErrs = imagelist.Expand(context.TODO(), p.registry, entries)
+		if len(lineErrs) == 0 {
+			klog.Infof("从镜像列表文件 %s 获取到 %d 个镜像", file, len(imgs))
+			return imgs, nil
+		}
+	}
+
+	var errs []error
+	for _, e := range lineErrs {
+		errs = append(errs, e)
+	}
+	return nil, utilerrors.NewAggregate(errs)
 }
 
 func (p *PluginController) Run() error {
@@ -418,7 +834,7 @@ func (p *PluginController) Run() error {
 	klog.Infof("待推送镜像列表为 %v", p.Images)
 
 	diff := len(p.Images)
-	maxCh := make(chan struct{}, MaxConcurrency)
+	maxCh := make(chan struct{}, p.parallelImages())
 	errCh := make(chan error, diff)
 	var wg sync.WaitGroup
 	for _, imageToPush := range p.Images {
@@ -447,11 +863,27 @@ func (p *PluginController) Run() error {
 	default:
 	}
 
+	if p.exports != nil {
+		if err := p.export(); err != nil {
+			p.CreateTaskMessage(fmt.Sprintf("离线包导出失败，原因：%v", err))
+			p.SyncTaskStatus("离线包导出失败", err.Error(), 3)
+			return err
+		}
+	}
+
 	p.SyncTaskStatus("镜像同步完成", "镜像全部同步完成", 2)
 	p.CreateTaskMessage("镜像任务执行完成")
 	return nil
 }
 
+// parallelImages 同时同步的镜像数量
+func (p *PluginController) parallelImages() int {
+	if p.Cfg.Plugin.ParallelImages > 0 {
+		return p.Cfg.Plugin.ParallelImages
+	}
+	return MaxConcurrency
+}
+
 // SyncTaskStatus
 // 0 未开始
 // 1 执行中
@@ -462,6 +894,10 @@ func (p *PluginController) SyncTaskStatus(status string, msg string, process int
 		klog.Infof("未启用任务回调同步功能")
 		return
 	}
+	// 任务状态在已缓存的镜像状态和消息之后上报
+	if p.callbacks != nil {
+		p.callbacks.Flush()
+	}
 
 	for i := 0; i < 3; i++ {
 		err := p.httpClient.Put(
@@ -478,27 +914,58 @@ func (p *PluginController) SyncTaskStatus(status string, msg string, process int
 	}
 }
 
-func (p *PluginController) SyncImageStatus(target string, status string, msg string, img config.Image) {
+func (p *PluginController) SyncImageStatus(target string, status string, msg string, img config.Image, result *syncResult) {
 	if !p.Synced {
 		klog.Infof("未启用镜像回调同步功能")
 		return
 	}
 
+	if p.callbacks != nil {
+		req := &rainbowtypes.UpdateImageStatusRequest{
+			Name:       img.Name,
+			ImageId:    img.Id,
+			TaskId:     p.TaskId,
+			RegistryId: p.RegistryId,
+			Status:     status,
+			Message:    msg,
+			Target:     target,
+			Tag:        sourceTag(img, target),
+		}
+		if result != nil {
+			req.Source = result.Source
+			req.SourceDigest = result.SourceDigest
+			req.TargetDigest = result.TargetDigest
+			req.Manifests = result.Manifests
+			req.MediaType = result.MediaType
+			req.ArtifactType = result.ArtifactType
+		}
+		p.callbacks.Add(rainbowtypes.CallbackEvent{Type: rainbowtypes.CallbackStatusEvent, Status: req})
+		return
+	}
+
+	data := map[string]interface{}{
+		"name":        img.Name,
+		"image_id":    img.Id,
+		"task_id":     p.TaskId,
+		"registry_id": p.RegistryId,
+		"status":      status,
+		"message":     msg,
+		"target":      target,
+		"tag":         sourceTag(img, target),
+	}
+	if result != nil {
+		data["source"] = result.Source
+		data["source_digest"] = result.SourceDigest
+		data["target_digest"] = result.TargetDigest
+		data["manifests"] = result.Manifests
+		data["media_type"] = result.MediaType
+		data["artifact_type"] = result.ArtifactType
+	}
+
 	for i := 0; i < 3; i++ {
-		err := p.httpClient.Put(
-			fmt.Sprintf("%s/rainbow/images/status", p.Callback),
-			nil,
-			map[string]interface{}{
-				"name":        img.Name,
-				"image_id":    img.Id,
-				"task_id":     p.TaskId,
-				"registry_id": p.RegistryId,
-				"status":      status,
-				"message":     msg,
-				"target":      target,
-			})
+		err := p.httpClient.Put(fmt.Sprintf("%s/rainbow/images/status", p.Callback), nil, data)
 		if err == nil {
-			klog.Infof("同步镜像(%d) 状态(%s) 信息(%s) mirror(%s) 成功", p.TaskId, status, msg, target, err)
+			klog.Infof("同步镜像(%d) 状态(%s) 信息(%s) mirror(%s) 成功", p.TaskId, status, msg, target)
 			return
 		}
 
@@ -507,6 +974,40 @@ func (p *PluginController) SyncImageStatus(target string, status string, msg str
 	}
 }
 
+// SyncImageStage 上报镜像同步阶段的状态
+func (p *PluginController) SyncImageStage(sc *stageContext, sequence int, stage config.Stage, status string, msg string) {
+	if !p.Synced {
+		return
+	}
+
+	req := &rainbowtypes.UpdateImageStageRequest{
+		Id:       p.TaskId,
+		ImageId:  sc.img.Id,
+		Target:   sc.target,
+		Stage:    stage.GetName(),
+		Type:     stage.Type,
+		Sequence: sequence,
+		Status:   status,
+		Message:  msg,
+	}
+	if p.callbacks != nil {
+		p.callbacks.Add(rainbowtypes.CallbackEvent{Type: rainbowtypes.CallbackStageEvent, Stage: req})
+		return
+	}
+
+	if err := p.httpClient.Put(fmt.Sprintf("%s/rainbow/tasks/%d/stages", p.Callback, p.TaskId), nil, map[string]interface{}{
+		"image_id": req.ImageId,
+		"target":   req.Target,
+		"stage":    req.Stage,
+		"type":     req.Type,
+		"sequence": req.Sequence,
+		"status":   req.Status,
+		"message":  req.Message,
+	}); err != nil {
+		klog.Errorf("上报镜像 %s 的 %s 阶段状态(%s)失败 %v", sc.target, req.Stage, status, err)
+	}
+}
+
 func (p *PluginController) CreateImages(names []string) ([]model.Image, error) {
 	if !p.Synced {
 		return nil, nil
@@ -525,6 +1026,10 @@ func (p *PluginController) CreateTaskMessage(msg string) {
 	if !p.Synced {
 		return
 	}
+	if p.callbacks != nil {
+		p.callbacks.Add(rainbowtypes.CallbackEvent{Type: rainbowtypes.CallbackMessageEvent, Message: msg})
+		return
+	}
 
 	if err := p.httpClient.Post(
 		fmt.Sprintf("%s/rainbow/tasks/%d/messages", p.Callback, p.TaskId),
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/cmd/app/config"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
+)
+
+// progressInterval 单个镜像上报进度的最小间隔
+const progressInterval = 2 * time.Second
+
+// progressReporter 节流上报单个镜像的字节进度，同一时间最多只有一个上报请求
+type progressReporter struct {
+	p      *PluginController
+	img    config.Image
+	target string
+
+	lock    sync.Mutex
+	last    time.Time
+	sending bool
+	latest  registry.Progress
+}
+
+func (p *PluginController) newProgressReporter(img config.Image, target string) *progressReporter {
+	return &progressReporter{p: p, img: img, target: target}
+}
+
+// Update 记录最新的进度，距离上次上报超过 progressInterval 时异步上报
+func (r *progressReporter) Update(progress registry.Progress) {
+	r.lock.Lock()
+	r.latest = progress
+	if r.sending || time.Since(r.last) < progressInterval {
+		r.lock.Unlock()
+		return
+	}
+	r.sending = true
+	r.last = time.Now()
+	r.lock.Unlock()
+
+	go func() {
+		r.send(progress)
+
+		r.lock.Lock()
+		r.sending = false
+		r.lock.Unlock()
+	}()
+}
+
+// Flush 同步上报最新的进度，镜像同步结束时调用
+func (r *progressReporter) Flush() {
+	r.lock.Lock()
+	progress := r.latest
+	r.lock.Unlock()
+
+	if progress.BytesTotal == 0 && progress.LayersTotal == 0 {
+		return
+	}
+	r.send(progress)
+}
+
+func (r *progressReporter) send(progress registry.Progress) {
+	if !r.p.Synced {
+		return
+	}
+
+	if err := r.p.httpClient.Put(fmt.Sprintf("%s/rainbow/tasks/%d/progress", r.p.Callback, r.p.TaskId), nil, map[string]interface{}{
+		"image_id":     r.img.Id,
+		"target":       r.target,
+		"bytes_done":   progress.BytesDone,
+		"bytes_total":  progress.BytesTotal,
+		"layers_done":  progress.LayersDone,
+		"layers_total": progress.LayersTotal,
+	}); err != nil {
+		klog.V(2).Infof("上报镜像 %s 同步进度失败 %v", r.target, err)
+	}
+}
+
+// readPullProgress 解析 docker pull 返回的进度流，按层汇总字节进度，拉取出错时返回错误
+func readPullProgress(reader io.Reader, report registry.ProgressFunc) error {
+	var (
+		totals  = make(map[string]int64)
+		current = make(map[string]int64)
+		layers  = make(map[string]bool)
+	)
+
+	decoder := json.NewDecoder(reader)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if len(msg.ID) == 0 {
+			continue
+		}
+
+		switch msg.Status {
+		case "Pulling fs layer", "Waiting":
+			layers[msg.ID] = false
+		case "Downloading":
+			if msg.Progress != nil {
+				totals[msg.ID] = msg.Progress.Total
+				current[msg.ID] = msg.Progress.Current
+			}
+		case "Download complete", "Pull complete", "Already exists":
+			layers[msg.ID] = true
+			current[msg.ID] = totals[msg.ID]
+		default:
+			continue
+		}
+
+		var progress registry.Progress
+		for id, done := range layers {
+			progress.LayersTotal++
+			if done {
+				progress.LayersDone++
+			}
+			progress.BytesTotal += totals[id]
+			progress.BytesDone += current[id]
+		}
+		report(progress)
+	}
+}
@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/cmd/app/config"
+	rainbowtypes "github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
+)
+
+const (
+	defaultRetries = 3
+	retryCap       = 30 * time.Second
+)
+
+var (
+	// retryDuration 首次重试前的等待时间
+	retryDuration = 2 * time.Second
+
+	// statusCodeRe 从 registry 客户端、skopeo 和 docker 的错误中提取 HTTP 状态码
+	statusCodeRe = regexp.MustCompile(`(?i)(?:状态码|status code|http status|status):?\s*(\d{3})`)
+
+	permanentPatterns = []string{
+		"manifest unknown", "name unknown", "blob unknown", "unauthorized", "authentication required",
+		"denied", "forbidden", "not found", "不存在", "不支持", "不合法", "invalid reference", "digest 校验失败",
+	}
+	retryablePatterns = []string{
+		"toomanyrequests", "too many requests", "rate limit", "timeout", "timed out", "deadline exceeded",
+		"connection reset", "connection refused", "broken pipe", "unexpected eof", "tls handshake",
+		"bad gateway", "service unavailable", "gateway timeout", "temporary failure", "try again",
+	}
+)
+
+// syncError 镜像同步失败的错误，Class 标识重新执行是否可能成功
+type syncError struct {
+	err     error
+	class   string
+	retries int
+}
+
+func (e *syncError) Error() string {
+	if e.retries == 0 {
+		return fmt.Sprintf("[%s] %v", e.class, e.err)
+	}
+	return fmt.Sprintf("[%s] 重试 %d 次后仍失败: %v", e.class, e.retries, e.err)
+}
+
+func (e *syncError) Unwrap() error {
+	return e.err
+}
+
+// classifyError 将错误分为可重试(限流、超时、5xx)和不可重试(manifest 不存在、认证失败等)，无法识别的错误按不可重试处理
+func classifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var regErr *registry.Error
+	if errors.As(err, &regErr) {
+		return classifyStatusCode(regErr.StatusCode)
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return rainbowtypes.SyncErrorRetryable
+	}
+
+	msg := strings.ToLower(err.Error())
+	if m := statusCodeRe.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		if code >= http.StatusBadRequest {
+			return classifyStatusCode(code)
+		}
+	}
+	for _, pattern := range permanentPatterns {
+		if strings.Contains(msg, pattern) {
+			return rainbowtypes.SyncErrorPermanent
+		}
+	}
+	for _, pattern := range retryablePatterns {
+		if strings.Contains(msg, pattern) {
+			return rainbowtypes.SyncErrorRetryable
+		}
+	}
+	klog.Warningf("无法识别的同步错误，按不可重试处理: %v", err)
+	return rainbowtypes.SyncErrorPermanent
+}
+
+func classifyStatusCode(code int) string {
+	if code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= http.StatusInternalServerError {
+		return rainbowtypes.SyncErrorRetryable
+	}
+	return rainbowtypes.SyncErrorPermanent
+}
+
+// newSyncError 为错误附加分类，已经分类的错误保持不变
+func newSyncError(err error) error {
+	var e *syncError
+	if errors.As(err, &e) {
+		return err
+	}
+	return &syncError{err: err, class: classifyError(err)}
+}
+
+// retryBackoff 指数退避并添加随机抖动，避免多个镜像同时重试再次触发限流
+func (p *PluginController) retryBackoff() wait.Backoff {
+	retries := p.Cfg.Plugin.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	}
+	if retries < 0 {
+		retries = 0
+	}
+	return wait.Backoff{
+		Duration: retryDuration,
+		Factor:   2,
+		Jitter:   0.5,
+		Steps:    retries,
+		Cap:      retryCap,
+	}
+}
+
+// copyWithRetry 同步镜像，可重试的错误按退避策略重试，最终失败时返回带分类的 syncError
+func (p *PluginController) copyWithRetry(imageToPush string, targetImage string, img config.Image) (*registry.CopyResult, error) {
+	backoff := p.retryBackoff()
+	for retries := 0; ; retries++ {
+		copyResult, err := p.sync(imageToPush, targetImage, img)
+		if err == nil {
+			return copyResult, nil
+		}
+
+		class := classifyError(err)
+		if class != rainbowtypes.SyncErrorRetryable || backoff.Steps == 0 {
+			return nil, &syncError{err: err, class: class, retries: retries}
+		}
+		delay := backoff.Step()
+		klog.Warningf("镜像 %s 同步失败 %v，%v 后进行第 %d 次重试", imageToPush, err, delay, retries+1)
+		p.CreateTaskMessage(fmt.Sprintf("镜像 %s 同步失败，%v 后进行第 %d 次重试，原因: %v", imageToPush, delay.Round(time.Second), retries+1, err))
+		time.Sleep(delay)
+	}
+}
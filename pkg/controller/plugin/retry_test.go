@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caoyingjunz/rainbow/cmd/app/config"
+	rainbowtypes "github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "nil", err: nil, want: ""},
+		{name: "registry 429", err: &registry.Error{StatusCode: http.StatusTooManyRequests}, want: rainbowtypes.SyncErrorRetryable},
+		{name: "registry 503", err: fmt.Errorf("copy: %w", &registry.Error{StatusCode: http.StatusServiceUnavailable}), want: rainbowtypes.SyncErrorRetryable},
+		{name: "registry 401", err: &registry.Error{StatusCode: http.StatusUnauthorized}, want: rainbowtypes.SyncErrorPermanent},
+		{name: "registry 404", err: &registry.Error{StatusCode: http.StatusNotFound}, want: rainbowtypes.SyncErrorPermanent},
+		{name: "context deadline", err: fmt.Errorf("pull: %w", context.DeadlineExceeded), want: rainbowtypes.SyncErrorRetryable},
+		{name: "net timeout", err: fmt.Errorf("dial: %w", timeoutError{}), want: rainbowtypes.SyncErrorRetryable},
+		{name: "status code in message", err: errors.New("failed to push image: received unexpected HTTP status: 502 Bad Gateway"), want: rainbowtypes.SyncErrorRetryable},
+		{name: "skopeo toomanyrequests", err: errors.New("reading manifest: toomanyrequests: You have reached your pull rate limit"), want: rainbowtypes.SyncErrorRetryable},
+		{name: "manifest unknown", err: errors.New("reading manifest v9.9: manifest unknown: MANIFEST_UNKNOWN"), want: rainbowtypes.SyncErrorPermanent},
+		{name: "unauthorized", err: errors.New("unauthorized: UNAUTHORIZED authentication required"), want: rainbowtypes.SyncErrorPermanent},
+		{name: "unknown error", err: errors.New("something unexpected happened"), want: rainbowtypes.SyncErrorPermanent},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := classifyError(tc.err); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCopyWithRetry(t *testing.T) {
+	defer func(d time.Duration) { retryDuration = d }(retryDuration)
+	retryDuration = time.Millisecond
+
+	tests := []struct {
+		name      string
+		status    int
+		body      string
+		wantClass string
+		// wantCalls 获取源镜像 manifest 的次数，首次请求加上重试次数
+		wantCalls int32
+	}{
+		{
+			name:      "permanent error is not retried",
+			status:    http.StatusNotFound,
+			body:      `{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`,
+			wantClass: rainbowtypes.SyncErrorPermanent,
+			wantCalls: 1,
+		},
+		{
+			name:      "unauthorized is not retried",
+			status:    http.StatusForbidden,
+			body:      `{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`,
+			wantClass: rainbowtypes.SyncErrorPermanent,
+			wantCalls: 1,
+		},
+		{
+			name:      "retryable error is retried until exhausted",
+			status:    http.StatusServiceUnavailable,
+			body:      `service unavailable`,
+			wantClass: rainbowtypes.SyncErrorRetryable,
+			wantCalls: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.Contains(r.URL.Path, "/manifests/") {
+					atomic.AddInt32(&calls, 1)
+				}
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+			host := strings.TrimPrefix(server.URL, "http://")
+
+			p := &PluginController{registry: registry.NewClient(registry.WithPlainHTTP(host))}
+			p.Cfg.Plugin.Driver = NativeDriver
+			p.Cfg.Plugin.Retries = 2
+
+			_, err := p.copyWithRetry(host+"/library/nginx:1.25", host+"/mirror/nginx:1.25", config.Image{})
+			var syncErr *syncError
+			if !errors.As(err, &syncErr) {
+				t.Fatalf("expected syncError, got %v", err)
+			}
+			if syncErr.class != tc.wantClass {
+				t.Errorf("expected class %s, got %s", tc.wantClass, syncErr.class)
+			}
+			if got := atomic.LoadInt32(&calls); got != tc.wantCalls {
+				t.Errorf("expected %d manifest requests, got %d", tc.wantCalls, got)
+			}
+		})
+	}
+}
@@ -8,9 +8,10 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apache/rocketmq-client-go/v2/consumer"
@@ -29,6 +30,7 @@ import (
 	"github.com/caoyingjunz/rainbow/pkg/types"
 	"github.com/caoyingjunz/rainbow/pkg/util"
 	"github.com/caoyingjunz/rainbow/pkg/util/errors"
+	"github.com/caoyingjunz/rainbow/pkg/util/naming"
 )
 
 type AgentGetter interface {
@@ -52,6 +54,11 @@ type AgentController struct {
 	callback string
 	baseDir  string
 	token    string
+
+	workers       int
+	activeWorkers int32
+	lastTaskError atomic.Value
+	activeTasks   sync.Map // 正在处理的任务，GC 时跳过对应的任务目录
 }
 
 func NewAgent(f db.ShareDaoFactory, cfg rainbowconfig.Config, redisClient *redis.Client) *AgentController {
@@ -116,6 +123,10 @@ func (s *AgentController) process(ctx context.Context, date []byte) error {
 		result, err = s.ProcessKubernetesTags(ctx, reqMeta.CallKubernetesTagRequest)
 	case types.CallSearchType:
 		result, err = s.ProcessSearch(ctx, reqMeta.CallSearchRequest)
+	case types.CallKubernetesComponentType:
+		result, err = s.ProcessKubernetesComponents(ctx, reqMeta.CallKubernetesComponentRequest)
+	case types.CallKubernetesAddonType:
+		result, err = s.ProcessKubernetesAddons(ctx, reqMeta.CallKubernetesAddonRequest)
 	default:
 		return fmt.Errorf("unsupported req call type %d", reqMeta.Type)
 	}
@@ -151,6 +162,7 @@ func (s *AgentController) Run(ctx context.Context, workers int) error {
 		return err
 	}
 
+	s.workers = workers
 	go s.startHeartbeat(ctx)
 	go s.getNextWorkItems(ctx)
 	go s.startSyncActionUsage(ctx)
@@ -204,53 +216,6 @@ func (s *AgentController) startSubscribe(ctx context.Context) {
 	}
 }
 
-func (s *AgentController) startGC(ctx context.Context) {
-	// 1小时尝试回收一次
-	ticker := time.NewTicker(900 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		if err := s.GarbageCollect(ctx); err != nil {
-			klog.Errorf("GarbageCollect 失败: %v", err)
-			continue
-		}
-		klog.Infof("GarbageCollect 完成")
-	}
-}
-
-func (s *AgentController) GarbageCollect(ctx context.Context) error {
-	entries, err := os.ReadDir(s.baseDir)
-	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
-	}
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-		if entry.Name() == "plugin" {
-			continue
-		}
-
-		fileInfo, err := entry.Info()
-		if err != nil {
-			klog.Errorf("获取文件夹(%s)信息失败 %v, 忽略", entry.Name(), err)
-			continue
-		}
-
-		// 回收指定时间的文件
-		now := time.Now()
-		if now.Sub(fileInfo.ModTime()) > 30*time.Minute {
-			removeDir := filepath.Join(s.baseDir, fileInfo.Name())
-			util.RemoveFile(removeDir)
-			klog.Infof("任务文件 %s 已被回收", removeDir)
-		} else {
-			klog.Infof("任务文件 %s 还在有效期内，暂不回收", fileInfo.Name())
-		}
-	}
-
-	return nil
-}
-
 func (s *AgentController) startSyncActionUsage(ctx context.Context) {
 	rand.Seed(time.Now().UnixNano())
 
@@ -323,7 +288,11 @@ func (s *AgentController) syncActionUsage(ctx context.Context, agent model.Agent
 	}
 
 	rounded := math.Round(grossAmount*1000) / 1000
-	klog.Infof("Agent(%s)当月截止目前已经使用 %d 美金", agent.Name, rounded)
+	klog.Infof("Agent(%s)当月截止目前已经使用 %.3f 美金", agent.Name, rounded)
+	// 按月记录开销历史，供 server 端进行预算检查
+	if err = s.recordMonthlyUsage(ctx, agent, rounded); err != nil {
+		klog.Errorf("记录 agent(%s) 月度开销失败 %v", agent.Name, err)
+	}
 	if agent.GrossAmount == rounded {
 		klog.Infof("agent(%s) 的 grossAmount 未发生变化，等待下一次同步", agent.Name)
 		return nil
@@ -332,6 +301,29 @@ func (s *AgentController) syncActionUsage(ctx context.Context, agent model.Agent
 	return s.factory.Agent().UpdateByName(ctx, agent.Name, map[string]interface{}{"gross_amount": rounded})
 }
 
+func (s *AgentController) recordMonthlyUsage(ctx context.Context, agent model.Agent, grossAmount float64) error {
+	month := time.Now().Format("2006-01")
+
+	usage, err := s.factory.Agent().GetUsage(ctx, db.WithAgent(agent.Name), db.WithGithubUser(agent.GithubUser), db.WithMonth(month))
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		_, err = s.factory.Agent().CreateUsage(ctx, &model.AgentUsage{
+			AgentName:   agent.Name,
+			GithubUser:  agent.GithubUser,
+			Month:       month,
+			GrossAmount: grossAmount,
+		})
+		return err
+	}
+	if usage.GrossAmount == grossAmount {
+		return nil
+	}
+
+	return s.factory.Agent().UpdateUsage(ctx, usage.Id, usage.ResourceVersion, map[string]interface{}{"gross_amount": grossAmount})
+}
+
 type UsageData struct {
 	UsageItems []UsageItem `json:"usageItems"`
 }
@@ -358,11 +350,22 @@ func (s *AgentController) startHeartbeat(ctx context.Context) {
 	for range ticker.C {
 		old, err := s.factory.Agent().GetByName(ctx, s.name)
 		if err != nil {
-			klog.Error("failed to get agent status %v", err)
+			klog.Errorf("failed to get agent status %v", err)
 			continue
 		}
 
-		updates := map[string]interface{}{"last_transition_time": time.Now()}
+		health := s.collectHealth(ctx)
+		updates := map[string]interface{}{
+			"last_transition_time": time.Now(),
+			"version":              health.Version,
+			"free_disk":            health.FreeDisk,
+			"queue_depth":          health.QueueDepth,
+			"active_workers":       health.ActiveWorkers,
+			"workers":              health.Workers,
+			"last_task_error":      health.LastTaskError,
+			"docker_healthy":       health.DockerHealthy,
+			"git_healthy":          health.GitHealthy,
+		}
 		if old.Status != model.UnRunAgentType {
 			if old.Status == model.UnknownAgentType {
 				updates["status"] = model.RunAgentType
@@ -371,10 +374,14 @@ func (s *AgentController) startHeartbeat(ctx context.Context) {
 		}
 
 		if err = s.factory.Agent().UpdateByName(ctx, s.name, updates); err != nil {
-			klog.Error("同步 agent(%s) 心跳失败%v", s.name, err)
+			klog.Errorf("同步 agent(%s) 心跳失败%v", s.name, err)
 		} else {
 			klog.V(2).Infof("同步 agent(%s) 心跳成功 %v", s.name, updates)
 		}
+		// 记录心跳时序，便于观察 agent 的资源变化趋势
+		if err = s.factory.Agent().CreateHeartbeat(ctx, &model.AgentHeartbeat{AgentName: s.name, AgentHealth: health}); err != nil {
+			klog.Errorf("记录 agent(%s) 心跳失败 %v", s.name, err)
+		}
 	}
 }
 
@@ -386,7 +393,7 @@ func (s *AgentController) getNextWorkItems(ctx context.Context) {
 		// 获取未处理
 		tasks, err := s.factory.Task().ListWithAgent(ctx, s.name, 0)
 		if err != nil {
-			klog.Error("failed to list tasks %v", err)
+			klog.Errorf("failed to list tasks %v", err)
 			continue
 		}
 		if len(tasks) == 0 {
@@ -420,7 +427,14 @@ func (s *AgentController) processNextWorkItem(ctx context.Context) bool {
 		if err = s.factory.Task().CreateTaskMessage(ctx, &model.TaskMessage{TaskId: taskId, Message: "节点调度完成"}); err != nil {
 			klog.Errorf("记录节点调度失败 %v", err)
 		}
-		if err = s.sync(ctx, taskId, resourceVersion); err != nil {
+		atomic.AddInt32(&s.activeWorkers, 1)
+		s.activeTasks.Store(taskId, struct{}{})
+		err = s.sync(ctx, taskId, resourceVersion)
+		s.activeTasks.Delete(taskId)
+		atomic.AddInt32(&s.activeWorkers, -1)
+		s.markTaskWorkspace(taskId, err)
+		if err != nil {
+			s.setLastTaskError(taskId, err)
 			if msgErr := s.factory.Task().CreateTaskMessage(ctx, &model.TaskMessage{TaskId: taskId, Message: fmt.Sprintf("同步失败，原因: %v", err)}); msgErr != nil {
 				klog.Errorf("记录同步失败 %v", msgErr)
 			}
@@ -462,27 +476,56 @@ func (s *AgentController) makePluginConfig(ctx context.Context, task model.Task)
 		registry, err = s.factory.Registry().Get(ctx, task.RegisterId)
 	}
 	if err != nil {
-		klog.Error("failed to get registry %v", err)
+		klog.Errorf("failed to get registry %v", err)
 		return nil, fmt.Errorf("failed to get registry %v", err)
 	}
 
+	rule := naming.Merge(naming.Rule{Name: task.NameTemplate, Tag: task.TagTemplate}, registryNamingRule(registry))
+	parallelImages, parallelLayers, bandwidth := transferOption(task, registry)
+	token, err := s.mintCallbackToken(ctx, taskId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mint callback token %v", err)
+	}
+
+	var stages []rainbowconfig.Stage
+	if len(task.Stages) != 0 {
+		if err = json.Unmarshal([]byte(task.Stages), &stages); err != nil {
+			return nil, fmt.Errorf("failed to parse task stages %v", err)
+		}
+	}
+
 	pluginTemplateConfig := &rainbowconfig.PluginTemplateConfig{
 		Default: rainbowconfig.DefaultOption{
 			Time: time.Now().Unix(), // 注入时间戳，确保每次内容都不相同
 		},
 		Plugin: rainbowconfig.PluginOption{
-			Callback:   s.callback,
-			TaskId:     taskId,
-			RegistryId: registry.Id,
-			Synced:     true,
-			Driver:     task.Driver,
-			Arch:       task.Architecture,
+			Callback:      s.callback,
+			TaskId:        taskId,
+			RegistryId:    registry.Id,
+			Synced:        true,
+			Driver:        task.Driver,
+			Arch:          task.Architecture,
+			Platforms:     util.TrimAndFilter(strings.Split(task.Platforms, ",")),
+			Signatures:    task.Signatures,
+			PublicKey:     task.PublicKey,
+			ArtifactKind:  task.ArtifactKind,
+			BatchCallback: true,
+			NameTemplate:  rule.Name,
+			TagTemplate:   rule.Tag,
+			Stages:        stages,
+			Token:         token,
+
+			ParallelImages: parallelImages,
+			ParallelLayers: parallelLayers,
+			BandwidthLimit: bandwidth,
+			Export:         task.ExportFormat,
 		},
 		Registry: rainbowconfig.Registry{
 			Repository: registry.Repository,
 			Namespace:  registry.Namespace,
 			Username:   registry.Username,
 			Password:   registry.Password,
+			Insecure:   registry.Insecure,
 		},
 	}
 
@@ -513,14 +556,15 @@ func (s *AgentController) makePluginConfig(ctx context.Context, task model.Task)
 		for _, tag := range tags {
 			name, ok := iNameMap[tag.ImageId]
 			if !ok {
-				klog.Warningf("未能找到镜像(%s)的名称，忽略", tag.ImageId)
+				klog.Warningf("未能找到镜像(%d)的名称，忽略", tag.ImageId)
 				continue
 			}
 			img = append(img, rainbowconfig.Image{
-				Name: name,
-				Id:   tag.ImageId,
-				Path: tag.Path,
-				Tags: []string{tag.Name},
+				Name:  name,
+				Id:    tag.ImageId,
+				Path:  tag.Path,
+				Tags:  []string{tag.Name},
+				Retag: makeRetag(tag),
 			})
 		}
 
@@ -529,6 +573,15 @@ func (s *AgentController) makePluginConfig(ctx context.Context, task model.Task)
 	case 1:
 		pluginTemplateConfig.Default.PushKubernetes = true
 		pluginTemplateConfig.Kubernetes.Version = task.KubernetesVersion
+		pluginTemplateConfig.Kubernetes.Components = s.kubernetesComponents(ctx, task.KubernetesVersion)
+		if len(task.Kubeadm) != 0 {
+			if pluginTemplateConfig.Kubernetes.Components, err = s.applyKubeadmProfile(task.Kubeadm, pluginTemplateConfig.Kubernetes.Components); err != nil {
+				return nil, err
+			}
+		}
+		if pluginTemplateConfig.Kubernetes.AddonImages, err = s.addonImages(ctx, task.Addons); err != nil {
+			return nil, fmt.Errorf("failed to expand task addons %v", err)
+		}
 	}
 
 	return pluginTemplateConfig, err
@@ -618,3 +671,11 @@ func KeyFunc(key interface{}) (int64, int64, error) {
 
 	return taskId, resourceVersion, nil
 }
+
+// makeRetag 版本按模板改写时，返回源版本到目标版本的映射
+func makeRetag(tag model.Tag) map[string]string {
+	if len(tag.MirrorTag) == 0 {
+		return nil
+	}
+	return map[string]string{tag.Name: tag.MirrorTag}
+}
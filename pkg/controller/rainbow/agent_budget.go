@@ -0,0 +1,249 @@
+package rainbow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/pkg/db"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util/errors"
+)
+
+func (s *ServerController) UpdateAgentBudget(ctx context.Context, req *types.UpdateAgentBudgetRequest) error {
+	if req.MonthlyBudget < 0 {
+		return fmt.Errorf("预算不能为负数")
+	}
+	return s.factory.Agent().UpdateByName(ctx, req.AgentName, map[string]interface{}{"monthly_budget": req.MonthlyBudget})
+}
+
+// ListAgentUsages 获取 agent 每月的开销历史，支持按 agent 过滤
+func (s *ServerController) ListAgentUsages(ctx context.Context, listOption types.ListOptions) (interface{}, error) {
+	return s.factory.Agent().ListUsages(ctx, db.WithAgent(listOption.Agent), db.WithOrderByDesc())
+}
+
+func (s *ServerController) CreateGithubAccount(ctx context.Context, req *types.CreateGithubAccountRequest) error {
+	repo := req.GithubRepository
+	if len(repo) == 0 {
+		repo = fmt.Sprintf("https://github.com/%s/plugin.git", req.GithubUser)
+	}
+
+	_, err := s.factory.Agent().CreateGithubAccount(ctx, &model.GithubAccount{
+		GithubUser:       req.GithubUser,
+		GithubEmail:      req.GithubEmail,
+		GithubRepository: repo,
+		GithubToken:      req.GithubToken,
+	})
+	return err
+}
+
+func (s *ServerController) DeleteGithubAccount(ctx context.Context, accountId int64) error {
+	return s.factory.Agent().DeleteGithubAccount(ctx, accountId)
+}
+
+func (s *ServerController) ListGithubAccounts(ctx context.Context, listOption types.ListOptions) (interface{}, error) {
+	return s.factory.Agent().ListGithubAccounts(ctx, db.WithAgent(listOption.Agent))
+}
+
+func (s *ServerController) getAgentBudget(agent model.Agent) float64 {
+	if agent.MonthlyBudget > 0 {
+		return agent.MonthlyBudget
+	}
+	return s.cfg.Rainbowd.Budget.MonthlyBudget
+}
+
+func (s *ServerController) startAgentBudgetController(ctx context.Context) {
+	klog.Infof("starting agent budget controller")
+
+	ticker := time.NewTicker(300 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		agents, err := s.factory.Agent().List(ctx)
+		if err != nil {
+			klog.Errorf("获取 agents 列表失败 %v，等待下一次检查", err)
+			continue
+		}
+
+		for _, agent := range agents {
+			if len(agent.GithubUser) == 0 {
+				continue
+			}
+			if err = s.syncAgentBudget(ctx, agent); err != nil {
+				klog.Errorf("检查 agent(%s) 预算失败 %v", agent.Name, err)
+			}
+		}
+	}
+}
+
+func (s *ServerController) syncAgentBudget(ctx context.Context, agent model.Agent) error {
+	month := time.Now().Format("2006-01")
+	usage, err := s.factory.Agent().GetUsage(ctx, db.WithAgent(agent.Name), db.WithGithubUser(agent.GithubUser), db.WithMonth(month))
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// 新的月份或者新的账号尚未产生开销，恢复因超出预算而停止调度的 agent
+			return s.resumeBudgetPausedAgent(ctx, agent)
+		}
+		return err
+	}
+	if usage.Exhausted {
+		// 达到上限时可能不存在备用账号，每次同步时重试切换，直到 agent 切换到新的账号
+		if !agent.BudgetPaused {
+			if err = s.pauseAgentBudget(ctx, agent.Name, true); err != nil {
+				return err
+			}
+		}
+		return s.swapAgentGithubAccount(ctx, agent, month, false)
+	}
+
+	budget := s.getAgentBudget(agent)
+	if budget <= 0 {
+		return s.resumeBudgetPausedAgent(ctx, agent)
+	}
+	percent := int(usage.GrossAmount * 100 / budget)
+
+	notified := nextBudgetThreshold(s.cfg.Rainbowd.Budget.Thresholds, percent, usage.Notified)
+
+	updates := map[string]interface{}{}
+	if usage.Budget != budget {
+		updates["budget"] = budget
+	}
+	if notified != usage.Notified {
+		updates["notified"] = notified
+		s.sendBudgetNotify(ctx, fmt.Sprintf("agent(%s) github 账号(%s) 本月开销 %.3f 美金，已达到预算(%.2f 美金)的 %d%%", agent.Name, agent.GithubUser, usage.GrossAmount, budget, notified))
+	}
+	if usage.GrossAmount >= budget {
+		updates["exhausted"] = true
+		updates["notified"] = 100
+	}
+	if len(updates) != 0 {
+		if err = s.factory.Agent().UpdateUsage(ctx, usage.Id, usage.ResourceVersion, updates); err != nil {
+			return err
+		}
+	}
+	if usage.GrossAmount < budget {
+		return s.resumeBudgetPausedAgent(ctx, agent)
+	}
+
+	// 达到预算上限，先停止调度，再尝试切换备用账号
+	klog.Warningf("agent(%s) 本月开销 %.3f 已达到预算 %.2f，停止调度", agent.Name, usage.GrossAmount, budget)
+	if err = s.pauseAgentBudget(ctx, agent.Name, true); err != nil {
+		return err
+	}
+	return s.swapAgentGithubAccount(ctx, agent, month, true)
+}
+
+// nextBudgetThreshold 返回开销比例已达到的最高告警阈值，notified 为本月已通知的阈值
+// 同一阈值每月仅通知一次，返回值与 notified 相同时无需通知，100% 由预算耗尽单独处理
+func nextBudgetThreshold(thresholds []int, percent int, notified int) int {
+	sorted := append([]int{}, thresholds...)
+	sort.Ints(sorted)
+	for _, threshold := range sorted {
+		if threshold >= 100 || percent < threshold || threshold <= notified {
+			continue
+		}
+		notified = threshold
+	}
+	return notified
+}
+
+// pauseAgentBudget 设置 agent 是否因预算耗尽停止调度，不影响人工设置的 unschedulable
+func (s *ServerController) pauseAgentBudget(ctx context.Context, agentName string, paused bool) error {
+	message := "Agent has been paused by budget"
+	if !paused {
+		message = "Agent has been resumed by budget"
+	}
+	return s.factory.Agent().UpdateByName(ctx, agentName, map[string]interface{}{"budget_paused": paused, "message": message})
+}
+
+// swapAgentGithubAccount 将 agent 切换到备用账号池中的空闲账号，notify 为 false 时表示重试，不再重复发送无备用账号的通知
+func (s *ServerController) swapAgentGithubAccount(ctx context.Context, agent model.Agent, month string, notify bool) error {
+	accounts, err := s.factory.Agent().ListGithubAccounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	var spare *model.GithubAccount
+	for i, account := range accounts {
+		if account.GithubUser == agent.GithubUser {
+			// 当前账号本月不再分配，并释放回账号池
+			if err = s.factory.Agent().UpdateGithubAccount(ctx, account.Id, account.ResourceVersion, map[string]interface{}{"agent_name": "", "exhausted_month": month}); err != nil {
+				klog.Errorf("释放 github 账号(%s)失败 %v", account.GithubUser, err)
+			}
+			continue
+		}
+		if spare == nil && len(account.AgentName) == 0 && account.ExhaustedMonth != month {
+			spare = &accounts[i]
+		}
+	}
+	if spare == nil {
+		if !notify {
+			klog.V(1).Infof("agent(%s) 仍不存在可用的备用账号，等待下一次检查", agent.Name)
+			return nil
+		}
+		s.sendBudgetNotify(ctx, fmt.Sprintf("agent(%s) github 账号(%s) 本月开销已达到预算上限，已停止调度，且不存在可用的备用账号", agent.Name, agent.GithubUser))
+		return nil
+	}
+
+	sshConfig, ok := s.sshConfigMap[agent.RainbowdName]
+	if !ok {
+		return fmt.Errorf("未加载 rainbow node(%s)", agent.RainbowdName)
+	}
+	if err = s.factory.Agent().UpdateGithubAccount(ctx, spare.Id, spare.ResourceVersion, map[string]interface{}{"agent_name": agent.Name}); err != nil {
+		return err
+	}
+	// 更新 github 属性之后重建 agent 容器，使新账号生效
+	if err = s.factory.Agent().UpdateByName(ctx, agent.Name, map[string]interface{}{
+		"github_user":       spare.GithubUser,
+		"github_email":      spare.GithubEmail,
+		"github_repository": spare.GithubRepository,
+		"github_token":      spare.GithubToken,
+		"gross_amount":      0,
+		"status":            model.UpgradeAgentType,
+		"message":           fmt.Sprintf("Agent github account has been swapped to %s", spare.GithubUser),
+	}); err != nil {
+		return err
+	}
+	newAgent, err := s.factory.Agent().GetByName(ctx, agent.Name)
+	if err != nil {
+		return err
+	}
+	if err = s.ReconcileAgent(ctx, &sshConfig, newAgent); err != nil {
+		s.sendBudgetNotify(ctx, fmt.Sprintf("agent(%s) 切换 github 账号(%s -> %s)失败 %v，已停止调度", agent.Name, agent.GithubUser, spare.GithubUser, err))
+		return err
+	}
+	if err = s.pauseAgentBudget(ctx, agent.Name, false); err != nil {
+		return err
+	}
+
+	s.sendBudgetNotify(ctx, fmt.Sprintf("agent(%s) github 账号(%s) 本月开销已达到预算上限，已自动切换至备用账号(%s)", agent.Name, agent.GithubUser, spare.GithubUser))
+	return nil
+}
+
+// resumeBudgetPausedAgent 当前账号的开销未达到预算上限(如进入新的月份)时，恢复因预算耗尽而停止调度的 agent
+func (s *ServerController) resumeBudgetPausedAgent(ctx context.Context, agent model.Agent) error {
+	if !agent.BudgetPaused {
+		return nil
+	}
+	if err := s.pauseAgentBudget(ctx, agent.Name, false); err != nil {
+		return err
+	}
+	s.sendBudgetNotify(ctx, fmt.Sprintf("agent(%s) github 账号(%s) 开销未达到预算上限，恢复调度", agent.Name, agent.GithubUser))
+	return nil
+}
+
+func (s *ServerController) sendBudgetNotify(ctx context.Context, content string) {
+	klog.Info(content)
+	if err := s.SendNotify(ctx, &types.SendNotificationRequest{
+		CreateNotificationRequest: types.CreateNotificationRequest{
+			Role: types.SystemNotifyRole,
+		},
+		Content: content,
+	}); err != nil {
+		klog.Errorf("发送 agent 预算通知失败 %v", err)
+	}
+}
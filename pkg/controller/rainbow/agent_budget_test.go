@@ -0,0 +1,156 @@
+package rainbow
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	rainbowconfig "github.com/caoyingjunz/rainbow/cmd/app/config"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+)
+
+func TestNextBudgetThreshold(t *testing.T) {
+	thresholds := []int{90, 50, 80}
+
+	tests := []struct {
+		name     string
+		percent  int
+		notified int
+		want     int
+	}{
+		{name: "below all thresholds", percent: 30, notified: 0, want: 0},
+		{name: "first threshold", percent: 55, notified: 0, want: 50},
+		{name: "already notified this month", percent: 60, notified: 50, want: 50},
+		{name: "skip to highest crossed threshold", percent: 95, notified: 50, want: 90},
+		{name: "new month notifies again", percent: 85, notified: 0, want: 80},
+		{name: "exhausted is not a threshold", percent: 120, notified: 90, want: 90},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextBudgetThreshold(thresholds, tc.percent, tc.notified); got != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got)
+			}
+		})
+	}
+	if !reflect.DeepEqual(thresholds, []int{90, 50, 80}) {
+		t.Errorf("thresholds should not be modified, got %v", thresholds)
+	}
+}
+
+func TestSyncAgentBudget(t *testing.T) {
+	agent := model.Agent{Name: "a1", RainbowdName: "node1", GithubUser: "u1"}
+	paused := agent
+	paused.BudgetPaused = true
+	accounts := []model.GithubAccount{{GithubUser: "u1", AgentName: "a1"}}
+
+	tests := []struct {
+		name  string
+		agent model.Agent
+		usage *model.AgentUsage
+		// 最后一次更新开销记录的内容，为空时表示不更新
+		wantUsage map[string]interface{}
+		// 依次设置的 budget_paused
+		wantPaused []bool
+		wantSent   int
+	}{
+		{
+			name:      "threshold notified",
+			agent:     agent,
+			usage:     &model.AgentUsage{GrossAmount: 5.5, Budget: 10},
+			wantUsage: map[string]interface{}{"notified": 50},
+			wantSent:  1,
+		},
+		{
+			name:  "threshold notified once per month",
+			agent: agent,
+			usage: &model.AgentUsage{GrossAmount: 6, Budget: 10, Notified: 50},
+		},
+		{
+			name:      "agent budget overrides default",
+			agent:     model.Agent{Name: "a1", GithubUser: "u1", MonthlyBudget: 20},
+			usage:     &model.AgentUsage{GrossAmount: 10, Budget: 10},
+			wantUsage: map[string]interface{}{"budget": float64(20), "notified": 50},
+			wantSent:  1,
+		},
+		{
+			name:       "exhausted pauses agent",
+			agent:      agent,
+			usage:      &model.AgentUsage{GrossAmount: 10.2, Budget: 10, Notified: 90},
+			wantUsage:  map[string]interface{}{"exhausted": true, "notified": 100},
+			wantPaused: []bool{true},
+			wantSent:   1,
+		},
+		{
+			name:       "exhausted usage pauses running agent",
+			agent:      agent,
+			usage:      &model.AgentUsage{GrossAmount: 10.2, Budget: 10, Notified: 100, Exhausted: true},
+			wantPaused: []bool{true},
+		},
+		{
+			name:  "exhausted and paused waits for spare account",
+			agent: paused,
+			usage: &model.AgentUsage{GrossAmount: 10.2, Budget: 10, Notified: 100, Exhausted: true},
+		},
+		{
+			name:       "new month resumes paused agent",
+			agent:      paused,
+			wantPaused: []bool{false},
+			wantSent:   1,
+		},
+		{
+			name:  "new month keeps running agent",
+			agent: agent,
+		},
+		{
+			name:       "under budget resumes paused agent",
+			agent:      paused,
+			usage:      &model.AgentUsage{GrossAmount: 2, Budget: 10},
+			wantPaused: []bool{false},
+			wantSent:   1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := newFakeAgentDao(tc.agent)
+			dao.usage = tc.usage
+			dao.accounts = accounts
+			notify := &fakeNotifyDao{}
+			s := &ServerController{
+				factory: &fakeFactory{agent: dao, notify: notify},
+				cfg: rainbowconfig.Config{Rainbowd: rainbowconfig.RainbowdOption{
+					Budget: rainbowconfig.BudgetOption{MonthlyBudget: 10, Thresholds: []int{50, 80, 90}},
+				}},
+			}
+			if err := s.syncAgentBudget(context.TODO(), tc.agent); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tc.wantUsage == nil {
+				if len(dao.usageUpdates) != 0 {
+					t.Errorf("expected no usage update, got %v", dao.usageUpdates)
+				}
+			} else if len(dao.usageUpdates) == 0 {
+				t.Errorf("expected usage update %v, got none", tc.wantUsage)
+			} else if last := dao.usageUpdates[len(dao.usageUpdates)-1]; !reflect.DeepEqual(last, tc.wantUsage) {
+				t.Errorf("expected usage update %v, got %v", tc.wantUsage, last)
+			}
+
+			var gotPaused []bool
+			for _, updates := range dao.agentUpdates {
+				if value, ok := updates["budget_paused"]; ok {
+					gotPaused = append(gotPaused, value.(bool))
+				}
+			}
+			if len(gotPaused) != 0 || len(tc.wantPaused) != 0 {
+				if !reflect.DeepEqual(gotPaused, tc.wantPaused) {
+					t.Errorf("expected budget_paused %v, got %v", tc.wantPaused, gotPaused)
+				}
+			}
+			if notify.sent != tc.wantSent {
+				t.Errorf("expected %d notifications, got %d", tc.wantSent, notify.sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package rainbow
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/klog/v2"
+
+	rainbowconfig "github.com/caoyingjunz/rainbow/cmd/app/config"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util/sshutil"
+)
+
+const (
+	defaultAgentLogTail = 200
+	maxAgentLogTail     = 5000
+)
+
+// since 会拼接到远程命令中，仅允许 docker logs 支持的时间格式字符
+var agentLogSinceRegex = regexp.MustCompile(`^[0-9A-Za-z:.+\-]+$`)
+
+// GetAgentLogs 通过 ssh 获取 agent 容器日志
+func (s *ServerController) GetAgentLogs(ctx context.Context, req *types.GetAgentLogsRequest) (interface{}, error) {
+	if req.Tail <= 0 {
+		req.Tail = defaultAgentLogTail
+	}
+	if req.Tail > maxAgentLogTail {
+		req.Tail = maxAgentLogTail
+	}
+	if len(req.Since) != 0 && !agentLogSinceRegex.MatchString(req.Since) {
+		return nil, fmt.Errorf("不合法的 since 参数 %s", req.Since)
+	}
+
+	agent, err := s.factory.Agent().Get(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+	sshConfig, ok := s.sshConfigMap[agent.RainbowdName]
+	if !ok {
+		return nil, fmt.Errorf("未加载 rainbow node(%s)", agent.RainbowdName)
+	}
+	sshClient, err := sshutil.NewSSHClient(&sshConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer sshClient.Close()
+
+	cmd := fmt.Sprintf("docker logs --tail %d", req.Tail)
+	if len(req.Since) != 0 {
+		cmd = fmt.Sprintf("%s --since %s", cmd, req.Since)
+	}
+	cmd = fmt.Sprintf("%s %s", cmd, agent.Name)
+	klog.V(1).Infof("cmd %s 即将被执行", cmd)
+
+	result, err := sshClient.RunCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("docker 命令执行失败: %s", result.Stderr)
+	}
+
+	// agent 日志输出到 stderr，合并后返回
+	return result.Stdout + result.Stderr, nil
+}
+
+// DiagnoseAgent 对 agent 执行一组固定检查，返回结构化的诊断报告
+func (s *ServerController) DiagnoseAgent(ctx context.Context, agentId int64) (interface{}, error) {
+	agent, err := s.factory.Agent().Get(ctx, agentId)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &types.AgentDiagnosis{AgentName: agent.Name, Healthy: true}
+	addCheck := func(name string, passed bool, message string) {
+		report.Checks = append(report.Checks, types.AgentDiagnosisCheck{Name: name, Passed: passed, Message: message})
+		if !passed {
+			report.Healthy = false
+		}
+	}
+
+	// 心跳
+	since := time.Since(agent.LastTransitionTime).Round(time.Second)
+	addCheck("heartbeat", since <= 5*time.Minute, fmt.Sprintf("状态 %s, 最近一次心跳在 %v 之前", agent.Status, since))
+
+	sshConfig, ok := s.sshConfigMap[agent.RainbowdName]
+	if !ok {
+		addCheck("rainbowd", false, fmt.Sprintf("未加载 rainbow node(%s)", agent.RainbowdName))
+		return report, nil
+	}
+	sshClient, err := sshutil.NewSSHClient(&sshConfig)
+	if err != nil {
+		addCheck("rainbowd", false, fmt.Sprintf("连接 rainbow node(%s) 失败 %v", agent.RainbowdName, err))
+		return report, nil
+	}
+	defer sshClient.Close()
+	addCheck("rainbowd", true, fmt.Sprintf("rainbow node(%s) 连接正常", agent.RainbowdName))
+
+	running := s.diagnoseAgentContainer(&sshConfig, agent, addCheck)
+	s.diagnoseAgentConfig(sshClient, agent, addCheck)
+	s.diagnoseAgentDisk(sshClient, agent, addCheck)
+	if running {
+		s.diagnoseAgentGitRemote(sshClient, agent, addCheck)
+	} else {
+		addCheck("git_remote", false, "agent 容器未运行，跳过检查")
+	}
+
+	return report, nil
+}
+
+func (s *ServerController) diagnoseAgentContainer(sshConfig *sshutil.SSHConfig, agent *model.Agent, addCheck func(string, bool, string)) bool {
+	container, err := s.GetAgentContainer(sshConfig, agent.Name)
+	if err != nil {
+		addCheck("container", false, fmt.Sprintf("获取 agent 容器失败 %v", err))
+		return false
+	}
+	if container == nil {
+		addCheck("container", false, "agent 容器不存在")
+		return false
+	}
+
+	running := container.State == "running"
+	addCheck("container", running, fmt.Sprintf("镜像 %s, 状态 %s", container.Image, container.Status))
+	return running
+}
+
+func (s *ServerController) diagnoseAgentConfig(sshClient *sshutil.SSHClient, agent *model.Agent, addCheck func(string, bool, string)) {
+	cfgFile := filepath.Join(s.cfg.Rainbowd.DataDir, agent.Name, "config.yaml")
+	result, err := sshClient.RunCommand(fmt.Sprintf("cat %s", cfgFile))
+	if err != nil || result.ExitCode != 0 {
+		addCheck("config", false, fmt.Sprintf("读取配置文件 %s 失败 %s", cfgFile, resultError(result, err)))
+		return
+	}
+
+	var cfg rainbowconfig.Config
+	if err = yaml.Unmarshal([]byte(result.Stdout), &cfg); err != nil {
+		addCheck("config", false, fmt.Sprintf("解析配置文件 %s 失败 %v", cfgFile, err))
+		return
+	}
+	if cfg.Agent.Name != agent.Name {
+		addCheck("config", false, fmt.Sprintf("配置文件中的 agent 名称(%s)与 agent(%s)不一致", cfg.Agent.Name, agent.Name))
+		return
+	}
+	if len(cfg.Mysql.Host) == 0 {
+		addCheck("config", false, "配置文件缺少 mysql 配置")
+		return
+	}
+	addCheck("config", true, fmt.Sprintf("配置文件 %s 校验通过", cfgFile))
+}
+
+func (s *ServerController) diagnoseAgentDisk(sshClient *sshutil.SSHClient, agent *model.Agent, addCheck func(string, bool, string)) {
+	dataDir := filepath.Join(s.cfg.Rainbowd.DataDir, agent.Name)
+	result, err := sshClient.RunCommand(fmt.Sprintf("df -P -B1 %s", dataDir))
+	if err != nil || result.ExitCode != 0 {
+		addCheck("disk", false, fmt.Sprintf("获取 %s 磁盘空间失败 %s", dataDir, resultError(result, err)))
+		return
+	}
+
+	// Filesystem 1-blocks Used Available Capacity Mounted on
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		addCheck("disk", false, fmt.Sprintf("无法解析 df 输出 %s", result.Stdout))
+		return
+	}
+	free, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		addCheck("disk", false, fmt.Sprintf("无法解析 df 输出 %s", result.Stdout))
+		return
+	}
+	addCheck("disk", free >= minAgentFreeDisk, fmt.Sprintf("%s 剩余空间 %d MiB", dataDir, free>>20))
+}
+
+func (s *ServerController) diagnoseAgentGitRemote(sshClient *sshutil.SSHClient, agent *model.Agent, addCheck func(string, bool, string)) {
+	cmd := fmt.Sprintf("docker exec -w /data/plugin %s timeout 30 git ls-remote --heads origin", agent.Name)
+	result, err := sshClient.RunCommand(cmd)
+	if err != nil || result.ExitCode != 0 {
+		// 错误信息中可能包含 token，返回前先脱敏
+		message := resultError(result, err)
+		if len(agent.GithubToken) != 0 {
+			message = strings.ReplaceAll(message, agent.GithubToken, "******")
+		}
+		addCheck("git_remote", false, fmt.Sprintf("访问 github 仓库(%s)失败 %s", agent.GithubRepository, message))
+		return
+	}
+
+	heads := len(strings.Split(strings.TrimSpace(result.Stdout), "\n"))
+	addCheck("git_remote", true, fmt.Sprintf("github 仓库(%s)访问正常, 共 %d 个分支", agent.GithubRepository, heads))
+}
+
+// resultError 返回远程命令的失败原因
+func resultError(result *sshutil.CommandResult, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(result.Stderr)
+}
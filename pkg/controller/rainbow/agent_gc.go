@@ -0,0 +1,318 @@
+package rainbow
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/pkg/db"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util"
+)
+
+// failedTaskMarker 任务在 agent 本地处理失败时写入任务目录的标记文件
+const failedTaskMarker = ".failed"
+
+// taskWorkspace agent 本地的任务目录
+type taskWorkspace struct {
+	taskId  int64
+	path    string
+	modTime time.Time
+	size    int64
+	failed  bool
+}
+
+func (s *AgentController) startGC(ctx context.Context) {
+	// 15分钟尝试回收一次
+	ticker := time.NewTicker(900 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.GarbageCollect(ctx); err != nil {
+			klog.Errorf("GarbageCollect 失败: %v", err)
+			continue
+		}
+		klog.Infof("GarbageCollect 完成")
+	}
+}
+
+// GarbageCollect 按照回收策略清理任务目录
+// 1. 正在处理或者等待处理的任务目录不回收
+// 2. 超过保留天数的任务目录回收，失败任务使用更长的保留天数，便于排查
+// 3. 任务目录总大小超过磁盘预算时，从最旧的成功任务开始回收
+// 4. 清理基础仓库和保留的任务目录中 plugin 仓库的过期任务分支
+func (s *AgentController) GarbageCollect(ctx context.Context) error {
+	workspaces, err := s.listTaskWorkspaces(ctx)
+	if err != nil {
+		return err
+	}
+	active, err := s.listActiveTasks(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	retain := time.Duration(s.cfg.Agent.RetainDays) * 24 * time.Hour
+	failedRetain := time.Duration(s.cfg.Agent.FailedRetainDays) * 24 * time.Hour
+
+	var (
+		remains []taskWorkspace
+		total   int64
+	)
+	for _, ws := range workspaces {
+		if active[ws.taskId] {
+			klog.V(1).Infof("任务文件 %s 正在使用中，暂不回收", ws.path)
+			continue
+		}
+
+		expired := now.Sub(ws.modTime) > retain
+		if ws.failed {
+			expired = now.Sub(ws.modTime) > failedRetain
+		}
+		if expired {
+			util.RemoveFile(ws.path)
+			klog.Infof("任务文件 %s 已超过保留时间，已被回收", ws.path)
+			continue
+		}
+
+		remains = append(remains, ws)
+		total += ws.size
+	}
+
+	// 超出磁盘预算时，优先回收成功的任务，再按照时间从旧到新回收
+	kept := remains
+	budget := int64(s.cfg.Agent.DiskBudget) << 20
+	if budget > 0 && total > budget {
+		sort.Slice(remains, func(i, j int) bool {
+			if remains[i].failed != remains[j].failed {
+				return !remains[i].failed
+			}
+			return remains[i].modTime.Before(remains[j].modTime)
+		})
+		kept = nil
+		for _, ws := range remains {
+			if total <= budget {
+				kept = append(kept, ws)
+				continue
+			}
+			util.RemoveFile(ws.path)
+			total -= ws.size
+			klog.Infof("任务文件总大小超过磁盘预算(%d MiB)，任务文件 %s 已被回收", s.cfg.Agent.DiskBudget, ws.path)
+		}
+	}
+
+	s.pruneGitBranches(kept, active)
+	return nil
+}
+
+// listTaskWorkspaces 获取 DataDir 下的全部任务目录
+func (s *AgentController) listTaskWorkspaces(ctx context.Context) ([]taskWorkspace, error) {
+	entries, err := os.ReadDir(s.baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var (
+		workspaces []taskWorkspace
+		taskIds    []int64
+	)
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "plugin" {
+			continue
+		}
+		// 任务目录以任务 ID 命名
+		taskId, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		fileInfo, err := entry.Info()
+		if err != nil {
+			klog.Errorf("获取文件夹(%s)信息失败 %v, 忽略", entry.Name(), err)
+			continue
+		}
+
+		path := filepath.Join(s.baseDir, entry.Name())
+		workspaces = append(workspaces, taskWorkspace{
+			taskId:  taskId,
+			path:    path,
+			modTime: fileInfo.ModTime(),
+			size:    dirSize(path),
+			failed:  util.IsFileExists(filepath.Join(path, failedTaskMarker)),
+		})
+		taskIds = append(taskIds, taskId)
+	}
+	if len(taskIds) == 0 {
+		return workspaces, nil
+	}
+
+	// 结合任务的最终状态和镜像的同步结果判断是否失败
+	tasks, err := s.factory.Task().List(ctx, db.WithIDIn(taskIds...))
+	if err != nil {
+		klog.Errorf("获取任务列表失败 %v, 仅根据本地标记判断失败任务", err)
+		return workspaces, nil
+	}
+	failed := make(map[int64]bool)
+	for _, task := range tasks {
+		switch task.Process {
+		case 3:
+			failed[task.Id] = true
+		case 2:
+			// 部分镜像同步失败时任务仍会正常结束，需要检查任务的版本状态
+			hasFailed, err := s.taskHasFailedImages(ctx, task.Id)
+			if err != nil {
+				klog.Errorf("获取任务(%d)的版本失败 %v, 仅根据本地标记判断", task.Id, err)
+				continue
+			}
+			failed[task.Id] = hasFailed
+		}
+	}
+	for i := range workspaces {
+		if failed[workspaces[i].taskId] {
+			workspaces[i].failed = true
+		}
+	}
+
+	return workspaces, nil
+}
+
+// taskHasFailedImages 任务中存在同步失败的版本时返回 true
+func (s *AgentController) taskHasFailedImages(ctx context.Context, taskId int64) (bool, error) {
+	tags, err := s.factory.Image().ListTags(ctx, db.WithTaskLike(taskId), db.WithStatusIn(types.SyncImageError))
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range tags {
+		if tagInTask(tag.TaskIds, taskId) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// tagInTask 版本关联的任务 ID 以逗号分隔，按 like 查询时可能匹配到其他任务，需要精确判断
+func tagInTask(taskIds string, taskId int64) bool {
+	id := strconv.FormatInt(taskId, 10)
+	for _, s := range strings.Split(taskIds, ",") {
+		if strings.TrimSpace(s) == id {
+			return true
+		}
+	}
+	return false
+}
+
+// listActiveTasks 获取正在处理和等待处理的任务
+func (s *AgentController) listActiveTasks(ctx context.Context) (map[int64]bool, error) {
+	active := make(map[int64]bool)
+	s.activeTasks.Range(func(key, value interface{}) bool {
+		active[key.(int64)] = true
+		return true
+	})
+
+	for _, process := range []int{0, 1} {
+		tasks, err := s.factory.Task().ListWithAgent(ctx, s.name, process)
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			active[task.Id] = true
+		}
+	}
+
+	return active, nil
+}
+
+// pruneGitBranches 清理 plugin 仓库中过期的任务分支
+// 任务分支创建在各任务目录的 plugin 仓库中，因此除基础仓库外，还需要清理保留下来的任务目录中的仓库
+// 正在处理的任务目录不在 workspaces 中，git 命令失败时仅记录日志，不影响本次回收
+func (s *AgentController) pruneGitBranches(workspaces []taskWorkspace, active map[int64]bool) {
+	baseRepo := filepath.Join(s.baseDir, "plugin")
+	s.pruneRepoBranches(baseRepo, 0, active)
+	for _, ws := range workspaces {
+		s.pruneRepoBranches(filepath.Join(ws.path, "plugin"), ws.taskId, active)
+	}
+
+	if !util.IsDirectoryExists(baseRepo) {
+		return
+	}
+	// 清理远程已删除分支的跟踪引用，需要访问网络，失败时等待下一次回收
+	if err := util.NewGit(baseRepo, "", "").PruneRemote(); err != nil {
+		klog.Warningf("清理 %s 的远程跟踪分支失败 %v", baseRepo, err)
+	}
+}
+
+// pruneRepoBranches 删除仓库中以任务 ID 命名、且不属于当前仓库所在任务和正在处理任务的本地分支
+func (s *AgentController) pruneRepoBranches(repoDir string, owner int64, active map[int64]bool) {
+	if !util.IsDirectoryExists(repoDir) {
+		return
+	}
+
+	git := util.NewGit(repoDir, "", "")
+	branches, err := git.LocalBranches()
+	if err != nil {
+		klog.Warningf("获取 %s 的本地分支失败 %v", repoDir, err)
+		return
+	}
+	current, err := git.CurrentBranch()
+	if err != nil {
+		klog.Warningf("获取 %s 的当前分支失败 %v", repoDir, err)
+		return
+	}
+	for _, branch := range branches {
+		branch = strings.TrimSpace(strings.TrimPrefix(branch, "*"))
+		if branch == current {
+			continue
+		}
+		// 仅处理以任务 ID 命名的分支
+		taskId, err := strconv.ParseInt(branch, 10, 64)
+		if err != nil || taskId == owner || active[taskId] {
+			continue
+		}
+		if err = git.DeleteBranch(branch); err != nil {
+			klog.Warningf("删除 %s 的本地分支 %s 失败 %v", repoDir, branch, err)
+			continue
+		}
+		klog.Infof("%s 的本地分支 %s 已被清理", repoDir, branch)
+	}
+}
+
+// markTaskWorkspace 标记任务目录的本地处理结果，失败的任务目录保留更长时间
+func (s *AgentController) markTaskWorkspace(taskId int64, err error) {
+	taskDir := filepath.Join(s.baseDir, strconv.FormatInt(taskId, 10))
+	if !util.IsDirectoryExists(taskDir) {
+		return
+	}
+
+	marker := filepath.Join(taskDir, failedTaskMarker)
+	if err == nil {
+		util.RemoveFile(marker)
+		return
+	}
+	if writeErr := util.WriteIntoFile(err.Error(), marker); writeErr != nil {
+		klog.Errorf("标记任务目录 %s 失败 %v", taskDir, writeErr)
+	}
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,25 @@
+package rainbow
+
+import "testing"
+
+func TestTagInTask(t *testing.T) {
+	tests := []struct {
+		taskIds string
+		taskId  int64
+		want    bool
+	}{
+		{taskIds: "12", taskId: 12, want: true},
+		{taskIds: "3,12,40", taskId: 12, want: true},
+		{taskIds: "3, 12", taskId: 12, want: true},
+		{taskIds: "112,120", taskId: 12, want: false},
+		{taskIds: "", taskId: 12, want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.taskIds, func(t *testing.T) {
+			if got := tagInTask(tc.taskIds, tc.taskId); got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package rainbow
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/pkg/db"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+)
+
+// Version agent 版本，由 build.sh 构建时通过 -ldflags "-X github.com/caoyingjunz/rainbow/pkg/controller/rainbow.Version=xxx" 注入
+var Version = "unknown"
+
+// collectHealth 采集 agent 的资源和健康状态，随心跳一起上报
+func (s *AgentController) collectHealth(ctx context.Context) model.AgentHealth {
+	health := model.AgentHealth{
+		Version:       Version,
+		QueueDepth:    s.queue.Len(),
+		ActiveWorkers: int(atomic.LoadInt32(&s.activeWorkers)),
+		Workers:       s.workers,
+		DockerHealthy: s.isCommandHealthy("docker", "version", "--format", "{{.Server.Version}}"),
+		GitHealthy:    s.isCommandHealthy("git", "--version"),
+	}
+	if lastErr, ok := s.lastTaskError.Load().(string); ok {
+		health.LastTaskError = lastErr
+	}
+
+	freeDisk, err := s.getFreeDisk(s.baseDir)
+	if err != nil {
+		klog.Warningf("获取 %s 剩余磁盘空间失败 %v", s.baseDir, err)
+	}
+	health.FreeDisk = freeDisk
+
+	return health
+}
+
+func (s *AgentController) isCommandHealthy(cmd string, args ...string) bool {
+	if _, err := s.exec.Command(cmd, args...).CombinedOutput(); err != nil {
+		klog.V(1).Infof("agent 本地工具 %s 不可用 %v", cmd, err)
+		return false
+	}
+	return true
+}
+
+// unknownFreeDisk 无法获取剩余磁盘空间时上报的值，server 不据此判断 agent 异常
+const unknownFreeDisk = -1
+
+// getFreeDisk 获取指定目录所在磁盘的剩余空间，单位字节，获取失败时返回 unknownFreeDisk
+func (s *AgentController) getFreeDisk(dir string) (int64, error) {
+	out, err := s.exec.Command("df", "-P", "-B1", dir).CombinedOutput()
+	if err != nil {
+		return unknownFreeDisk, err
+	}
+
+	// Filesystem 1-blocks Used Available Capacity Mounted on
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 4 {
+		return unknownFreeDisk, fmt.Errorf("无法解析 df 输出 %s", string(out))
+	}
+	freeDisk, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return unknownFreeDisk, err
+	}
+	return freeDisk, nil
+}
+
+func (s *AgentController) setLastTaskError(taskId int64, err error) {
+	s.lastTaskError.Store(fmt.Sprintf("任务(%d): %v", taskId, err))
+}
+
+// minAgentFreeDisk agent DataDir 剩余空间低于该值时视为异常
+const minAgentFreeDisk = 1 << 30
+
+// isAgentDegraded 根据最近一次心跳判断 agent 是否处于异常状态，未上报健康信息的旧版本 agent 视为正常
+func isAgentDegraded(agent model.Agent) bool {
+	if len(agent.Version) == 0 {
+		return false
+	}
+	if !agent.GitHealthy || !agent.DockerHealthy {
+		return true
+	}
+	// 剩余空间未知时不作为异常判断依据
+	return agent.FreeDisk >= 0 && agent.FreeDisk < minAgentFreeDisk
+}
+
+func filterHealthyAgents(agents []model.Agent) []model.Agent {
+	var healthy []model.Agent
+	for _, agent := range agents {
+		if isAgentDegraded(agent) {
+			klog.Warningf("agent(%s) 状态异常(git: %v, docker: %v, 剩余磁盘: %d)，暂不调度", agent.Name, agent.GitHealthy, agent.DockerHealthy, agent.FreeDisk)
+			continue
+		}
+		healthy = append(healthy, agent)
+	}
+	return healthy
+}
+
+// ListAgentHeartbeats 获取 agent 心跳时序，默认返回最近 1 小时
+func (s *ServerController) ListAgentHeartbeats(ctx context.Context, listOption types.ListOptions) (interface{}, error) {
+	if len(listOption.Agent) == 0 {
+		return nil, fmt.Errorf("agent 不能为空")
+	}
+	return s.factory.Agent().ListHeartbeats(ctx,
+		db.WithAgent(listOption.Agent),
+		db.WithCreatedAfter(time.Now().Add(-time.Hour)),
+		db.WithCreateOrderByASC(),
+	)
+}
@@ -3,6 +3,7 @@ package rainbow
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/caoyingjunz/rainbow/pkg/types"
 	"github.com/caoyingjunz/rainbow/pkg/util"
+	"github.com/caoyingjunz/rainbow/pkg/util/kubeadm"
 )
 
 func (s *AgentController) ProcessGithub(ctx context.Context, req *types.CallGithubRequest) ([]byte, error) {
@@ -140,6 +142,29 @@ func (s *AgentController) ProcessKubernetesTags(ctx context.Context, req *types.
 	return allData, nil
 }
 
+// ProcessKubernetesComponents 从 kubeadm 源码中解析各 kubernetes 版本的组件版本，单个版本失败时跳过
+func (s *AgentController) ProcessKubernetesComponents(ctx context.Context, req *types.CallKubernetesComponentRequest) ([]byte, error) {
+	var components []kubeadm.Components
+	for _, v := range req.Versions {
+		c, err := fetchKubernetesComponents(v)
+		if err != nil {
+			klog.Errorf("获取 kubernetes(%s) 组件版本失败 %v", v, err)
+			continue
+		}
+		components = append(components, *c)
+	}
+
+	return json.Marshal(components)
+}
+
+func fetchKubernetesComponents(version string) (*kubeadm.Components, error) {
+	data, err := DoHttpRequest(fmt.Sprintf(kubeadm.ConstantsURL, version))
+	if err != nil {
+		return nil, err
+	}
+	return kubeadm.ParseConstants(version, data)
+}
+
 func appendData(allData, newData []byte) []byte {
 	// 情况1: 原始二进制直接拼接
 	// return append(allData, newData...)
@@ -0,0 +1,507 @@
+package rainbow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/pkg/db"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util"
+	"github.com/caoyingjunz/rainbow/pkg/util/uuid"
+)
+
+const (
+	defaultRolloutCanaryCount    = 1
+	defaultRolloutMaxUnavailable = 1
+	defaultRolloutHealthTimeout  = 300 // 单位秒，agent 心跳间隔为 60s
+)
+
+func (s *ServerController) preCreateAgentRollout(ctx context.Context, req *types.CreateAgentRolloutRequest) error {
+	switch req.Type {
+	case model.BinaryRolloutType:
+		binary, err := resolveRolloutBinary(s.cfg.Rainbowd.TemplateDir, req.Binary)
+		if err != nil {
+			return err
+		}
+		req.Binary = binary
+		if !util.IsFileExists(req.Binary) {
+			return fmt.Errorf("agent 二进制文件(%s)不存在", req.Binary)
+		}
+	case model.ImageRolloutType:
+		if len(req.AgentImage) == 0 {
+			return fmt.Errorf("agent 镜像不能为空")
+		}
+	default:
+		return fmt.Errorf("unsupported rollout type %s", req.Type)
+	}
+
+	// 同一时间仅允许一个升级任务
+	actives, err := s.factory.Agent().CountRollouts(ctx, db.WithStatusIn(getActiveRolloutStatus()...))
+	if err != nil {
+		return err
+	}
+	if actives != 0 {
+		return fmt.Errorf("存在未结束的 agent 升级任务，请稍后再试")
+	}
+
+	if len(req.Agents) == 0 {
+		agents, err := s.factory.Agent().List(ctx, db.WithStatus(model.RunAgentType))
+		if err != nil {
+			return err
+		}
+		for _, agent := range agents {
+			req.Agents = append(req.Agents, agent.Name)
+		}
+	}
+	req.Agents = util.TrimAndFilter(req.Agents)
+	if len(req.Agents) == 0 {
+		return fmt.Errorf("不存在可升级的 agent")
+	}
+	for _, agentName := range req.Agents {
+		agent, err := s.factory.Agent().GetByName(ctx, agentName)
+		if err != nil {
+			return fmt.Errorf("获取 agent(%s) 失败 %v", agentName, err)
+		}
+		if agent.Status != model.RunAgentType {
+			return fmt.Errorf("agent(%s)状态为(%s), 仅支持升级在线的 agent", agentName, agent.Status)
+		}
+		if _, ok := s.sshConfigMap[agent.RainbowdName]; !ok {
+			return fmt.Errorf("未加载 rainbow node(%s)", agent.RainbowdName)
+		}
+	}
+
+	if req.CanaryCount <= 0 {
+		req.CanaryCount = defaultRolloutCanaryCount
+	}
+	if req.MaxUnavailable <= 0 {
+		req.MaxUnavailable = defaultRolloutMaxUnavailable
+	}
+	if req.HealthTimeout <= 0 {
+		req.HealthTimeout = defaultRolloutHealthTimeout
+	}
+	return nil
+}
+
+// CreateAgentRollout 创建 agent 分批滚动升级，先升级灰度 agent，心跳正常后再分批升级剩余 agent
+func (s *ServerController) CreateAgentRollout(ctx context.Context, req *types.CreateAgentRolloutRequest) error {
+	if err := s.preCreateAgentRollout(ctx, req); err != nil {
+		klog.Errorf("创建 agent 升级前置检查失败: %v", err)
+		return err
+	}
+	if len(strings.TrimSpace(req.Name)) == 0 {
+		req.Name = uuid.NewRandName("rollout-", 8)
+	}
+
+	object, err := s.factory.Agent().CreateRollout(ctx, &model.AgentRollout{
+		Name:           req.Name,
+		Type:           req.Type,
+		Binary:         req.Binary,
+		AgentImage:     req.AgentImage,
+		Agents:         strings.Join(req.Agents, ","),
+		CanaryCount:    req.CanaryCount,
+		MaxUnavailable: req.MaxUnavailable,
+		HealthTimeout:  req.HealthTimeout,
+		BatchStartTime: time.Now(),
+		Status:         model.PendingRolloutStatus,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.CreateRolloutMessages(ctx, object.Id, fmt.Sprintf("升级任务已创建，待升级 agents: %v", req.Agents))
+	return nil
+}
+
+func (s *ServerController) GetAgentRollout(ctx context.Context, rolloutId int64) (interface{}, error) {
+	return s.factory.Agent().GetRollout(ctx, rolloutId)
+}
+
+func (s *ServerController) ListAgentRollouts(ctx context.Context, listOption types.ListOptions) (interface{}, error) {
+	// 初始化分页属性
+	listOption.SetDefaultPageOption()
+
+	pageResult := types.PageResult{
+		PageRequest: types.PageRequest{
+			Page:  listOption.Page,
+			Limit: listOption.Limit,
+		},
+	}
+	opts := []db.Options{
+		db.WithNameLike(listOption.NameSelector),
+		db.WithStatus(listOption.CustomStatus),
+	}
+
+	var err error
+	pageResult.Total, err = s.factory.Agent().CountRollouts(ctx, opts...)
+	if err != nil {
+		klog.Errorf("获取 agent 升级总数失败 %v", err)
+		pageResult.Message = err.Error()
+	}
+	offset := (listOption.Page - 1) * listOption.Limit
+	opts = append(opts, []db.Options{
+		db.WithModifyOrderByDesc(),
+		db.WithOffset(offset),
+		db.WithLimit(listOption.Limit),
+	}...)
+	pageResult.Items, err = s.factory.Agent().ListRollouts(ctx, opts...)
+	if err != nil {
+		klog.Errorf("获取 agent 升级列表失败 %v", err)
+		pageResult.Message = err.Error()
+		return pageResult, err
+	}
+
+	return pageResult, nil
+}
+
+func (s *ServerController) ListAgentRolloutMessages(ctx context.Context, rolloutId int64) (interface{}, error) {
+	return s.factory.Agent().ListRolloutMessages(ctx, db.WithRollout(rolloutId))
+}
+
+// CreateRolloutMessages 批量创建升级过程信息
+func (s *ServerController) CreateRolloutMessages(ctx context.Context, rolloutId int64, messages ...string) {
+	for _, msg := range messages {
+		if err := s.factory.Agent().CreateRolloutMessage(ctx, &model.AgentRolloutMessage{RolloutId: rolloutId, Message: msg}); err != nil {
+			klog.Errorf("记录 %s 失败 %v", msg, err)
+		}
+	}
+}
+
+func getActiveRolloutStatus() []string {
+	return []string{
+		model.PendingRolloutStatus,
+		model.CanaryRolloutStatus,
+		model.ProgressingRolloutStatus,
+		model.RollingBackRolloutStatus,
+	}
+}
+
+func (s *ServerController) startAgentRolloutController(ctx context.Context) {
+	klog.Infof("starting agent rollout controller")
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rollouts, err := s.factory.Agent().ListRollouts(ctx, db.WithStatusIn(getActiveRolloutStatus()...))
+		if err != nil {
+			klog.Errorf("获取 agent 升级列表失败 %v，等待下一次同步", err)
+			continue
+		}
+
+		for _, rollout := range rollouts {
+			if err = s.syncAgentRollout(ctx, &rollout); err != nil {
+				klog.Errorf("同步 agent 升级(%s)失败 %v", rollout.Name, err)
+			}
+		}
+	}
+}
+
+func (s *ServerController) syncAgentRollout(ctx context.Context, rollout *model.AgentRollout) error {
+	if rollout.Status == model.RollingBackRolloutStatus {
+		return s.rollbackAgentRollout(ctx, rollout, rollout.Message)
+	}
+
+	upgraded := splitAgentNames(rollout.Upgraded)
+	current := splitAgentNames(rollout.Current)
+
+	// 已升级的 agent 必须持续上报心跳，否则回滚
+	for _, agentName := range upgraded {
+		healthy, reason := s.isRolloutAgentHealthy(ctx, agentName, time.Time{}, rollout.HealthTimeout)
+		if !healthy {
+			return s.rollbackAgentRollout(ctx, rollout, reason)
+		}
+	}
+
+	// 当前批次仍在等待心跳
+	if len(current) != 0 {
+		for _, agentName := range current {
+			healthy, reason := s.isRolloutAgentHealthy(ctx, agentName, rollout.BatchStartTime, rollout.HealthTimeout)
+			if healthy {
+				continue
+			}
+			if time.Since(rollout.BatchStartTime) > time.Duration(rollout.HealthTimeout)*time.Second {
+				return s.rollbackAgentRollout(ctx, rollout, reason)
+			}
+			klog.V(1).Infof("agent 升级(%s) 等待 agent(%s) 心跳恢复", rollout.Name, agentName)
+			return nil
+		}
+
+		upgraded = append(upgraded, current...)
+		s.CreateRolloutMessages(ctx, rollout.Id, fmt.Sprintf("agents %v 升级完成，心跳正常", current))
+		if err := s.factory.Agent().UpdateRollout(ctx, rollout.Id, rollout.ResourceVersion, map[string]interface{}{
+			"upgraded": strings.Join(upgraded, ","),
+			"current":  "",
+		}); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	status, batch := nextRolloutBatch(rollout, upgraded)
+	if len(batch) == 0 {
+		s.CreateRolloutMessages(ctx, rollout.Id, "全部 agent 升级完成")
+		return s.factory.Agent().UpdateRollout(ctx, rollout.Id, rollout.ResourceVersion, map[string]interface{}{
+			"status":  model.SucceededRolloutStatus,
+			"message": "全部 agent 升级完成",
+		})
+	}
+
+	// 先记录批次，保证升级过程中异常退出时能够回滚
+	if err := s.factory.Agent().UpdateRollout(ctx, rollout.Id, rollout.ResourceVersion, map[string]interface{}{
+		"status":           status,
+		"current":          strings.Join(batch, ","),
+		"batch_start_time": time.Now(),
+	}); err != nil {
+		return err
+	}
+	rollout.ResourceVersion++
+	rollout.Current = strings.Join(batch, ",")
+	s.CreateRolloutMessages(ctx, rollout.Id, fmt.Sprintf("开始%s agents %v", status, batch))
+
+	for _, agentName := range batch {
+		if err := s.upgradeRolloutAgent(ctx, rollout, agentName); err != nil {
+			return s.rollbackAgentRollout(ctx, rollout, fmt.Sprintf("升级 agent(%s) 失败 %v", agentName, err))
+		}
+	}
+
+	// 升级动作可能耗时较长，以升级完成的时间作为心跳检查的起点
+	return s.factory.Agent().UpdateRollout(ctx, rollout.Id, rollout.ResourceVersion, map[string]interface{}{
+		"batch_start_time": time.Now(),
+	})
+}
+
+// nextRolloutBatch 返回下一批待升级的 agent，先升级灰度批次，之后按照最大不可用数量分批升级
+// 全部 agent 均已升级时返回空批次
+func nextRolloutBatch(rollout *model.AgentRollout, upgraded []string) (string, []string) {
+	var pending []string
+	for _, agentName := range splitAgentNames(rollout.Agents) {
+		if !util.InSlice(agentName, upgraded) {
+			pending = append(pending, agentName)
+		}
+	}
+	if len(pending) == 0 {
+		return "", nil
+	}
+
+	status, batchSize := model.ProgressingRolloutStatus, rollout.MaxUnavailable
+	if len(upgraded) == 0 {
+		status, batchSize = model.CanaryRolloutStatus, rollout.CanaryCount
+	}
+	if batchSize > len(pending) {
+		batchSize = len(pending)
+	}
+	return status, pending[:batchSize]
+}
+
+// isRolloutAgentHealthy 检查 agent 是否在线，且在 since 之后上报过心跳
+func (s *ServerController) isRolloutAgentHealthy(ctx context.Context, agentName string, since time.Time, timeout int64) (bool, string) {
+	agent, err := s.factory.Agent().GetByName(ctx, agentName)
+	if err != nil {
+		return false, fmt.Sprintf("获取 agent(%s) 失败 %v", agentName, err)
+	}
+	return checkRolloutAgentHeartbeat(agent, since, timeout, time.Now())
+}
+
+func checkRolloutAgentHeartbeat(agent *model.Agent, since time.Time, timeout int64, now time.Time) (bool, string) {
+	if agent.Status != model.RunAgentType {
+		return false, fmt.Sprintf("agent(%s) 状态为 %s", agent.Name, agent.Status)
+	}
+	if !agent.LastTransitionTime.After(since) {
+		return false, fmt.Sprintf("agent(%s) 升级后未上报心跳", agent.Name)
+	}
+	if now.Sub(agent.LastTransitionTime) > time.Duration(timeout)*time.Second {
+		return false, fmt.Sprintf("agent(%s) 已停止上报心跳", agent.Name)
+	}
+
+	return true, ""
+}
+
+func (s *ServerController) upgradeRolloutAgent(ctx context.Context, rollout *model.AgentRollout, agentName string) error {
+	agent, err := s.factory.Agent().GetByName(ctx, agentName)
+	if err != nil {
+		return err
+	}
+	sshConfig, ok := s.sshConfigMap[agent.RainbowdName]
+	if !ok {
+		return fmt.Errorf("未加载 rainbow node(%s)", agent.RainbowdName)
+	}
+
+	switch rollout.Type {
+	case model.BinaryRolloutType:
+		if err = s.BackupAgentBinary(&sshConfig, agent); err != nil {
+			return err
+		}
+		// 记录已备份的 agent，回滚时仅恢复这些 agent
+		if err = s.recordPrevious(ctx, rollout, agentName, agentRollbackBinary); err != nil {
+			return err
+		}
+		if err = s.factory.Agent().UpdateByName(ctx, agentName, map[string]interface{}{"status": model.UpgradeAgentBinaryType, "message": fmt.Sprintf("Agent is upgrading by rollout %s", rollout.Name)}); err != nil {
+			return err
+		}
+		if err = s.UpgradeAgentBinaryContainerFrom(&sshConfig, agent, rollout.Binary); err != nil {
+			return err
+		}
+		return s.factory.Agent().UpdateByName(ctx, agentName, map[string]interface{}{"status": model.RunAgentType})
+	case model.ImageRolloutType:
+		if err = s.recordPrevious(ctx, rollout, agentName, s.getAgentImage(agent)); err != nil {
+			return err
+		}
+		if err = s.factory.Agent().UpdateByName(ctx, agentName, map[string]interface{}{"agent_image": rollout.AgentImage, "status": model.UpgradeAgentType, "message": fmt.Sprintf("Agent is upgrading by rollout %s", rollout.Name)}); err != nil {
+			return err
+		}
+		newAgent, err := s.factory.Agent().GetByName(ctx, agentName)
+		if err != nil {
+			return err
+		}
+		return s.ReconcileAgent(ctx, &sshConfig, newAgent)
+	default:
+		return fmt.Errorf("unsupported rollout type %s", rollout.Type)
+	}
+}
+
+// recordPrevious 记录 agent 升级前的镜像或者二进制备份，作为回滚点
+func (s *ServerController) recordPrevious(ctx context.Context, rollout *model.AgentRollout, agentName string, image string) error {
+	previous := make(map[string]string)
+	if len(rollout.PreviousImages) != 0 {
+		if err := json.Unmarshal([]byte(rollout.PreviousImages), &previous); err != nil {
+			return err
+		}
+	}
+	previous[agentName] = image
+	data, err := json.Marshal(previous)
+	if err != nil {
+		return err
+	}
+
+	if err = s.factory.Agent().UpdateRollout(ctx, rollout.Id, rollout.ResourceVersion, map[string]interface{}{"previous_images": string(data)}); err != nil {
+		return err
+	}
+	rollout.ResourceVersion++
+	rollout.PreviousImages = string(data)
+	return nil
+}
+
+// rollbackAgentRollout 回滚已升级和正在升级的 agent
+func (s *ServerController) rollbackAgentRollout(ctx context.Context, rollout *model.AgentRollout, reason string) error {
+	klog.Warningf("agent 升级(%s)即将回滚，原因: %s", rollout.Name, reason)
+	if rollout.Status != model.RollingBackRolloutStatus {
+		if err := s.factory.Agent().UpdateRollout(ctx, rollout.Id, rollout.ResourceVersion, map[string]interface{}{
+			"status":  model.RollingBackRolloutStatus,
+			"message": reason,
+		}); err != nil {
+			return err
+		}
+		rollout.ResourceVersion++
+		s.CreateRolloutMessages(ctx, rollout.Id, fmt.Sprintf("升级异常，开始回滚，原因: %s", reason))
+	}
+
+	previous := make(map[string]string)
+	if len(rollout.PreviousImages) != 0 {
+		if err := json.Unmarshal([]byte(rollout.PreviousImages), &previous); err != nil {
+			return err
+		}
+	}
+
+	var failed []string
+	for _, agentName := range append(splitAgentNames(rollout.Upgraded), splitAgentNames(rollout.Current)...) {
+		if err := s.rollbackRolloutAgent(ctx, rollout, agentName, previous); err != nil {
+			klog.Errorf("回滚 agent(%s) 失败 %v", agentName, err)
+			failed = append(failed, agentName)
+			continue
+		}
+		s.CreateRolloutMessages(ctx, rollout.Id, fmt.Sprintf("agent(%s) 回滚完成", agentName))
+	}
+
+	status := model.RolledBackRolloutStatus
+	if len(failed) != 0 {
+		status = model.FailedRolloutStatus
+		reason = fmt.Sprintf("%s; 回滚失败的 agents: %v", reason, failed)
+		s.CreateRolloutMessages(ctx, rollout.Id, fmt.Sprintf("agents %v 回滚失败，请手动处理", failed))
+	}
+	return s.factory.Agent().UpdateRollout(ctx, rollout.Id, rollout.ResourceVersion, map[string]interface{}{
+		"status":  status,
+		"message": reason,
+	})
+}
+
+func (s *ServerController) rollbackRolloutAgent(ctx context.Context, rollout *model.AgentRollout, agentName string, previous map[string]string) error {
+	agent, err := s.factory.Agent().GetByName(ctx, agentName)
+	if err != nil {
+		return err
+	}
+	sshConfig, ok := s.sshConfigMap[agent.RainbowdName]
+	if !ok {
+		return fmt.Errorf("未加载 rainbow node(%s)", agent.RainbowdName)
+	}
+
+	switch rollout.Type {
+	case model.BinaryRolloutType:
+		if _, ok := previous[agentName]; !ok {
+			// 尚未备份二进制文件，说明未开始升级，无需回滚
+			return nil
+		}
+		if err = s.RestoreAgentBinary(&sshConfig, agent); err != nil {
+			return err
+		}
+		return s.factory.Agent().UpdateByName(ctx, agentName, map[string]interface{}{"status": model.RunAgentType, "message": fmt.Sprintf("Agent has been rolled back by rollout %s", rollout.Name)})
+	case model.ImageRolloutType:
+		image, ok := previous[agentName]
+		if !ok {
+			// 尚未开始升级，无需回滚
+			return nil
+		}
+		// 与 rainbowd 默认镜像一致时，清空自定义镜像
+		if image == s.cfg.Rainbowd.AgentImage {
+			image = ""
+		}
+		if err = s.factory.Agent().UpdateByName(ctx, agentName, map[string]interface{}{"agent_image": image, "status": model.UpgradeAgentType, "message": fmt.Sprintf("Agent is rolling back by rollout %s", rollout.Name)}); err != nil {
+			return err
+		}
+		newAgent, err := s.factory.Agent().GetByName(ctx, agentName)
+		if err != nil {
+			return err
+		}
+		return s.ReconcileAgent(ctx, &sshConfig, newAgent)
+	default:
+		return fmt.Errorf("unsupported rollout type %s", rollout.Type)
+	}
+}
+
+// resolveRolloutBinary 返回 template_dir 下的 agent 二进制文件路径，不允许使用 template_dir 之外的文件
+func resolveRolloutBinary(templateDir string, binary string) (string, error) {
+	if len(templateDir) == 0 {
+		return "", fmt.Errorf("未配置 template_dir，无法使用二进制方式升级")
+	}
+	base, err := filepath.Abs(templateDir)
+	if err != nil {
+		return "", err
+	}
+	if len(binary) == 0 {
+		binary = "agent"
+	}
+
+	path := binary
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	path = filepath.Clean(path)
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("agent 二进制文件(%s)必须位于 %s 目录下", binary, templateDir)
+	}
+	return path, nil
+}
+
+func splitAgentNames(agents string) []string {
+	if len(agents) == 0 {
+		return []string{}
+	}
+	return util.TrimAndFilter(strings.Split(agents, ","))
+}
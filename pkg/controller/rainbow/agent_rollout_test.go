@@ -0,0 +1,219 @@
+package rainbow
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/util/sshutil"
+)
+
+func TestNextRolloutBatch(t *testing.T) {
+	rollout := &model.AgentRollout{Agents: "a1,a2,a3,a4,a5", CanaryCount: 1, MaxUnavailable: 2}
+
+	tests := []struct {
+		name       string
+		rollout    *model.AgentRollout
+		upgraded   []string
+		wantStatus string
+		wantBatch  []string
+	}{
+		{
+			name:       "canary first",
+			rollout:    rollout,
+			upgraded:   []string{},
+			wantStatus: model.CanaryRolloutStatus,
+			wantBatch:  []string{"a1"},
+		},
+		{
+			name:       "max unavailable after canary",
+			rollout:    rollout,
+			upgraded:   []string{"a1"},
+			wantStatus: model.ProgressingRolloutStatus,
+			wantBatch:  []string{"a2", "a3"},
+		},
+		{
+			name:       "last batch smaller than max unavailable",
+			rollout:    rollout,
+			upgraded:   []string{"a1", "a2", "a3", "a4"},
+			wantStatus: model.ProgressingRolloutStatus,
+			wantBatch:  []string{"a5"},
+		},
+		{
+			name:       "canary larger than agents",
+			rollout:    &model.AgentRollout{Agents: "a1, a2", CanaryCount: 3, MaxUnavailable: 1},
+			upgraded:   []string{},
+			wantStatus: model.CanaryRolloutStatus,
+			wantBatch:  []string{"a1", "a2"},
+		},
+		{
+			name:     "all upgraded",
+			rollout:  rollout,
+			upgraded: []string{"a1", "a2", "a3", "a4", "a5"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status, batch := nextRolloutBatch(tc.rollout, tc.upgraded)
+			if status != tc.wantStatus {
+				t.Errorf("expected status %q, got %q", tc.wantStatus, status)
+			}
+			if len(batch) != 0 || len(tc.wantBatch) != 0 {
+				if !reflect.DeepEqual(batch, tc.wantBatch) {
+					t.Errorf("expected batch %v, got %v", tc.wantBatch, batch)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRolloutAgentHeartbeat(t *testing.T) {
+	now := time.Now()
+	since := now.Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		agent model.Agent
+		since time.Time
+		want  bool
+	}{
+		{
+			name:  "heartbeat after upgrade",
+			agent: model.Agent{Name: "a1", Status: model.RunAgentType, LastTransitionTime: now.Add(-10 * time.Second)},
+			since: since,
+			want:  true,
+		},
+		{
+			name:  "offline",
+			agent: model.Agent{Name: "a1", Status: model.UnRunAgentType, LastTransitionTime: now.Add(-10 * time.Second)},
+			since: since,
+		},
+		{
+			name:  "no heartbeat since upgrade",
+			agent: model.Agent{Name: "a1", Status: model.RunAgentType, LastTransitionTime: since.Add(-time.Second)},
+			since: since,
+		},
+		{
+			// 已升级的 agent 不限制心跳起点，仅检查心跳是否超时
+			name:  "heartbeat stopped",
+			agent: model.Agent{Name: "a1", Status: model.RunAgentType, LastTransitionTime: now.Add(-301 * time.Second)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			healthy, reason := checkRolloutAgentHeartbeat(&tc.agent, tc.since, 300, now)
+			if healthy != tc.want {
+				t.Errorf("expected healthy %v, got %v (%s)", tc.want, healthy, reason)
+			}
+			if !healthy && len(reason) == 0 {
+				t.Errorf("expected a reason for unhealthy agent")
+			}
+		})
+	}
+}
+
+func TestSyncAgentRollout(t *testing.T) {
+	now := time.Now()
+	healthy := func(name string) model.Agent {
+		return model.Agent{Name: name, RainbowdName: "node1", Status: model.RunAgentType, LastTransitionTime: now.Add(-10 * time.Second)}
+	}
+	// 心跳早于当前批次开始时间，说明升级后尚未上报心跳
+	silent := func(name string) model.Agent {
+		return model.Agent{Name: name, RainbowdName: "node1", Status: model.RunAgentType, LastTransitionTime: now.Add(-20 * time.Minute)}
+	}
+
+	tests := []struct {
+		name    string
+		rollout model.AgentRollout
+		agents  []model.Agent
+		// 最后一次更新升级任务的内容，为空时表示不更新
+		want map[string]interface{}
+	}{
+		{
+			name: "canary healthy",
+			rollout: model.AgentRollout{
+				Status: model.CanaryRolloutStatus, Agents: "a1,a2,a3", Current: "a1",
+				BatchStartTime: now.Add(-time.Minute), HealthTimeout: 300,
+			},
+			agents: []model.Agent{healthy("a1")},
+			want:   map[string]interface{}{"upgraded": "a1", "current": ""},
+		},
+		{
+			name: "batch waiting for heartbeat",
+			rollout: model.AgentRollout{
+				Status: model.ProgressingRolloutStatus, Agents: "a1,a2,a3", Upgraded: "a1", Current: "a2,a3",
+				BatchStartTime: now.Add(-time.Minute), HealthTimeout: 300,
+			},
+			agents: []model.Agent{healthy("a1"), healthy("a2"), silent("a3")},
+		},
+		{
+			name: "batch heartbeat timeout rolls back",
+			rollout: model.AgentRollout{
+				Type: model.BinaryRolloutType, Status: model.ProgressingRolloutStatus, Agents: "a1,a2", Upgraded: "a1", Current: "a2",
+				BatchStartTime: now.Add(-10 * time.Minute), HealthTimeout: 300,
+			},
+			agents: []model.Agent{healthy("a1"), silent("a2")},
+			want:   map[string]interface{}{"status": model.RolledBackRolloutStatus},
+		},
+		{
+			name: "upgraded agent offline rolls back",
+			rollout: model.AgentRollout{
+				Type: model.BinaryRolloutType, Status: model.ProgressingRolloutStatus, Agents: "a1,a2", Upgraded: "a1",
+				BatchStartTime: now.Add(-time.Minute), HealthTimeout: 300,
+			},
+			agents: []model.Agent{{Name: "a1", RainbowdName: "node1", Status: model.UnRunAgentType}, healthy("a2")},
+			want:   map[string]interface{}{"status": model.RolledBackRolloutStatus},
+		},
+		{
+			name: "rollback failure",
+			rollout: model.AgentRollout{
+				Type: model.BinaryRolloutType, Status: model.RollingBackRolloutStatus, Agents: "a1", Current: "a1", Message: "心跳超时",
+			},
+			agents: []model.Agent{{Name: "a1", RainbowdName: "node2", Status: model.RunAgentType}},
+			want:   map[string]interface{}{"status": model.FailedRolloutStatus},
+		},
+		{
+			name: "all upgraded",
+			rollout: model.AgentRollout{
+				Status: model.ProgressingRolloutStatus, Agents: "a1,a2", Upgraded: "a1,a2",
+				BatchStartTime: now.Add(-time.Minute), HealthTimeout: 300,
+			},
+			agents: []model.Agent{healthy("a1"), healthy("a2")},
+			want:   map[string]interface{}{"status": model.SucceededRolloutStatus},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dao := newFakeAgentDao(tc.agents...)
+			s := &ServerController{
+				factory:      &fakeFactory{agent: dao},
+				sshConfigMap: map[string]sshutil.SSHConfig{"node1": {}},
+			}
+			rollout := tc.rollout
+			if err := s.syncAgentRollout(context.TODO(), &rollout); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tc.want == nil {
+				if len(dao.rolloutUpdates) != 0 {
+					t.Errorf("expected no update, got %v", dao.rolloutUpdates)
+				}
+				return
+			}
+			if len(dao.rolloutUpdates) == 0 {
+				t.Fatalf("expected update %v, got none", tc.want)
+			}
+			last := dao.rolloutUpdates[len(dao.rolloutUpdates)-1]
+			for key, value := range tc.want {
+				if last[key] != value {
+					t.Errorf("expected %s=%v, got %v", key, value, last[key])
+				}
+			}
+		})
+	}
+}
@@ -39,6 +39,7 @@ type ContainerInfo struct {
 	Image        string `json:"Image"`
 	Command      string `json:"Command"`
 	CreatedAt    string `json:"CreatedAt"`
+	State        string `json:"State"`
 	Status       string `json:"Status"`
 	Ports        string `json:"Ports"`
 	Size         string `json:"Size"`
@@ -208,6 +209,54 @@ func (s *ServerController) UpdateAgentStatus(ctx context.Context, req *types.Upd
 	return nil
 }
 
+// CordonAgent 禁止调度，agent 保持在线，已分配的任务继续执行
+func (s *ServerController) CordonAgent(ctx context.Context, agentName string) error {
+	if _, err := s.factory.Agent().GetByName(ctx, agentName); err != nil {
+		return err
+	}
+	return s.factory.Agent().UpdateByName(ctx, agentName, map[string]interface{}{"unschedulable": true, "message": "Agent has been cordoned"})
+}
+
+// UncordonAgent 恢复调度
+func (s *ServerController) UncordonAgent(ctx context.Context, agentName string) error {
+	if _, err := s.factory.Agent().GetByName(ctx, agentName); err != nil {
+		return err
+	}
+	return s.factory.Agent().UpdateByName(ctx, agentName, map[string]interface{}{"unschedulable": false, "message": "Agent has been uncordoned"})
+}
+
+// DrainAgent 禁止调度，并将尚未开始的任务重新分配给其他 agent，返回被重新分配的任务
+func (s *ServerController) DrainAgent(ctx context.Context, agentName string) (interface{}, error) {
+	if err := s.CordonAgent(ctx, agentName); err != nil {
+		return nil, err
+	}
+
+	tasks, err := s.factory.Task().ListWithAgent(ctx, agentName, 0)
+	if err != nil {
+		klog.Errorf("获取 agent(%s) 未开始任务失败 %v", agentName, err)
+		return nil, err
+	}
+
+	reassigned := make(map[string]string)
+	for _, task := range tasks {
+		targetAgent, err := s.assignAgent(ctx)
+		if err != nil {
+			return reassigned, err
+		}
+		// 无可用 agent 时清空分配，等待调度器重新分配
+		if err = s.factory.Task().Update(ctx, task.Id, task.ResourceVersion, map[string]interface{}{
+			"agent_name": targetAgent,
+		}); err != nil {
+			klog.Errorf("任务 %s 重新分配失败 %v", task.Name, err)
+			continue
+		}
+		klog.Infof("agent %s 驱逐中，任务 %s 已被重新分配给 agent %s", agentName, task.Name, targetAgent)
+		reassigned[task.Name] = targetAgent
+	}
+
+	return reassigned, nil
+}
+
 func (s *ServerController) UpdateAgent(ctx context.Context, req *types.UpdateAgentRequest) error {
 	repo := req.GithubRepository
 	if len(repo) == 0 {
@@ -309,7 +358,7 @@ func (s *ServerController) RunAgentContainer(sshConfig *sshutil.SSHConfig, agent
 	cmd1 := []string{"docker", "run", "-d", "--name", agent.Name,
 		"-v", fmt.Sprintf("%s:/data", s.cfg.Rainbowd.DataDir+"/"+agent.Name),
 		"-v", "/etc/localtime:/etc/localtime:ro",
-		"--network", "host", s.cfg.Rainbowd.AgentImage, "/data/agent", "--configFile", "/data/config.yaml"}
+		"--network", "host", s.getAgentImage(agent), "/data/agent", "--configFile", "/data/config.yaml"}
 	// 输入 github 的配置
 	cmd2 := []string{"docker", "exec", agent.Name, "git", "config", "--global", "user.name", agent.GithubUser}
 	cmd3 := []string{"docker", "exec", agent.Name, "git", "config", "--global", "user.email", agent.GithubEmail}
@@ -336,7 +385,7 @@ func (s *ServerController) BootstrapAgentContainer(sshConfig *sshutil.SSHConfig,
 	containerName := agent.Name + uuid.NewRandName("-upgrade-", 8)
 	pluginDir := "/data/plugin/"
 
-	cmd1 := []string{"docker", "run", "-d", "--name", containerName, "-v", fmt.Sprintf("%s:/data", s.cfg.Rainbowd.DataDir+"/"+agent.Name), "-v", "/etc/localtime:/etc/localtime:ro", "--network", "host", s.cfg.Rainbowd.AgentImage, "sleep", "infinity"}
+	cmd1 := []string{"docker", "run", "-d", "--name", containerName, "-v", fmt.Sprintf("%s:/data", s.cfg.Rainbowd.DataDir+"/"+agent.Name), "-v", "/etc/localtime:/etc/localtime:ro", "--network", "host", s.getAgentImage(agent), "sleep", "infinity"}
 	cmd2 := []string{"docker", "exec", containerName, "git", "init", pluginDir}
 	cmd3 := []string{"docker", "exec", containerName, "git", "config", "--global", "user.name", agent.GithubUser}
 	cmd4 := []string{"docker", "exec", containerName, "git", "config", "--global", "user.email", agent.GithubEmail}
@@ -387,9 +436,22 @@ func (s *ServerController) BootstrapAgentContainer(sshConfig *sshutil.SSHConfig,
 	return nil
 }
 
+// getAgentImage 获取 agent 的运行镜像，未单独指定时使用 rainbowd 的默认镜像
+func (s *ServerController) getAgentImage(agent *model.Agent) string {
+	if len(agent.AgentImage) != 0 {
+		return agent.AgentImage
+	}
+	return s.cfg.Rainbowd.AgentImage
+}
+
 // UpgradeAgentBinaryContainer 先停止 agent 容器，然后替换 agent 二进制文件 然后启动 agent 容器
 func (s *ServerController) UpgradeAgentBinaryContainer(sshConfig *sshutil.SSHConfig, agent *model.Agent) error {
-	klog.Infof("UpgradeAgentBinaryContainer rainbow %s agent %s", agent.RainbowdName, agent.Name)
+	return s.UpgradeAgentBinaryContainerFrom(sshConfig, agent, s.cfg.Rainbowd.TemplateDir+"/agent")
+}
+
+// UpgradeAgentBinaryContainerFrom 使用指定的 agent 二进制文件进行升级
+func (s *ServerController) UpgradeAgentBinaryContainerFrom(sshConfig *sshutil.SSHConfig, agent *model.Agent, binary string) error {
+	klog.Infof("UpgradeAgentBinaryContainer rainbow %s agent %s binary %s", agent.RainbowdName, agent.Name, binary)
 	if err := s.StopAgentContainer(sshConfig, agent); err != nil {
 		return err
 	}
@@ -403,7 +465,7 @@ func (s *ServerController) UpgradeAgentBinaryContainer(sshConfig *sshutil.SSHCon
 	containerName := agent.Name
 	destDir := filepath.Join(s.cfg.Rainbowd.DataDir, containerName)
 	// 替换 agent 二进制
-	if err = sshClient.UploadFile(s.cfg.Rainbowd.TemplateDir+"/agent", destDir+"/agent", "0755"); err != nil {
+	if err = sshClient.UploadFile(binary, destDir+"/agent", "0755"); err != nil {
 		klog.Errorf("传输 agent 二进制文件失败 %v", err)
 		return err
 	}
@@ -411,6 +473,47 @@ func (s *ServerController) UpgradeAgentBinaryContainer(sshConfig *sshutil.SSHCon
 	return s.StartAgentContainer(sshConfig, agent)
 }
 
+// agentRollbackBinary agent 二进制文件的备份文件名，位于 agent 的数据目录
+const agentRollbackBinary = "agent.rollback"
+
+// BackupAgentBinary 备份 agent 当前的二进制文件，用于升级失败时回滚
+func (s *ServerController) BackupAgentBinary(sshConfig *sshutil.SSHConfig, agent *model.Agent) error {
+	destDir := filepath.Join(s.cfg.Rainbowd.DataDir, agent.Name)
+	return s.runAgentHostCommand(sshConfig, fmt.Sprintf("cp -f %s/agent %s/%s", destDir, destDir, agentRollbackBinary))
+}
+
+// RestoreAgentBinary 使用备份的二进制文件恢复 agent，然后重启 agent 容器
+func (s *ServerController) RestoreAgentBinary(sshConfig *sshutil.SSHConfig, agent *model.Agent) error {
+	if err := s.StopAgentContainer(sshConfig, agent); err != nil {
+		return err
+	}
+
+	destDir := filepath.Join(s.cfg.Rainbowd.DataDir, agent.Name)
+	if err := s.runAgentHostCommand(sshConfig, fmt.Sprintf("cp -f %s/%s %s/agent", destDir, agentRollbackBinary, destDir)); err != nil {
+		return err
+	}
+	return s.StartAgentContainer(sshConfig, agent)
+}
+
+func (s *ServerController) runAgentHostCommand(sshConfig *sshutil.SSHConfig, cmd string) error {
+	sshClient, err := sshutil.NewSSHClient(sshConfig)
+	if err != nil {
+		return err
+	}
+	defer sshClient.Close()
+
+	klog.V(1).Infof("cmd %s 即将被执行", cmd)
+	result, err := sshClient.RunCommand(cmd)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("远程命令执行失败: %s", result.Stderr)
+	}
+
+	return nil
+}
+
 func (s *ServerController) UninstallAgentContainer(sshConfig *sshutil.SSHConfig, agent *model.Agent) error {
 	sshClient, err := sshutil.NewSSHClient(sshConfig)
 	if err != nil {
@@ -515,7 +618,7 @@ func (s *ServerController) CreateAgentRepo(ctx context.Context, req *types.CallG
 		klog.Errorf("创建 agent github repo（%s）失败：%v", req.Repo, err)
 		return nil, err
 	}
-	klog.Errorf("创建 agent github repo（%s）成功：%v", req.Repo)
+	klog.Infof("创建 agent github repo（%s）成功", req.Repo)
 	return nil, nil
 }
 
@@ -533,7 +636,7 @@ func (s *ServerController) CreateAgentReposIfNot(ctx context.Context, req *types
 		klog.Errorf("创建 agentRepos（%s）失败：%v", req.Repo, err)
 		return err
 	}
-	klog.Errorf("创建 agentRepo（%s）成功：%v", req.Repo)
+	klog.Infof("创建 agentRepo（%s）成功", req.Repo)
 	return nil
 }
 
@@ -0,0 +1,85 @@
+package rainbow
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/pkg/db"
+)
+
+// callbackTokenTTL plugin 回调 token 的有效期，覆盖 github action 单个 job 的最长执行时间
+const callbackTokenTTL = 6 * time.Hour
+
+func hashCallbackToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// mintCallbackToken 为任务生成新的回调 token，格式为 <taskId>.<随机串>
+// 数据库中仅保存摘要，之前下发的 token 随之失效
+func (s *AgentController) mintCallbackToken(ctx context.Context, taskId int64) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := fmt.Sprintf("%d.%s", taskId, hex.EncodeToString(buf))
+
+	if err := s.factory.Task().UpdateDirectly(ctx, taskId, map[string]interface{}{
+		"callback_token":           hashCallbackToken(token),
+		"callback_token_expire_at": time.Now().Add(callbackTokenTTL).Unix(),
+	}); err != nil {
+		klog.Errorf("生成任务(%d)回调 token 失败 %v", taskId, err)
+		return "", err
+	}
+	return token, nil
+}
+
+// AuthenticateCallback 校验 plugin 回调使用的 token，返回 token 所属的任务
+func (s *ServerController) AuthenticateCallback(ctx context.Context, token string) (int64, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("回调 token 不合法")
+	}
+	taskId, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("回调 token 不合法")
+	}
+
+	task, err := s.factory.Task().Get(ctx, taskId)
+	if err != nil {
+		return 0, fmt.Errorf("任务(%d)不存在", taskId)
+	}
+	if len(task.CallbackToken) == 0 || subtle.ConstantTimeCompare([]byte(task.CallbackToken), []byte(hashCallbackToken(token))) != 1 {
+		return 0, fmt.Errorf("回调 token 不合法")
+	}
+	if time.Now().Unix() > task.CallbackTokenExpireAt {
+		return 0, fmt.Errorf("回调 token 已过期")
+	}
+	return taskId, nil
+}
+
+// ValidateCallbackImage 校验回调的镜像属于该任务，避免任务 token 修改其他任务的镜像
+func (s *ServerController) ValidateCallbackImage(ctx context.Context, taskId int64, imageId int64) error {
+	tags, err := s.factory.Image().ListTags(ctx, db.WithImage(imageId), db.WithTaskLike(taskId))
+	if err != nil {
+		return err
+	}
+	taskIdStr := fmt.Sprintf("%d", taskId)
+	for _, tag := range tags {
+		for _, id := range strings.Split(tag.TaskIds, ",") {
+			if id == taskIdStr {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("镜像(%d)不属于任务(%d)", imageId, taskId)
+}
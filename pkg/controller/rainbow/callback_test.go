@@ -0,0 +1,113 @@
+package rainbow
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/caoyingjunz/rainbow/pkg/types"
+)
+
+func TestProcessCallbackEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		seen   []string
+		// handleErrs 处理指定事件时返回的错误
+		handleErrs map[string]error
+		recordErr  error
+
+		wantHandled  []string
+		wantRecorded []string
+		wantResult   types.BatchCallbackResult
+		wantErr      bool
+	}{
+		{
+			name:         "process all events",
+			events:       []string{"a", "b"},
+			wantHandled:  []string{"a", "b"},
+			wantRecorded: []string{"a", "b"},
+			wantResult:   types.BatchCallbackResult{Processed: 2},
+		},
+		{
+			name:         "skip processed and duplicated events",
+			events:       []string{"a", "b", "b", "c"},
+			seen:         []string{"a"},
+			wantHandled:  []string{"b", "c"},
+			wantRecorded: []string{"b", "c"},
+			wantResult:   types.BatchCallbackResult{Processed: 2, Skipped: 2},
+		},
+		{
+			name:         "failed event is recorded and does not block later events",
+			events:       []string{"a", "b", "c"},
+			handleErrs:   map[string]error{"b": fmt.Errorf("镜像(1)不属于任务(1)")},
+			wantHandled:  []string{"a", "b", "c"},
+			wantRecorded: []string{"a", "b: 镜像(1)不属于任务(1)", "c"},
+			wantResult:   types.BatchCallbackResult{Processed: 2, Failed: 1, Errors: []string{"b: 镜像(1)不属于任务(1)"}},
+		},
+		{
+			name:         "transient error fails the batch for retry",
+			events:       []string{"a", "b", "c"},
+			handleErrs:   map[string]error{"b": fmt.Errorf("更新镜像状态失败: %w", driver.ErrBadConn)},
+			wantHandled:  []string{"a", "b"},
+			wantRecorded: []string{"a"},
+			wantResult:   types.BatchCallbackResult{Processed: 1},
+			wantErr:      true,
+		},
+		{
+			name:        "record failure fails the batch",
+			events:      []string{"a", "b"},
+			recordErr:   fmt.Errorf("duplicate entry"),
+			wantHandled: []string{"a"},
+			wantResult:  types.BatchCallbackResult{},
+			wantErr:     true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []types.CallbackEvent
+			for _, id := range tc.events {
+				events = append(events, types.CallbackEvent{Id: id, Type: types.CallbackMessageEvent})
+			}
+			seen := make(map[string]bool)
+			for _, id := range tc.seen {
+				seen[id] = true
+			}
+
+			var handled, recorded []string
+			result := &types.BatchCallbackResult{}
+			err := processCallbackEvents(events, seen, result,
+				func(event types.CallbackEvent) error {
+					handled = append(handled, event.Id)
+					return tc.handleErrs[event.Id]
+				},
+				func(event types.CallbackEvent, handleErr error) error {
+					if tc.recordErr != nil {
+						return tc.recordErr
+					}
+					if handleErr != nil {
+						recorded = append(recorded, event.Id+": "+handleErr.Error())
+					} else {
+						recorded = append(recorded, event.Id)
+					}
+					return nil
+				},
+			)
+
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if !reflect.DeepEqual(handled, tc.wantHandled) {
+				t.Errorf("handled = %v, want %v", handled, tc.wantHandled)
+			}
+			if !reflect.DeepEqual(recorded, tc.wantRecorded) {
+				t.Errorf("recorded = %v, want %v", recorded, tc.wantRecorded)
+			}
+			if !reflect.DeepEqual(*result, tc.wantResult) {
+				t.Errorf("result = %+v, want %+v", *result, tc.wantResult)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package rainbow
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/caoyingjunz/rainbow/pkg/db"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+)
+
+// fakeFactory 仅实现测试用到的 dao 方法，调用未实现的方法时 panic
+type fakeFactory struct {
+	db.ShareDaoFactory
+
+	agent  *fakeAgentDao
+	notify *fakeNotifyDao
+}
+
+func (f *fakeFactory) Agent() db.AgentInterface   { return f.agent }
+func (f *fakeFactory) Notify() db.NotifyInterface { return f.notify }
+
+type fakeAgentDao struct {
+	db.AgentInterface
+
+	agents         map[string]model.Agent
+	agentUpdates   []map[string]interface{}
+	rolloutUpdates []map[string]interface{}
+	messages       []string
+
+	usage          *model.AgentUsage
+	usageUpdates   []map[string]interface{}
+	accounts       []model.GithubAccount
+	accountUpdates []map[string]interface{}
+}
+
+func newFakeAgentDao(agents ...model.Agent) *fakeAgentDao {
+	f := &fakeAgentDao{agents: make(map[string]model.Agent)}
+	for _, agent := range agents {
+		f.agents[agent.Name] = agent
+	}
+	return f
+}
+
+func (f *fakeAgentDao) GetByName(_ context.Context, agentName string) (*model.Agent, error) {
+	agent, ok := f.agents[agentName]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &agent, nil
+}
+
+func (f *fakeAgentDao) UpdateByName(_ context.Context, _ string, updates map[string]interface{}) error {
+	f.agentUpdates = append(f.agentUpdates, updates)
+	return nil
+}
+
+func (f *fakeAgentDao) UpdateRollout(_ context.Context, _ int64, _ int64, updates map[string]interface{}) error {
+	f.rolloutUpdates = append(f.rolloutUpdates, updates)
+	return nil
+}
+
+func (f *fakeAgentDao) CreateRolloutMessage(_ context.Context, object *model.AgentRolloutMessage) error {
+	f.messages = append(f.messages, object.Message)
+	return nil
+}
+
+func (f *fakeAgentDao) GetUsage(_ context.Context, _ ...db.Options) (*model.AgentUsage, error) {
+	if f.usage == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	usage := *f.usage
+	return &usage, nil
+}
+
+func (f *fakeAgentDao) UpdateUsage(_ context.Context, _ int64, _ int64, updates map[string]interface{}) error {
+	f.usageUpdates = append(f.usageUpdates, updates)
+	return nil
+}
+
+func (f *fakeAgentDao) ListGithubAccounts(_ context.Context, _ ...db.Options) ([]model.GithubAccount, error) {
+	return append([]model.GithubAccount{}, f.accounts...), nil
+}
+
+func (f *fakeAgentDao) UpdateGithubAccount(_ context.Context, _ int64, _ int64, updates map[string]interface{}) error {
+	f.accountUpdates = append(f.accountUpdates, updates)
+	return nil
+}
+
+// fakeNotifyDao 不存在已开启的通知通道，仅记录发送通知的次数
+type fakeNotifyDao struct {
+	db.NotifyInterface
+
+	sent int
+}
+
+func (f *fakeNotifyDao) List(_ context.Context, _ ...db.Options) ([]model.Notification, error) {
+	f.sent++
+	return nil, nil
+}
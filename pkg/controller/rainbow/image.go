@@ -2,6 +2,7 @@ package rainbow
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -13,6 +14,7 @@ import (
 	"github.com/caoyingjunz/rainbow/pkg/db/model"
 	"github.com/caoyingjunz/rainbow/pkg/types"
 	"github.com/caoyingjunz/rainbow/pkg/util/errors"
+	"github.com/caoyingjunz/rainbow/pkg/util/kubeadm"
 )
 
 func (s *ServerController) CreateImage(ctx context.Context, req *types.CreateImageRequest) error {
@@ -96,15 +98,35 @@ func (s *ServerController) UpdateImageStatus(ctx context.Context, req *types.Upd
 		klog.Infof("镜像(%s)已更新过，跳过远程更新", old.Name)
 	}
 
-	parts := strings.Split(req.Target, ":")
-	tag := parts[1]
+	// 目标版本可能按模板改写，优先使用 plugin 回调的源版本
+	targetTag := parseTargetTag(req.Target)
+	tag := req.Tag
+	if len(tag) == 0 {
+		tag = targetTag
+	}
+	if len(tag) == 0 {
+		return fmt.Errorf("无法从目标镜像 %s 中解析版本", req.Target)
+	}
+	if len(targetTag) == 0 {
+		targetTag = tag
+	}
 	if err = s.factory.Image().UpdateTag(ctx, req.ImageId, tag, map[string]interface{}{"status": req.Status, "message": req.Message}); err != nil {
-		klog.Errorf("更新镜像(%d)的版本(%d)状态失败:%v", req.ImageId, tag, err)
+		klog.Errorf("更新镜像(%d)的版本(%s)状态失败:%v", req.ImageId, tag, err)
 		return err
 	}
+	if req.Status == types.SyncImageComplete && len(req.Manifests) != 0 {
+		if err = s.recordTagPlatforms(ctx, req.ImageId, tag, req.Manifests); err != nil {
+			klog.Errorf("记录镜像(%d)版本(%s)的平台信息失败: %v", req.ImageId, tag, err)
+		}
+	}
+	if req.Status == types.SyncImageComplete && len(req.TargetDigest) != 0 {
+		if err = s.recordTagProvenance(ctx, req, tag); err != nil {
+			klog.Errorf("记录镜像(%d)版本(%s)的来源信息失败: %v", req.ImageId, tag, err)
+		}
+	}
 
-	// 当状态已经变成完成时，更新镜像的修改时间
-	if req.Status == types.SyncImageComplete {
+	// 当状态已经变成完成时，更新镜像的修改时间，未设置默认远程仓库(如离线环境)时跳过
+	if req.Status == types.SyncImageComplete && SwrClient != nil {
 		targetName := old.Name
 		if strings.Contains(targetName, "/") {
 			targetName = strings.ReplaceAll(targetName, "/", "$")
@@ -113,7 +135,7 @@ func (s *ServerController) UpdateImageStatus(ctx context.Context, req *types.Upd
 		newTag, err := SwrClient.ShowRepoTag(&swrmodel.ShowRepoTagRequest{
 			Namespace:  HuaweiNamespace,
 			Repository: targetName,
-			Tag:        tag,
+			Tag:        targetTag,
 		})
 		if err != nil {
 			klog.Warningf("获取远端新版本信息失败 %v", err)
@@ -623,6 +645,16 @@ func (s *ServerController) CreateImages(ctx context.Context, req *types.CreateIm
 		PublicImage: task.IsPublic,
 		IsOfficial:  task.IsOfficial,
 		Logo:        task.Logo,
+
+		NameTemplate: task.NameTemplate,
+		TagTemplate:  task.TagTemplate,
+	}
+	if len(task.Kubeadm) != 0 {
+		var profile kubeadm.Profile
+		if err = json.Unmarshal([]byte(task.Kubeadm), &profile); err != nil {
+			return nil, fmt.Errorf("解析任务的 kubeadm 配置失败 %v", err)
+		}
+		taskReq.Kubeadm = &profile
 	}
 	if err := s.CreateImageWithTag(ctx, req.TaskId, taskReq); err != nil {
 		klog.Errorf("创建k8s镜像记录失败 :%v", err)
@@ -681,12 +713,12 @@ func (s *ServerController) afterDeleteImageTag(ctx context.Context, image *model
 func (s *ServerController) DeleteImageTag(ctx context.Context, imageId int64, tagId int64) error {
 	err := s.factory.Image().DeleteTag(ctx, tagId)
 	if err != nil {
-		return fmt.Errorf("删除镜像(%d) tag %s 失败:%v", imageId, tagId, err)
+		return fmt.Errorf("删除镜像(%d) tag %d 失败:%v", imageId, tagId, err)
 	}
 
 	delTag, err := s.factory.Image().GetTag(ctx, tagId, true)
 	if err != nil {
-		klog.Errorf("获取已删除镜像(%d)的tag(%s) 失败: %v", imageId, tagId, err)
+		klog.Errorf("获取已删除镜像(%d)的tag(%d) 失败: %v", imageId, tagId, err)
 		return nil
 	}
 	image, err := s.factory.Image().Get(ctx, imageId, false)
@@ -704,6 +736,70 @@ func (s *ServerController) GetImageTag(ctx context.Context, imageId int64, tagId
 	return s.factory.Image().GetTag(ctx, tagId, false)
 }
 
+// recordTagPlatforms 记录多架构镜像版本中各平台的 manifest，重复同步时覆盖旧记录
+func (s *ServerController) recordTagPlatforms(ctx context.Context, imageId int64, tagName string, manifests []types.PlatformManifest) error {
+	tag, err := s.factory.Image().GetTagBy(ctx, db.WithImage(imageId), db.WithName(tagName))
+	if err != nil {
+		return err
+	}
+	if err = s.factory.Image().DeleteTagPlatforms(ctx, db.WithTagId(tag.Id)); err != nil {
+		return err
+	}
+
+	var platforms []model.TagPlatform
+	for _, m := range manifests {
+		platforms = append(platforms, model.TagPlatform{
+			ImageId:   imageId,
+			TagId:     tag.Id,
+			Platform:  m.Platform,
+			Digest:    m.Digest,
+			MediaType: m.MediaType,
+			Size:      m.Size,
+		})
+	}
+	return s.factory.Image().CreateTagPlatforms(ctx, platforms)
+}
+
+// recordTagProvenance 记录 plugin 校验通过的同步来源，同时更新版本的 digest
+func (s *ServerController) recordTagProvenance(ctx context.Context, req *types.UpdateImageStatusRequest, tagName string) error {
+	tag, err := s.factory.Image().GetTagBy(ctx, db.WithImage(req.ImageId), db.WithName(tagName))
+	if err != nil {
+		return err
+	}
+	task, err := s.factory.Task().Get(ctx, req.TaskId)
+	if err != nil {
+		return err
+	}
+
+	if err = s.factory.Image().CreateTagProvenance(ctx, &model.TagProvenance{
+		ImageId:      req.ImageId,
+		TagId:        tag.Id,
+		TaskId:       req.TaskId,
+		AgentName:    task.AgentName,
+		Source:       req.Source,
+		SourceDigest: req.SourceDigest,
+		Target:       req.Target,
+		TargetDigest: req.TargetDigest,
+	}); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{"digest": req.TargetDigest}
+	if len(req.MediaType) != 0 {
+		updates["media_type"] = req.MediaType
+		updates["artifact_type"] = req.ArtifactType
+	}
+	return s.factory.Image().UpdateTag(ctx, req.ImageId, tagName, updates)
+}
+
+// ListImageTagProvenances 获取镜像版本的同步来源记录，最近的记录在前
+func (s *ServerController) ListImageTagProvenances(ctx context.Context, imageId int64, tagId int64) (interface{}, error) {
+	return s.factory.Image().ListTagProvenances(ctx, db.WithImage(imageId), db.WithTagId(tagId), db.WithCreateOrderByDesc())
+}
+
+func (s *ServerController) ListImageTagPlatforms(ctx context.Context, imageId int64, tagId int64) (interface{}, error) {
+	return s.factory.Image().ListTagPlatforms(ctx, db.WithImage(imageId), db.WithTagId(tagId))
+}
+
 func (s *ServerController) CreateNamespace(ctx context.Context, req *types.CreateNamespaceRequest) error {
 	// 全局只能有一个命名空间
 	_, err := s.factory.Image().GetNamespace(ctx, db.WithName(req.Name))
@@ -923,3 +1019,14 @@ func (s *ServerController) DeleteImageLabel(ctx context.Context, imageId int64,
 func (s *ServerController) ListImageLabels(ctx context.Context, imageId int64, listOption types.ListOptions) (interface{}, error) {
 	return s.factory.Label().ListImageLabelsV2(ctx, imageId)
 }
+
+// parseTargetTag 返回目标镜像的版本，版本只能出现在最后一个 / 之后，避免把仓库端口当做版本
+func parseTargetTag(target string) string {
+	if i := strings.Index(target, "@"); i >= 0 {
+		target = target[:i]
+	}
+	if i := strings.LastIndex(target, ":"); i > strings.LastIndex(target, "/") {
+		return target[i+1:]
+	}
+	return ""
+}
@@ -0,0 +1,26 @@
+package rainbow
+
+import "testing"
+
+func TestParseTargetTag(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "harbor.example.com/library/nginx:1.25", want: "1.25"},
+		{target: "harbor.example.com:5000/library/nginx:1.25", want: "1.25"},
+		{target: "harbor.example.com:5000/library/nginx", want: ""},
+		{target: "nginx:latest", want: "latest"},
+		{target: "nginx", want: ""},
+		{target: "harbor.example.com:5000/library/nginx@sha256:0123", want: ""},
+		{target: "harbor.example.com:5000/library/nginx:1.25@sha256:0123", want: "1.25"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.target, func(t *testing.T) {
+			if got := parseTargetTag(tc.target); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package rainbow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/pkg/db"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util"
+	"github.com/caoyingjunz/rainbow/pkg/util/addons"
+)
+
+// ListKubernetesAddons 查询插件目录，指定 kubernetes 版本时仅返回支持该版本的插件
+func (s *ServerController) ListKubernetesAddons(ctx context.Context, req *types.ListKubernetesAddonRequest) ([]model.KubernetesAddon, error) {
+	objects, err := s.factory.Task().ListKubernetesAddons(ctx, db.WithName(req.Name), db.WithCategory(req.Category), db.WithOrderByASC())
+	if err != nil {
+		klog.Errorf("获取插件目录失败 %v", err)
+		return nil, err
+	}
+	if len(req.KubernetesVersion) == 0 {
+		return objects, nil
+	}
+
+	var result []model.KubernetesAddon
+	for _, object := range objects {
+		if addonFromModel(object).Supports(req.KubernetesVersion) {
+			result = append(result, object)
+		}
+	}
+	return result, nil
+}
+
+// SyncKubernetesAddons 通过 agent 拉取插件清单并更新插件目录，清单中不存在的插件会被删除
+func (s *ServerController) SyncKubernetesAddons(ctx context.Context, req *types.CallKubernetesAddonRequest) (interface{}, error) {
+	if len(req.URL) == 0 {
+		req.URL = s.cfg.Server.AddonManifest
+	}
+	if len(req.URL) == 0 {
+		return nil, fmt.Errorf("未配置插件清单地址")
+	}
+
+	key := uuid.NewString()
+	data, err := json.Marshal(types.CallMetaRequest{
+		Type:                       types.CallKubernetesAddonType,
+		Uid:                        key,
+		CallKubernetesAddonRequest: req,
+	})
+	if err != nil {
+		return nil, err
+	}
+	val, err := s.Call(ctx, req.ClientId, key, data)
+	if err != nil {
+		return nil, err
+	}
+	var manifest []addons.Addon
+	if err = json.Unmarshal(val, &manifest); err != nil {
+		klog.Errorf("反序列化插件清单失败 %v", err)
+		return nil, err
+	}
+
+	synced := make(map[string]bool)
+	for _, a := range manifest {
+		if err = s.factory.Task().CreateOrUpdateKubernetesAddon(ctx, &model.KubernetesAddon{
+			Name:          a.Name,
+			Version:       a.Version,
+			Category:      a.Category,
+			MinKubernetes: a.MinKubernetes,
+			MaxKubernetes: a.MaxKubernetes,
+			Images:        strings.Join(a.Images, ","),
+		}); err != nil {
+			klog.Errorf("同步插件(%s)失败 %v", a.Key(), err)
+			return nil, err
+		}
+		synced[a.Key()] = true
+	}
+
+	objects, err := s.factory.Task().ListKubernetesAddons(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for _, object := range objects {
+		k := object.Name + "@" + object.Version
+		if synced[k] {
+			continue
+		}
+		if err = s.factory.Task().DeleteKubernetesAddon(ctx, object.Id); err != nil {
+			klog.Errorf("删除插件(%s)失败 %v", k, err)
+			continue
+		}
+		deleted = append(deleted, k)
+	}
+
+	klog.Infof("插件目录同步完成，共 %d 个插件，删除 %v", len(synced), deleted)
+	return map[string]interface{}{"synced": len(synced), "deleted": deleted}, nil
+}
+
+// resolveAddons 将任务选择的插件解析为支持该 kubernetes 版本的 name@version
+func (s *ServerController) resolveAddons(ctx context.Context, selectors []string, kubernetesVersion string) ([]string, error) {
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+	objects, err := s.factory.Task().ListKubernetesAddons(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var catalogue []addons.Addon
+	for _, object := range objects {
+		catalogue = append(catalogue, addonFromModel(object))
+	}
+
+	var keys []string
+	for _, selector := range selectors {
+		a, err := addons.Resolve(catalogue, strings.TrimSpace(selector), kubernetesVersion)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, a.Key())
+	}
+	return keys, nil
+}
+
+func addonFromModel(object model.KubernetesAddon) addons.Addon {
+	return addons.Addon{
+		Name:          object.Name,
+		Category:      object.Category,
+		Version:       object.Version,
+		MinKubernetes: object.MinKubernetes,
+		MaxKubernetes: object.MaxKubernetes,
+		Images:        util.TrimAndFilter(strings.Split(object.Images, ",")),
+	}
+}
+
+// ProcessKubernetesAddons 拉取并校验插件清单
+func (s *AgentController) ProcessKubernetesAddons(ctx context.Context, req *types.CallKubernetesAddonRequest) ([]byte, error) {
+	data, err := DoHttpRequest(req.URL)
+	if err != nil {
+		return nil, fmt.Errorf("获取插件清单 %s 失败 %v", req.URL, err)
+	}
+	manifest, err := addons.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(manifest)
+}
+
+// addonImages 展开任务选择的插件，返回插件的全部镜像
+func (s *AgentController) addonImages(ctx context.Context, keys string) ([]string, error) {
+	var images []string
+	for _, k := range util.TrimAndFilter(strings.Split(keys, ",")) {
+		parts := strings.SplitN(k, "@", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("插件 %s 不合法", k)
+		}
+		objects, err := s.factory.Task().ListKubernetesAddons(ctx, db.WithName(parts[0]), db.WithVersion(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		if len(objects) == 0 {
+			return nil, fmt.Errorf("插件 %s 不存在", k)
+		}
+		images = append(images, addonFromModel(objects[0]).Images...)
+	}
+	return images, nil
+}
@@ -0,0 +1,278 @@
+package rainbow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/pkg/db"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/db/model/rainbow"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+)
+
+// maxPrefetchMinors latest-minors 策略最多保留的次版本数量
+const maxPrefetchMinors = 10
+
+func (s *ServerController) ListKubernetesPrefetches(ctx context.Context, listOption types.ListOptions) (interface{}, error) {
+	listOption.SetDefaultPageOption()
+
+	pageResult := types.PageResult{
+		PageRequest: types.PageRequest{
+			Page:  listOption.Page,
+			Limit: listOption.Limit,
+		},
+	}
+	opts := []db.Options{
+		db.WithUser(listOption.UserId),
+		db.WithNameLike(listOption.NameSelector),
+	}
+	var err error
+	pageResult.Total, err = s.factory.Task().CountKubernetesPrefetch(ctx, opts...)
+	if err != nil {
+		klog.Errorf("获取自动预取策略总数失败 %v", err)
+		pageResult.Message = err.Error()
+	}
+	offset := (listOption.Page - 1) * listOption.Limit
+	opts = append(opts, []db.Options{
+		db.WithModifyOrderByDesc(),
+		db.WithOffset(offset),
+		db.WithLimit(listOption.Limit),
+	}...)
+	pageResult.Items, err = s.factory.Task().ListKubernetesPrefetches(ctx, opts...)
+	if err != nil {
+		klog.Errorf("获取自动预取策略列表失败 %v", err)
+		pageResult.Message = err.Error()
+		return pageResult, err
+	}
+
+	return pageResult, nil
+}
+
+func (s *ServerController) GetKubernetesPrefetch(ctx context.Context, prefetchId int64) (interface{}, error) {
+	return s.factory.Task().GetKubernetesPrefetch(ctx, prefetchId)
+}
+
+func (s *ServerController) CreateKubernetesPrefetch(ctx context.Context, req *types.CreateKubernetesPrefetchRequest) error {
+	if len(req.Architecture) == 0 {
+		req.Architecture = defaultArch
+	}
+	if len(req.Driver) == 0 {
+		req.Driver = defaultDriver
+	}
+	if err := validatePrefetch(req.Policy, req.Minors, req.MinVersion, req.Architecture); err != nil {
+		return err
+	}
+
+	// 初始化仓库
+	if req.RegisterId == 0 {
+		req.RegisterId = *RegistryId
+	}
+
+	return s.factory.Task().CreateKubernetesPrefetch(ctx, &model.KubernetesPrefetch{
+		UserModel: rainbow.UserModel{
+			UserId:   req.UserId,
+			UserName: req.UserName,
+		},
+		Name:         req.Name,
+		Enable:       req.Enable,
+		Policy:       req.Policy,
+		Minors:       req.Minors,
+		MinVersion:   strings.TrimSpace(req.MinVersion),
+		RegisterId:   req.RegisterId,
+		Namespace:    req.Namespace,
+		Architecture: req.Architecture,
+		Driver:       req.Driver,
+		Addons:       strings.Join(req.Addons, ","),
+	})
+}
+
+func (s *ServerController) UpdateKubernetesPrefetch(ctx context.Context, req *types.UpdateKubernetesPrefetchRequest) error {
+	if len(req.Architecture) == 0 {
+		req.Architecture = defaultArch
+	}
+	if len(req.Driver) == 0 {
+		req.Driver = defaultDriver
+	}
+	if err := validatePrefetch(req.Policy, req.Minors, req.MinVersion, req.Architecture); err != nil {
+		return err
+	}
+
+	return s.factory.Task().UpdateKubernetesPrefetch(ctx, req.Id, req.ResourceVersion, map[string]interface{}{
+		"name":         req.Name,
+		"enable":       req.Enable,
+		"policy":       req.Policy,
+		"minors":       req.Minors,
+		"min_version":  strings.TrimSpace(req.MinVersion),
+		"namespace":    req.Namespace,
+		"architecture": req.Architecture,
+		"driver":       req.Driver,
+		"addons":       strings.Join(req.Addons, ","),
+	})
+}
+
+func (s *ServerController) DeleteKubernetesPrefetch(ctx context.Context, prefetchId int64) error {
+	return s.factory.Task().DeleteKubernetesPrefetch(ctx, prefetchId)
+}
+
+func validatePrefetch(policy string, minors int, minVersion string, arch string) error {
+	switch policy {
+	case types.PrefetchLatestMinors:
+		if minors <= 0 || minors > maxPrefetchMinors {
+			return fmt.Errorf("latest-minors 策略的次版本数量需在 1 到 %d 之间", maxPrefetchMinors)
+		}
+	case types.PrefetchSince:
+		if _, err := version.ParseGeneric(strings.TrimSpace(minVersion)); err != nil {
+			return fmt.Errorf("since 策略的最低版本(%s)不合法: %v", minVersion, err)
+		}
+	default:
+		return fmt.Errorf("不支持的自动预取策略(%s)，仅支持 %s 和 %s", policy, types.PrefetchLatestMinors, types.PrefetchSince)
+	}
+
+	return ValidateArch(arch)
+}
+
+// prefetchKubernetesVersions 为新发现的 kubernetes 版本匹配已启用的自动预取策略，并创建同步任务
+// 每个策略的匹配版本合并为一个任务，由 CreateTask 按版本拆分成子任务
+func (s *ServerController) prefetchKubernetesVersions(ctx context.Context, newVersions []string) {
+	if len(newVersions) == 0 {
+		return
+	}
+	prefetches, err := s.factory.Task().ListKubernetesPrefetches(ctx, db.WithEnable(1))
+	if err != nil {
+		klog.Errorf("获取自动预取策略失败 %v", err)
+		return
+	}
+	if len(prefetches) == 0 {
+		return
+	}
+
+	objects, err := s.factory.Task().ListKubernetesVersions(ctx)
+	if err != nil {
+		klog.Errorf("获取 kubernetes 版本失败 %v", err)
+		return
+	}
+	known := make([]string, 0, len(objects))
+	for _, object := range objects {
+		known = append(known, object.Tag)
+	}
+
+	for _, p := range prefetches {
+		matched := matchPrefetchVersions(p, newVersions, known)
+		if len(matched) == 0 {
+			continue
+		}
+
+		var addons []string
+		if len(p.Addons) != 0 {
+			addons = strings.Split(p.Addons, ",")
+		}
+		if err = s.CreateTask(ctx, &types.CreateTaskRequest{
+			Name:              "prefetch-" + p.Name,
+			UserId:            p.UserId,
+			UserName:          p.UserName,
+			RegisterId:        p.RegisterId,
+			Type:              1,
+			KubernetesVersion: strings.Join(matched, ","),
+			Namespace:         p.Namespace,
+			Architecture:      p.Architecture,
+			Driver:            p.Driver,
+			PublicImage:       true,
+			Addons:            addons,
+			OwnerRef:          types.PrefetchOwnerRef,
+			PrefetchId:        p.Id,
+		}); err != nil {
+			klog.Errorf("自动预取策略(%s)创建 kubernetes(%v) 同步任务失败 %v", p.Name, matched, err)
+			continue
+		}
+
+		if err = s.factory.Task().UpdateKubernetesPrefetch(ctx, p.Id, p.ResourceVersion, map[string]interface{}{
+			"last_version": matched[len(matched)-1],
+		}); err != nil {
+			klog.Warningf("更新自动预取策略(%s)的最近版本失败 %v", p.Name, err)
+		}
+		klog.Infof("自动预取策略(%s)已创建 kubernetes(%v) 同步任务", p.Name, matched)
+	}
+}
+
+// matchPrefetchVersions 返回 newVersions 中匹配策略的正式版本，按版本从低到高排序
+// known 为全部已知版本，用于计算 latest-minors 策略的最近次版本，预发布版本不参与匹配
+func matchPrefetchVersions(p model.KubernetesPrefetch, newVersions []string, known []string) []string {
+	var match func(v *version.Version) bool
+	switch p.Policy {
+	case types.PrefetchLatestMinors:
+		minors := latestMinors(known, p.Minors)
+		match = func(v *version.Version) bool {
+			return minors[minorKey(v)]
+		}
+	case types.PrefetchSince:
+		minVersion, err := version.ParseGeneric(p.MinVersion)
+		if err != nil {
+			return nil
+		}
+		match = func(v *version.Version) bool {
+			return v.AtLeast(minVersion)
+		}
+	default:
+		return nil
+	}
+
+	type tagVersion struct {
+		tag     string
+		version *version.Version
+	}
+	var matched []tagVersion
+	for _, nv := range newVersions {
+		v, err := version.ParseSemantic(nv)
+		if err != nil || len(v.PreRelease()) != 0 {
+			continue
+		}
+		if match(v) {
+			matched = append(matched, tagVersion{tag: nv, version: v})
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].version.LessThan(matched[j].version)
+	})
+
+	versions := make([]string, 0, len(matched))
+	for _, m := range matched {
+		versions = append(versions, m.tag)
+	}
+	return versions
+}
+
+// latestMinors 返回已知正式版本中最新的 n 个次版本
+func latestMinors(known []string, n int) map[string]bool {
+	var minors []*version.Version
+	seen := make(map[string]bool)
+	for _, k := range known {
+		v, err := version.ParseSemantic(k)
+		if err != nil || len(v.PreRelease()) != 0 {
+			continue
+		}
+		key := minorKey(v)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		minors = append(minors, version.MajorMinor(v.Major(), v.Minor()))
+	}
+	sort.Slice(minors, func(i, j int) bool {
+		return minors[j].LessThan(minors[i])
+	})
+
+	result := make(map[string]bool)
+	for i := 0; i < len(minors) && i < n; i++ {
+		result[minorKey(minors[i])] = true
+	}
+	return result
+}
+
+func minorKey(v *version.Version) string {
+	return fmt.Sprintf("%d.%d", v.Major(), v.Minor())
+}
@@ -0,0 +1,127 @@
+package rainbow
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+)
+
+func TestMatchPrefetchVersions(t *testing.T) {
+	known := []string{
+		"v1.28.0", "v1.28.15",
+		"v1.29.0", "v1.29.10",
+		"v1.30.0", "v1.30.6",
+		"v1.32.0-alpha.1",
+	}
+
+	tests := []struct {
+		name        string
+		prefetch    model.KubernetesPrefetch
+		newVersions []string
+		known       []string
+		want        []string
+	}{
+		{
+			name:        "latest minors",
+			prefetch:    model.KubernetesPrefetch{Policy: types.PrefetchLatestMinors, Minors: 2},
+			newVersions: []string{"v1.30.7", "v1.29.11", "v1.28.16"},
+			known:       append(known, "v1.30.7", "v1.29.11", "v1.28.16"),
+			want:        []string{"v1.29.11", "v1.30.7"},
+		},
+		{
+			name:        "latest minors with a new minor in the same batch",
+			prefetch:    model.KubernetesPrefetch{Policy: types.PrefetchLatestMinors, Minors: 2},
+			newVersions: []string{"v1.31.0", "v1.30.7", "v1.29.11"},
+			known:       append(known, "v1.31.0", "v1.30.7", "v1.29.11"),
+			want:        []string{"v1.30.7", "v1.31.0"},
+		},
+		{
+			name:        "latest minors skips pre-release",
+			prefetch:    model.KubernetesPrefetch{Policy: types.PrefetchLatestMinors, Minors: 1},
+			newVersions: []string{"v1.32.0-beta.0", "v1.30.7"},
+			known:       append(known, "v1.32.0-beta.0", "v1.30.7"),
+			want:        []string{"v1.30.7"},
+		},
+		{
+			name:        "since",
+			prefetch:    model.KubernetesPrefetch{Policy: types.PrefetchSince, MinVersion: "v1.29.5"},
+			newVersions: []string{"v1.30.7", "v1.29.4", "v1.29.11", "v1.28.16"},
+			known:       known,
+			want:        []string{"v1.29.11", "v1.30.7"},
+		},
+		{
+			name:        "since skips pre-release",
+			prefetch:    model.KubernetesPrefetch{Policy: types.PrefetchSince, MinVersion: "1.30"},
+			newVersions: []string{"v1.31.0-rc.1", "v1.31.0", "v1.30.0"},
+			known:       known,
+			want:        []string{"v1.30.0", "v1.31.0"},
+		},
+		{
+			name:        "since with invalid min version",
+			prefetch:    model.KubernetesPrefetch{Policy: types.PrefetchSince, MinVersion: "latest"},
+			newVersions: []string{"v1.30.7"},
+			known:       known,
+		},
+		{
+			name:        "unknown policy",
+			prefetch:    model.KubernetesPrefetch{Policy: "all"},
+			newVersions: []string{"v1.30.7"},
+			known:       known,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := matchPrefetchVersions(tc.prefetch, tc.newVersions, tc.known)
+			if len(got) == 0 && len(tc.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLatestMinors(t *testing.T) {
+	tests := []struct {
+		name  string
+		known []string
+		n     int
+		want  map[string]bool
+	}{
+		{
+			name:  "dedup patches",
+			known: []string{"v1.28.0", "v1.29.0", "v1.29.3", "v1.30.1"},
+			n:     2,
+			want:  map[string]bool{"1.30": true, "1.29": true},
+		},
+		{
+			name:  "pre-release does not count as a minor",
+			known: []string{"v1.29.0", "v1.30.1", "v1.31.0-alpha.3"},
+			n:     1,
+			want:  map[string]bool{"1.30": true},
+		},
+		{
+			name:  "fewer minors than requested",
+			known: []string{"v1.30.1", "invalid"},
+			n:     3,
+			want:  map[string]bool{"1.30": true},
+		},
+		{
+			name: "empty",
+			n:    2,
+			want: map[string]bool{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := latestMinors(tc.known, tc.n); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
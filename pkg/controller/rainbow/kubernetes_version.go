@@ -3,6 +3,7 @@ package rainbow
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	"github.com/google/uuid"
 	"k8s.io/klog/v2"
@@ -10,8 +11,12 @@ import (
 	"github.com/caoyingjunz/rainbow/pkg/db"
 	"github.com/caoyingjunz/rainbow/pkg/db/model"
 	"github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util/kubeadm"
 )
 
+// kubernetesComponentBatch 单次远程调用获取组件版本的 kubernetes 版本数量，避免超过远程调用的等待时间
+const kubernetesComponentBatch = 10
+
 func (s *ServerController) ListKubernetesVersions(ctx context.Context, listOption types.ListOptions) (interface{}, error) {
 	// 初始化分页属性
 	listOption.SetDefaultPageOption()
@@ -99,9 +104,121 @@ func (s *ServerController) SyncKubernetesTags(ctx context.Context, req *types.Ca
 	}
 
 	klog.Infof("新增k8s同步版本(%v)", addVersions)
+	s.syncKubernetesComponents(ctx, req.ClientId)
+	// 首次同步时全部版本均为新增，不触发自动预取
+	if len(oldTags) != 0 {
+		s.prefetchKubernetesVersions(ctx, addVersions)
+	}
 	return addVersions, nil
 }
 
+// syncKubernetesComponents 补全缺少组件版本的 kubernetes 版本，每次最多处理 kubernetesComponentBatch 个，优先处理新版本
+func (s *ServerController) syncKubernetesComponents(ctx context.Context, clientId string) {
+	versions, err := s.factory.Task().ListKubernetesVersions(ctx, db.WithTagOrderByDESC())
+	if err != nil {
+		klog.Errorf("获取 kubernetes 版本失败 %v", err)
+		return
+	}
+	var missing []string
+	for _, v := range versions {
+		if len(v.PauseVersion) == 0 {
+			missing = append(missing, v.Tag)
+		}
+		if len(missing) >= kubernetesComponentBatch {
+			break
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	key := uuid.NewString()
+	data, err := json.Marshal(types.CallMetaRequest{
+		Type: types.CallKubernetesComponentType,
+		Uid:  key,
+		CallKubernetesComponentRequest: &types.CallKubernetesComponentRequest{
+			ClientId: clientId,
+			Versions: missing,
+		},
+	})
+	if err != nil {
+		return
+	}
+	val, err := s.Call(ctx, clientId, key, data)
+	if err != nil {
+		klog.Errorf("获取 kubernetes 组件版本失败 %v", err)
+		return
+	}
+	var components []kubeadm.Components
+	if err = json.Unmarshal(val, &components); err != nil {
+		klog.Errorf("反序列化 kubernetes 组件版本失败 %v", err)
+		return
+	}
+
+	for _, c := range components {
+		if err = s.factory.Task().UpdateKubernetesVersion(ctx, c.Version, componentUpdates(c)); err != nil {
+			klog.Errorf("更新 kubernetes(%s) 组件版本失败 %v", c.Version, err)
+			continue
+		}
+		klog.Infof("kubernetes(%s) 组件版本已更新 pause(%s) etcd(%s) coredns(%s)", c.Version, c.Pause, c.Etcd, c.CoreDNS)
+	}
+}
+
+// kubernetesComponents 返回 kubernetes 版本的组件版本，数据库中不存在时直接从 kubeadm 源码中解析并保存
+// 获取失败时返回 nil，plugin 回退到使用 kubeadm 生成镜像列表
+func (s *AgentController) kubernetesComponents(ctx context.Context, version string) *kubeadm.Components {
+	object, err := s.factory.Task().GetKubernetesVersion(ctx, version)
+	if err == nil && len(object.PauseVersion) != 0 {
+		return &kubeadm.Components{
+			Version:         object.Tag,
+			ImageRepository: object.ImageRepository,
+			Pause:           object.PauseVersion,
+			Etcd:            object.EtcdVersion,
+			CoreDNS:         object.CoreDNSVersion,
+		}
+	}
+
+	c, err := fetchKubernetesComponents(version)
+	if err != nil {
+		klog.Warningf("获取 kubernetes(%s) 组件版本失败 %v，将使用 kubeadm 获取镜像列表", version, err)
+		return nil
+	}
+	if object != nil {
+		if err = s.factory.Task().UpdateKubernetesVersion(ctx, version, componentUpdates(*c)); err != nil {
+			klog.Errorf("更新 kubernetes(%s) 组件版本失败 %v", version, err)
+		}
+	}
+	return c
+}
+
+// applyKubeadmProfile 在组件版本上应用任务的自定义 kubeadm 配置
+// 自定义配置需要完整的组件版本，无法获取默认组件版本时直接报错，不再回退到 kubeadm
+func (s *AgentController) applyKubeadmProfile(data string, c *kubeadm.Components) (*kubeadm.Components, error) {
+	var profile kubeadm.Profile
+	if err := json.Unmarshal([]byte(data), &profile); err != nil {
+		return nil, fmt.Errorf("解析任务的 kubeadm 配置失败 %v", err)
+	}
+	if c == nil {
+		return nil, fmt.Errorf("未能获取默认组件版本，无法应用 kubeadm 配置(%s)", profile.Name)
+	}
+
+	applied, err := profile.Apply(*c)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("kubernetes(%s) 使用 kubeadm 配置(%s)生成镜像列表 %+v", c.Version, profile.Name, *applied)
+	return applied, nil
+}
+
+func componentUpdates(c kubeadm.Components) map[string]interface{} {
+	return map[string]interface{}{
+		"image_repository": c.ImageRepository,
+		"pause_version":    c.Pause,
+		"etcd_version":     c.Etcd,
+		"coredns_version":  c.CoreDNS,
+	}
+}
+
 type Tag struct {
 	Name string `json:"name"`
 }
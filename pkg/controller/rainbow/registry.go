@@ -10,12 +10,19 @@ import (
 	"github.com/caoyingjunz/rainbow/pkg/db/model"
 	"github.com/caoyingjunz/rainbow/pkg/types"
 	"github.com/caoyingjunz/rainbow/pkg/util/docker"
+	"github.com/caoyingjunz/rainbow/pkg/util/naming"
 )
 
 func (s *ServerController) CreateRegistry(ctx context.Context, req *types.CreateRegistryRequest) error {
 	if strings.Contains(req.Password, ";") {
 		return fmt.Errorf("镜像仓库密码不能包含特殊字符串 !")
 	}
+	if err := (naming.Rule{Name: req.NameTemplate, Tag: req.TagTemplate}).Validate(); err != nil {
+		return err
+	}
+	if err := validateTransfer("", req.ParallelImages, req.ParallelLayers, req.BandwidthLimit); err != nil {
+		return err
+	}
 
 	_, err := s.factory.Registry().Create(ctx, &model.Registry{
 		Name:       req.Name,
@@ -25,6 +32,15 @@ func (s *ServerController) CreateRegistry(ctx context.Context, req *types.Create
 		Username:   req.Username,
 		Password:   req.Password,
 		Role:       req.Role,
+
+		NameTemplate: req.NameTemplate,
+		TagTemplate:  req.TagTemplate,
+
+		ParallelImages: req.ParallelImages,
+		ParallelLayers: req.ParallelLayers,
+		BandwidthLimit: req.BandwidthLimit,
+
+		Insecure: req.Insecure,
 	})
 
 	return err
@@ -32,7 +48,7 @@ func (s *ServerController) CreateRegistry(ctx context.Context, req *types.Create
 
 func (s *ServerController) LoginRegistry(ctx context.Context, req *types.CreateRegistryRequest) error {
 	if err := docker.LoginDocker(req.Repository, req.Username, req.Password); err != nil {
-		klog.Error("登陆镜像仓库 (%s) 失败 %v", req.Repository, err)
+		klog.Errorf("登陆镜像仓库 (%s) 失败 %v", req.Repository, err)
 		return err
 	}
 
@@ -46,6 +62,12 @@ func (s *ServerController) UpdateRegistry(ctx context.Context, req *types.Update
 	if strings.Contains(req.Password, ";") {
 		return fmt.Errorf("镜像仓库密码不能包含特殊字符串 !")
 	}
+	if err := (naming.Rule{Name: req.NameTemplate, Tag: req.TagTemplate}).Validate(); err != nil {
+		return err
+	}
+	if err := validateTransfer("", req.ParallelImages, req.ParallelLayers, req.BandwidthLimit); err != nil {
+		return err
+	}
 
 	return s.factory.Registry().Update(ctx, req.Id, req.ResourceVersion, map[string]interface{}{
 		"user_id":    req.UserId,
@@ -53,6 +75,15 @@ func (s *ServerController) UpdateRegistry(ctx context.Context, req *types.Update
 		"namespace":  req.Namespace,
 		"username":   req.Username,
 		"password":   req.Password,
+
+		"name_template": req.NameTemplate,
+		"tag_template":  req.TagTemplate,
+
+		"parallel_images": req.ParallelImages,
+		"parallel_layers": req.ParallelLayers,
+		"bandwidth_limit": req.BandwidthLimit,
+
+		"insecure": req.Insecure,
 	})
 }
 
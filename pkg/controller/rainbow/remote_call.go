@@ -3,6 +3,7 @@ package rainbow
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -243,7 +244,7 @@ func (s *ServerController) doSearch(ctx context.Context, clientId string, key st
 	}
 	if sr.StatusCode != 0 {
 		klog.Errorf("doSearch 远程调用失败 %v", err)
-		return nil, fmt.Errorf(sr.ErrMessage)
+		return nil, errors.New(sr.ErrMessage)
 	}
 
 	return sr.Result, nil
@@ -289,7 +290,7 @@ func (s *ServerController) CallV2(ctx context.Context, clientId string, key stri
 	}
 	if sr.StatusCode != 0 {
 		klog.Errorf("远程调用失败 %v", err)
-		return nil, fmt.Errorf(sr.ErrMessage)
+		return nil, errors.New(sr.ErrMessage)
 	}
 
 	return sr.Result, nil
@@ -328,7 +329,7 @@ func (s *ServerController) Call(ctx context.Context, clientId string, key string
 	}
 	if sr.StatusCode != 0 {
 		klog.Errorf("远程调用失败 %v", err)
-		return nil, fmt.Errorf(sr.ErrMessage)
+		return nil, errors.New(sr.ErrMessage)
 	}
 
 	return sr.Result, nil
@@ -42,6 +42,13 @@ type ServerInterface interface {
 	LoginRegistry(ctx context.Context, req *types.CreateRegistryRequest) error
 
 	CreateTask(ctx context.Context, req *types.CreateTaskRequest) error
+	CreateTaskFromFile(ctx *gin.Context) (*types.ImageFileResult, error)
+	ImportTaskArchive(ctx *gin.Context) (*types.ImportArchiveResult, error)
+
+	UploadTaskExport(ctx *gin.Context, taskId int64) error
+	GetTaskExport(ctx context.Context, taskId int64) (*model.TaskExport, error)
+	DownloadTaskExport(ctx context.Context, taskId int64) (string, *model.TaskExport, error)
+
 	UpdateTask(ctx context.Context, req *types.UpdateTaskRequest) error
 	ListTasks(ctx context.Context, listOption types.ListOptions) (interface{}, error)
 	DeleteTask(ctx context.Context, taskId int64) error
@@ -72,6 +79,26 @@ type ServerInterface interface {
 	GetAgent(ctx context.Context, agentId int64) (interface{}, error)
 	ListAgents(ctx context.Context, listOption types.ListOptions) (interface{}, error)
 	UpdateAgentStatus(ctx context.Context, req *types.UpdateAgentStatusRequest) error
+	ListAgentHeartbeats(ctx context.Context, listOption types.ListOptions) (interface{}, error)
+
+	GetAgentLogs(ctx context.Context, req *types.GetAgentLogsRequest) (interface{}, error)
+	DiagnoseAgent(ctx context.Context, agentId int64) (interface{}, error)
+
+	CordonAgent(ctx context.Context, agentName string) error
+	UncordonAgent(ctx context.Context, agentName string) error
+	DrainAgent(ctx context.Context, agentName string) (interface{}, error)
+
+	UpdateAgentBudget(ctx context.Context, req *types.UpdateAgentBudgetRequest) error
+	ListAgentUsages(ctx context.Context, listOption types.ListOptions) (interface{}, error)
+
+	CreateGithubAccount(ctx context.Context, req *types.CreateGithubAccountRequest) error
+	DeleteGithubAccount(ctx context.Context, accountId int64) error
+	ListGithubAccounts(ctx context.Context, listOption types.ListOptions) (interface{}, error)
+
+	CreateAgentRollout(ctx context.Context, req *types.CreateAgentRolloutRequest) error
+	GetAgentRollout(ctx context.Context, rolloutId int64) (interface{}, error)
+	ListAgentRollouts(ctx context.Context, listOption types.ListOptions) (interface{}, error)
+	ListAgentRolloutMessages(ctx context.Context, rolloutId int64) (interface{}, error)
 
 	CreateAgentRepo(ctx context.Context, req *types.CallGithubRequest) (interface{}, error)
 	SyncAgentRepos(ctx context.Context, req *types.CallGithubRequest) error
@@ -95,6 +122,8 @@ type ServerInterface interface {
 	CreateImages(ctx context.Context, req *types.CreateImagesRequest) ([]model.Image, error)
 	DeleteImageTag(ctx context.Context, imageId int64, TagId int64) error
 	GetImageTag(ctx context.Context, imageId int64, tagId int64) (interface{}, error)
+	ListImageTagPlatforms(ctx context.Context, imageId int64, tagId int64) (interface{}, error)
+	ListImageTagProvenances(ctx context.Context, imageId int64, tagId int64) (interface{}, error)
 
 	BindImageLabels(ctx context.Context, imageId int64, req types.BindImageLabels) error
 	ListImageLabels(ctx context.Context, imageId int64, listOption types.ListOptions) (interface{}, error)
@@ -132,6 +161,13 @@ type ServerInterface interface {
 
 	CreateTaskMessage(ctx context.Context, req types.CreateTaskMessageRequest) error
 	ListTaskMessages(ctx context.Context, taskId int64) (interface{}, error)
+	UpdateImageProgress(ctx context.Context, req *types.UpdateImageProgressRequest) error
+	GetTaskProgress(ctx context.Context, taskId int64) (*types.TaskProgress, error)
+	BatchCallback(ctx context.Context, req *types.BatchCallbackRequest) (*types.BatchCallbackResult, error)
+	UpdateImageStage(ctx context.Context, req *types.UpdateImageStageRequest) error
+	ListImageStages(ctx context.Context, taskId int64) ([]model.ImageStage, error)
+	AuthenticateCallback(ctx context.Context, token string) (int64, error)
+	ValidateCallbackImage(ctx context.Context, taskId int64, imageId int64) error
 
 	ListArchitectures(ctx context.Context, listOption types.ListOptions) ([]string, error)
 
@@ -156,6 +192,14 @@ type ServerInterface interface {
 
 	ListKubernetesVersions(ctx context.Context, listOption types.ListOptions) (interface{}, error)
 	SyncKubernetesTags(ctx context.Context, req *types.CallKubernetesTagRequest) (interface{}, error)
+	ListKubernetesAddons(ctx context.Context, req *types.ListKubernetesAddonRequest) ([]model.KubernetesAddon, error)
+	SyncKubernetesAddons(ctx context.Context, req *types.CallKubernetesAddonRequest) (interface{}, error)
+
+	CreateKubernetesPrefetch(ctx context.Context, req *types.CreateKubernetesPrefetchRequest) error
+	UpdateKubernetesPrefetch(ctx context.Context, req *types.UpdateKubernetesPrefetchRequest) error
+	DeleteKubernetesPrefetch(ctx context.Context, prefetchId int64) error
+	GetKubernetesPrefetch(ctx context.Context, prefetchId int64) (interface{}, error)
+	ListKubernetesPrefetches(ctx context.Context, listOption types.ListOptions) (interface{}, error)
 
 	ListRainbowds(ctx context.Context, listOption types.ListOptions) (interface{}, error)
 
@@ -292,6 +336,8 @@ func (s *ServerController) RegisterRainbowd(ctx context.Context) error {
 }
 
 func (s *ServerController) Run(ctx context.Context, workers int) error {
+	s.recoverImportTasks(ctx)
+
 	go s.schedule(ctx)
 	go s.sync(ctx)
 	go s.startSyncDailyPulls(ctx)
@@ -299,6 +345,8 @@ func (s *ServerController) Run(ctx context.Context, workers int) error {
 	go s.startAgentHeartbeat(ctx)
 	go s.startSyncKubernetesTags(ctx)
 	go s.startSubscribeController(ctx)
+	go s.startAgentRolloutController(ctx)
+	go s.startAgentBudgetController(ctx)
 
 	//klog.Infof("starting rocketmq producer")
 	//if err := s.Producer.Start(); err != nil {
@@ -395,7 +443,7 @@ func (s *ServerController) startSubscribeController(ctx context.Context) {
 			}
 
 			if err = s.RunSubscribe(ctx, &types.RunSubscribeRequest{SubscribeId: sub.Id}); err != nil {
-				klog.Error("failed to do Subscribe(%s) %v", sub.Path, err)
+				klog.Errorf("failed to do Subscribe(%s) %v", sub.Path, err)
 				s.CreateSubscribeMessageAndFailTimesAdd(ctx, sub, err.Error())
 			} else {
 				s.CreateSubscribeMessageWithLog(ctx, sub, fmt.Sprintf("%s 在 %v 订阅触发成功", sub.Path, time.Now().Format("2006-01-02 15:04:05")))
@@ -415,7 +463,12 @@ func (s *ServerController) startSyncKubernetesTags(ctx context.Context) {
 	opt := types.CallKubernetesTagRequest{SyncAll: false}
 	for range ticker.C {
 		if _, err := s.SyncKubernetesTags(ctx, &opt); err != nil {
-			klog.Error("failed kubernetes version syncer %v", err)
+			klog.Errorf("failed kubernetes version syncer %v", err)
+		}
+		if len(s.cfg.Server.AddonManifest) != 0 {
+			if _, err := s.SyncKubernetesAddons(ctx, &types.CallKubernetesAddonRequest{}); err != nil {
+				klog.Errorf("同步 kubernetes 插件目录失败 %v", err)
+			}
 		}
 	}
 }
@@ -479,7 +532,7 @@ func (s *ServerController) schedule(ctx context.Context) {
 
 	for range ticker.C {
 		if err := s.doSchedule(ctx); err != nil {
-			klog.Error("failed to do schedule %v", err)
+			klog.Errorf("failed to do schedule %v", err)
 		}
 	}
 }
@@ -579,6 +632,11 @@ func (s *ServerController) assignAgent(ctx context.Context) (string, error) {
 		return "", nil
 	}
 
+	// 优先调度到健康的 agent，全部异常时保持原有调度
+	if healthy := filterHealthyAgents(agents); len(healthy) != 0 {
+		agents = healthy
+	}
+
 	var agentNames []string
 	agentMap := make(map[string]int)
 	for _, agent := range agents {
@@ -662,12 +720,17 @@ func (s *ServerController) startAgentHeartbeat(ctx context.Context) {
 				}
 				err = s.factory.Agent().UpdateByName(ctx, agent.Name, map[string]interface{}{"status": model.UnknownAgentType, "message": "Agent stopped posting status"})
 				if err != nil {
-					klog.Error("failed to sync agent %s status %v", agent.Name, err)
+					klog.Errorf("failed to sync agent %s status %v", agent.Name, err)
 				} else {
 					klog.Infof("agent(%s)被设置成未知", agent.Name)
 				}
 			}
 		}
+
+		// 心跳时序仅保留最近 7 天
+		if err = s.factory.Agent().DeleteHeartbeats(ctx, db.WithCreatedBefore(time.Now().Add(-7*24*time.Hour))); err != nil {
+			klog.Warningf("清理 agent 心跳记录失败 %v", err)
+		}
 	}
 }
 
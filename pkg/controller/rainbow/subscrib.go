@@ -106,6 +106,8 @@ func (s *ServerController) runSubscribeFull(ctx context.Context, sub *model.Subs
 		Driver:       types.SkopeoDriver,
 		PublicImage:  true,
 		Architecture: sub.Arch,
+		Signatures:   sub.Signatures,
+		PublicKey:    sub.PublicKey,
 	}); err != nil {
 		klog.Errorf("创建订阅镜像任务失败 %v", err)
 		return err
@@ -215,6 +217,8 @@ func (s *ServerController) runSubscribeIncrement(ctx context.Context, sub *model
 		Driver:       types.SkopeoDriver,
 		PublicImage:  true,
 		Architecture: sub.Arch,
+		Signatures:   sub.Signatures,
+		PublicKey:    sub.PublicKey,
 	}); err != nil {
 		klog.Errorf("创建订阅镜像任务失败 %v", err)
 		return err
@@ -375,6 +379,9 @@ func (s *ServerController) preCreateSubscribe(ctx context.Context, req *types.Cr
 	if err := ValidateArch(req.Arch); err != nil {
 		return err
 	}
+	if err := ValidatePublicKey(req.PublicKey); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -453,6 +460,8 @@ func (s *ServerController) CreateSubscribe(ctx context.Context, req *types.Creat
 		Policy:     strings.TrimSpace(req.Policy),
 		Arch:       req.Arch,
 		Rewrite:    req.Rewrite,
+		Signatures: req.Signatures,
+		PublicKey:  req.PublicKey,
 	})
 }
 
@@ -463,6 +472,9 @@ func (s *ServerController) preUpdateSubscribe(ctx context.Context, req *types.Up
 	if err := ValidateArch(req.Arch); err != nil {
 		return err
 	}
+	if err := ValidatePublicKey(req.PublicKey); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -478,6 +490,8 @@ func (s *ServerController) UpdateSubscribe(ctx context.Context, req *types.Updat
 		"policy":     req.Policy,
 		"arch":       req.Arch,
 		"rewrite":    req.Rewrite,
+		"signatures": req.Signatures,
+		"public_key": req.PublicKey,
 	}
 
 	enable := req.Enable
@@ -2,7 +2,13 @@ package rainbow
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -11,11 +17,15 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 
+	rainbowconfig "github.com/caoyingjunz/rainbow/cmd/app/config"
 	"github.com/caoyingjunz/rainbow/pkg/db"
 	"github.com/caoyingjunz/rainbow/pkg/db/model"
 	"github.com/caoyingjunz/rainbow/pkg/types"
 	"github.com/caoyingjunz/rainbow/pkg/util"
 	"github.com/caoyingjunz/rainbow/pkg/util/errors"
+	"github.com/caoyingjunz/rainbow/pkg/util/imagelist"
+	"github.com/caoyingjunz/rainbow/pkg/util/naming"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
 	"github.com/caoyingjunz/rainbow/pkg/util/uuid"
 )
 
@@ -29,9 +39,13 @@ const (
 
 const (
 	defaultNamespace = "emptyNamespace" // pixiuHub 内置默认空命名空间
+	maxImageFileSize = 1 << 20          // 镜像列表文件的最大长度
 	defaultArch      = "linux/amd64"
 	defaultDriver    = "skopeo"
 
+	maxParallelImages = 20 // 单个任务同时同步的最大镜像数量
+	maxParallelLayers = 16 // 单个镜像同时复制的最大层数
+
 	k8sImageCount      = 5   // 默认数量
 	defaultRemainCount = 100 // TODO 临时设置，后续缩降到 20
 )
@@ -41,6 +55,42 @@ func (s *ServerController) preCreateTask(ctx context.Context, req *types.CreateT
 	if err := ValidateArch(req.Architecture); err != nil {
 		return err
 	}
+	if err := validateArtifactKind(req); err != nil {
+		return err
+	}
+	if err := validatePlatforms(req); err != nil {
+		return err
+	}
+	if err := validateStages(req.Stages, s.cfg.Server.ExecStages); err != nil {
+		return err
+	}
+	if err := validateExport(req); err != nil {
+		return err
+	}
+	driver := req.Driver
+	if len(driver) == 0 {
+		driver = defaultDriver
+	}
+	if err := validateTransfer(driver, req.ParallelImages, req.ParallelLayers, req.BandwidthLimit); err != nil {
+		return err
+	}
+	if len(req.Addons) != 0 && req.Type != 1 {
+		return fmt.Errorf("仅 kubernetes 任务支持同步插件")
+	}
+	if req.Kubeadm != nil {
+		if req.Type != 1 {
+			return fmt.Errorf("仅 kubernetes 任务支持自定义 kubeadm 配置")
+		}
+		if err := req.Kubeadm.Validate(strings.Split(req.KubernetesVersion, ",")...); err != nil {
+			return err
+		}
+	}
+	if err := ValidatePublicKey(req.PublicKey); err != nil {
+		return err
+	}
+	if err := (naming.Rule{Name: req.NameTemplate, Tag: req.TagTemplate}).Validate(); err != nil {
+		return err
+	}
 
 	// 验证该用户是否还有余额
 	if err := s.validateUserQuota(ctx, req); err != nil {
@@ -71,6 +121,182 @@ func (s *ServerController) preCreateTask(ctx context.Context, req *types.CreateT
 	return nil
 }
 
+// validateArtifactKind 校验制品类型，非镜像制品按原样同步，仅支持 native 驱动且不能指定平台
+func validateArtifactKind(req *types.CreateTaskRequest) error {
+	switch req.ArtifactKind {
+	case "", types.ImageArtifact:
+		return nil
+	case types.HelmArtifact, types.WasmArtifact, types.SBOMArtifact, types.GenericArtifact:
+	default:
+		return fmt.Errorf("不支持的制品类型 %s", req.ArtifactKind)
+	}
+
+	if req.Type != 0 {
+		return fmt.Errorf("kubernetes 任务不支持制品类型 %s", req.ArtifactKind)
+	}
+	if len(req.Platforms) != 0 {
+		return fmt.Errorf("制品类型 %s 按原样同步，不支持指定平台", req.ArtifactKind)
+	}
+	if len(req.Driver) == 0 {
+		req.Driver = types.NativeDriver
+	}
+	if req.Driver != types.NativeDriver {
+		return fmt.Errorf("制品类型 %s 仅支持 native 驱动", req.ArtifactKind)
+	}
+	return nil
+}
+
+// validateStages 校验 plugin 同步镜像的阶段，必须包含且只能包含一个 copy 阶段，
+// verify-digest 和 signatures 依赖同步结果，只能在 copy 之后执行，signatures 还需要在 verify-digest 之后执行
+// exec 阶段在 runner 上执行命令，只能按名称引用管理员配置的 execStages，命令和超时时间从配置中填充
+func validateStages(stages []rainbowconfig.Stage, execStages []rainbowconfig.Stage) error {
+	if len(stages) == 0 {
+		return nil
+	}
+
+	var copied, verified bool
+	names := sets.NewString()
+	for i, stage := range stages {
+		name := stage.GetName()
+		if names.Has(name) {
+			return fmt.Errorf("阶段名称 %s 重复", name)
+		}
+		names.Insert(name)
+
+		switch stage.Type {
+		case types.StageValidateSourcePolicy:
+			for _, pattern := range stage.AllowedSources {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("阶段 %s 的源镜像规则 %s 不合法", name, pattern)
+				}
+			}
+		case types.StageCopy:
+			if copied {
+				return fmt.Errorf("只能包含一个 copy 阶段")
+			}
+			if stage.Optional {
+				return fmt.Errorf("copy 阶段不能设置为可选")
+			}
+			copied = true
+		case types.StageVerifyDigest:
+			if !copied {
+				return fmt.Errorf("阶段 %s 需要在 copy 之后执行", name)
+			}
+			verified = true
+		case types.StageSignatures:
+			if !verified {
+				return fmt.Errorf("阶段 %s 需要在 verify-digest 之后执行", name)
+			}
+		case types.StageExec:
+			if len(stage.Command) != 0 {
+				return fmt.Errorf("exec 阶段 %s 不能指定命令，请引用管理员配置的 exec 阶段", name)
+			}
+			allowed, ok := findExecStage(execStages, stage.Name)
+			if !ok {
+				return fmt.Errorf("exec 阶段 %s 未由管理员配置", name)
+			}
+			stages[i].Command = allowed.Command
+			stages[i].Timeout = allowed.Timeout
+		case types.StageWebhook:
+			if _, err := url.ParseRequestURI(stage.URL); err != nil {
+				return fmt.Errorf("webhook 阶段 %s 的地址不合法 %v", name, err)
+			}
+		default:
+			return fmt.Errorf("不支持的阶段类型 %s", stage.Type)
+		}
+	}
+	if !copied {
+		return fmt.Errorf("缺少 copy 阶段")
+	}
+	return nil
+}
+
+// findExecStage 按名称查找管理员配置的 exec 阶段，未配置命令的阶段不可使用
+func findExecStage(execStages []rainbowconfig.Stage, name string) (rainbowconfig.Stage, bool) {
+	if len(name) == 0 {
+		return rainbowconfig.Stage{}, false
+	}
+	for _, stage := range execStages {
+		if stage.Name == name && len(stage.Command) != 0 {
+			return stage, true
+		}
+	}
+	return rainbowconfig.Stage{}, false
+}
+
+// validatePlatforms 校验多架构同步的平台，skopeo 驱动仅支持同步全部平台，同步部分平台需要使用 native 驱动
+func validatePlatforms(req *types.CreateTaskRequest) error {
+	if len(req.Platforms) == 0 {
+		return nil
+	}
+	driver := req.Driver
+	if len(driver) == 0 {
+		driver = defaultDriver
+	}
+	if driver == types.DockerDriver {
+		return fmt.Errorf("docker 驱动不支持多架构同步，请使用 skopeo 或 native 驱动")
+	}
+
+	for _, platform := range req.Platforms {
+		if platform == types.AllPlatforms {
+			if len(req.Platforms) != 1 {
+				return fmt.Errorf("%s 不能与其他平台同时指定", types.AllPlatforms)
+			}
+			continue
+		}
+		if _, err := registry.ParsePlatform(platform); err != nil {
+			return err
+		}
+		if driver != types.NativeDriver {
+			return fmt.Errorf("%s 驱动仅支持同步全部平台，同步部分平台请使用 native 驱动", driver)
+		}
+	}
+	return nil
+}
+
+// validateExport 校验离线包导出设置，导出依赖 native 驱动读取目标仓库的镜像
+// docker 格式的离线包仅支持单平台镜像
+func validateExport(req *types.CreateTaskRequest) error {
+	if len(req.ExportFormat) == 0 {
+		return nil
+	}
+	switch req.ExportFormat {
+	case registry.ArchiveOCI:
+	case registry.ArchiveDocker:
+		if len(req.Platforms) != 0 {
+			return fmt.Errorf("docker 格式的离线包不支持多架构镜像，请使用 oci 格式")
+		}
+		if len(req.ArtifactKind) != 0 && req.ArtifactKind != types.ImageArtifact {
+			return fmt.Errorf("docker 格式的离线包仅支持镜像，请使用 oci 格式")
+		}
+	default:
+		return fmt.Errorf("不支持的离线包格式(%s)，仅支持 %s 和 %s", req.ExportFormat, registry.ArchiveOCI, registry.ArchiveDocker)
+	}
+	if req.Driver != types.NativeDriver {
+		return fmt.Errorf("导出离线包仅支持 native 驱动")
+	}
+	return nil
+}
+
+// validateTransfer 校验并发和带宽设置，driver 为空时仅校验取值范围，用于仓库级的设置
+// docker 驱动的层并发由 docker daemon 控制
+func validateTransfer(driver string, parallelImages int, parallelLayers int, bandwidth string) error {
+	if parallelImages < 0 || parallelImages > maxParallelImages {
+		return fmt.Errorf("同时同步的镜像数量需要在 0 到 %d 之间", maxParallelImages)
+	}
+	if parallelLayers < 0 || parallelLayers > maxParallelLayers {
+		return fmt.Errorf("同时复制的层数需要在 0 到 %d 之间", maxParallelLayers)
+	}
+	if _, err := registry.ParseBandwidth(bandwidth); err != nil {
+		return err
+	}
+
+	if parallelLayers != 0 && driver == types.DockerDriver {
+		return fmt.Errorf("docker 驱动不支持设置同时复制的层数，请使用 skopeo 或 native 驱动")
+	}
+	return nil
+}
+
 func (s *ServerController) validateUserQuota(ctx context.Context, req *types.CreateTaskRequest) error {
 	userObj, err := s.factory.Task().GetUser(ctx, req.UserId)
 	if err != nil {
@@ -82,7 +308,7 @@ func (s *ServerController) validateUserQuota(ctx context.Context, req *types.Cre
 	}
 
 	imageCount := k8sImageCount // k8s 镜像数是 5
-	if req.Type == 0 {
+	if req.Type != 1 {
 		imageCount = len(req.Images)
 	}
 
@@ -135,6 +361,23 @@ func (s *ServerController) CreateTask(ctx context.Context, req *types.CreateTask
 		req.Driver = defaultDriver
 	}
 
+	var stages string
+	if len(req.Stages) != 0 {
+		data, err := json.Marshal(req.Stages)
+		if err != nil {
+			return err
+		}
+		stages = string(data)
+	}
+	var kubeadmProfile string
+	if req.Kubeadm != nil {
+		data, err := json.Marshal(req.Kubeadm)
+		if err != nil {
+			return err
+		}
+		kubeadmProfile = string(data)
+	}
+
 	// 如果是k8s类型的镜像，则由 plugin 回调创建
 	// 0：直接指定镜像列表 1: 指定 kubernetes 版本
 	switch req.Type {
@@ -155,8 +398,20 @@ func (s *ServerController) CreateTask(ctx context.Context, req *types.CreateTask
 			Logo:              req.Logo,
 			IsOfficial:        req.IsOfficial,
 			Architecture:      req.Architecture, // 通用镜像架构，会被镜像自身的架构覆盖
+			Platforms:         strings.Join(req.Platforms, ","),
+			Signatures:        req.Signatures,
+			PublicKey:         req.PublicKey,
+			ArtifactKind:      req.ArtifactKind,
+			NameTemplate:      req.NameTemplate,
+			TagTemplate:       req.TagTemplate,
+			Stages:            stages,
+			ParallelImages:    req.ParallelImages,
+			ParallelLayers:    req.ParallelLayers,
+			BandwidthLimit:    req.BandwidthLimit,
 			OwnerRef:          req.OwnerRef,
 			SubscribeId:       req.SubscribeId,
+			PrefetchId:        req.PrefetchId,
+			ExportFormat:      req.ExportFormat,
 		})
 		if err != nil {
 			return err
@@ -171,6 +426,15 @@ func (s *ServerController) CreateTask(ctx context.Context, req *types.CreateTask
 		}
 	case 1:
 		kubernetesVersions := strings.Split(req.KubernetesVersion, ",")
+		// 创建子任务前解析每个版本的插件，任一版本不支持时不创建任务
+		addonsByVersion := make(map[string]string)
+		for _, kv := range kubernetesVersions {
+			keys, err := s.resolveAddons(ctx, req.Addons, kv)
+			if err != nil {
+				return err
+			}
+			addonsByVersion[kv] = strings.Join(keys, ",")
+		}
 		for _, kv := range kubernetesVersions {
 			subName := req.Name + "-" + kv
 			object, err := s.factory.Task().Create(ctx, &model.Task{
@@ -189,8 +453,22 @@ func (s *ServerController) CreateTask(ctx context.Context, req *types.CreateTask
 				Logo:              req.Logo,
 				IsOfficial:        req.IsOfficial,
 				Architecture:      req.Architecture,
+				Platforms:         strings.Join(req.Platforms, ","),
+				Signatures:        req.Signatures,
+				PublicKey:         req.PublicKey,
+				ArtifactKind:      req.ArtifactKind,
+				NameTemplate:      req.NameTemplate,
+				TagTemplate:       req.TagTemplate,
+				Stages:            stages,
+				ParallelImages:    req.ParallelImages,
+				ParallelLayers:    req.ParallelLayers,
+				BandwidthLimit:    req.BandwidthLimit,
+				Addons:            addonsByVersion[kv],
+				Kubeadm:           kubeadmProfile,
 				OwnerRef:          req.OwnerRef,
 				SubscribeId:       req.SubscribeId,
+				PrefetchId:        req.PrefetchId,
+				ExportFormat:      req.ExportFormat,
 			})
 			if err != nil {
 				return err
@@ -204,6 +482,55 @@ func (s *ServerController) CreateTask(ctx context.Context, req *types.CreateTask
 	return nil
 }
 
+// CreateTaskFromFile 通过上传的镜像列表文件创建任务，文件字段为 file，任务的其他参数以 json 格式放在 task 字段中
+// 文件中任意一行校验失败时不创建任务，返回每一行的错误
+func (s *ServerController) CreateTaskFromFile(ctx *gin.Context) (*types.ImageFileResult, error) {
+	var req types.CreateTaskRequest
+	if task := ctx.PostForm("task"); len(task) != 0 {
+		if err := json.Unmarshal([]byte(task), &req); err != nil {
+			return nil, fmt.Errorf("解析任务参数失败 %v", err)
+		}
+	}
+
+	f, err := ctx.FormFile("file")
+	if err != nil {
+		klog.Errorf("获取镜像列表文件失败 %v", err)
+		return nil, fmt.Errorf("获取镜像列表文件失败 %v", err)
+	}
+	if f.Size > maxImageFileSize {
+		return nil, fmt.Errorf("镜像列表文件不能超过 %d KB", maxImageFileSize/1024)
+	}
+	file, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.ImageFileResult{}
+	entries, lineErrs := imagelist.Parse(f.Filename, data)
+	if len(lineErrs) == 0 {
+		result.Images, lineErrs = imagelist.Expand(ctx, registry.NewClient(), entries)
+	}
+	if len(lineErrs) != 0 {
+		result.Errors = lineErrs
+		return result, fmt.Errorf("镜像列表文件 %s 存在 %d 处错误", f.Filename, len(lineErrs))
+	}
+	if len(result.Images) == 0 {
+		return result, fmt.Errorf("镜像列表文件 %s 中不存在镜像", f.Filename)
+	}
+
+	req.Type = 0
+	req.Images = result.Images
+	if err = s.CreateTask(ctx, &req); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
 // CreateTaskMessages 批量创建同步消息
 func (s *ServerController) CreateTaskMessages(ctx context.Context, taskId int64, messages ...string) {
 	for _, msg := range messages {
@@ -214,10 +541,38 @@ func (s *ServerController) CreateTaskMessages(ctx context.Context, taskId int64,
 }
 
 func (s *ServerController) parseImageNameFromPath(ctx context.Context, path string, regId int64, namespace string) (string, error) {
-	parts2 := strings.Split(path, "/")
-	name := parts2[len(parts2)-1]
-	if len(name) == 0 {
-		return "", fmt.Errorf("不合规镜像名称 %s", path)
+	reg, err := s.factory.Registry().Get(ctx, regId)
+	if err != nil {
+		return "", fmt.Errorf("获取仓库(%d)失败 %v", regId, err)
+	}
+	return makeImageName(registryNamingRule(reg), path, regId, namespace)
+}
+
+// registryNamingRule 仓库配置的目标镜像命名规则
+func registryNamingRule(reg *model.Registry) naming.Rule {
+	return naming.Rule{Name: reg.NameTemplate, Tag: reg.TagTemplate}
+}
+
+// transferOption 合并任务和仓库的并发和带宽设置，任务中的设置优先
+func transferOption(task model.Task, reg *model.Registry) (int, int, string) {
+	parallelImages, parallelLayers, bandwidth := task.ParallelImages, task.ParallelLayers, task.BandwidthLimit
+	if parallelImages == 0 {
+		parallelImages = reg.ParallelImages
+	}
+	if parallelLayers == 0 {
+		parallelLayers = reg.ParallelLayers
+	}
+	if len(bandwidth) == 0 {
+		bandwidth = reg.BandwidthLimit
+	}
+	return parallelImages, parallelLayers, bandwidth
+}
+
+// makeImageName 按命名规则生成目标镜像名称，使用默认内置仓库时添加租户名称
+func makeImageName(rule naming.Rule, path string, regId int64, namespace string) (string, error) {
+	name, err := rule.ApplyName(path)
+	if err != nil {
+		return "", err
 	}
 	// 如果使用默认内置仓库，则添加租户名称
 	if regId == *RegistryId {
@@ -253,18 +608,19 @@ func (s *ServerController) CreateImageWithTag(ctx context.Context, taskId int64,
 		}
 	}
 
+	// 任务中设置的命名模板优先于仓库的模板
+	rule := naming.Merge(naming.Rule{Name: req.NameTemplate, Tag: req.TagTemplate}, registryNamingRule(reg))
 	namespace := req.Namespace
+	// 使用自定义 kubeadm 配置同步的版本记录配置名称
+	var profile string
+	if req.Kubeadm != nil {
+		profile = req.Kubeadm.Name
+	}
 	for path, tags := range imageMap {
 		var imageId int64
-		parts2 := strings.Split(path, "/")
-		name := parts2[len(parts2)-1]
-		if len(name) == 0 {
-			return fmt.Errorf("不合规镜像名称 %s", path)
-		}
-		if req.RegisterId == *RegistryId {
-			if len(namespace) != 0 {
-				name = namespace + "/" + name
-			}
+		name, err := makeImageName(rule, path, req.RegisterId, namespace)
+		if err != nil {
+			return err
 		}
 
 		mirror := reg.Repository + "/" + reg.Namespace + "/" + name
@@ -304,6 +660,14 @@ func (s *ServerController) CreateImageWithTag(ctx context.Context, taskId int64,
 
 		// 版本需要和任务关联
 		for _, tag := range tags {
+			mirrorTag, err := rule.ApplyTag(path, tag)
+			if err != nil {
+				return err
+			}
+			if mirrorTag == tag {
+				mirrorTag = ""
+			}
+
 			oldTag, tagErr := s.factory.Image().GetTagWithArch(ctx, imageId, tag, req.Architecture, false)
 			if tagErr != nil {
 				// 非不存在报错，则直接返回异常
@@ -321,6 +685,8 @@ func (s *ServerController) CreateImageWithTag(ctx context.Context, taskId int64,
 					Name:         tag,
 					Status:       types.SyncImageInitializing,
 					Architecture: req.Architecture,
+					MirrorTag:    mirrorTag,
+					Profile:      profile,
 				}); err != nil {
 					klog.Errorf("创建镜像(%s)的版本(%s)失败 %v", path, tag, err)
 					return err
@@ -338,6 +704,13 @@ func (s *ServerController) CreateImageWithTag(ctx context.Context, taskId int64,
 				if path != oldTag.Path {
 					update["path"] = path
 				}
+				// 命名模板修改时，使用新的目标版本
+				if mirrorTag != oldTag.MirrorTag {
+					update["mirror_tag"] = mirrorTag
+				}
+				if profile != oldTag.Profile {
+					update["profile"] = profile
+				}
 				if err = s.factory.Image().UpdateTag(ctx, imageId, tag, update); err != nil {
 					klog.Errorf("更新镜像(%s)的版本(%s)任务Id失败 %v", path, tag, err)
 					return err
@@ -536,11 +909,7 @@ func (s *ServerController) sendToAdmin(ctx context.Context, req *types.UpdateTas
 		klog.Errorf("获取本次任务的镜像tag失败 %v", err)
 		return err
 	}
-	taskType := "镜像组"
-	if task.Type == 1 {
-		taskType = "Kubernetes"
-	}
-	notifyContent := fmt.Sprintf("同步类型: %s\n执行用户: %s\n推送数量: %d", taskType, task.UserName, num)
+	notifyContent := fmt.Sprintf("同步类型: %s\n执行用户: %s\n推送数量: %d", taskTypeName(task), task.UserName, num)
 
 	return s.SendNotify(ctx, &types.SendNotificationRequest{
 		Content: notifyContent,
@@ -577,11 +946,7 @@ func (s *ServerController) sendToUser(ctx context.Context, req *types.UpdateTask
 		return err
 	}
 
-	taskType := "镜像组"
-	if task.Type == 1 {
-		taskType = "Kubernetes"
-	}
-	notifyContent := fmt.Sprintf("同步类型: %s\n推送结果:", taskType)
+	notifyContent := fmt.Sprintf("同步类型: %s\n推送结果:", taskTypeName(task))
 
 	if len(successImages) != 0 {
 		suc := "  成功:"
@@ -610,6 +975,20 @@ func (s *ServerController) sendToUser(ctx context.Context, req *types.UpdateTask
 	})
 }
 
+// taskTypeName 返回通知中展示的任务类型，自动预取的任务附带 kubernetes 版本，便于订阅者识别
+func taskTypeName(task *model.Task) string {
+	if task.OwnerRef == types.PrefetchOwnerRef {
+		return fmt.Sprintf("Kubernetes %s 自动预取", task.KubernetesVersion)
+	}
+	if task.Type == 1 {
+		return "Kubernetes"
+	}
+	if task.Type == types.ImportTaskType {
+		return "离线包导入"
+	}
+	return "镜像组"
+}
+
 func removeTaskID(taskIds string, taskIDToRemove string) string {
 	ids := strings.Split(taskIds, ",")
 	result := make([]string, 0, len(ids))
@@ -629,6 +1008,17 @@ func (s *ServerController) DeleteTask(ctx context.Context, taskId int64) error {
 		return err
 	}
 
+	if err := s.factory.Task().DeleteImageProgresses(ctx, taskId); err != nil {
+		klog.Warningf("清理任务(%d)同步进度失败 %v", taskId, err)
+	}
+	if err := s.factory.Task().DeleteImageStages(ctx, taskId); err != nil {
+		klog.Warningf("清理任务(%d)同步阶段失败 %v", taskId, err)
+	}
+	if err := s.factory.Task().DeleteCallbackEvents(ctx, taskId); err != nil {
+		klog.Warningf("清理任务(%d)回调记录失败 %v", taskId, err)
+	}
+	s.deleteTaskExport(ctx, taskId)
+
 	tags, err := s.factory.Image().ListTags(ctx, db.WithTaskLike(taskId))
 	if err != nil {
 		klog.Errorf("获取本次任务的镜像tag失败 %v", err)
@@ -638,7 +1028,7 @@ func (s *ServerController) DeleteTask(ctx context.Context, taskId int64) error {
 		if err = s.factory.Image().UpdateTag(ctx, tag.ImageId, tag.Name, map[string]interface{}{
 			"task_ids": removeTaskID(tag.TaskIds, fmt.Sprintf("%d", taskId)),
 		}); err != nil {
-			klog.Warningf("移除任务(%s)关联的tag(%s)时失败 %v", taskId, tag.Name, err)
+			klog.Warningf("移除任务(%d)关联的tag(%s)时失败 %v", taskId, tag.Name, err)
 		}
 	}
 
@@ -655,6 +1045,15 @@ func (s *ServerController) GetTask(ctx context.Context, taskId int64) (interface
 }
 
 func (s *ServerController) ReRunTask(ctx context.Context, req *types.UpdateTaskRequest) error {
+	task, err := s.factory.Task().Get(ctx, req.Id)
+	if err != nil {
+		return err
+	}
+	// 离线包导入完成后即删除，无法重新执行
+	if task.Type == types.ImportTaskType {
+		return fmt.Errorf("离线包导入任务不支持重新执行，请重新上传离线包")
+	}
+
 	updates := map[string]interface{}{
 		"agent_name":      "",
 		"status":          TaskWaitStatus,
@@ -667,6 +1066,15 @@ func (s *ServerController) ReRunTask(ctx context.Context, req *types.UpdateTaskR
 		return err
 	}
 
+	if err := s.factory.Task().DeleteImageProgresses(ctx, req.Id); err != nil {
+		klog.Errorf("清理任务(%d)同步进度失败 %v", req.Id, err)
+	}
+	if err := s.factory.Task().DeleteImageStages(ctx, req.Id); err != nil {
+		klog.Errorf("清理任务(%d)同步阶段失败 %v", req.Id, err)
+	}
+	if err := s.factory.Task().DeleteCallbackEvents(ctx, req.Id); err != nil {
+		klog.Errorf("清理任务(%d)回调记录失败 %v", req.Id, err)
+	}
 	// 全量重新推送时，重置任务过程信息
 	if !req.OnlyPushError {
 		if err := s.factory.Task().DeleteTaskMessages(ctx, req.Id); err != nil {
@@ -691,6 +1099,207 @@ func (s *ServerController) ListTaskMessages(ctx context.Context, taskId int64) (
 	return s.factory.Task().ListTaskMessages(ctx, db.WithTask(taskId))
 }
 
+// UpdateImageProgress 记录 plugin 上报的镜像同步进度，同一任务的同一目标镜像只保留最新的进度
+func (s *ServerController) UpdateImageProgress(ctx context.Context, req *types.UpdateImageProgressRequest) error {
+	if len(req.Target) == 0 {
+		return fmt.Errorf("目标镜像不能为空")
+	}
+	return s.factory.Task().CreateOrUpdateImageProgress(ctx, &model.ImageProgress{
+		TaskId:      req.Id,
+		ImageId:     req.ImageId,
+		Target:      req.Target,
+		BytesDone:   req.BytesDone,
+		BytesTotal:  req.BytesTotal,
+		LayersDone:  req.LayersDone,
+		LayersTotal: req.LayersTotal,
+	})
+}
+
+// BatchCallback 按顺序处理 plugin 批量上报的镜像状态和任务消息
+// plugin 在未收到成功响应时会重发整批事件，已处理过的事件按 Id 跳过，保证重复上报不会重复写入
+// 事件按上报顺序处理，处理失败的事件记录失败原因并计入 Failed，不影响之后的事件
+// 仅数据库等可重试的错误或记录事件失败时返回错误，由 plugin 重发整批事件
+func (s *ServerController) BatchCallback(ctx context.Context, req *types.BatchCallbackRequest) (*types.BatchCallbackResult, error) {
+	result := &types.BatchCallbackResult{}
+	if len(req.Events) == 0 {
+		return result, nil
+	}
+
+	eventIds := make([]string, 0, len(req.Events))
+	for _, event := range req.Events {
+		if len(event.Id) == 0 {
+			return result, fmt.Errorf("回调事件 Id 不能为空")
+		}
+		eventIds = append(eventIds, event.Id)
+	}
+	processed, err := s.factory.Task().ListCallbackEvents(ctx, db.WithTask(req.Id), db.WithEventIdIn(eventIds...))
+	if err != nil {
+		return result, err
+	}
+	seen := make(map[string]bool)
+	for _, event := range processed {
+		seen[event.EventId] = true
+	}
+
+	err = processCallbackEvents(req.Events, seen, result,
+		func(event types.CallbackEvent) error {
+			return s.handleCallbackEvent(ctx, req.Id, event)
+		},
+		func(event types.CallbackEvent, handleErr error) error {
+			object := &model.CallbackEvent{TaskId: req.Id, EventId: event.Id}
+			if handleErr != nil {
+				object.Error = handleErr.Error()
+			}
+			return s.factory.Task().CreateCallbackEvent(ctx, object)
+		},
+	)
+	if err != nil {
+		klog.Errorf("处理任务(%d)回调事件失败 %v", req.Id, err)
+	}
+	return result, err
+}
+
+// processCallbackEvents 依次处理未处理过的回调事件，同一批次中重复的事件只处理一次
+// 处理失败的事件记录失败原因后继续处理后续事件，避免单个事件阻塞任务的全部回调
+// 仅在遇到可重试的错误或者记录事件失败时返回错误，由 plugin 整批重发，已记录的事件会被跳过
+func processCallbackEvents(events []types.CallbackEvent, seen map[string]bool, result *types.BatchCallbackResult,
+	handle func(types.CallbackEvent) error, record func(types.CallbackEvent, error) error) error {
+	for _, event := range events {
+		if seen[event.Id] {
+			result.Skipped++
+			continue
+		}
+
+		err := handle(event)
+		if errors.IsTransient(err) {
+			return fmt.Errorf("处理回调事件(%s)失败: %v", event.Id, err)
+		}
+		if err != nil {
+			klog.Warningf("回调事件(%s)处理失败 %v，记录后继续处理后续事件", event.Id, err)
+		}
+		if recordErr := record(event, err); recordErr != nil {
+			return fmt.Errorf("记录回调事件(%s)失败: %v", event.Id, recordErr)
+		}
+
+		seen[event.Id] = true
+		if err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", event.Id, err))
+			continue
+		}
+		result.Processed++
+	}
+	return nil
+}
+
+// handleCallbackEvent 按事件类型处理单个回调事件
+func (s *ServerController) handleCallbackEvent(ctx context.Context, taskId int64, event types.CallbackEvent) error {
+	switch event.Type {
+	case types.CallbackStatusEvent:
+		if event.Status == nil {
+			return fmt.Errorf("回调事件(%s)缺少镜像状态", event.Id)
+		}
+		event.Status.TaskId = taskId
+		if err := s.ValidateCallbackImage(ctx, taskId, event.Status.ImageId); err != nil {
+			return err
+		}
+		return s.UpdateImageStatus(ctx, event.Status)
+	case types.CallbackMessageEvent:
+		return s.CreateTaskMessage(ctx, types.CreateTaskMessageRequest{Id: taskId, Message: event.Message})
+	case types.CallbackStageEvent:
+		if event.Stage == nil {
+			return fmt.Errorf("回调事件(%s)缺少阶段状态", event.Id)
+		}
+		event.Stage.Id = taskId
+		return s.UpdateImageStage(ctx, event.Stage)
+	default:
+		return fmt.Errorf("不支持的回调事件类型 %s", event.Type)
+	}
+}
+
+// UpdateImageStage 记录 plugin 上报的镜像同步阶段状态，同一目标镜像的同一阶段只保留最新的状态
+func (s *ServerController) UpdateImageStage(ctx context.Context, req *types.UpdateImageStageRequest) error {
+	if len(req.Target) == 0 || len(req.Stage) == 0 {
+		return fmt.Errorf("目标镜像和阶段名称不能为空")
+	}
+	return s.factory.Task().CreateOrUpdateImageStage(ctx, &model.ImageStage{
+		TaskId:   req.Id,
+		ImageId:  req.ImageId,
+		Target:   req.Target,
+		Stage:    req.Stage,
+		Type:     req.Type,
+		Sequence: req.Sequence,
+		Status:   req.Status,
+		Message:  req.Message,
+	})
+}
+
+// ListImageStages 获取任务中各镜像的同步阶段，按目标镜像和执行顺序排序
+func (s *ServerController) ListImageStages(ctx context.Context, taskId int64) ([]model.ImageStage, error) {
+	stages, err := s.factory.Task().ListImageStages(ctx, db.WithTask(taskId))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(stages, func(i, j int) bool {
+		if stages[i].Target != stages[j].Target {
+			return stages[i].Target < stages[j].Target
+		}
+		return stages[i].Sequence < stages[j].Sequence
+	})
+	return stages, nil
+}
+
+// GetTaskProgress 汇总任务的同步进度
+// 已完成和已失败的版本计为完成，同步中的版本按上报的字节进度计算，任务结束时为 100
+func (s *ServerController) GetTaskProgress(ctx context.Context, taskId int64) (*types.TaskProgress, error) {
+	task, err := s.factory.Task().Get(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.factory.Task().ListImageProgresses(ctx, db.WithTask(taskId))
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.factory.Image().ListTags(ctx, db.WithTaskLike(taskId))
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &types.TaskProgress{TaskId: taskId, Process: task.Process, Images: len(tags), Items: items}
+	byTag := make(map[string]model.ImageProgress)
+	for _, item := range items {
+		progress.BytesDone += item.BytesDone
+		progress.BytesTotal += item.BytesTotal
+		if i := strings.LastIndex(item.Target, ":"); i > strings.LastIndex(item.Target, "/") {
+			byTag[fmt.Sprintf("%d/%s", item.ImageId, item.Target[i+1:])] = item
+		}
+	}
+
+	var done float64
+	for _, tag := range tags {
+		switch tag.Status {
+		case types.SyncImageComplete:
+			progress.CompletedImages++
+			done++
+		case types.SyncImageError:
+			progress.FailedImages++
+			done++
+		default:
+			if item, ok := byTag[fmt.Sprintf("%d/%s", tag.ImageId, tag.GetMirrorTag())]; ok && item.BytesTotal > 0 {
+				// 字节传输完成后仍需推送 manifest 和校验，未回调完成前最多计为 99%
+				done += math.Min(float64(item.BytesDone)/float64(item.BytesTotal), 0.99)
+			}
+		}
+	}
+	if len(tags) != 0 {
+		progress.Percent = int(done * 100 / float64(len(tags)))
+	}
+	if task.Process == 2 {
+		progress.Percent = 100
+	}
+	return progress, nil
+}
+
 func (s *ServerController) ListTasksByIds(ctx context.Context, ids []int64) (interface{}, error) {
 	return s.factory.Task().List(ctx, db.WithIDIn(ids...))
 }
@@ -0,0 +1,145 @@
+package rainbow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/klog/v2"
+
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/util/errors"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
+)
+
+// UploadTaskExport 保存 plugin 上传的任务离线包，文件字段为 file，sha256 字段为离线包的 sha256
+// 离线包保存在 ExportDir/<taskId> 目录下，并写入 sha256sum 格式的校验文件，每个任务仅保留最近一次导出的离线包
+func (s *ServerController) UploadTaskExport(ctx *gin.Context, taskId int64) error {
+	task, err := s.factory.Task().Get(ctx, taskId)
+	if err != nil {
+		return err
+	}
+	format := ctx.PostForm("format")
+	switch format {
+	case registry.ArchiveOCI, registry.ArchiveDocker:
+	default:
+		return fmt.Errorf("不支持的离线包格式(%s)", format)
+	}
+	if format != task.ExportFormat {
+		return fmt.Errorf("离线包格式(%s)与任务的导出格式(%s)不一致", format, task.ExportFormat)
+	}
+	expected := ctx.PostForm("sha256")
+	images, _ := strconv.Atoi(ctx.PostForm("images"))
+
+	f, err := ctx.FormFile("file")
+	if err != nil {
+		return fmt.Errorf("获取离线包失败 %v", err)
+	}
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dir := taskExportDir(s.cfg.Server.ExportDir, taskId)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建离线包目录失败 %v", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("保存离线包失败 %v", err)
+	}
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if len(expected) != 0 && expected != digest {
+		return fmt.Errorf("离线包 sha256 校验失败, 期望 %s, 实际为 %s", expected, digest)
+	}
+
+	name := fmt.Sprintf("task-%d-%s.tar", taskId, format)
+	old, err := s.factory.Task().GetTaskExport(ctx, taskId)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("保存离线包失败 %v", err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, name+".sha256"), []byte(fmt.Sprintf("%s  %s\n", digest, name)), 0644); err != nil {
+		return fmt.Errorf("写入离线包校验文件失败 %v", err)
+	}
+	if old != nil && old.Name != name {
+		_ = os.Remove(filepath.Join(dir, old.Name))
+		_ = os.Remove(filepath.Join(dir, old.Name+".sha256"))
+	}
+
+	if err = s.factory.Task().CreateOrUpdateTaskExport(ctx, &model.TaskExport{
+		TaskId: taskId,
+		Format: format,
+		Name:   name,
+		Size:   size,
+		Sha256: digest,
+		Images: images,
+	}); err != nil {
+		return err
+	}
+	s.CreateTaskMessages(ctx, taskId, fmt.Sprintf("离线包 %s 已保存，共 %d 个镜像", name, images))
+	klog.Infof("任务(%d)的离线包 %s 已保存，大小 %d，sha256 %s", taskId, name, size, digest)
+	return nil
+}
+
+// GetTaskExport 获取任务离线包的格式、大小和 sha256
+func (s *ServerController) GetTaskExport(ctx context.Context, taskId int64) (*model.TaskExport, error) {
+	object, err := s.factory.Task().GetTaskExport(ctx, taskId)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("任务(%d)未导出离线包", taskId)
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+// DownloadTaskExport 返回任务离线包的本地路径
+func (s *ServerController) DownloadTaskExport(ctx context.Context, taskId int64) (string, *model.TaskExport, error) {
+	object, err := s.GetTaskExport(ctx, taskId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fullPath := filepath.Join(taskExportDir(s.cfg.Server.ExportDir, taskId), filepath.Base(object.Name))
+	if _, err = os.Stat(fullPath); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, fmt.Errorf("离线包文件不存在")
+		}
+		return "", nil, fmt.Errorf("stat file failed: %v", err)
+	}
+	return fullPath, object, nil
+}
+
+// deleteTaskExport 删除任务的离线包文件和记录
+func (s *ServerController) deleteTaskExport(ctx context.Context, taskId int64) {
+	if err := os.RemoveAll(taskExportDir(s.cfg.Server.ExportDir, taskId)); err != nil {
+		klog.Warningf("清理任务(%d)离线包失败 %v", taskId, err)
+	}
+	if err := s.factory.Task().DeleteTaskExport(ctx, taskId); err != nil {
+		klog.Warningf("清理任务(%d)离线包记录失败 %v", taskId, err)
+	}
+}
+
+func taskExportDir(exportDir string, taskId int64) string {
+	return filepath.Join(exportDir, strconv.FormatInt(taskId, 10))
+}
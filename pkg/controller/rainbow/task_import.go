@@ -0,0 +1,401 @@
+package rainbow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/klog/v2"
+
+	rainbowconfig "github.com/caoyingjunz/rainbow/cmd/app/config"
+	"github.com/caoyingjunz/rainbow/pkg/db"
+	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
+	"github.com/caoyingjunz/rainbow/pkg/util/uuid"
+)
+
+const (
+	TaskImportStatus = "导入中"
+
+	// importDir 上传的离线包在 ExportDir 下的暂存目录，导入结束后删除
+	importDir = "imports"
+)
+
+// ImportTaskArchive 上传 OCI image layout 或 docker save 格式的离线包，由 rainbow server 推送到指定的仓库
+// 文件字段为 file，任务的其他参数以 json 格式放在 task 字段中，按普通任务创建镜像和版本，导入过程记录在任务消息中
+func (s *ServerController) ImportTaskArchive(ctx *gin.Context) (*types.ImportArchiveResult, error) {
+	// 解析表单前限制请求大小，避免超大的离线包写满暂存目录
+	limit, err := s.importSizeLimit()
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Request.ContentLength > limit {
+		return nil, fmt.Errorf("离线包大小超过上限 %s", s.cfg.Server.MaxImportSize)
+	}
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit)
+
+	// 读取 task 字段时会解析整个表单，超过上限时在获取文件时返回错误
+	var req types.CreateTaskRequest
+	if task := ctx.PostForm("task"); len(task) != 0 {
+		if err := json.Unmarshal([]byte(task), &req); err != nil {
+			return nil, fmt.Errorf("解析任务参数失败 %v", err)
+		}
+	}
+	if req.Type != 0 && req.Type != types.ImportTaskType {
+		return nil, fmt.Errorf("离线包导入不支持任务类型 %d", req.Type)
+	}
+	if len(req.Platforms) != 0 || len(req.Stages) != 0 || len(req.ExportFormat) != 0 {
+		return nil, fmt.Errorf("离线包导入按原样推送，不支持指定平台、同步阶段或导出离线包")
+	}
+
+	f, err := ctx.FormFile("file")
+	if err != nil {
+		klog.Errorf("获取离线包失败 %v", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, fmt.Errorf("离线包大小超过上限 %s", s.cfg.Server.MaxImportSize)
+		}
+		return nil, fmt.Errorf("获取离线包失败 %v", err)
+	}
+	archivePath, err := s.saveImportArchive(f)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := registry.OpenArchive(archivePath)
+	if err != nil {
+		_ = os.Remove(archivePath)
+		return nil, err
+	}
+
+	images, err := archiveImageNames(archive)
+	if err != nil {
+		_ = archive.Close()
+		_ = os.Remove(archivePath)
+		return nil, fmt.Errorf("离线包 %s %v", f.Filename, err)
+	}
+
+	req.Type = types.ImportTaskType
+	req.Images = images
+	req.Driver = types.NativeDriver
+	task, err := s.createImportTask(ctx, &req)
+	if err != nil {
+		_ = archive.Close()
+		_ = os.Remove(archivePath)
+		return nil, err
+	}
+
+	go s.importArchive(context.TODO(), task, archive, archivePath)
+	return &types.ImportArchiveResult{TaskId: task.Id, Images: images}, nil
+}
+
+// importSizeLimit 返回上传离线包的大小上限，包含表单的其他字段
+func (s *ServerController) importSizeLimit() (int64, error) {
+	q, err := resource.ParseQuantity(s.cfg.Server.MaxImportSize)
+	if err != nil || q.Sign() <= 0 {
+		return 0, fmt.Errorf("离线包大小上限 %s 不合法，应为字节数，如 20Gi", s.cfg.Server.MaxImportSize)
+	}
+	return q.Value(), nil
+}
+
+// saveImportArchive 将上传的离线包保存到暂存目录，离线包需要随机读取，不能直接使用上传的数据流
+func (s *ServerController) saveImportArchive(f *multipart.FileHeader) (string, error) {
+	dir := filepath.Join(s.cfg.Server.ExportDir, importDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建离线包暂存目录失败 %v", err)
+	}
+
+	src, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp(dir, "import-*.tar")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst.Name())
+		return "", fmt.Errorf("保存离线包失败 %v", err)
+	}
+	return dst.Name(), nil
+}
+
+// archiveImageNames 返回离线包中去重后的镜像名称，存在未记录名称的镜像时返回错误
+func archiveImageNames(archive *registry.ArchiveReader) ([]string, error) {
+	var (
+		names   []string
+		unnamed int
+	)
+	seen := make(map[string]bool)
+	for _, img := range archive.Images() {
+		if len(img.Name) == 0 {
+			unnamed++
+			continue
+		}
+		if !seen[img.Name] {
+			seen[img.Name] = true
+			names = append(names, img.Name)
+		}
+	}
+	if unnamed != 0 {
+		return nil, fmt.Errorf("存在 %d 个未记录镜像名称的镜像，仅记录版本的 OCI image layout 无法确定导入的镜像名称", unnamed)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("中不存在镜像")
+	}
+	return names, nil
+}
+
+// createImportTask 创建离线包导入任务及其镜像和版本，任务创建时即为执行中，不会被调度到 agent
+func (s *ServerController) createImportTask(ctx context.Context, req *types.CreateTaskRequest) (*model.Task, error) {
+	if len(req.Architecture) == 0 {
+		req.Architecture = defaultArch
+	}
+	if err := s.preCreateTask(ctx, req); err != nil {
+		klog.Errorf("创建任务前置检查未通过 %v", err)
+		return nil, err
+	}
+
+	if len(strings.TrimSpace(req.Name)) == 0 {
+		req.Name = uuid.NewRandName("import-", 8)
+	}
+	req.Namespace = WrapNamespace(req.Namespace, req.UserName)
+	if req.RegisterId == 0 {
+		req.RegisterId = *RegistryId
+	}
+
+	object, err := s.factory.Task().Create(ctx, &model.Task{
+		Name:         req.Name,
+		UserId:       req.UserId,
+		UserName:     req.UserName,
+		RegisterId:   req.RegisterId,
+		Process:      1,
+		Status:       TaskImportStatus,
+		Message:      "离线包导入中",
+		Type:         req.Type,
+		Driver:       req.Driver,
+		Namespace:    req.Namespace,
+		IsPublic:     req.PublicImage,
+		Logo:         req.Logo,
+		IsOfficial:   req.IsOfficial,
+		Architecture: req.Architecture,
+		NameTemplate: req.NameTemplate,
+		TagTemplate:  req.TagTemplate,
+		OwnerRef:     req.OwnerRef,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.CreateTaskMessages(ctx, object.Id, "离线包上传完成", fmt.Sprintf("离线包中共 %d 个镜像，等待导入", len(req.Images)))
+
+	if err = s.CreateImageWithTag(ctx, object.Id, req); err != nil {
+		s.CreateTaskMessages(ctx, object.Id, fmt.Sprintf("创建镜像和版本失败 %v", err))
+		_ = s.DeleteTaskWithImages(ctx, object.Id)
+		return nil, err
+	}
+	return object, nil
+}
+
+// importTarget 离线包中的镜像对应的目标镜像和版本
+type importTarget struct {
+	image  rainbowconfig.Image
+	tag    string
+	target string
+}
+
+// importArchive 依次将离线包中的镜像推送到任务的仓库，按 plugin 回调的方式更新版本状态和任务状态
+func (s *ServerController) importArchive(ctx context.Context, task *model.Task, archive *registry.ArchiveReader, archivePath string) {
+	defer func() {
+		_ = archive.Close()
+		_ = os.Remove(archivePath)
+	}()
+
+	reg, targets, err := s.importTargets(ctx, task)
+	if err != nil {
+		klog.Errorf("获取任务(%d)的导入目标失败 %v", task.Id, err)
+		s.CreateTaskMessages(ctx, task.Id, fmt.Sprintf("离线包导入失败，原因：%v", err))
+		_ = s.UpdateTaskStatus(ctx, &types.UpdateTaskStatusRequest{TaskId: task.Id, Status: "离线包导入失败", Message: err.Error(), Process: 3})
+		return
+	}
+	opts := []registry.Option{registry.WithAuth(reg.Repository, reg.Username, reg.Password)}
+	if reg.Insecure {
+		opts = append(opts, registry.WithPlainHTTP(reg.Repository))
+	}
+	client := registry.NewClient(opts...)
+
+	total := len(targets)
+	s.CreateTaskMessages(ctx, task.Id, fmt.Sprintf("开始导入镜像到仓库 %s/%s", reg.Repository, reg.Namespace))
+	var done, failed int
+	for _, img := range archive.Images() {
+		path, tag, _ := ParseImageItem(img.Name)
+		t, ok := targets[path+":"+tag]
+		if !ok {
+			// 同一镜像在离线包中出现多次时，只导入一次
+			continue
+		}
+		delete(targets, path+":"+tag)
+
+		status := &types.UpdateImageStatusRequest{
+			Name:       t.image.Name,
+			ImageId:    t.image.Id,
+			TaskId:     task.Id,
+			RegistryId: reg.Id,
+			Status:     types.SyncImageRunning,
+			Target:     t.target,
+			Tag:        t.tag,
+		}
+		_ = s.UpdateImageStatus(ctx, status)
+
+		result, err := client.PushArchiveImage(ctx, archive, img, t.target, nil)
+		if err != nil {
+			failed++
+			klog.Errorf("导入镜像 %s 到 %s 失败 %v", img.Name, t.target, err)
+			status.Status, status.Message = types.SyncImageError, err.Error()
+			_ = s.UpdateImageStatus(ctx, status)
+			s.CreateTaskMessages(ctx, task.Id, fmt.Sprintf("镜像 %s 导入失败，原因：%v", img.Name, err))
+			continue
+		}
+
+		done++
+		status.Status = types.SyncImageComplete
+		status.Source = img.Name
+		status.SourceDigest = result.SourceDigest
+		status.TargetDigest = result.TargetDigest
+		status.MediaType = result.MediaType
+		status.ArtifactType = result.ArtifactType
+		status.Manifests = archiveManifests(result)
+		_ = s.UpdateImageStatus(ctx, status)
+		s.CreateTaskMessages(ctx, task.Id, fmt.Sprintf("镜像 %s 导入完成(%d/%d)，digest %s", img.Name, done+failed, total, result.TargetDigest))
+	}
+
+	if failed != 0 {
+		s.CreateTaskMessages(ctx, task.Id, fmt.Sprintf("离线包导入结束，%d 个镜像导入完成，%d 个镜像导入失败", done, failed))
+		_ = s.UpdateTaskStatus(ctx, &types.UpdateTaskStatusRequest{TaskId: task.Id, Status: "镜像导入结束", Message: "存在镜像导入异常", Process: 2})
+		return
+	}
+	s.CreateTaskMessages(ctx, task.Id, "离线包导入完成")
+	_ = s.UpdateTaskStatus(ctx, &types.UpdateTaskStatusRequest{TaskId: task.Id, Status: "镜像导入完成", Message: "镜像全部导入完成", Process: 2})
+}
+
+// recoverImportTasks rainbow server 启动时，将重启前未完成的导入任务标记为失败，并清理遗留的离线包
+// 导入在 rainbow server 进程中执行，重启后无法继续，暂存的离线包也不会再被使用
+func (s *ServerController) recoverImportTasks(ctx context.Context) {
+	tasks, err := s.factory.Task().List(ctx, db.WithStatusIn(TaskImportStatus))
+	if err != nil {
+		klog.Errorf("获取未完成的导入任务失败 %v", err)
+	}
+	for _, task := range tasks {
+		if task.Type != types.ImportTaskType || task.Process != 1 {
+			continue
+		}
+		klog.Warningf("导入任务(%d)因 rainbow server 重启中断，标记为失败", task.Id)
+		s.failImportTags(ctx, task.Id)
+		s.CreateTaskMessages(ctx, task.Id, "离线包导入失败，原因：rainbow server 重启，导入中断")
+		_ = s.UpdateTaskStatus(ctx, &types.UpdateTaskStatusRequest{TaskId: task.Id, Status: "离线包导入失败", Message: "rainbow server 重启，导入中断", Process: 3})
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.cfg.Server.ExportDir, importDir, "import-*.tar"))
+	if err != nil {
+		klog.Errorf("查找遗留的离线包失败 %v", err)
+		return
+	}
+	for _, file := range files {
+		if err = os.Remove(file); err != nil {
+			klog.Errorf("删除遗留的离线包 %s 失败 %v", file, err)
+			continue
+		}
+		klog.Infof("已删除遗留的离线包 %s", file)
+	}
+}
+
+// failImportTags 将导入任务中未完成的版本标记为失败
+func (s *ServerController) failImportTags(ctx context.Context, taskId int64) {
+	tags, err := s.factory.Image().ListTags(ctx, db.WithTaskLike(taskId))
+	if err != nil {
+		klog.Errorf("获取导入任务(%d)的版本失败 %v", taskId, err)
+		return
+	}
+	for _, tag := range tags {
+		if tag.Status == types.SyncImageComplete || tag.Status == types.SyncImageError {
+			continue
+		}
+		if err = s.factory.Image().UpdateTag(ctx, tag.ImageId, tag.Name, map[string]interface{}{"status": types.SyncImageError, "message": "rainbow server 重启，导入中断"}); err != nil {
+			klog.Errorf("更新镜像(%d)的版本(%s)状态失败 %v", tag.ImageId, tag.Name, err)
+		}
+	}
+}
+
+// importTargets 按任务的版本生成源镜像到目标镜像的映射，与 agent 下发给 plugin 的镜像列表一致
+func (s *ServerController) importTargets(ctx context.Context, task *model.Task) (*model.Registry, map[string]importTarget, error) {
+	reg, err := s.factory.Registry().Get(ctx, task.RegisterId)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取仓库(%d)失败 %v", task.RegisterId, err)
+	}
+	tags, err := s.factory.Image().ListTags(ctx, db.WithTaskLike(task.Id))
+	if err != nil {
+		return nil, nil, err
+	}
+	var imageIds []int64
+	for _, tag := range tags {
+		imageIds = append(imageIds, tag.ImageId)
+	}
+	images, err := s.factory.Image().List(ctx, db.WithIDIn(imageIds...))
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make(map[int64]string)
+	for _, image := range images {
+		names[image.Id] = image.Name
+	}
+
+	targets := make(map[string]importTarget)
+	for _, tag := range tags {
+		name, ok := names[tag.ImageId]
+		if !ok {
+			continue
+		}
+		img := rainbowconfig.Image{
+			Name:  name,
+			Id:    tag.ImageId,
+			Path:  tag.Path,
+			Tags:  []string{tag.Name},
+			Retag: makeRetag(tag),
+		}
+		for source, target := range img.GetMap(reg.Repository, reg.Namespace) {
+			targets[source] = importTarget{image: img, tag: tag.Name, target: target}
+		}
+	}
+	return reg, targets, nil
+}
+
+// archiveManifests 导入多架构镜像时，返回各平台的 manifest 用于记录版本的平台信息
+func archiveManifests(result *registry.CopyResult) []types.PlatformManifest {
+	var manifests []types.PlatformManifest
+	for _, m := range result.Manifests {
+		platform := m.Platform.String()
+		if len(platform) == 0 || platform == "unknown/unknown" {
+			platform = m.Annotations["vnd.docker.reference.type"]
+		}
+		manifests = append(manifests, types.PlatformManifest{
+			Platform:  platform,
+			Digest:    m.Digest,
+			MediaType: m.MediaType,
+			Size:      m.Size,
+		})
+	}
+	return manifests
+}
@@ -0,0 +1,96 @@
+package rainbow
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	rainbowconfig "github.com/caoyingjunz/rainbow/cmd/app/config"
+	"github.com/caoyingjunz/rainbow/pkg/types"
+)
+
+func TestValidateStages(t *testing.T) {
+	execStages := []rainbowconfig.Stage{
+		{Name: "scan", Type: types.StageExec, Command: []string{"trivy", "image", "--exit-code", "1"}, Timeout: 300},
+		{Name: "empty", Type: types.StageExec},
+	}
+
+	tests := []struct {
+		name    string
+		stages  []rainbowconfig.Stage
+		want    []rainbowconfig.Stage
+		wantErr string
+	}{
+		{
+			name: "exec stage resolved from operator config",
+			stages: []rainbowconfig.Stage{
+				{Type: types.StageCopy},
+				{Name: "scan", Type: types.StageExec, Optional: true},
+			},
+			want: []rainbowconfig.Stage{
+				{Type: types.StageCopy},
+				{Name: "scan", Type: types.StageExec, Optional: true, Command: []string{"trivy", "image", "--exit-code", "1"}, Timeout: 300},
+			},
+		},
+		{
+			name: "exec stage with command from request",
+			stages: []rainbowconfig.Stage{
+				{Type: types.StageCopy},
+				{Name: "scan", Type: types.StageExec, Command: []string{"sh", "-c", "env"}},
+			},
+			wantErr: "不能指定命令",
+		},
+		{
+			name: "unknown exec stage",
+			stages: []rainbowconfig.Stage{
+				{Type: types.StageCopy},
+				{Name: "upload", Type: types.StageExec},
+			},
+			wantErr: "未由管理员配置",
+		},
+		{
+			name: "operator exec stage without command",
+			stages: []rainbowconfig.Stage{
+				{Type: types.StageCopy},
+				{Name: "empty", Type: types.StageExec},
+			},
+			wantErr: "未由管理员配置",
+		},
+		{
+			name: "unnamed exec stage",
+			stages: []rainbowconfig.Stage{
+				{Type: types.StageCopy},
+				{Type: types.StageExec},
+			},
+			wantErr: "未由管理员配置",
+		},
+		{
+			name:    "verify digest before copy",
+			stages:  []rainbowconfig.Stage{{Type: types.StageVerifyDigest}, {Type: types.StageCopy}},
+			wantErr: "需要在 copy 之后执行",
+		},
+		{
+			name:    "duplicate copy stage",
+			stages:  []rainbowconfig.Stage{{Name: "copy-1", Type: types.StageCopy}, {Name: "copy-2", Type: types.StageCopy}},
+			wantErr: "只能包含一个 copy 阶段",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateStages(tc.stages, execStages)
+			if len(tc.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tc.stages, tc.want) {
+				t.Errorf("expected stages %+v, got %+v", tc.want, tc.stages)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/caoyingjunz/rainbow/pkg/types"
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
 )
 
 func DoHttpRequest(url string) ([]byte, error) {
@@ -144,6 +145,15 @@ func ValidateArch(arch string) error {
 	return nil
 }
 
+// ValidatePublicKey 校验用于 cosign 签名校验的公钥
+func ValidatePublicKey(publicKey string) error {
+	if len(publicKey) == 0 {
+		return nil
+	}
+	_, err := registry.ParsePublicKey([]byte(publicKey))
+	return err
+}
+
 func ByteSizeSimple(bytes int64) string {
 	if bytes <= 0 {
 		return "0 B"
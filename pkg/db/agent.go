@@ -21,6 +21,29 @@ type AgentInterface interface {
 	List(ctx context.Context, opts ...Options) ([]model.Agent, error)
 	ListForSchedule(ctx context.Context, opts ...Options) ([]model.Agent, error)
 	Count(ctx context.Context, opts ...Options) (int64, error)
+
+	CreateRollout(ctx context.Context, object *model.AgentRollout) (*model.AgentRollout, error)
+	UpdateRollout(ctx context.Context, rolloutId int64, resourceVersion int64, updates map[string]interface{}) error
+	GetRollout(ctx context.Context, rolloutId int64) (*model.AgentRollout, error)
+	ListRollouts(ctx context.Context, opts ...Options) ([]model.AgentRollout, error)
+	CountRollouts(ctx context.Context, opts ...Options) (int64, error)
+
+	CreateRolloutMessage(ctx context.Context, object *model.AgentRolloutMessage) error
+	ListRolloutMessages(ctx context.Context, opts ...Options) ([]model.AgentRolloutMessage, error)
+
+	CreateUsage(ctx context.Context, object *model.AgentUsage) (*model.AgentUsage, error)
+	UpdateUsage(ctx context.Context, usageId int64, resourceVersion int64, updates map[string]interface{}) error
+	GetUsage(ctx context.Context, opts ...Options) (*model.AgentUsage, error)
+	ListUsages(ctx context.Context, opts ...Options) ([]model.AgentUsage, error)
+
+	CreateGithubAccount(ctx context.Context, object *model.GithubAccount) (*model.GithubAccount, error)
+	UpdateGithubAccount(ctx context.Context, accountId int64, resourceVersion int64, updates map[string]interface{}) error
+	DeleteGithubAccount(ctx context.Context, accountId int64) error
+	ListGithubAccounts(ctx context.Context, opts ...Options) ([]model.GithubAccount, error)
+
+	CreateHeartbeat(ctx context.Context, object *model.AgentHeartbeat) error
+	DeleteHeartbeats(ctx context.Context, opts ...Options) error
+	ListHeartbeats(ctx context.Context, opts ...Options) ([]model.AgentHeartbeat, error)
 }
 
 func newAgent(db *gorm.DB) AgentInterface {
@@ -123,7 +146,7 @@ func (a *agent) ListForSchedule(ctx context.Context, opts ...Options) ([]model.A
 	for _, opt := range opts {
 		tx = opt(tx)
 	}
-	if err := tx.Where("status = ?", "在线").Find(&audits).Error; err != nil {
+	if err := tx.Where("status = ? and unschedulable = ? and budget_paused = ?", "在线", false, false).Find(&audits).Error; err != nil {
 		return nil, err
 	}
 
@@ -143,3 +166,210 @@ func (a *agent) Count(ctx context.Context, opts ...Options) (int64, error) {
 
 	return total, nil
 }
+
+func (a *agent) CreateRollout(ctx context.Context, object *model.AgentRollout) (*model.AgentRollout, error) {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	if err := a.db.WithContext(ctx).Create(object).Error; err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func (a *agent) UpdateRollout(ctx context.Context, rolloutId int64, resourceVersion int64, updates map[string]interface{}) error {
+	updates["gmt_modified"] = time.Now()
+	updates["resource_version"] = resourceVersion + 1
+
+	f := a.db.WithContext(ctx).Model(&model.AgentRollout{}).Where("id = ? and resource_version = ?", rolloutId, resourceVersion).Updates(updates)
+	if f.Error != nil {
+		return f.Error
+	}
+	if f.RowsAffected == 0 {
+		return fmt.Errorf("record not updated")
+	}
+
+	return nil
+}
+
+func (a *agent) GetRollout(ctx context.Context, rolloutId int64) (*model.AgentRollout, error) {
+	var audit model.AgentRollout
+	if err := a.db.WithContext(ctx).Where("id = ?", rolloutId).First(&audit).Error; err != nil {
+		return nil, err
+	}
+	return &audit, nil
+}
+
+func (a *agent) ListRollouts(ctx context.Context, opts ...Options) ([]model.AgentRollout, error) {
+	var audits []model.AgentRollout
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
+
+func (a *agent) CountRollouts(ctx context.Context, opts ...Options) (int64, error) {
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	var total int64
+	if err := tx.Model(&model.AgentRollout{}).Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+func (a *agent) CreateRolloutMessage(ctx context.Context, object *model.AgentRolloutMessage) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	return a.db.WithContext(ctx).Create(object).Error
+}
+
+func (a *agent) ListRolloutMessages(ctx context.Context, opts ...Options) ([]model.AgentRolloutMessage, error) {
+	var audits []model.AgentRolloutMessage
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
+
+func (a *agent) CreateUsage(ctx context.Context, object *model.AgentUsage) (*model.AgentUsage, error) {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	if err := a.db.WithContext(ctx).Create(object).Error; err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func (a *agent) UpdateUsage(ctx context.Context, usageId int64, resourceVersion int64, updates map[string]interface{}) error {
+	updates["gmt_modified"] = time.Now()
+	updates["resource_version"] = resourceVersion + 1
+
+	f := a.db.WithContext(ctx).Model(&model.AgentUsage{}).Where("id = ? and resource_version = ?", usageId, resourceVersion).Updates(updates)
+	if f.Error != nil {
+		return f.Error
+	}
+	if f.RowsAffected == 0 {
+		return fmt.Errorf("record not updated")
+	}
+
+	return nil
+}
+
+func (a *agent) GetUsage(ctx context.Context, opts ...Options) (*model.AgentUsage, error) {
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	var audit model.AgentUsage
+	if err := tx.First(&audit).Error; err != nil {
+		return nil, err
+	}
+	return &audit, nil
+}
+
+func (a *agent) ListUsages(ctx context.Context, opts ...Options) ([]model.AgentUsage, error) {
+	var audits []model.AgentUsage
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
+
+func (a *agent) CreateGithubAccount(ctx context.Context, object *model.GithubAccount) (*model.GithubAccount, error) {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	if err := a.db.WithContext(ctx).Create(object).Error; err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func (a *agent) UpdateGithubAccount(ctx context.Context, accountId int64, resourceVersion int64, updates map[string]interface{}) error {
+	updates["gmt_modified"] = time.Now()
+	updates["resource_version"] = resourceVersion + 1
+
+	f := a.db.WithContext(ctx).Model(&model.GithubAccount{}).Where("id = ? and resource_version = ?", accountId, resourceVersion).Updates(updates)
+	if f.Error != nil {
+		return f.Error
+	}
+	if f.RowsAffected == 0 {
+		return fmt.Errorf("record not updated")
+	}
+
+	return nil
+}
+
+func (a *agent) DeleteGithubAccount(ctx context.Context, accountId int64) error {
+	return a.db.WithContext(ctx).Where("id = ?", accountId).Delete(&model.GithubAccount{}).Error
+}
+
+func (a *agent) ListGithubAccounts(ctx context.Context, opts ...Options) ([]model.GithubAccount, error) {
+	var audits []model.GithubAccount
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
+
+func (a *agent) CreateHeartbeat(ctx context.Context, object *model.AgentHeartbeat) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	return a.db.WithContext(ctx).Create(object).Error
+}
+
+func (a *agent) DeleteHeartbeats(ctx context.Context, opts ...Options) error {
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	return tx.Delete(&model.AgentHeartbeat{}).Error
+}
+
+func (a *agent) ListHeartbeats(ctx context.Context, opts ...Options) ([]model.AgentHeartbeat, error) {
+	var audits []model.AgentHeartbeat
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
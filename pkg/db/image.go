@@ -53,6 +53,13 @@ type ImageInterface interface {
 	SearchTags(ctx context.Context, name, arch, path, userID string) ([]model.Tag, error)
 
 	TagCount(ctx context.Context, opts ...Options) (int64, error)
+
+	CreateTagPlatforms(ctx context.Context, objects []model.TagPlatform) error
+	DeleteTagPlatforms(ctx context.Context, opts ...Options) error
+	ListTagPlatforms(ctx context.Context, opts ...Options) ([]model.TagPlatform, error)
+
+	CreateTagProvenance(ctx context.Context, object *model.TagProvenance) error
+	ListTagProvenances(ctx context.Context, opts ...Options) ([]model.TagProvenance, error)
 	PullAllCount(ctx context.Context) (int64, error)
 
 	CreateNamespace(ctx context.Context, object *model.Namespace) (*model.Namespace, error)
@@ -422,6 +429,62 @@ func (a *image) GetTagBy(ctx context.Context, opts ...Options) (*model.Tag, erro
 	return &audit, nil
 }
 
+func (a *image) CreateTagPlatforms(ctx context.Context, objects []model.TagPlatform) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	now := time.Now()
+	for i := range objects {
+		objects[i].GmtCreate = now
+		objects[i].GmtModified = now
+	}
+
+	return a.db.WithContext(ctx).Create(&objects).Error
+}
+
+func (a *image) DeleteTagPlatforms(ctx context.Context, opts ...Options) error {
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	return tx.Delete(&model.TagPlatform{}).Error
+}
+
+func (a *image) ListTagPlatforms(ctx context.Context, opts ...Options) ([]model.TagPlatform, error) {
+	var audits []model.TagPlatform
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
+
+func (a *image) CreateTagProvenance(ctx context.Context, object *model.TagProvenance) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	return a.db.WithContext(ctx).Create(object).Error
+}
+
+func (a *image) ListTagProvenances(ctx context.Context, opts ...Options) ([]model.TagProvenance, error) {
+	var audits []model.TagProvenance
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+
+	return audits, nil
+}
+
 func (a *image) GetTag(ctx context.Context, tagId int64, del bool) (*model.Tag, error) {
 	tx := a.db.WithContext(ctx)
 	if del {
@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	register(&Agent{}, &Account{})
+	register(&Agent{}, &Account{}, &AgentRollout{}, &AgentRolloutMessage{}, &AgentUsage{}, &GithubAccount{}, &AgentHeartbeat{})
 }
 
 const (
@@ -31,6 +31,21 @@ const (
 	PrivateAgentType string = "private"
 )
 
+const (
+	// agent 滚动升级类型
+	BinaryRolloutType string = "binary"
+	ImageRolloutType  string = "image"
+
+	// agent 滚动升级状态
+	PendingRolloutStatus     string = "等待中"
+	CanaryRolloutStatus      string = "灰度中"
+	ProgressingRolloutStatus string = "升级中"
+	SucceededRolloutStatus   string = "升级完成"
+	RollingBackRolloutStatus string = "回滚中"
+	RolledBackRolloutStatus  string = "已回滚"
+	FailedRolloutStatus      string = "失败"
+)
+
 type Agent struct {
 	rainbow.Model
 
@@ -40,12 +55,32 @@ type Agent struct {
 	Status             string    `gorm:"column:status;" json:"status"`
 	Message            string    `json:"message"`
 	RainbowdName       string    `json:"rainbowd_name"`
+	AgentImage         string    `json:"agent_image"`                                             // agent 运行镜像，为空时使用 rainbowd 的默认镜像
+	Unschedulable      bool      `gorm:"column:unschedulable;default:false" json:"unschedulable"` // 是否禁止调度，维护时设置，不影响已分配任务的执行
 
 	GithubUser       string  `json:"github_user"`       // github 后端用户名
 	GithubEmail      string  `json:"github_email"`      // github 邮箱
 	GithubRepository string  `json:"github_repository"` // github 仓库地址
 	GithubToken      string  `json:"github_token"`      // github token
 	GrossAmount      float64 `json:"gross_amount"`      // github 账号开销金额，每个账号上限 16 美金，达到之后自动下线 agent
+	MonthlyBudget    float64 `json:"monthly_budget"`    // 每月开销预算，为 0 时使用 rainbowd 的默认预算
+
+	// 达到预算上限时由预算控制器设置，与人工设置的 unschedulable 相互独立
+	BudgetPaused bool `gorm:"column:budget_paused;default:false" json:"budget_paused"`
+
+	AgentHealth `json:",inline"` // 最近一次心跳上报的资源和健康状态
+}
+
+// AgentHealth agent 心跳上报的资源和健康状态
+type AgentHealth struct {
+	Version       string `json:"version"`
+	FreeDisk      int64  `json:"free_disk"`      // DataDir 所在磁盘的剩余空间，单位字节，-1 表示未知
+	QueueDepth    int    `json:"queue_depth"`    // 等待处理的任务数
+	ActiveWorkers int    `json:"active_workers"` // 正在处理任务的 worker 数
+	Workers       int    `json:"workers"`
+	LastTaskError string `json:"last_task_error"`
+	DockerHealthy bool   `json:"docker_healthy"`
+	GitHealthy    bool   `json:"git_healthy"`
 }
 
 func (a *Agent) TableName() string {
@@ -66,3 +101,83 @@ type Account struct {
 func (a *Account) TableName() string {
 	return "accounts"
 }
+
+// AgentRollout agent 的分批滚动升级记录
+type AgentRollout struct {
+	rainbow.Model
+
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`            // binary 或者 image
+	Binary         string    `json:"binary"`          // 新的 agent 二进制文件路径，type 为 binary 时生效
+	AgentImage     string    `json:"agent_image"`     // 新的 agent 镜像，type 为 image 时生效
+	Agents         string    `json:"agents"`          // 参与升级的 agents，多个以逗号隔开
+	Upgraded       string    `json:"upgraded"`        // 已升级且心跳正常的 agents
+	Current        string    `json:"current"`         // 当前批次正在升级的 agents
+	PreviousImages string    `json:"previous_images"` // 升级前的镜像或已备份的二进制，json 格式，用于回滚
+	CanaryCount    int       `json:"canary_count"`    // 灰度数量
+	MaxUnavailable int       `json:"max_unavailable"` // 每批次最多同时升级的数量
+	HealthTimeout  int64     `json:"health_timeout"`  // 等待心跳恢复的超时时间，单位秒
+	BatchStartTime time.Time `gorm:"column:batch_start_time;type:datetime;default:current_timestamp;not null" json:"batch_start_time"`
+	Status         string    `json:"status"`
+	Message        string    `json:"message"`
+}
+
+func (a *AgentRollout) TableName() string {
+	return "agent_rollouts"
+}
+
+type AgentRolloutMessage struct {
+	rainbow.Model
+
+	RolloutId int64  `json:"rollout_id" gorm:"index:idx"`
+	Message   string `json:"message"`
+}
+
+func (a *AgentRolloutMessage) TableName() string {
+	return "agent_rollout_messages"
+}
+
+// AgentUsage agent 每月的 github actions 开销记录
+type AgentUsage struct {
+	rainbow.Model
+
+	AgentName   string  `gorm:"index:idx_agent_month" json:"agent_name"`
+	GithubUser  string  `json:"github_user"`
+	Month       string  `gorm:"index:idx_agent_month" json:"month"` // 格式为 2006-01
+	GrossAmount float64 `json:"gross_amount"`
+	Budget      float64 `json:"budget"`
+	Notified    int     `json:"notified"`  // 已发送告警的最高阈值
+	Exhausted   bool    `json:"exhausted"` // 是否已达到预算上限
+}
+
+func (a *AgentUsage) TableName() string {
+	return "agent_usages"
+}
+
+// GithubAccount 备用 github 账号池，agent 开销达到上限后自动切换
+type GithubAccount struct {
+	rainbow.Model
+
+	GithubUser       string `gorm:"index:idx_github_user,unique" json:"github_user"`
+	GithubEmail      string `json:"github_email"`
+	GithubRepository string `json:"github_repository"`
+	GithubToken      string `json:"-"`
+	AgentName        string `json:"agent_name"`      // 正在使用该账号的 agent，为空时表示空闲
+	ExhaustedMonth   string `json:"exhausted_month"` // 最近一次达到开销上限的月份，当月不再分配
+}
+
+func (a *GithubAccount) TableName() string {
+	return "github_accounts"
+}
+
+// AgentHeartbeat agent 心跳的时序记录
+type AgentHeartbeat struct {
+	rainbow.Model
+
+	AgentName   string `gorm:"index:idx_agent" json:"agent_name"`
+	AgentHealth `json:",inline"`
+}
+
+func (a *AgentHeartbeat) TableName() string {
+	return "agent_heartbeats"
+}
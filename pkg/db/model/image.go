@@ -9,7 +9,7 @@ import (
 )
 
 func init() {
-	register(&Image{}, &Tag{}, &Namespace{})
+	register(&Image{}, &Tag{}, &Namespace{}, &TagPlatform{}, &TagProvenance{})
 }
 
 type Image struct {
@@ -59,14 +59,60 @@ type Tag struct {
 	Message      string `json:"message"` // 错误信息
 	Manifest     string `json:"manifest"`
 	Digest       string `json:"digest"`
-	Architecture string `json:"architecture"` // 版本对应的架构，默认是 arm64，也可以是 amd64
-	ReadSize     string `json:"read_size"`    // 转换之后的，方便人读的大小
+	Architecture string `json:"architecture"`  // 版本对应的架构，默认是 arm64，也可以是 amd64
+	ReadSize     string `json:"read_size"`     // 转换之后的，方便人读的大小
+	MediaType    string `json:"media_type"`    // manifest 的类型
+	ArtifactType string `json:"artifact_type"` // OCI artifact 的类型，如 helm chart 为 application/vnd.cncf.helm.config.v1+json
+	MirrorTag    string `json:"mirror_tag"`    // 按版本模板改写后的目标版本，为空时和 Name 一致
+	Profile      string `json:"profile"`       // 同步 kubernetes 镜像时使用的 kubeadm 配置名称
 }
 
 func (t *Tag) TableName() string {
 	return "tags"
 }
 
+// GetMirrorTag 返回目标仓库中的版本
+func (t *Tag) GetMirrorTag() string {
+	if len(t.MirrorTag) != 0 {
+		return t.MirrorTag
+	}
+	return t.Name
+}
+
+// TagPlatform 多架构镜像版本中各平台对应的 manifest
+type TagPlatform struct {
+	rainbow.Model
+
+	ImageId   int64  `gorm:"index:idx_image" json:"image_id"`
+	TagId     int64  `gorm:"index:idx_tag" json:"tag_id"`
+	Platform  string `json:"platform"`
+	Digest    string `json:"digest"`
+	MediaType string `json:"media_type"`
+	Size      int64  `json:"size"`
+}
+
+func (t *TagPlatform) TableName() string {
+	return "tag_platforms"
+}
+
+// TagProvenance 镜像版本的同步来源记录，每次同步并校验通过后记录一次
+type TagProvenance struct {
+	rainbow.Model
+
+	ImageId      int64  `gorm:"index:idx_image" json:"image_id"`
+	TagId        int64  `gorm:"index:idx_tag" json:"tag_id"`
+	TaskId       int64  `json:"task_id"`
+	AgentName    string `json:"agent_name"`
+	Source       string `json:"source"` // 源镜像地址
+	SourceDigest string `json:"source_digest"`
+	Target       string `json:"target"` // 目标镜像地址
+	TargetDigest string `json:"target_digest"`
+}
+
+func (t *TagProvenance) TableName() string {
+	return "tag_provenances"
+}
+
 type Downflow struct {
 	rainbow.Model
 
@@ -3,15 +3,59 @@ package model
 import "github.com/caoyingjunz/rainbow/pkg/db/model/rainbow"
 
 func init() {
-	register(&KubernetesVersion{})
+	register(&KubernetesVersion{}, &KubernetesAddon{}, &KubernetesPrefetch{})
 }
 
 type KubernetesVersion struct {
 	rainbow.Model
 
 	Tag string `gorm:"index:idx_tag,unique" json:"tag"` // k8s, db, ai等标识
+
+	// kubeadm 使用的组件版本，由 server 定期从 kubeadm 源码中解析，用于生成 kubernetes 镜像列表
+	ImageRepository string `json:"image_repository"`
+	PauseVersion    string `json:"pause_version"`
+	EtcdVersion     string `json:"etcd_version"`
+	CoreDNSVersion  string `json:"coredns_version"`
 }
 
 func (t *KubernetesVersion) TableName() string {
 	return "kubernetes_versions"
 }
+
+// KubernetesAddon 插件目录中的一个插件版本，由 server 定期从插件清单同步
+type KubernetesAddon struct {
+	rainbow.Model
+
+	Name          string `json:"name" gorm:"type:varchar(64);uniqueIndex:idx_name_version"`
+	Version       string `json:"version" gorm:"type:varchar(64);uniqueIndex:idx_name_version"`
+	Category      string `json:"category"`                // cni、ingress、metrics 或 csi
+	MinKubernetes string `json:"min_kubernetes"`          // 支持的最低 kubernetes 次版本，为空时不限制
+	MaxKubernetes string `json:"max_kubernetes"`          // 支持的最高 kubernetes 次版本，为空时不限制
+	Images        string `json:"images" gorm:"type:text"` // 插件的镜像，多个以逗号隔开
+}
+
+func (t *KubernetesAddon) TableName() string {
+	return "kubernetes_addons"
+}
+
+// KubernetesPrefetch kubernetes 版本自动预取策略，server 发现匹配策略的新版本时自动创建同步任务
+type KubernetesPrefetch struct {
+	rainbow.Model
+	rainbow.UserModel
+
+	Name         string `json:"name"`
+	Enable       bool   `json:"enable"`
+	Policy       string `json:"policy"`      // latest-minors: 最近 Minors 个次版本的补丁版本，since: 不低于 MinVersion 的版本
+	Minors       int    `json:"minors"`      // latest-minors 策略保留的次版本数量
+	MinVersion   string `json:"min_version"` // since 策略的最低版本，比如 v1.28
+	RegisterId   int64  `json:"register_id"`
+	Namespace    string `json:"namespace"`
+	Architecture string `json:"architecture"`
+	Driver       string `json:"driver"`
+	Addons       string `json:"addons"`       // 同步的插件，多个以逗号隔开
+	LastVersion  string `json:"last_version"` // 最近一次自动预取的版本
+}
+
+func (t *KubernetesPrefetch) TableName() string {
+	return "kubernetes_prefetches"
+}
@@ -19,6 +19,18 @@ type Registry struct {
 	Username   string `json:"username"`
 	Password   string `json:"password"`
 
+	// 推送到该仓库时目标镜像的名称和版本模板，任务中设置的模板优先
+	NameTemplate string `json:"name_template"`
+	TagTemplate  string `json:"tag_template"`
+
+	// 推送到该仓库时的并发和带宽限制，任务中的设置优先
+	ParallelImages int    `json:"parallel_images"`
+	ParallelLayers int    `json:"parallel_layers"`
+	BandwidthLimit string `json:"bandwidth_limit"`
+
+	// Insecure 仓库仅支持 http 访问
+	Insecure bool `json:"insecure"`
+
 	// 默认华为仓库客户端依赖配置
 	RegionId string `json:"region_id"`
 	Ak       string `json:"ak"`
@@ -7,7 +7,7 @@ import (
 )
 
 func init() {
-	register(&Task{}, &TaskMessage{}, &Subscribe{}, &SubscribeMessage{})
+	register(&Task{}, &TaskMessage{}, &ImageProgress{}, &ImageStage{}, &CallbackEvent{}, &TaskExport{}, &Subscribe{}, &SubscribeMessage{})
 }
 
 type Task struct {
@@ -22,7 +22,7 @@ type Task struct {
 	Mode              int64  `json:"mode"`
 	Status            string `json:"status"`
 	Message           string `json:"message"`
-	Type              int    `json:"type"` // 0：直接指定镜像列表 1: 指定 kubernetes 版本
+	Type              int    `json:"type"` // 0：直接指定镜像列表 1: 指定 kubernetes 版本 2: 离线包导入
 	KubernetesVersion string `json:"kubernetes_version"`
 	Driver            string `json:"driver"` // docker or skopeo
 	Namespace         string `json:"namespace"`
@@ -31,8 +31,30 @@ type Task struct {
 	Logo              string `json:"logo"`
 	OnlyPushError     bool   `json:"only_push_error"` // 仅同步推送异常
 	Architecture      string `json:"architecture"`
-	OwnerRef          int    `json:"owner_ref"`    // 任务所属，直接创建 0，订阅创建 1
-	SubscribeId       int64  `json:"subscribe_id"` // 所属关联订阅ID，默认为 0 手动创建 1 订阅创建
+	Platforms         string `json:"platforms"`               // 多架构同步的平台，多个以逗号隔开，all 表示全部平台，为空时仅同步 Architecture
+	Signatures        bool   `json:"signatures"`              // 同步镜像关联的签名、attestation 和 SBOM
+	PublicKey         string `json:"public_key"`              // 推送前用于校验 cosign 签名的公钥
+	ArtifactKind      string `json:"artifact_kind"`           // 制品类型，为空时为 image
+	NameTemplate      string `json:"name_template"`           // 目标镜像名称模板，为空时使用仓库的模板
+	TagTemplate       string `json:"tag_template"`            // 目标镜像版本模板，为空时使用仓库的模板
+	Stages            string `json:"stages" gorm:"type:text"` // plugin 同步镜像的阶段，json 格式，为空时使用默认阶段
+	ParallelImages    int    `json:"parallel_images"`         // 同时同步的镜像数量，为 0 时使用仓库的设置
+	ParallelLayers    int    `json:"parallel_layers"`         // 单个镜像同时复制的层数，为 0 时使用仓库的设置
+	BandwidthLimit    string `json:"bandwidth_limit"`         // 带宽上限，为空时使用仓库的设置
+	Addons            string `json:"addons"`                  // kubernetes 任务同步的插件，格式为 name@version，多个以逗号隔开
+	OwnerRef          int    `json:"owner_ref"`               // 任务所属，直接创建 0，订阅创建 1，kubernetes 自动预取创建 2
+	SubscribeId       int64  `json:"subscribe_id"`            // 所属关联订阅ID，默认为 0 手动创建 1 订阅创建
+	PrefetchId        int64  `json:"prefetch_id"`             // 所属 kubernetes 自动预取策略ID
+
+	// kubernetes 任务的自定义 kubeadm 配置，json 格式，为空时使用 kubeadm 默认的镜像仓库和组件版本
+	Kubeadm string `json:"kubeadm" gorm:"type:text"`
+
+	// 同步完成后导出离线包的格式，oci 或 docker，为空时不导出
+	ExportFormat string `json:"export_format"`
+
+	// plugin 回调使用的任务级 token，仅保存 sha256 摘要，每次下发 plugin 配置时重新生成
+	CallbackToken         string `json:"-" gorm:"type:varchar(64)"`
+	CallbackTokenExpireAt int64  `json:"-"`
 }
 
 func (t *Task) TableName() string {
@@ -50,6 +72,72 @@ func (t *TaskMessage) TableName() string {
 	return "task_messages"
 }
 
+// ImageProgress plugin 上报的镜像同步进度，每个任务的每个目标镜像一条记录
+type ImageProgress struct {
+	rainbow.Model
+
+	TaskId      int64  `json:"task_id" gorm:"uniqueIndex:idx_task_target"`
+	ImageId     int64  `json:"image_id"`
+	Target      string `json:"target" gorm:"type:varchar(255);uniqueIndex:idx_task_target"`
+	BytesDone   int64  `json:"bytes_done"`
+	BytesTotal  int64  `json:"bytes_total"`
+	LayersDone  int    `json:"layers_done"`
+	LayersTotal int    `json:"layers_total"`
+}
+
+func (t *ImageProgress) TableName() string {
+	return "image_progresses"
+}
+
+// ImageStage plugin 上报的镜像同步阶段状态，每个任务的每个目标镜像的每个阶段一条记录
+type ImageStage struct {
+	rainbow.Model
+
+	TaskId   int64  `json:"task_id" gorm:"uniqueIndex:idx_task_target_stage"`
+	ImageId  int64  `json:"image_id"`
+	Target   string `json:"target" gorm:"type:varchar(255);uniqueIndex:idx_task_target_stage"`
+	Stage    string `json:"stage" gorm:"type:varchar(64);uniqueIndex:idx_task_target_stage"`
+	Type     string `json:"type"`
+	Sequence int    `json:"sequence"` // 阶段的执行顺序
+	Status   string `json:"status"`
+	Message  string `json:"message"`
+}
+
+func (t *ImageStage) TableName() string {
+	return "image_stages"
+}
+
+// CallbackEvent 已处理的 plugin 回调事件，用于批量回调重试时的去重
+type CallbackEvent struct {
+	rainbow.Model
+
+	TaskId  int64  `json:"task_id" gorm:"uniqueIndex:idx_task_event"`
+	EventId string `json:"event_id" gorm:"type:varchar(128);uniqueIndex:idx_task_event"`
+
+	// Error 处理失败时的原因，失败的事件同样记录，避免 plugin 重发时一直失败
+	Error string `json:"error"`
+}
+
+func (t *CallbackEvent) TableName() string {
+	return "callback_events"
+}
+
+// TaskExport 任务导出的离线包，每个任务保留最近一次导出的离线包
+type TaskExport struct {
+	rainbow.Model
+
+	TaskId int64  `json:"task_id" gorm:"uniqueIndex"`
+	Format string `json:"format"`
+	Name   string `json:"name"` // 离线包文件名
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256" gorm:"type:varchar(64)"`
+	Images int    `json:"images"` // 离线包中的镜像数量
+}
+
+func (t *TaskExport) TableName() string {
+	return "task_exports"
+}
+
 type Subscribe struct { // 同步远端镜像更新状态
 	rainbow.Model
 	rainbow.UserModel
@@ -69,6 +157,8 @@ type Subscribe struct { // 同步远端镜像更新状态
 	Policy         string        `json:"policy"`                                                                                           // 默认定义所有版本镜像，支持正则表达式，比如 v1.*
 	Arch           string        `json:"arch"`
 	Rewrite        bool          `json:"rewrite"`
+	Signatures     bool          `json:"signatures"` // 同步镜像关联的签名、attestation 和 SBOM
+	PublicKey      string        `json:"public_key"` // 推送前用于校验 cosign 签名的公钥
 }
 
 func (t *Subscribe) TableName() string {
@@ -113,6 +113,12 @@ func WithIDIn(ids ...int64) Options {
 	}
 }
 
+func WithEventIdIn(ids ...string) Options {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("event_id IN ?", ids)
+	}
+}
+
 func WithIDStrIn(ids ...string) Options {
 	return func(tx *gorm.DB) *gorm.DB {
 		// e.g. `WHERE id IN (1, 2, 3)`
@@ -230,6 +236,42 @@ func WithTask(taskId int64) Options {
 	}
 }
 
+func WithRollout(rolloutId int64) Options {
+	return func(tx *gorm.DB) *gorm.DB {
+		if rolloutId == 0 {
+			return tx
+		}
+		return tx.Where("rollout_id = ?", rolloutId)
+	}
+}
+
+func WithStatusIn(status ...string) Options {
+	return func(tx *gorm.DB) *gorm.DB {
+		if len(status) == 0 {
+			return tx
+		}
+		return tx.Where("status IN ?", status)
+	}
+}
+
+func WithMonth(month string) Options {
+	return func(tx *gorm.DB) *gorm.DB {
+		if len(month) == 0 {
+			return tx
+		}
+		return tx.Where("month = ?", month)
+	}
+}
+
+func WithGithubUser(githubUser string) Options {
+	return func(tx *gorm.DB) *gorm.DB {
+		if len(githubUser) == 0 {
+			return tx
+		}
+		return tx.Where("github_user = ?", githubUser)
+	}
+}
+
 func WithBuild(buildId int64) Options {
 	return func(tx *gorm.DB) *gorm.DB {
 		if buildId == 0 {
@@ -275,6 +317,15 @@ func WithImage(imageId int64) Options {
 	}
 }
 
+func WithTagId(tagId int64) Options {
+	return func(tx *gorm.DB) *gorm.DB {
+		if tagId == 0 {
+			return tx
+		}
+		return tx.Where("tag_id = ?", tagId)
+	}
+}
+
 func WithPathLike(path string) Options {
 	return func(tx *gorm.DB) *gorm.DB {
 		if len(path) == 0 {
@@ -356,6 +407,24 @@ func WithLabel(labelId int64) Options {
 	}
 }
 
+func WithCategory(category string) Options {
+	return func(tx *gorm.DB) *gorm.DB {
+		if len(category) == 0 {
+			return tx
+		}
+		return tx.Where("category = ?", category)
+	}
+}
+
+func WithVersion(version string) Options {
+	return func(tx *gorm.DB) *gorm.DB {
+		if len(version) == 0 {
+			return tx
+		}
+		return tx.Where("version = ?", version)
+	}
+}
+
 func WithOfficial() Options {
 	return func(tx *gorm.DB) *gorm.DB {
 		return tx.Where("is_official = 1")
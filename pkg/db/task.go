@@ -43,6 +43,22 @@ type TaskInterface interface {
 	DeleteTaskMessages(ctx context.Context, taskId int64) error
 	ListTaskMessages(ctx context.Context, opts ...Options) ([]model.TaskMessage, error)
 
+	CreateOrUpdateImageProgress(ctx context.Context, object *model.ImageProgress) error
+	ListImageProgresses(ctx context.Context, opts ...Options) ([]model.ImageProgress, error)
+	DeleteImageProgresses(ctx context.Context, taskId int64) error
+
+	CreateOrUpdateImageStage(ctx context.Context, object *model.ImageStage) error
+	ListImageStages(ctx context.Context, opts ...Options) ([]model.ImageStage, error)
+	DeleteImageStages(ctx context.Context, taskId int64) error
+
+	CreateOrUpdateTaskExport(ctx context.Context, object *model.TaskExport) error
+	GetTaskExport(ctx context.Context, taskId int64) (*model.TaskExport, error)
+	DeleteTaskExport(ctx context.Context, taskId int64) error
+
+	CreateCallbackEvent(ctx context.Context, object *model.CallbackEvent) error
+	ListCallbackEvents(ctx context.Context, opts ...Options) ([]model.CallbackEvent, error)
+	DeleteCallbackEvents(ctx context.Context, taskId int64) error
+
 	CreateUser(ctx context.Context, object *model.User) error
 	ListUsers(ctx context.Context, opts ...Options) ([]model.User, error)
 	CountUsers(ctx context.Context, opts ...Options) (int64, error)
@@ -59,6 +75,18 @@ type TaskInterface interface {
 	GetKubernetesVersionCount(ctx context.Context, opts ...Options) (int64, error)
 	GetKubernetesVersion(ctx context.Context, name string) (*model.KubernetesVersion, error)
 	CreateKubernetesVersion(ctx context.Context, object *model.KubernetesVersion) error
+	UpdateKubernetesVersion(ctx context.Context, tag string, updates map[string]interface{}) error
+
+	CreateOrUpdateKubernetesAddon(ctx context.Context, object *model.KubernetesAddon) error
+	ListKubernetesAddons(ctx context.Context, opts ...Options) ([]model.KubernetesAddon, error)
+	DeleteKubernetesAddon(ctx context.Context, addonId int64) error
+
+	CreateKubernetesPrefetch(ctx context.Context, object *model.KubernetesPrefetch) error
+	UpdateKubernetesPrefetch(ctx context.Context, prefetchId int64, resourceVersion int64, updates map[string]interface{}) error
+	DeleteKubernetesPrefetch(ctx context.Context, prefetchId int64) error
+	GetKubernetesPrefetch(ctx context.Context, prefetchId int64) (*model.KubernetesPrefetch, error)
+	ListKubernetesPrefetches(ctx context.Context, opts ...Options) ([]model.KubernetesPrefetch, error)
+	CountKubernetesPrefetch(ctx context.Context, opts ...Options) (int64, error)
 
 	CreateSubscribe(ctx context.Context, object *model.Subscribe) error
 	UpdateSubscribe(ctx context.Context, subId int64, resourceVersion int64, updates map[string]interface{}) error
@@ -356,6 +384,110 @@ func (a *task) ListTaskMessages(ctx context.Context, opts ...Options) ([]model.T
 	return audits, nil
 }
 
+func (a *task) CreateOrUpdateImageProgress(ctx context.Context, object *model.ImageProgress) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	return a.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}, {Name: "target"}},
+		DoUpdates: clause.AssignmentColumns([]string{"gmt_modified", "image_id", "bytes_done", "bytes_total", "layers_done", "layers_total"}),
+	}).Create(object).Error
+}
+
+func (a *task) ListImageProgresses(ctx context.Context, opts ...Options) ([]model.ImageProgress, error) {
+	var audits []model.ImageProgress
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+func (a *task) DeleteImageProgresses(ctx context.Context, taskId int64) error {
+	return a.db.WithContext(ctx).Where("task_id = ?", taskId).Delete(&model.ImageProgress{}).Error
+}
+
+func (a *task) CreateOrUpdateTaskExport(ctx context.Context, object *model.TaskExport) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	return a.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"gmt_modified", "format", "name", "size", "sha256", "images"}),
+	}).Create(object).Error
+}
+
+func (a *task) GetTaskExport(ctx context.Context, taskId int64) (*model.TaskExport, error) {
+	var audit model.TaskExport
+	if err := a.db.WithContext(ctx).Where("task_id = ?", taskId).First(&audit).Error; err != nil {
+		return nil, err
+	}
+	return &audit, nil
+}
+
+func (a *task) DeleteTaskExport(ctx context.Context, taskId int64) error {
+	return a.db.WithContext(ctx).Where("task_id = ?", taskId).Delete(&model.TaskExport{}).Error
+}
+
+func (a *task) CreateOrUpdateImageStage(ctx context.Context, object *model.ImageStage) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	return a.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "task_id"}, {Name: "target"}, {Name: "stage"}},
+		DoUpdates: clause.AssignmentColumns([]string{"gmt_modified", "image_id", "type", "sequence", "status", "message"}),
+	}).Create(object).Error
+}
+
+func (a *task) ListImageStages(ctx context.Context, opts ...Options) ([]model.ImageStage, error) {
+	var audits []model.ImageStage
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+func (a *task) DeleteImageStages(ctx context.Context, taskId int64) error {
+	return a.db.WithContext(ctx).Where("task_id = ?", taskId).Delete(&model.ImageStage{}).Error
+}
+
+func (a *task) CreateCallbackEvent(ctx context.Context, object *model.CallbackEvent) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	return a.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(object).Error
+}
+
+func (a *task) ListCallbackEvents(ctx context.Context, opts ...Options) ([]model.CallbackEvent, error) {
+	var audits []model.CallbackEvent
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+func (a *task) DeleteCallbackEvents(ctx context.Context, taskId int64) error {
+	return a.db.WithContext(ctx).Where("task_id = ?", taskId).Delete(&model.CallbackEvent{}).Error
+}
+
 func (a *task) CreateUser(ctx context.Context, object *model.User) error {
 	now := time.Now()
 	object.GmtCreate = now
@@ -487,7 +619,7 @@ func (a *task) GetKubernetesVersionCount(ctx context.Context, opts ...Options) (
 
 func (a *task) GetKubernetesVersion(ctx context.Context, name string) (*model.KubernetesVersion, error) {
 	var audit model.KubernetesVersion
-	if err := a.db.WithContext(ctx).Where("name = ?", name).First(&audit).Error; err != nil {
+	if err := a.db.WithContext(ctx).Where("tag = ?", name).First(&audit).Error; err != nil {
 		return nil, err
 	}
 	return &audit, nil
@@ -504,6 +636,104 @@ func (a *task) CreateKubernetesVersion(ctx context.Context, object *model.Kubern
 	return nil
 }
 
+func (a *task) UpdateKubernetesVersion(ctx context.Context, tag string, updates map[string]interface{}) error {
+	updates["gmt_modified"] = time.Now()
+	return a.db.WithContext(ctx).Model(&model.KubernetesVersion{}).Where("tag = ?", tag).Updates(updates).Error
+}
+
+func (a *task) CreateOrUpdateKubernetesAddon(ctx context.Context, object *model.KubernetesAddon) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	return a.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}, {Name: "version"}},
+		DoUpdates: clause.AssignmentColumns([]string{"gmt_modified", "category", "min_kubernetes", "max_kubernetes", "images"}),
+	}).Create(object).Error
+}
+
+func (a *task) ListKubernetesAddons(ctx context.Context, opts ...Options) ([]model.KubernetesAddon, error) {
+	var audits []model.KubernetesAddon
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+func (a *task) DeleteKubernetesAddon(ctx context.Context, addonId int64) error {
+	return a.db.WithContext(ctx).Where("id = ?", addonId).Delete(&model.KubernetesAddon{}).Error
+}
+
+func (a *task) CreateKubernetesPrefetch(ctx context.Context, object *model.KubernetesPrefetch) error {
+	now := time.Now()
+	object.GmtCreate = now
+	object.GmtModified = now
+
+	if err := a.db.WithContext(ctx).Create(object).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a *task) UpdateKubernetesPrefetch(ctx context.Context, prefetchId int64, resourceVersion int64, updates map[string]interface{}) error {
+	updates["gmt_modified"] = time.Now()
+	updates["resource_version"] = resourceVersion + 1
+
+	f := a.db.WithContext(ctx).Model(&model.KubernetesPrefetch{}).Where("id = ? and resource_version = ?", prefetchId, resourceVersion).Updates(updates)
+	if f.Error != nil {
+		return f.Error
+	}
+	if f.RowsAffected == 0 {
+		return errors.ErrRecordNotUpdate
+	}
+
+	return nil
+}
+
+func (a *task) DeleteKubernetesPrefetch(ctx context.Context, prefetchId int64) error {
+	return a.db.WithContext(ctx).Where("id = ?", prefetchId).Delete(&model.KubernetesPrefetch{}).Error
+}
+
+func (a *task) GetKubernetesPrefetch(ctx context.Context, prefetchId int64) (*model.KubernetesPrefetch, error) {
+	var audit model.KubernetesPrefetch
+	if err := a.db.WithContext(ctx).Where("id = ?", prefetchId).First(&audit).Error; err != nil {
+		return nil, err
+	}
+	return &audit, nil
+}
+
+func (a *task) ListKubernetesPrefetches(ctx context.Context, opts ...Options) ([]model.KubernetesPrefetch, error) {
+	var audits []model.KubernetesPrefetch
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	if err := tx.Find(&audits).Error; err != nil {
+		return nil, err
+	}
+	return audits, nil
+}
+
+func (a *task) CountKubernetesPrefetch(ctx context.Context, opts ...Options) (int64, error) {
+	tx := a.db.WithContext(ctx)
+	for _, opt := range opts {
+		tx = opt(tx)
+	}
+
+	var total int64
+	if err := tx.Model(&model.KubernetesPrefetch{}).Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
 func (a *task) CreateSubscribe(ctx context.Context, object *model.Subscribe) error {
 	now := time.Now()
 	object.GmtCreate = now
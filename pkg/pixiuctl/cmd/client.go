@@ -14,6 +14,7 @@ import (
 	"k8s.io/klog/v2"
 
 	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/types"
 	"github.com/caoyingjunz/rainbow/pkg/util"
 	"github.com/caoyingjunz/rainbow/pkg/util/signatureutil"
 )
@@ -76,6 +77,18 @@ type ImageTagListResult struct {
 	Result TagPageData `json:"result,omitempty"`
 }
 
+type TaskProgressResult struct {
+	ListResult `json:",inline"`
+
+	Result *types.TaskProgress `json:"result,omitempty"`
+}
+
+type TaskExportResult struct {
+	ListResult `json:",inline"`
+
+	Result *model.TaskExport `json:"result,omitempty"`
+}
+
 func NewPixiuHubClient(url, accessKey, secretKey string) (*PixiuHubClient, error) {
 	pc := &PixiuHubClient{
 		baseURL:   url,
@@ -133,6 +146,48 @@ func (pc *PixiuHubClient) ListTasks() error {
 	return nil
 }
 
+func (pc *PixiuHubClient) GetTaskProgress(taskId int64) (*types.TaskProgress, error) {
+	var result TaskProgressResult
+	httpClient := util.HttpClientV2{URL: fmt.Sprintf("%s/api/v2/tasks/%d/progress", pc.baseURL, taskId)}
+	if err := httpClient.Method("GET").
+		WithTimeout(5 * time.Second).
+		WithHeader(map[string]string{"X-ACCESS-KEY": pc.accessKey, "Authorization": pc.signature}).
+		Do(&result); err != nil {
+		return nil, err
+	}
+	if result.Code == 200 {
+		return result.Result, nil
+	}
+	return nil, fmt.Errorf("%s", result.Message)
+}
+
+func (pc *PixiuHubClient) GetTaskExport(taskId int64) (*model.TaskExport, error) {
+	var result TaskExportResult
+	httpClient := util.HttpClientV2{URL: fmt.Sprintf("%s/api/v2/tasks/%d/export", pc.baseURL, taskId)}
+	if err := httpClient.Method("GET").
+		WithTimeout(5 * time.Second).
+		WithHeader(map[string]string{"X-ACCESS-KEY": pc.accessKey, "Authorization": pc.signature}).
+		Do(&result); err != nil {
+		return nil, err
+	}
+	if result.Code == 200 {
+		return result.Result, nil
+	}
+	return nil, fmt.Errorf("%s", result.Message)
+}
+
+// DownloadTaskExport 下载任务的离线包到 filename，离线包可能较大，不设置超时
+func (pc *PixiuHubClient) DownloadTaskExport(taskId int64, filename string) error {
+	httpClient := util.HttpClientV2{URL: fmt.Sprintf("%s/api/v2/tasks/%d/export/download", pc.baseURL, taskId)}
+	if err := httpClient.Method("GET").
+		WithHeader(map[string]string{"X-ACCESS-KEY": pc.accessKey, "Authorization": pc.signature}).
+		WithFile(filename).
+		Do(nil); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (pc *PixiuHubClient) ListRegistries() ([]model.Registry, error) {
 	var result RegistryListResult
 	httpClient := util.HttpClientV2{URL: fmt.Sprintf("%s/api/v2/registries?user_id=%s", pc.baseURL, pc.userInfo.UserId)}
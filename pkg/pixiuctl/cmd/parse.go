@@ -8,8 +8,9 @@ import (
 	"text/tabwriter"
 
 	"github.com/spf13/cobra"
-	"gopkg.in/yaml.v3"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+
+	"github.com/caoyingjunz/rainbow/pkg/util/imagelist"
 )
 
 type ParseOptions struct {
@@ -46,17 +47,17 @@ func (o *ParseOptions) Run() error {
 		return err
 	}
 
-	var node yaml.Node
-	if err = yaml.Unmarshal(data, &node); err != nil {
-		return fmt.Errorf("解析 YAML 失败: %w", err)
+	entries, errs := imagelist.ParseYAML(data)
+	for _, e := range errs {
+		if e.Line == 0 {
+			return fmt.Errorf("%v", e)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "忽略 %v\n", e)
 	}
 
-	images := map[string]struct{}{}
-	collectImages(&node, images)
-
-	list := make([]string, 0, len(images))
-	for image := range images {
-		list = append(list, image)
+	list := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry.Image)
 	}
 	sort.Strings(list)
 
@@ -64,59 +65,6 @@ func (o *ParseOptions) Run() error {
 	return nil
 }
 
-func collectImages(node *yaml.Node, images map[string]struct{}) {
-	if node == nil {
-		return
-	}
-
-	switch node.Kind {
-	case yaml.DocumentNode:
-		for _, c := range node.Content {
-			collectImages(c, images)
-		}
-	case yaml.MappingNode:
-		for i := 0; i+1 < len(node.Content); i += 2 {
-			keyNode := node.Content[i]
-			valNode := node.Content[i+1]
-			key := strings.ToLower(strings.TrimSpace(keyNode.Value))
-
-			// Most Kubernetes-style manifests use "image".
-			if key == "image" && valNode.Kind == yaml.ScalarNode {
-				v := strings.TrimSpace(valNode.Value)
-				if v != "" {
-					images[v] = struct{}{}
-				}
-			}
-
-			// Support common custom formats with "images: [a,b]" or list items.
-			if key == "images" {
-				switch valNode.Kind {
-				case yaml.SequenceNode:
-					for _, item := range valNode.Content {
-						if item.Kind == yaml.ScalarNode {
-							v := strings.TrimSpace(item.Value)
-							if v != "" {
-								images[v] = struct{}{}
-							}
-						}
-					}
-				case yaml.ScalarNode:
-					v := strings.TrimSpace(valNode.Value)
-					if v != "" {
-						images[v] = struct{}{}
-					}
-				}
-			}
-
-			collectImages(valNode, images)
-		}
-	case yaml.SequenceNode:
-		for _, c := range node.Content {
-			collectImages(c, images)
-		}
-	}
-}
-
 func printImages(images []string) {
 	if len(images) == 0 {
 		_, _ = fmt.Fprintln(os.Stdout, "未在 YAML 中发现镜像字段")
@@ -72,7 +72,7 @@ func PrintImageTagsTable(tags []model.Tag) {
 	for _, t := range tags {
 		modified := t.GmtModified.Format("2006-01-02 15:04:05")
 		source := t.Path
-		pullCmd := "docker pull " + t.Mirror + ":" + t.Name
+		pullCmd := "docker pull " + t.Mirror + ":" + t.GetMirrorTag()
 		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.Name, t.Architecture, t.Status, t.ReadSize, modified, source, pullCmd)
 	}
 }
@@ -295,7 +295,7 @@ func (o *PullOptions) SearchRepo(repo string) (*model.Tag, error) {
 // 下载镜像
 // 重命名镜像，删除 mirror 镜像
 func (o *PullOptions) pull(tag *model.Tag) error {
-	sourceImage := tag.Mirror + ":" + tag.Name
+	sourceImage := tag.Mirror + ":" + tag.GetMirrorTag()
 	targetImage := tag.Path + ":" + tag.Name
 
 	switch o.resolvedDriver {
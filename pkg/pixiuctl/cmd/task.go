@@ -63,6 +63,8 @@ func NewTaskCommand() *cobra.Command {
 	createCmd.Flags().BoolVar(&o.Private, "private", false, "whether the sync images is private (default false)")
 
 	cmd.AddCommand(createCmd)
+	cmd.AddCommand(NewTaskProgressCommand(o))
+	cmd.AddCommand(NewTaskExportCommand(o))
 
 	return cmd
 }
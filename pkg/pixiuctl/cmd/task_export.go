@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+type TaskExportOptions struct {
+	*TaskOptions
+
+	Output string
+}
+
+func NewTaskExportCommand(base *TaskOptions) *cobra.Command {
+	o := &TaskExportOptions{
+		TaskOptions: base,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "export <taskId>",
+		Short: "Download the offline bundle of an image synchronization task",
+		Long:  "Download the OCI layout or docker save compatible bundle exported by an image synchronization task and verify its sha256.",
+		Example: `  pixiuctl task export 12
+  pixiuctl task export 12 -o images.tar`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				_ = cmd.Help()
+				return
+			}
+			cmdutil.CheckErr(o.Complete(cmd, args))
+			cmdutil.CheckErr(o.ValidateExport(args))
+			cmdutil.CheckErr(o.RunExport(args[0]))
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.Output, "output", "o", "", "File to save the bundle, default is the bundle name")
+
+	return cmd
+}
+
+func (o *TaskExportOptions) ValidateExport(args []string) error {
+	if err := o.TaskOptions.Validate(nil, nil); err != nil {
+		return err
+	}
+	if _, err := strconv.ParseInt(strings.TrimSpace(args[0]), 10, 64); err != nil {
+		return fmt.Errorf("taskId 必须是整数，当前为 %q", args[0])
+	}
+	return nil
+}
+
+func (o *TaskExportOptions) RunExport(taskIDRaw string) error {
+	taskID, _ := strconv.ParseInt(strings.TrimSpace(taskIDRaw), 10, 64)
+
+	pc, err := NewPixiuHubClient(o.baseURL, o.cfg.Auth.AccessKey, o.cfg.Auth.SecretKey)
+	if err != nil {
+		return err
+	}
+	export, err := pc.GetTaskExport(taskID)
+	if err != nil {
+		return err
+	}
+
+	output := o.Output
+	if len(output) == 0 {
+		output = export.Name
+	}
+	fmt.Printf("下载离线包 %s (%s 格式, %d 个镜像, %s)\n", export.Name, export.Format, export.Images, byteSize(export.Size))
+	if err = pc.DownloadTaskExport(taskID, output); err != nil {
+		return err
+	}
+
+	digest, err := fileSha256(output)
+	if err != nil {
+		return err
+	}
+	if digest != export.Sha256 {
+		return fmt.Errorf("离线包 %s sha256 校验失败, 期望 %s, 实际为 %s", output, export.Sha256, digest)
+	}
+	fmt.Printf("离线包已保存到 %s, sha256 校验通过 %s\n", output, digest)
+	return nil
+}
+
+func fileSha256(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+
+	"github.com/caoyingjunz/rainbow/pkg/types"
+)
+
+type TaskProgressOptions struct {
+	*TaskOptions
+
+	Watch    bool
+	Interval time.Duration
+}
+
+func NewTaskProgressCommand(base *TaskOptions) *cobra.Command {
+	o := &TaskProgressOptions{
+		TaskOptions: base,
+		Interval:    2 * time.Second,
+	}
+
+	cmd := &cobra.Command{
+		Use:   "progress <taskId>",
+		Short: "Show the progress of an image synchronization task",
+		Long:  "Show the percent complete and bytes transferred of an image synchronization task.",
+		Example: `  pixiuctl task progress 12
+  pixiuctl task progress 12 --watch`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				_ = cmd.Help()
+				return
+			}
+			cmdutil.CheckErr(o.Complete(cmd, args))
+			cmdutil.CheckErr(o.ValidateProgress(args))
+			cmdutil.CheckErr(o.RunProgress(args[0]))
+		},
+	}
+
+	cmd.Flags().BoolVarP(&o.Watch, "watch", "w", false, "Watch the progress until the task finishes")
+	cmd.Flags().DurationVar(&o.Interval, "interval", 2*time.Second, "Refresh interval when watching")
+
+	return cmd
+}
+
+func (o *TaskProgressOptions) ValidateProgress(args []string) error {
+	if err := o.TaskOptions.Validate(nil, nil); err != nil {
+		return err
+	}
+	if _, err := strconv.ParseInt(strings.TrimSpace(args[0]), 10, 64); err != nil {
+		return fmt.Errorf("taskId 必须是整数，当前为 %q", args[0])
+	}
+	if o.Interval < time.Second {
+		return fmt.Errorf("--interval must be at least 1s")
+	}
+	return nil
+}
+
+func (o *TaskProgressOptions) RunProgress(taskIDRaw string) error {
+	taskID, _ := strconv.ParseInt(strings.TrimSpace(taskIDRaw), 10, 64)
+
+	pc, err := NewPixiuHubClient(o.baseURL, o.cfg.Auth.AccessKey, o.cfg.Auth.SecretKey)
+	if err != nil {
+		return err
+	}
+
+	for {
+		progress, err := pc.GetTaskProgress(taskID)
+		if err != nil {
+			return err
+		}
+		printTaskProgress(progress)
+		if !o.Watch || progress.Process >= 2 {
+			return nil
+		}
+		time.Sleep(o.Interval)
+	}
+}
+
+func printTaskProgress(p *types.TaskProgress) {
+	fmt.Printf("任务 %d: %3d%%  镜像 %d/%d 完成, %d 失败  %s/%s\n",
+		p.TaskId, p.Percent, p.CompletedImages, p.Images, p.FailedImages,
+		byteSize(p.BytesDone), byteSize(p.BytesTotal))
+}
+
+func byteSize(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size, exponent := float64(bytes), 0
+	for size >= 1024 && exponent < len(units)-1 {
+		size /= 1024
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %s", size, units[exponent])
+}
@@ -1,6 +1,11 @@
 package types
 
-import "time"
+import (
+	"time"
+
+	"github.com/caoyingjunz/rainbow/cmd/app/config"
+	"github.com/caoyingjunz/rainbow/pkg/util/kubeadm"
+)
 
 type (
 	UserMetaRequest struct {
@@ -64,23 +69,40 @@ type (
 	}
 
 	CreateTaskRequest struct {
-		Name              string   `json:"name"`
-		UserId            string   `json:"user_id"`
-		UserName          string   `json:"user_name"`
-		RegisterId        int64    `json:"register_id"`
-		Type              int      `json:"type"` // 0：直接指定镜像列表 1: 指定 kubernetes 版本
-		KubernetesVersion string   `json:"kubernetes_version"`
-		Images            []string `json:"images"` // 镜像列表中含镜像和架构，格式类似 nginx:1.0.1/amd64，直接指定架构优先级高于任务 arch
-		AgentName         string   `json:"agent_name"`
-		Mode              int64    `json:"mode"`
-		PublicImage       bool     `json:"public_image"`
-		Driver            string   `json:"driver"`
-		Logo              string   `json:"logo"`
-		Namespace         string   `json:"namespace"`
-		IsOfficial        bool     `json:"is_official"`
-		Architecture      string   `json:"architecture"`
-		OwnerRef          int      `json:"owner_ref"` // 任务所属，直接创建 0，订阅创建 1
-		SubscribeId       int64    `json:"subscribe_id"`
+		Name              string         `json:"name"`
+		UserId            string         `json:"user_id"`
+		UserName          string         `json:"user_name"`
+		RegisterId        int64          `json:"register_id"`
+		Type              int            `json:"type"` // 0：直接指定镜像列表 1: 指定 kubernetes 版本 2: 离线包导入
+		KubernetesVersion string         `json:"kubernetes_version"`
+		Images            []string       `json:"images"` // 镜像列表中含镜像和架构，格式类似 nginx:1.0.1/amd64，直接指定架构优先级高于任务 arch
+		AgentName         string         `json:"agent_name"`
+		Mode              int64          `json:"mode"`
+		PublicImage       bool           `json:"public_image"`
+		Driver            string         `json:"driver"`
+		Logo              string         `json:"logo"`
+		Namespace         string         `json:"namespace"`
+		IsOfficial        bool           `json:"is_official"`
+		Architecture      string         `json:"architecture"`
+		Platforms         []string       `json:"platforms"`       // 多架构同步的平台，如 linux/amd64，all 表示同步全部平台并保持 index digest 不变
+		Signatures        bool           `json:"signatures"`      // 同步镜像关联的签名、attestation 和 SBOM
+		PublicKey         string         `json:"public_key"`      // PEM 格式的公钥，不为空时推送前校验源镜像的 cosign 签名
+		ArtifactKind      string         `json:"artifact_kind"`   // 制品类型，image(默认)、helm、wasm、sbom 或 artifact
+		Stages            []config.Stage `json:"stages"`          // plugin 同步单个镜像时依次执行的阶段，为空时使用默认阶段，exec 阶段只能按名称引用管理员配置的阶段
+		NameTemplate      string         `json:"name_template"`   // 目标镜像名称模板，如 k8s-{{ flatten .Repository }}，为空时使用仓库的模板
+		TagTemplate       string         `json:"tag_template"`    // 目标镜像版本模板，如 {{ trimPrefix "v" .Tag }}-mirror，为空时使用仓库的模板
+		ParallelImages    int            `json:"parallel_images"` // 同时同步的镜像数量，为 0 时使用仓库的设置
+		ParallelLayers    int            `json:"parallel_layers"` // 单个镜像同时复制的层数，为 0 时使用仓库的设置
+		BandwidthLimit    string         `json:"bandwidth_limit"` // 带宽上限，如 10Mi 表示每秒 10MiB，为空时使用仓库的设置
+		Addons            []string       `json:"addons"`          // kubernetes 任务同步的插件，格式为 name 或 name@version，未指定版本时选择支持该 kubernetes 版本的最新版本
+		OwnerRef          int            `json:"owner_ref"`       // 任务所属，直接创建 0，订阅创建 1，kubernetes 自动预取创建 2
+		SubscribeId       int64          `json:"subscribe_id"`
+		PrefetchId        int64          `json:"prefetch_id"`
+
+		// Kubeadm kubernetes 任务的自定义 kubeadm 配置，镜像列表按该配置生成
+		Kubeadm *kubeadm.Profile `json:"kubeadm"`
+		// ExportFormat 同步完成后导出离线包的格式，oci 或 docker，为空时不导出，仅 native 驱动支持
+		ExportFormat string `json:"export_format"`
 	}
 
 	UpdateTaskRequest struct {
@@ -119,6 +141,15 @@ type (
 		Username   string `json:"username"`
 		Password   string `json:"password"`
 		Role       int    `json:"role"`
+
+		NameTemplate string `json:"name_template"`
+		TagTemplate  string `json:"tag_template"`
+
+		ParallelImages int    `json:"parallel_images"`
+		ParallelLayers int    `json:"parallel_layers"`
+		BandwidthLimit string `json:"bandwidth_limit"`
+
+		Insecure bool `json:"insecure"`
 	}
 
 	UpdateRegistryRequest struct {
@@ -130,6 +161,15 @@ type (
 		Namespace       string `json:"namespace"`
 		Username        string `json:"username"`
 		Password        string `json:"password"`
+
+		NameTemplate string `json:"name_template"`
+		TagTemplate  string `json:"tag_template"`
+
+		ParallelImages int    `json:"parallel_images"`
+		ParallelLayers int    `json:"parallel_layers"`
+		BandwidthLimit string `json:"bandwidth_limit"`
+
+		Insecure bool `json:"insecure"`
 	}
 
 	CreateImageRequest struct {
@@ -171,6 +211,26 @@ type (
 		Status     string `json:"status"`
 		Message    string `json:"message"`
 		Target     string `json:"target"`
+		Tag        string `json:"tag"` // 源镜像版本，目标版本按模板改写时通过该字段找到对应的版本
+
+		Manifests []PlatformManifest `json:"manifests"` // 多架构同步时各平台的 manifest
+
+		// 同步完成后 plugin 校验通过的源镜像和目标镜像 digest
+		Source       string `json:"source"`
+		SourceDigest string `json:"source_digest"`
+		TargetDigest string `json:"target_digest"`
+
+		// 同步完成后目标 manifest 的类型，以及 artifactType 或 config 的类型
+		MediaType    string `json:"media_type"`
+		ArtifactType string `json:"artifact_type"`
+	}
+
+	// PlatformManifest 多架构镜像中单个平台的 manifest
+	PlatformManifest struct {
+		Platform  string `json:"platform"`
+		Digest    string `json:"digest"`
+		MediaType string `json:"media_type"`
+		Size      int64  `json:"size"`
 	}
 
 	CreateAccessRequest struct {
@@ -255,6 +315,50 @@ type (
 		Status    string `json:"status"`
 	}
 
+	// GetAgentLogsRequest 获取 agent 容器日志
+	GetAgentLogsRequest struct {
+		Id    int64  `uri:"Id" binding:"required"`
+		Tail  int    `form:"tail"`  // 返回最后的行数，默认 200
+		Since string `form:"since"` // 起始时间，支持 docker logs 的格式，例如 10m 或者 2006-01-02T15:04:05
+	}
+
+	// AgentDiagnosis agent 诊断报告
+	AgentDiagnosis struct {
+		AgentName string                `json:"agent_name"`
+		Healthy   bool                  `json:"healthy"`
+		Checks    []AgentDiagnosisCheck `json:"checks"`
+	}
+
+	AgentDiagnosisCheck struct {
+		Name    string `json:"name"`
+		Passed  bool   `json:"passed"`
+		Message string `json:"message"`
+	}
+
+	UpdateAgentBudgetRequest struct {
+		AgentName     string  `json:"agent_name"`
+		MonthlyBudget float64 `json:"monthly_budget"` // 每月开销预算，单位美金，为 0 时使用默认预算
+	}
+
+	// CreateGithubAccountRequest 添加备用 github 账号
+	CreateGithubAccountRequest struct {
+		GithubUser       string `json:"github_user" binding:"required"`
+		GithubEmail      string `json:"github_email"`
+		GithubRepository string `json:"github_repository"` // 默认为 https://github.com/{github_user}/plugin.git
+		GithubToken      string `json:"github_token" binding:"required"`
+	}
+
+	CreateAgentRolloutRequest struct {
+		Name           string   `json:"name"`
+		Type           string   `json:"type"`            // binary 或者 image
+		Binary         string   `json:"binary"`          // 新的 agent 二进制文件，必须位于 template_dir 下，默认为 template_dir/agent
+		AgentImage     string   `json:"agent_image"`     // 新的 agent 镜像
+		Agents         []string `json:"agents"`          // 参与升级的 agents，为空时升级全部在线 agent
+		CanaryCount    int      `json:"canary_count"`    // 灰度数量，默认 1
+		MaxUnavailable int      `json:"max_unavailable"` // 每批次最多同时升级的数量，默认 1
+		HealthTimeout  int64    `json:"health_timeout"`  // 等待心跳恢复的超时时间，单位秒，默认 300
+	}
+
 	CreateNotificationRequest struct {
 		UserMetaRequest `json:",inline"`
 
@@ -384,6 +488,53 @@ type (
 		SyncAll  bool   `json:"sync_all"`
 	}
 
+	CallKubernetesComponentRequest struct {
+		ClientId string   `json:"client_id"`
+		Versions []string `json:"versions"`
+	}
+
+	CallKubernetesAddonRequest struct {
+		ClientId string `json:"client_id"`
+		URL      string `json:"url"` // 插件清单地址，为空时使用 server 配置的 addon_manifest
+	}
+
+	ListKubernetesAddonRequest struct {
+		Name              string `form:"name"`
+		Category          string `form:"category"`
+		KubernetesVersion string `form:"kubernetes_version"` // 仅返回支持该版本的插件
+	}
+
+	CreateKubernetesPrefetchRequest struct {
+		UserMetaRequest `json:",inline"`
+
+		Name         string   `json:"name" binding:"required"`
+		Enable       bool     `json:"enable"`
+		Policy       string   `json:"policy"`      // latest-minors 或 since
+		Minors       int      `json:"minors"`      // latest-minors 策略保留的次版本数量，比如 3 表示最近 3 个次版本的补丁版本
+		MinVersion   string   `json:"min_version"` // since 策略的最低版本，比如 v1.28
+		RegisterId   int64    `json:"register_id"`
+		Namespace    string   `json:"namespace"`
+		Architecture string   `json:"architecture"`
+		Driver       string   `json:"driver"`
+		Addons       []string `json:"addons"`
+	}
+
+	UpdateKubernetesPrefetchRequest struct {
+		Id              int64 `json:"id"`
+		ResourceVersion int64 `json:"resource_version"`
+
+		UserMetaRequest `json:",inline"`
+		Name            string   `json:"name" binding:"required"`
+		Enable          bool     `json:"enable"`
+		Policy          string   `json:"policy"`
+		Minors          int      `json:"minors"`
+		MinVersion      string   `json:"min_version"`
+		Namespace       string   `json:"namespace"`
+		Architecture    string   `json:"architecture"`
+		Driver          string   `json:"driver"`
+		Addons          []string `json:"addons"`
+	}
+
 	CallGithubRequest struct {
 		ClientId string `json:"client_id,omitempty"`
 
@@ -430,6 +581,9 @@ type (
 		CallGithubRequest        *CallGithubRequest        `json:"callGithubRequest,omitempty"`
 		CallKubernetesTagRequest *CallKubernetesTagRequest `json:"callKubernetesTagRequest,omitempty"`
 		CallSearchRequest        *CallSearchRequest        `json:"callSearchRequest,omitempty"`
+
+		CallKubernetesComponentRequest *CallKubernetesComponentRequest `json:"callKubernetesComponentRequest,omitempty"`
+		CallKubernetesAddonRequest     *CallKubernetesAddonRequest     `json:"callKubernetesAddonRequest,omitempty"`
 	}
 
 	CreateTaskMessageRequest struct {
@@ -437,6 +591,44 @@ type (
 		Message string `json:"message"`
 	}
 
+	// UpdateImageProgressRequest plugin 上报的镜像字节级同步进度
+	UpdateImageProgressRequest struct {
+		Id          int64  `json:"id"` // 任务 ID
+		ImageId     int64  `json:"image_id"`
+		Target      string `json:"target"`
+		BytesDone   int64  `json:"bytes_done"`
+		BytesTotal  int64  `json:"bytes_total"`
+		LayersDone  int    `json:"layers_done"`
+		LayersTotal int    `json:"layers_total"`
+	}
+
+	// UpdateImageStageRequest plugin 上报的镜像同步阶段状态
+	UpdateImageStageRequest struct {
+		Id       int64  `json:"id"` // 任务 ID
+		ImageId  int64  `json:"image_id"`
+		Target   string `json:"target"`
+		Stage    string `json:"stage"`
+		Type     string `json:"type"`
+		Sequence int    `json:"sequence"`
+		Status   string `json:"status"`
+		Message  string `json:"message"`
+	}
+
+	// BatchCallbackRequest plugin 批量上报的镜像状态和任务消息，按顺序处理
+	BatchCallbackRequest struct {
+		Id     int64           `json:"id"` // 任务 ID
+		Events []CallbackEvent `json:"events"`
+	}
+
+	// CallbackEvent 单个回调事件，Id 为 plugin 生成的唯一标识，重复上报的事件会被跳过
+	CallbackEvent struct {
+		Id      string                    `json:"id"`
+		Type    string                    `json:"type"` // status、message 或 stage
+		Status  *UpdateImageStatusRequest `json:"status,omitempty"`
+		Message string                    `json:"message,omitempty"`
+		Stage   *UpdateImageStageRequest  `json:"stage,omitempty"`
+	}
+
 	CreateBuildMessageRequest struct {
 		Id      int64  `json:"id"`
 		Message string `json:"message"`
@@ -455,6 +647,8 @@ type (
 		Policy     string        `json:"policy"`     // 默认定义所有版本镜像，支持正则表达式，比如 v1.*
 		Arch       string        `json:"arch"`       // 支持的架构，默认不限制  linux/amd64
 		Rewrite    bool          `json:"rewrite"`    // 是否覆盖推送
+		Signatures bool          `json:"signatures"` // 同步镜像关联的签名、attestation 和 SBOM
+		PublicKey  string        `json:"public_key"` // PEM 格式的公钥，不为空时推送前校验源镜像的 cosign 签名
 	}
 
 	UpdateSubscribeRequest struct {
@@ -470,6 +664,8 @@ type (
 		Arch            string        `json:"arch"`       // 支持的架构，默认不限制  linux/amd64
 		Rewrite         bool          `json:"rewrite"`    // 是否覆盖推送
 		Namespace       string        `json:"namespace"`
+		Signatures      bool          `json:"signatures"` // 同步镜像关联的签名、attestation 和 SBOM
+		PublicKey       string        `json:"public_key"` // PEM 格式的公钥，不为空时推送前校验源镜像的 cosign 签名
 	}
 
 	RunSubscribeRequest struct {
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/caoyingjunz/rainbow/pkg/db/model"
+	"github.com/caoyingjunz/rainbow/pkg/util/imagelist"
 )
 
 type IdMeta struct {
@@ -48,6 +49,32 @@ const (
 	SyncImageComplete     = "Completed"
 )
 
+// plugin 批量回调的事件类型
+const (
+	CallbackStatusEvent  = "status"
+	CallbackMessageEvent = "message"
+	CallbackStageEvent   = "stage"
+)
+
+// plugin 同步镜像的阶段类型
+const (
+	StageValidateSourcePolicy = "validate-source-policy" // 校验源镜像是否在允许的范围内，配置公钥时校验 cosign 签名
+	StageCopy                 = "copy"                   // 同步镜像，可重试的错误按退避策略重试
+	StageVerifyDigest         = "verify-digest"          // 校验目标镜像和源镜像的 digest
+	StageSignatures           = "signatures"             // 同步镜像关联的签名、attestation 和 SBOM
+	StageExec                 = "exec"                   // 执行自定义命令，如签名和扫描
+	StageWebhook              = "webhook"                // 将镜像信息 POST 到指定地址，如通知和扫描报告
+)
+
+// 阶段被跳过时的状态，其余状态和镜像同步状态一致
+const StageSkipped = "Skipped"
+
+// 镜像同步失败的分类，附加在版本的 Message 中，如 [retryable] xxx
+const (
+	SyncErrorRetryable = "retryable" // 限流、超时和 5xx 等临时错误，重新执行可能成功
+	SyncErrorPermanent = "permanent" // manifest 不存在、认证失败等，重新执行不会成功
+)
+
 const (
 	SyncNamespaceLogoType        = 0
 	SyncNamespaceLabelType       = 1
@@ -63,8 +90,33 @@ const (
 const (
 	SkopeoDriver = "skopeo"
 	DockerDriver = "docker"
+	NativeDriver = "native"
+
+	// AllPlatforms 同步多架构镜像的全部平台
+	AllPlatforms = "all"
+)
+
+// 任务同步的制品类型，image 以外的类型均按 OCI artifact 原样同步，仅支持 native 驱动
+const (
+	ImageArtifact   = "image"
+	HelmArtifact    = "helm"
+	WasmArtifact    = "wasm"
+	SBOMArtifact    = "sbom"
+	GenericArtifact = "artifact"
 )
 
+// kubernetes 自动预取策略
+const (
+	PrefetchLatestMinors = "latest-minors" // 最近 N 个次版本的补丁版本
+	PrefetchSince        = "since"         // 不低于指定版本的全部版本
+)
+
+// kubernetes 自动预取创建的任务所属
+const PrefetchOwnerRef = 2
+
+// ImportTaskType 离线包导入任务的类型，由 rainbow server 直接推送，不调度到 agent
+const ImportTaskType = 2
+
 const (
 	SyncTaskInitializing = "initializing"
 )
@@ -108,6 +160,10 @@ const (
 	CallGithubType        = 5
 	CallKubernetesTagType = 6
 	CallSearchType        = 7
+	// CallKubernetesComponentType 获取 kubernetes 版本对应的 kubeadm 组件版本
+	CallKubernetesComponentType = 8
+	// CallKubernetesAddonType 获取插件清单
+	CallKubernetesAddonType = 9
 )
 
 const (
@@ -547,3 +603,38 @@ type PixiuctlDownloadItem struct {
 	Version string   `json:"version"`
 	Items   []string `json:"items"`
 }
+
+// ImageFileResult 通过镜像列表文件创建任务的结果，存在错误时不会创建任务
+type ImageFileResult struct {
+	Images []string              `json:"images"`
+	Errors []imagelist.LineError `json:"errors,omitempty"`
+}
+
+// ImportArchiveResult 上传离线包创建导入任务的结果
+type ImportArchiveResult struct {
+	TaskId int64    `json:"task_id"`
+	Images []string `json:"images"`
+}
+
+// TaskProgress 任务的同步进度，由各镜像上报的字节进度和版本状态汇总
+type TaskProgress struct {
+	TaskId          int64                 `json:"task_id"`
+	Process         int                   `json:"process"`
+	Percent         int                   `json:"percent"` // 完成百分比，0-100
+	BytesDone       int64                 `json:"bytes_done"`
+	BytesTotal      int64                 `json:"bytes_total"`
+	Images          int                   `json:"images"`
+	CompletedImages int                   `json:"completed_images"`
+	FailedImages    int                   `json:"failed_images"`
+	Items           []model.ImageProgress `json:"items"`
+}
+
+// BatchCallbackResult 批量回调的处理结果，Processed 为本次处理的事件数，Skipped 为已处理过而跳过的事件数
+// Failed 为处理失败的事件数，失败的事件同样记录为已处理，Errors 为失败的原因
+type BatchCallbackResult struct {
+	Processed int `json:"processed"`
+	Skipped   int `json:"skipped"`
+
+	Failed int      `json:"failed"`
+	Errors []string `json:"errors,omitempty"`
+}
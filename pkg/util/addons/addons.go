@@ -0,0 +1,166 @@
+package addons
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+const (
+	CategoryCNI     = "cni"
+	CategoryIngress = "ingress"
+	CategoryMetrics = "metrics"
+	CategoryCSI     = "csi"
+)
+
+var categories = map[string]bool{
+	CategoryCNI:     true,
+	CategoryIngress: true,
+	CategoryMetrics: true,
+	CategoryCSI:     true,
+}
+
+// Manifest 插件目录的清单，yaml 或 json 格式，例如:
+//
+//	addons:
+//	  - name: calico
+//	    category: cni
+//	    version: v3.28.0
+//	    min_kubernetes: v1.27
+//	    max_kubernetes: v1.30
+//	    images:
+//	      - quay.io/calico/cni:v3.28.0
+//	      - quay.io/calico/node:v3.28.0
+type Manifest struct {
+	Addons []Addon `json:"addons" yaml:"addons"`
+}
+
+// Addon 一个插件版本及其镜像，MinKubernetes 和 MaxKubernetes 为支持的 kubernetes 次版本范围(包含)，为空时不限制
+type Addon struct {
+	Name          string   `json:"name" yaml:"name"`
+	Category      string   `json:"category" yaml:"category"`
+	Version       string   `json:"version" yaml:"version"`
+	MinKubernetes string   `json:"min_kubernetes,omitempty" yaml:"min_kubernetes,omitempty"`
+	MaxKubernetes string   `json:"max_kubernetes,omitempty" yaml:"max_kubernetes,omitempty"`
+	Images        []string `json:"images" yaml:"images"`
+}
+
+// Key 插件的唯一标识，格式为 name@version
+func (a Addon) Key() string {
+	return a.Name + "@" + a.Version
+}
+
+// Parse 解析并校验插件清单，同一插件的版本不能重复
+func Parse(data []byte) ([]Addon, error) {
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("解析插件清单失败: %v", err)
+	}
+
+	keys := make(map[string]bool)
+	for _, a := range m.Addons {
+		if err := a.Validate(); err != nil {
+			return nil, err
+		}
+		if keys[a.Key()] {
+			return nil, fmt.Errorf("插件 %s 重复", a.Key())
+		}
+		keys[a.Key()] = true
+	}
+	return m.Addons, nil
+}
+
+// Validate 校验插件的名称、分类、版本范围和镜像
+func (a Addon) Validate() error {
+	if len(a.Name) == 0 || len(a.Version) == 0 || strings.ContainsAny(a.Name+a.Version, "@,") {
+		return fmt.Errorf("插件名称(%s)和版本(%s)不能为空，且不能包含 @ 和 ,", a.Name, a.Version)
+	}
+	if !categories[a.Category] {
+		return fmt.Errorf("插件 %s 的分类 %s 不支持", a.Key(), a.Category)
+	}
+	for _, v := range []string{a.MinKubernetes, a.MaxKubernetes} {
+		if len(v) == 0 {
+			continue
+		}
+		if _, err := version.ParseGeneric(v); err != nil {
+			return fmt.Errorf("插件 %s 的 kubernetes 版本范围 %s 不合法", a.Key(), v)
+		}
+	}
+	if len(a.Images) == 0 {
+		return fmt.Errorf("插件 %s 未包含镜像", a.Key())
+	}
+	for _, image := range a.Images {
+		if len(strings.TrimSpace(image)) == 0 || strings.Contains(image, ",") {
+			return fmt.Errorf("插件 %s 的镜像 %q 不合法", a.Key(), image)
+		}
+	}
+	return nil
+}
+
+// Supports 插件是否支持该 kubernetes 版本，仅比较主版本和次版本
+func (a Addon) Supports(kubernetesVersion string) bool {
+	v, err := version.ParseGeneric(kubernetesVersion)
+	if err != nil {
+		return false
+	}
+	minor := version.MajorMinor(v.Major(), v.Minor())
+	if min, err := version.ParseGeneric(a.MinKubernetes); err == nil && minor.LessThan(version.MajorMinor(min.Major(), min.Minor())) {
+		return false
+	}
+	if max, err := version.ParseGeneric(a.MaxKubernetes); err == nil && version.MajorMinor(max.Major(), max.Minor()).LessThan(minor) {
+		return false
+	}
+	return true
+}
+
+// Resolve 按 name 或 name@version 选择插件，未指定版本时选择支持该 kubernetes 版本的最新版本
+func Resolve(addons []Addon, selector string, kubernetesVersion string) (*Addon, error) {
+	name, ver := selector, ""
+	if i := strings.Index(selector, "@"); i >= 0 {
+		name, ver = selector[:i], selector[i+1:]
+	}
+
+	var candidates []Addon
+	for _, a := range addons {
+		if a.Name != name || (len(ver) != 0 && a.Version != ver) {
+			continue
+		}
+		candidates = append(candidates, a)
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("插件 %s 不存在", selector)
+	}
+
+	var supported []Addon
+	for _, a := range candidates {
+		if a.Supports(kubernetesVersion) {
+			supported = append(supported, a)
+		}
+	}
+	if len(supported) == 0 {
+		return nil, fmt.Errorf("插件 %s 不支持 kubernetes %s", selector, kubernetesVersion)
+	}
+	sort.Slice(supported, func(i, j int) bool {
+		return compareVersion(supported[i].Version, supported[j].Version) > 0
+	})
+	return &supported[0], nil
+}
+
+// compareVersion 比较插件版本，无法解析时按字符串比较
+func compareVersion(a, b string) int {
+	va, errA := version.ParseGeneric(a)
+	vb, errB := version.ParseGeneric(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	if va.LessThan(vb) {
+		return -1
+	}
+	if vb.LessThan(va) {
+		return 1
+	}
+	return 0
+}
@@ -1,7 +1,10 @@
 package errors
 
 import (
+	"context"
+	"database/sql/driver"
 	"errors"
+	"net"
 
 	"gorm.io/gorm"
 )
@@ -27,3 +30,15 @@ func IsImageNotFound(err error) bool {
 func IsDisableStatus(err error) bool {
 	return errors.Is(err, ErrDisableStatus)
 }
+
+// IsTransient 判断是否为连接中断、网络异常或者超时等可重试的错误
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
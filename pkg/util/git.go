@@ -123,3 +123,26 @@ func (g *Git) LocalBranches() ([]string, error) {
 	}
 	return branches, nil
 }
+
+func (g *Git) DeleteBranch(branch string) error {
+	cmd := g.executor.Command("git", "branch", "-D", branch)
+	cmd.SetDir(g.RepoDir)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %s", err, string(out))
+	}
+	return nil
+}
+
+// PruneRemote 清理远端已删除分支的本地引用
+func (g *Git) PruneRemote() error {
+	cmd := g.executor.Command("git", "remote", "prune", "origin")
+	cmd.SetDir(g.RepoDir)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v %s", err, string(out))
+	}
+	return nil
+}
@@ -106,6 +106,9 @@ func (c *httpClient) Post(url string, val interface{}, data interface{}, header
 		return err
 	}
 
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
 	// 设置请求头
 	if header != nil {
 		for key, value := range header {
@@ -146,6 +149,9 @@ func (c *httpClient) Put(url string, val interface{}, data map[string]interface{
 	if err != nil {
 		return err
 	}
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
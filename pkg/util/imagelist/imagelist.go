@@ -0,0 +1,230 @@
+package imagelist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
+)
+
+// Entry 镜像列表中的一个镜像，Line 为镜像在文件中的行号
+type Entry struct {
+	Line  int
+	Image string
+}
+
+// LineError 镜像列表中某一行的校验错误
+type LineError struct {
+	Line    int    `json:"line"`
+	Content string `json:"content"`
+	Reason  string `json:"reason"`
+}
+
+func (e LineError) Error() string {
+	if e.Line == 0 {
+		return e.Reason
+	}
+	return fmt.Sprintf("第 %d 行(%s): %s", e.Line, e.Content, e.Reason)
+}
+
+// Parse 解析镜像列表文件，.yaml 和 .yml 文件按 kubernetes 清单提取 image 字段，其他文件按每行一个镜像解析
+func Parse(name string, data []byte) ([]Entry, []LineError) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	default:
+		return ParseText(data)
+	}
+}
+
+// ParseText 解析纯文本的镜像列表，每行一个镜像，支持 # 注释，tag 支持通配符，如 nginx:1.25.*
+func ParseText(data []byte) ([]Entry, []LineError) {
+	var (
+		entries []Entry
+		errs    []LineError
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		content := scanner.Text()
+		if i := strings.Index(content, "#"); i >= 0 {
+			content = content[:i]
+		}
+		content = strings.TrimSpace(content)
+		if len(content) == 0 {
+			continue
+		}
+
+		if err := Validate(content); err != nil {
+			errs = append(errs, LineError{Line: line, Content: content, Reason: err.Error()})
+			continue
+		}
+		entries = append(entries, Entry{Line: line, Image: content})
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, LineError{Reason: fmt.Sprintf("读取镜像列表失败: %v", err)})
+	}
+
+	return entries, errs
+}
+
+// ParseYAML 从 YAML 中提取 image 字段和 images 列表，支持多文档
+func ParseYAML(data []byte) ([]Entry, []LineError) {
+	var (
+		entries []Entry
+		errs    []LineError
+	)
+
+	seen := make(map[string]bool)
+	collect := func(node *yaml.Node) {
+		content := strings.TrimSpace(node.Value)
+		if len(content) == 0 || seen[content] {
+			return
+		}
+		seen[content] = true
+		if err := Validate(content); err != nil {
+			errs = append(errs, LineError{Line: node.Line, Content: content, Reason: err.Error()})
+			return
+		}
+		entries = append(entries, Entry{Line: node.Line, Image: content})
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if err != io.EOF {
+				errs = append(errs, LineError{Reason: fmt.Sprintf("解析 YAML 失败: %v", err)})
+			}
+			break
+		}
+		walk(&node, collect)
+	}
+
+	return entries, errs
+}
+
+// walk 遍历 YAML 节点，找到 image 字段和 images 列表中的镜像
+func walk(node *yaml.Node, collect func(node *yaml.Node)) {
+	if node == nil {
+		return
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range node.Content {
+			walk(c, collect)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := strings.ToLower(strings.TrimSpace(node.Content[i].Value))
+			value := node.Content[i+1]
+
+			if (key == "image" || key == "images") && value.Kind == yaml.ScalarNode {
+				collect(value)
+			}
+			if key == "images" && value.Kind == yaml.SequenceNode {
+				for _, item := range value.Content {
+					if item.Kind == yaml.ScalarNode {
+						collect(item)
+					}
+				}
+			}
+			walk(value, collect)
+		}
+	}
+}
+
+// Validate 校验单个镜像地址，通配符只能出现在 tag 中
+func Validate(image string) error {
+	if strings.ContainsAny(image, " \t") {
+		return fmt.Errorf("镜像地址不能包含空格")
+	}
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(ref.Registry+"/"+ref.Repository, "*?[]") {
+		return fmt.Errorf("通配符只能用于 tag")
+	}
+	if HasGlob(image) {
+		if len(ref.Digest) != 0 {
+			return fmt.Errorf("指定 digest 时不能使用通配符")
+		}
+		if _, err = path.Match(ref.Tag, ""); err != nil {
+			return fmt.Errorf("不合法的 tag 通配符 %s", ref.Tag)
+		}
+	}
+	return nil
+}
+
+// HasGlob 判断镜像的 tag 是否包含通配符
+func HasGlob(image string) bool {
+	i := strings.LastIndex(image, ":")
+	if i < 0 || i < strings.LastIndex(image, "/") {
+		return false
+	}
+	return strings.ContainsAny(image[i+1:], "*?[")
+}
+
+// Expand 通过仓库的 tag 列表展开带通配符的镜像，未匹配到任何 tag 时记录为该行的错误
+func Expand(ctx context.Context, client *registry.Client, entries []Entry) ([]string, []LineError) {
+	var (
+		images []string
+		errs   []LineError
+	)
+
+	seen := make(map[string]bool)
+	add := func(image string) {
+		if !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+
+	for _, entry := range entries {
+		if !HasGlob(entry.Image) {
+			add(entry.Image)
+			continue
+		}
+
+		i := strings.LastIndex(entry.Image, ":")
+		name, pattern := entry.Image[:i], entry.Image[i+1:]
+		ref, err := registry.ParseReference(entry.Image)
+		if err != nil {
+			errs = append(errs, LineError{Line: entry.Line, Content: entry.Image, Reason: err.Error()})
+			continue
+		}
+		tags, err := client.ListTags(ctx, ref)
+		if err != nil {
+			errs = append(errs, LineError{Line: entry.Line, Content: entry.Image, Reason: fmt.Sprintf("获取 tag 列表失败: %v", err)})
+			continue
+		}
+
+		var matched []string
+		for _, tag := range tags {
+			if ok, _ := path.Match(pattern, tag); ok {
+				matched = append(matched, tag)
+			}
+		}
+		if len(matched) == 0 {
+			errs = append(errs, LineError{Line: entry.Line, Content: entry.Image, Reason: "未匹配到任何 tag"})
+			continue
+		}
+		sort.Strings(matched)
+		for _, tag := range matched {
+			add(name + ":" + tag)
+		}
+	}
+
+	return images, errs
+}
@@ -0,0 +1,118 @@
+package kubeadm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+const (
+	// ConstantsURL kubeadm 在各版本中定义 pause、etcd 和 coredns 版本的源文件
+	ConstantsURL = "https://raw.githubusercontent.com/kubernetes/kubernetes/%s/cmd/kubeadm/app/constants/constants.go"
+
+	DefaultImageRepository = "registry.k8s.io"
+	// LegacyImageRepository v1.25 之前 kubeadm 默认使用的镜像仓库
+	LegacyImageRepository = "k8s.gcr.io"
+)
+
+var (
+	pauseRe         = regexp.MustCompile(`(?m)^\s*PauseVersion\s*=\s*"([^"]+)"`)
+	coreDNSRe       = regexp.MustCompile(`(?m)^\s*CoreDNSVersion\s*=\s*"([^"]+)"`)
+	defaultEtcdRe   = regexp.MustCompile(`(?m)^\s*DefaultEtcdVersion\s*=\s*"([^"]+)"`)
+	supportedEtcdRe = regexp.MustCompile(`SupportedEtcdVersion\s*=\s*map\[uint8\]string\{([^}]*)\}`)
+	etcdEntryRe     = regexp.MustCompile(`(\d+)\s*:\s*"([^"]+)"`)
+)
+
+// Components kubeadm 部署指定 kubernetes 版本时使用的组件版本
+// kube-apiserver、kube-controller-manager、kube-scheduler 和 kube-proxy 与 kubernetes 版本一致
+type Components struct {
+	Version         string `json:"version" yaml:"version"`
+	ImageRepository string `json:"image_repository" yaml:"image_repository"`
+	Pause           string `json:"pause" yaml:"pause"`
+	Etcd            string `json:"etcd" yaml:"etcd"`
+	CoreDNS         string `json:"coredns" yaml:"coredns"`
+
+	// etcd 和 coredns 的自定义镜像仓库，对应 ClusterConfiguration 的 etcd.local.imageRepository 和 dns.imageRepository
+	EtcdRepository    string `json:"etcd_repository,omitempty" yaml:"etcd_repository,omitempty"`
+	CoreDNSRepository string `json:"coredns_repository,omitempty" yaml:"coredns_repository,omitempty"`
+}
+
+// ParseConstants 从 kubeadm 的 constants.go 中解析组件版本，etcd 按 kubernetes 的次版本选择，与 kubeadm 的行为一致
+func ParseConstants(kubernetesVersion string, data []byte) (*Components, error) {
+	v, err := version.ParseSemantic(kubernetesVersion)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes 版本 %s 不合法: %v", kubernetesVersion, err)
+	}
+
+	c := &Components{
+		Version:         kubernetesVersion,
+		ImageRepository: DefaultImageRepository,
+		Pause:           match(pauseRe, data),
+		CoreDNS:         match(coreDNSRe, data),
+		Etcd:            match(defaultEtcdRe, data),
+	}
+	if v.Minor() < 25 {
+		c.ImageRepository = LegacyImageRepository
+	}
+	if m := supportedEtcdRe.FindSubmatch(data); m != nil {
+		for _, entry := range etcdEntryRe.FindAllSubmatch(m[1], -1) {
+			if minor, err := strconv.ParseUint(string(entry[1]), 10, 8); err == nil && uint(minor) == v.Minor() {
+				c.Etcd = string(entry[2])
+			}
+		}
+	}
+
+	if err = c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func match(re *regexp.Regexp, data []byte) string {
+	if m := re.FindSubmatch(data); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// Validate 校验组件版本是否完整
+func (c Components) Validate() error {
+	if len(c.Version) == 0 || len(c.ImageRepository) == 0 {
+		return fmt.Errorf("kubernetes 版本和镜像仓库不能为空")
+	}
+	if len(c.Pause) == 0 || len(c.Etcd) == 0 || len(c.CoreDNS) == 0 {
+		return fmt.Errorf("kubernetes %s 的组件版本不完整 pause(%s) etcd(%s) coredns(%s)", c.Version, c.Pause, c.Etcd, c.CoreDNS)
+	}
+	return nil
+}
+
+// Images 返回 kubeadm config images list 输出的镜像列表，顺序与 kubeadm 一致
+func (c Components) Images() []string {
+	repo := c.ImageRepository
+	// v1.21 开始 coredns 镜像位于默认仓库的 coredns/coredns，自定义仓库时与 kubeadm 一致使用 <仓库>/coredns
+	coreDNS := repo + "/coredns"
+	if repo == DefaultImageRepository || repo == LegacyImageRepository {
+		if v, err := version.ParseSemantic(c.Version); err == nil && v.Minor() >= 21 {
+			coreDNS = repo + "/coredns/coredns"
+		}
+	}
+	if len(c.CoreDNSRepository) != 0 {
+		coreDNS = c.CoreDNSRepository + "/coredns"
+	}
+	etcd := repo + "/etcd"
+	if len(c.EtcdRepository) != 0 {
+		etcd = c.EtcdRepository + "/etcd"
+	}
+
+	return []string{
+		repo + "/kube-apiserver:" + c.Version,
+		repo + "/kube-controller-manager:" + c.Version,
+		repo + "/kube-scheduler:" + c.Version,
+		repo + "/kube-proxy:" + c.Version,
+		coreDNS + ":" + c.CoreDNS,
+		repo + "/pause:" + c.Pause,
+		etcd + ":" + c.Etcd,
+	}
+}
@@ -0,0 +1,167 @@
+package kubeadm
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readConstants(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read fixture %s: %v", name, err)
+	}
+	return data
+}
+
+// want 为对应版本 kubeadm config images list 的输出
+func TestParseConstantsImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		fixture string
+		want    []string
+	}{
+		{
+			name:    "v1.20 legacy coredns path",
+			version: "v1.20.0",
+			fixture: "constants-v1.20.txt",
+			want: []string{
+				"k8s.gcr.io/kube-apiserver:v1.20.0",
+				"k8s.gcr.io/kube-controller-manager:v1.20.0",
+				"k8s.gcr.io/kube-scheduler:v1.20.0",
+				"k8s.gcr.io/kube-proxy:v1.20.0",
+				"k8s.gcr.io/coredns:1.7.0",
+				"k8s.gcr.io/pause:3.2",
+				"k8s.gcr.io/etcd:3.4.13-0",
+			},
+		},
+		{
+			name:    "v1.23 legacy repository",
+			version: "v1.23.6",
+			fixture: "constants-v1.23.txt",
+			want: []string{
+				"k8s.gcr.io/kube-apiserver:v1.23.6",
+				"k8s.gcr.io/kube-controller-manager:v1.23.6",
+				"k8s.gcr.io/kube-scheduler:v1.23.6",
+				"k8s.gcr.io/kube-proxy:v1.23.6",
+				"k8s.gcr.io/coredns/coredns:v1.8.6",
+				"k8s.gcr.io/pause:3.6",
+				"k8s.gcr.io/etcd:3.5.1-0",
+			},
+		},
+		{
+			name:    "v1.28",
+			version: "v1.28.0",
+			fixture: "constants-v1.28.txt",
+			want: []string{
+				"registry.k8s.io/kube-apiserver:v1.28.0",
+				"registry.k8s.io/kube-controller-manager:v1.28.0",
+				"registry.k8s.io/kube-scheduler:v1.28.0",
+				"registry.k8s.io/kube-proxy:v1.28.0",
+				"registry.k8s.io/coredns/coredns:v1.10.1",
+				"registry.k8s.io/pause:3.9",
+				"registry.k8s.io/etcd:3.5.9-0",
+			},
+		},
+		{
+			name:    "v1.30",
+			version: "v1.30.0",
+			fixture: "constants-v1.30.txt",
+			want: []string{
+				"registry.k8s.io/kube-apiserver:v1.30.0",
+				"registry.k8s.io/kube-controller-manager:v1.30.0",
+				"registry.k8s.io/kube-scheduler:v1.30.0",
+				"registry.k8s.io/kube-proxy:v1.30.0",
+				"registry.k8s.io/coredns/coredns:v1.11.1",
+				"registry.k8s.io/pause:3.9",
+				"registry.k8s.io/etcd:3.5.12-0",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ParseConstants(tc.version, readConstants(t, tc.fixture))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := c.Images(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseConstantsEtcd(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		fixture string
+		want    string
+	}{
+		{
+			name:    "minor in supported map",
+			version: "v1.17.4",
+			fixture: "constants-v1.20.txt",
+			want:    "3.4.3-0",
+		},
+		{
+			name:    "minor not in supported map uses default",
+			version: "v1.32.0",
+			fixture: "constants-v1.30.txt",
+			want:    "3.5.12-0",
+		},
+		{
+			name:    "pre-release uses its minor",
+			version: "v1.24.0-rc.0",
+			fixture: "constants-v1.23.txt",
+			want:    "3.5.1-0",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ParseConstants(tc.version, readConstants(t, tc.fixture))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if c.Etcd != tc.want {
+				t.Errorf("expected etcd %s, got %s", tc.want, c.Etcd)
+			}
+		})
+	}
+}
+
+func TestParseConstantsError(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		data    string
+	}{
+		{
+			name:    "invalid version",
+			version: "1.28",
+			data:    string(readConstants(t, "constants-v1.28.txt")),
+		},
+		{
+			name:    "missing coredns",
+			version: "v1.28.0",
+			data:    "PauseVersion = \"3.9\"\nDefaultEtcdVersion = \"3.5.9-0\"\n",
+		},
+		{
+			name:    "empty file",
+			version: "v1.28.0",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseConstants(tc.version, []byte(tc.data)); err == nil {
+				t.Errorf("expected error for %s", tc.name)
+			}
+		})
+	}
+}
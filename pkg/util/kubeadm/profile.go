@@ -0,0 +1,129 @@
+package kubeadm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const clusterConfigurationKind = "ClusterConfiguration"
+
+// Profile 自定义的 kubeadm 配置，用于私有镜像仓库或自定义 etcd、coredns 版本的集群
+// ClusterConfiguration 为 kubeadm 配置片段，其余字段为单独指定的覆盖项，优先级高于配置片段
+type Profile struct {
+	Name                 string `json:"name"`
+	ClusterConfiguration string `json:"cluster_configuration,omitempty"`
+	ImageRepository      string `json:"image_repository,omitempty"`
+	Etcd                 string `json:"etcd,omitempty"`
+	CoreDNS              string `json:"coredns,omitempty"`
+	Pause                string `json:"pause,omitempty"`
+}
+
+// clusterConfiguration kubeadm ClusterConfiguration 中影响镜像列表的字段，v1beta3 和 v1beta4 格式相同
+type clusterConfiguration struct {
+	Kind              string `yaml:"kind"`
+	KubernetesVersion string `yaml:"kubernetesVersion"`
+	ImageRepository   string `yaml:"imageRepository"`
+	Etcd              struct {
+		Local *imageMeta `yaml:"local"`
+	} `yaml:"etcd"`
+	DNS imageMeta `yaml:"dns"`
+}
+
+type imageMeta struct {
+	ImageRepository string `yaml:"imageRepository"`
+	ImageTag        string `yaml:"imageTag"`
+}
+
+// parseClusterConfiguration 解析 kubeadm 配置片段，片段可以包含多个文档，仅使用 ClusterConfiguration
+// 未指定 kind 的单个文档也按 ClusterConfiguration 处理
+func parseClusterConfiguration(data string) (*clusterConfiguration, error) {
+	var found *clusterConfiguration
+	decoder := yaml.NewDecoder(bytes.NewBufferString(data))
+	for {
+		var cfg clusterConfiguration
+		err := decoder.Decode(&cfg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("解析 kubeadm 配置失败: %v", err)
+		}
+		if len(cfg.Kind) != 0 && cfg.Kind != clusterConfigurationKind {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("kubeadm 配置中存在多个 ClusterConfiguration")
+		}
+		found = &cfg
+	}
+	if found == nil {
+		return nil, fmt.Errorf("kubeadm 配置中未找到 ClusterConfiguration")
+	}
+
+	return found, nil
+}
+
+// Validate 校验 kubeadm 配置，配置片段指定了 kubernetesVersion 时需与任务的版本一致
+func (p Profile) Validate(kubernetesVersions ...string) error {
+	if len(strings.TrimSpace(p.Name)) == 0 {
+		return fmt.Errorf("kubeadm 配置名称不能为空")
+	}
+	if len(p.ClusterConfiguration) == 0 {
+		if len(p.ImageRepository) == 0 && len(p.Etcd) == 0 && len(p.CoreDNS) == 0 && len(p.Pause) == 0 {
+			return fmt.Errorf("kubeadm 配置(%s)未指定 ClusterConfiguration 或任何覆盖项", p.Name)
+		}
+		return nil
+	}
+
+	cfg, err := parseClusterConfiguration(p.ClusterConfiguration)
+	if err != nil {
+		return err
+	}
+	if len(cfg.KubernetesVersion) != 0 {
+		for _, v := range kubernetesVersions {
+			if v != cfg.KubernetesVersion {
+				return fmt.Errorf("kubeadm 配置的 kubernetesVersion(%s) 与任务版本(%s)不一致", cfg.KubernetesVersion, v)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply 在默认组件版本的基础上应用 kubeadm 配置，返回新的组件版本
+func (p Profile) Apply(c Components) (*Components, error) {
+	if len(p.ClusterConfiguration) != 0 {
+		cfg, err := parseClusterConfiguration(p.ClusterConfiguration)
+		if err != nil {
+			return nil, err
+		}
+		c.ImageRepository = override(c.ImageRepository, cfg.ImageRepository)
+		if cfg.Etcd.Local != nil {
+			c.EtcdRepository = override(c.EtcdRepository, cfg.Etcd.Local.ImageRepository)
+			c.Etcd = override(c.Etcd, cfg.Etcd.Local.ImageTag)
+		}
+		c.CoreDNSRepository = override(c.CoreDNSRepository, cfg.DNS.ImageRepository)
+		c.CoreDNS = override(c.CoreDNS, cfg.DNS.ImageTag)
+	}
+
+	c.ImageRepository = override(c.ImageRepository, p.ImageRepository)
+	c.Etcd = override(c.Etcd, p.Etcd)
+	c.CoreDNS = override(c.CoreDNS, p.CoreDNS)
+	c.Pause = override(c.Pause, p.Pause)
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func override(value string, custom string) string {
+	if custom = strings.TrimSpace(custom); len(custom) != 0 {
+		return strings.TrimSuffix(custom, "/")
+	}
+	return value
+}
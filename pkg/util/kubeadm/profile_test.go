@@ -0,0 +1,151 @@
+package kubeadm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfileApply(t *testing.T) {
+	defaults := Components{
+		Version:         "v1.28.0",
+		ImageRepository: DefaultImageRepository,
+		Pause:           "3.9",
+		Etcd:            "3.5.9-0",
+		CoreDNS:         "v1.10.1",
+	}
+
+	tests := []struct {
+		name    string
+		profile Profile
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "overrides only",
+			profile: Profile{Name: "p", ImageRepository: "harbor.example.com/k8s/", Pause: "3.8"},
+			want: []string{
+				"harbor.example.com/k8s/kube-apiserver:v1.28.0",
+				"harbor.example.com/k8s/kube-controller-manager:v1.28.0",
+				"harbor.example.com/k8s/kube-scheduler:v1.28.0",
+				"harbor.example.com/k8s/kube-proxy:v1.28.0",
+				"harbor.example.com/k8s/coredns:v1.10.1",
+				"harbor.example.com/k8s/pause:3.8",
+				"harbor.example.com/k8s/etcd:3.5.9-0",
+			},
+		},
+		{
+			name: "cluster configuration",
+			profile: Profile{Name: "p", ClusterConfiguration: `apiVersion: kubeadm.k8s.io/v1beta3
+kind: InitConfiguration
+---
+apiVersion: kubeadm.k8s.io/v1beta3
+kind: ClusterConfiguration
+imageRepository: harbor.example.com/k8s
+etcd:
+  local:
+    imageRepository: harbor.example.com/etcd
+    imageTag: 3.5.10-0
+dns:
+  imageRepository: harbor.example.com/dns
+  imageTag: v1.11.1
+`},
+			want: []string{
+				"harbor.example.com/k8s/kube-apiserver:v1.28.0",
+				"harbor.example.com/k8s/kube-controller-manager:v1.28.0",
+				"harbor.example.com/k8s/kube-scheduler:v1.28.0",
+				"harbor.example.com/k8s/kube-proxy:v1.28.0",
+				"harbor.example.com/dns/coredns:v1.11.1",
+				"harbor.example.com/k8s/pause:3.9",
+				"harbor.example.com/etcd/etcd:3.5.10-0",
+			},
+		},
+		{
+			name: "overrides take precedence over cluster configuration",
+			profile: Profile{
+				Name:                 "p",
+				ClusterConfiguration: "imageRepository: harbor.example.com/k8s\ndns:\n  imageTag: v1.11.1\n",
+				ImageRepository:      "mirror.example.com/k8s",
+				CoreDNS:              "v1.11.3",
+				Etcd:                 "3.5.15-0",
+			},
+			want: []string{
+				"mirror.example.com/k8s/kube-apiserver:v1.28.0",
+				"mirror.example.com/k8s/kube-controller-manager:v1.28.0",
+				"mirror.example.com/k8s/kube-scheduler:v1.28.0",
+				"mirror.example.com/k8s/kube-proxy:v1.28.0",
+				"mirror.example.com/k8s/coredns:v1.11.3",
+				"mirror.example.com/k8s/pause:3.9",
+				"mirror.example.com/k8s/etcd:3.5.15-0",
+			},
+		},
+		{
+			name:    "no cluster configuration",
+			profile: Profile{Name: "p", ClusterConfiguration: "apiVersion: kubeadm.k8s.io/v1beta3\nkind: InitConfiguration\n"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid yaml",
+			profile: Profile{Name: "p", ClusterConfiguration: "imageRepository: [\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := tc.profile.Apply(defaults)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Apply() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := c.Images(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  Profile
+		versions []string
+		wantErr  bool
+	}{
+		{
+			name:    "empty name",
+			profile: Profile{Pause: "3.9"},
+			wantErr: true,
+		},
+		{
+			name:    "nothing to apply",
+			profile: Profile{Name: "p"},
+			wantErr: true,
+		},
+		{
+			name:     "matching kubernetes version",
+			profile:  Profile{Name: "p", ClusterConfiguration: "kind: ClusterConfiguration\nkubernetesVersion: v1.28.0\n"},
+			versions: []string{"v1.28.0"},
+		},
+		{
+			name:     "mismatched kubernetes version",
+			profile:  Profile{Name: "p", ClusterConfiguration: "kind: ClusterConfiguration\nkubernetesVersion: v1.28.0\n"},
+			versions: []string{"v1.28.0", "v1.29.0"},
+			wantErr:  true,
+		},
+		{
+			name:    "multiple cluster configurations",
+			profile: Profile{Name: "p", ClusterConfiguration: "kind: ClusterConfiguration\n---\nkind: ClusterConfiguration\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.profile.Validate(tc.versions...); (err != nil) != tc.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package naming
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/caoyingjunz/rainbow/pkg/util/registry"
+)
+
+var (
+	// nameRe 目标镜像名称，仓库中的 repository 规范，允许多级路径
+	nameRe = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	// tagRe 目标镜像版本，docker tag 规范
+	tagRe = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+	funcs = template.FuncMap{
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"flatten":    func(s string) string { return strings.ReplaceAll(s, "/", "-") },
+		"regexReplace": func(expr, repl, s string) (string, error) {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return "", err
+			}
+			return re.ReplaceAllString(s, repl), nil
+		},
+	}
+)
+
+// Rule 目标镜像的命名规则，Name 和 Tag 为 go template，为空时分别使用源镜像的最后一段和源版本
+//
+// 模板中可以使用的变量:
+//
+//	.Registry   源镜像仓库地址，如 registry.k8s.io
+//	.Repository 源镜像在仓库中的路径，如 foo/bar
+//	.Path       源镜像地址，不含版本，如 registry.k8s.io/foo/bar
+//	.Name       源镜像地址的最后一段，如 bar
+//	.Tag        源镜像版本，仅 Tag 模板可用
+//
+// 模板中可以使用的函数: lower、upper、replace、trimPrefix、trimSuffix、flatten(将 / 替换为 -) 和 regexReplace
+//
+// 例如 registry.k8s.io/foo/bar:v1.2.3 使用 Name: k8s-{{ flatten .Repository }} 和 Tag: {{ trimPrefix "v" .Tag }}-mirror
+// 时，目标镜像为 k8s-foo-bar:1.2.3-mirror
+type Rule struct {
+	Name string `json:"name_template,omitempty" yaml:"name_template,omitempty"`
+	Tag  string `json:"tag_template,omitempty" yaml:"tag_template,omitempty"`
+}
+
+type source struct {
+	Registry   string
+	Repository string
+	Path       string
+	Name       string
+	Tag        string
+}
+
+// Merge 合并任务和仓库的命名规则，任务中设置的模板优先
+func Merge(task, reg Rule) Rule {
+	if len(task.Name) == 0 {
+		task.Name = reg.Name
+	}
+	if len(task.Tag) == 0 {
+		task.Tag = reg.Tag
+	}
+	return task
+}
+
+// IsZero 未设置任何模板时，使用默认的命名规则
+func (r Rule) IsZero() bool {
+	return len(r.Name) == 0 && len(r.Tag) == 0
+}
+
+// Validate 校验模板能否正常解析和渲染
+func (r Rule) Validate() error {
+	if _, err := r.ApplyName("registry.k8s.io/foo/bar"); err != nil {
+		return err
+	}
+	if _, err := r.ApplyTag("registry.k8s.io/foo/bar", "v1.2.3"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ApplyName 根据源镜像地址(不含版本)生成目标镜像名称
+func (r Rule) ApplyName(path string) (string, error) {
+	src := newSource(path, "")
+	if len(r.Name) == 0 {
+		if len(src.Name) == 0 {
+			return "", fmt.Errorf("不合规镜像名称 %s", path)
+		}
+		return src.Name, nil
+	}
+
+	name, err := render("name", r.Name, src)
+	if err != nil {
+		return "", err
+	}
+	if !nameRe.MatchString(name) {
+		return "", fmt.Errorf("镜像 %s 按命名模板生成的名称 %q 不合法", path, name)
+	}
+	return name, nil
+}
+
+// ApplyTag 根据源镜像地址和版本生成目标镜像版本
+func (r Rule) ApplyTag(path string, tag string) (string, error) {
+	if len(r.Tag) == 0 {
+		return tag, nil
+	}
+
+	target, err := render("tag", r.Tag, newSource(path, tag))
+	if err != nil {
+		return "", err
+	}
+	if !tagRe.MatchString(target) {
+		return "", fmt.Errorf("镜像 %s:%s 按版本模板生成的版本 %q 不合法", path, tag, target)
+	}
+	return target, nil
+}
+
+func newSource(path string, tag string) source {
+	parts := strings.Split(path, "/")
+	src := source{Path: path, Name: parts[len(parts)-1], Tag: tag}
+	if ref, err := registry.ParseReference(path); err == nil {
+		src.Registry = ref.Registry
+		src.Repository = ref.Repository
+	}
+	return src
+}
+
+func render(name string, text string, src source) (string, error) {
+	tpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析命名模板 %q 失败: %v", text, err)
+	}
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, src); err != nil {
+		return "", fmt.Errorf("渲染命名模板 %q 失败: %v", text, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
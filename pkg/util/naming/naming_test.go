@@ -0,0 +1,184 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		task Rule
+		reg  Rule
+		want Rule
+	}{
+		{
+			name: "task overrides registry",
+			task: Rule{Name: "task-{{ .Name }}", Tag: "{{ .Tag }}-task"},
+			reg:  Rule{Name: "reg-{{ .Name }}", Tag: "{{ .Tag }}-reg"},
+			want: Rule{Name: "task-{{ .Name }}", Tag: "{{ .Tag }}-task"},
+		},
+		{
+			name: "fallback to registry per field",
+			task: Rule{Tag: "{{ .Tag }}-task"},
+			reg:  Rule{Name: "reg-{{ .Name }}", Tag: "{{ .Tag }}-reg"},
+			want: Rule{Name: "reg-{{ .Name }}", Tag: "{{ .Tag }}-task"},
+		},
+		{
+			name: "both empty",
+			want: Rule{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Merge(tc.task, tc.reg)
+			if got != tc.want {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+			if got.IsZero() != (tc.want == Rule{}) {
+				t.Errorf("unexpected IsZero %v for %+v", got.IsZero(), got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr string
+	}{
+		{
+			name: "default rule",
+		},
+		{
+			name: "valid templates",
+			rule: Rule{Name: "k8s-{{ flatten .Repository }}", Tag: `{{ trimPrefix "v" .Tag }}-mirror`},
+		},
+		{
+			name:    "parse error",
+			rule:    Rule{Name: "{{ .Name "},
+			wantErr: "解析命名模板",
+		},
+		{
+			name:    "unknown field",
+			rule:    Rule{Name: "{{ .Unknown }}"},
+			wantErr: "渲染命名模板",
+		},
+		{
+			name:    "tag is not available in name template",
+			rule:    Rule{Name: "{{ .Name }}-{{ .Tag }}"},
+			wantErr: "不合法",
+		},
+		{
+			name:    "invalid tag output",
+			rule:    Rule{Tag: "{{ .Tag }}/latest"},
+			wantErr: "不合法",
+		},
+		{
+			name:    "invalid regular expression",
+			rule:    Rule{Name: `{{ regexReplace "(" "" .Name }}`},
+			wantErr: "渲染命名模板",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.Validate()
+			if len(tc.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		path     string
+		tag      string
+		wantName string
+		wantTag  string
+		wantErr  bool
+	}{
+		{
+			name:     "default rule keeps last segment and tag",
+			path:     "registry.k8s.io/foo/bar",
+			tag:      "v1.2.3",
+			wantName: "bar",
+			wantTag:  "v1.2.3",
+		},
+		{
+			name:     "flatten repository and trim tag prefix",
+			rule:     Rule{Name: "k8s-{{ flatten .Repository }}", Tag: `{{ trimPrefix "v" .Tag }}-mirror`},
+			path:     "registry.k8s.io/foo/bar",
+			tag:      "v1.2.3",
+			wantName: "k8s-foo-bar",
+			wantTag:  "1.2.3-mirror",
+		},
+		{
+			name:     "registry with port",
+			rule:     Rule{Name: `{{ replace ":" "-" .Registry }}/{{ .Repository }}`},
+			path:     "harbor.example.com:5000/library/nginx",
+			tag:      "1.25",
+			wantName: "harbor.example.com-5000/library/nginx",
+			wantTag:  "1.25",
+		},
+		{
+			name:     "docker hub library image",
+			rule:     Rule{Name: "{{ lower .Repository }}"},
+			path:     "nginx",
+			tag:      "latest",
+			wantName: "library/nginx",
+			wantTag:  "latest",
+		},
+		{
+			name:     "regex replace",
+			rule:     Rule{Name: `{{ regexReplace "^kube-" "" .Name }}`},
+			path:     "registry.k8s.io/kube-apiserver",
+			tag:      "v1.30.0",
+			wantName: "apiserver",
+			wantTag:  "v1.30.0",
+		},
+		{
+			name:    "invalid name output",
+			rule:    Rule{Name: "{{ upper .Name }}"},
+			path:    "registry.k8s.io/foo/bar",
+			tag:     "v1.2.3",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name, err := tc.rule.ApplyName(tc.path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got name %q", name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if name != tc.wantName {
+				t.Errorf("expected name %q, got %q", tc.wantName, name)
+			}
+			tag, err := tc.rule.ApplyTag(tc.path, tc.tag)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tag != tc.wantTag {
+				t.Errorf("expected tag %q, got %q", tc.wantTag, tag)
+			}
+		})
+	}
+}
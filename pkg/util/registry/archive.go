@@ -0,0 +1,327 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// 离线包的格式
+const (
+	// ArchiveOCI OCI image layout 的 tar 包，多架构镜像保留 index
+	ArchiveOCI = "oci"
+	// ArchiveDocker 兼容 docker load 的 tar 包，同时也是 OCI image layout，仅支持单平台镜像
+	ArchiveDocker = "docker"
+)
+
+const (
+	ociLayoutFile      = "oci-layout"
+	ociIndexFile       = "index.json"
+	dockerManifestFile = "manifest.json"
+
+	// index.json 中记录镜像名称的注解，与 docker save 写入的一致
+	annotationRefName   = "org.opencontainers.image.ref.name"
+	annotationImageName = "io.containerd.image.name"
+)
+
+// dockerManifest docker load 使用的 manifest.json 中的一项
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// Archive 将镜像依次写入离线包，同一 blob 只写入一次
+// 全部镜像写入后需调用 Close 写入 index.json 等索引文件，写入失败后离线包不可再使用
+type Archive struct {
+	c      *Client
+	format string
+	tw     *tar.Writer
+
+	blobs           map[string]bool
+	index           []Descriptor
+	dockerManifests []dockerManifest
+}
+
+// NewArchive 创建写入 w 的离线包，w 由调用方负责关闭
+func (c *Client) NewArchive(w io.Writer, format string) (*Archive, error) {
+	switch format {
+	case ArchiveOCI, ArchiveDocker:
+	default:
+		return nil, fmt.Errorf("不支持的离线包格式 %s，仅支持 %s 和 %s", format, ArchiveOCI, ArchiveDocker)
+	}
+
+	return &Archive{
+		c:      c,
+		format: format,
+		tw:     tar.NewWriter(w),
+		blobs:  make(map[string]bool),
+	}, nil
+}
+
+// Add 将源镜像写入离线包，name 为离线包中记录的镜像名称，格式为 仓库/镜像:版本
+// 平台选择与 Copy 一致，docker 格式不支持写入多架构 index
+func (a *Archive) Add(ctx context.Context, src string, name string, opts CopyOptions) (*CopyResult, error) {
+	srcRef, err := ParseReference(src)
+	if err != nil {
+		return nil, err
+	}
+	nameRef, err := ParseReference(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(nameRef.Tag) == 0 {
+		return nil, fmt.Errorf("离线包中的镜像名称 %s 需要指定版本", name)
+	}
+
+	content, desc, err := a.c.GetManifest(ctx, srcRef)
+	if err != nil {
+		return nil, fmt.Errorf("获取镜像 %s 的 manifest 失败: %v", src, err)
+	}
+	tracker := newProgressTracker(opts.Progress)
+
+	result := &CopyResult{SourceDigest: desc.Digest}
+	if IsIndex(desc.MediaType) && (opts.Artifact || opts.MultiArch) {
+		if a.format == ArchiveDocker {
+			return nil, fmt.Errorf("docker 格式的离线包不支持多架构镜像 %s", src)
+		}
+		platforms := opts.Platforms
+		if opts.Artifact {
+			platforms = nil
+		}
+		if content, result.Manifests, err = a.writeIndex(ctx, srcRef, content, platforms, tracker); err != nil {
+			return nil, err
+		}
+	} else {
+		if IsIndex(desc.MediaType) {
+			platform := opts.Platform
+			if platform == nil {
+				platform = &Platform{OS: "linux", Architecture: runtime.GOARCH}
+			}
+			child, err := selectPlatform(content, platform)
+			if err != nil {
+				return nil, fmt.Errorf("镜像 %s %v", src, err)
+			}
+			if content, desc, err = a.c.GetManifest(ctx, srcRef.WithDigest(child.Digest)); err != nil {
+				return nil, fmt.Errorf("获取镜像 %s 平台 %s 的 manifest 失败: %v", src, platform, err)
+			}
+			result.SourceDigest = desc.Digest
+		}
+		manifest, err := a.writeManifest(ctx, srcRef, content, desc, tracker)
+		if err != nil {
+			return nil, err
+		}
+		if a.format == ArchiveDocker {
+			a.addDockerManifest(manifest, nameRef)
+		}
+	}
+
+	result.TargetDigest = Digest(content)
+	result.MediaType = desc.MediaType
+	result.ArtifactType = GetArtifactType(content)
+	a.index = append(a.index, Descriptor{
+		MediaType: desc.MediaType,
+		Digest:    result.TargetDigest,
+		Size:      int64(len(content)),
+		Annotations: map[string]string{
+			annotationRefName:   nameRef.Tag,
+			annotationImageName: name,
+		},
+	})
+	klog.V(1).Infof("镜像 %s 已写入离线包(%s)", src, result.TargetDigest)
+	return result, nil
+}
+
+// writeIndex 写入 index 及其引用的各平台 manifest，仅写入部分平台时重写 index，返回写入的 index 内容
+func (a *Archive) writeIndex(ctx context.Context, src Reference, content []byte, platforms []*Platform, tracker *progressTracker) ([]byte, []Descriptor, error) {
+	var index Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, nil, fmt.Errorf("解析 index 失败: %v", err)
+	}
+
+	manifests := filterPlatforms(index.Manifests, platforms)
+	if len(manifests) == 0 {
+		return nil, nil, fmt.Errorf("镜像 %s 不存在平台 %v 的镜像", src, platforms)
+	}
+	for _, m := range manifests {
+		childContent, childDesc, err := a.c.GetManifest(ctx, src.WithDigest(m.Digest))
+		if err != nil {
+			return nil, nil, fmt.Errorf("获取镜像 %s 平台 %s 的 manifest 失败: %v", src, m.Platform, err)
+		}
+		if IsIndex(childDesc.MediaType) {
+			if _, _, err = a.writeIndex(ctx, src.WithDigest(m.Digest), childContent, nil, tracker); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if _, err = a.writeManifest(ctx, src, childContent, childDesc, tracker); err != nil {
+			return nil, nil, fmt.Errorf("写入平台 %s 失败: %v", m.Platform, err)
+		}
+	}
+
+	if len(manifests) != len(index.Manifests) {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(content, &raw); err != nil {
+			return nil, nil, fmt.Errorf("解析 index 失败: %v", err)
+		}
+		data, err := json.Marshal(manifests)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw["manifests"] = data
+		if content, err = json.Marshal(raw); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := a.writeContent(Digest(content), content); err != nil {
+		return nil, nil, err
+	}
+	return content, manifests, nil
+}
+
+// writeManifest 写入单个 manifest 引用的 config、layers 和 blobs，最后写入 manifest 本身
+func (a *Archive) writeManifest(ctx context.Context, src Reference, content []byte, desc Descriptor, tracker *progressTracker) (*Manifest, error) {
+	switch desc.MediaType {
+	case MediaTypeDockerManifest, MediaTypeOCIManifest, MediaTypeOCIArtifactManifest:
+	default:
+		return nil, fmt.Errorf("不支持的 manifest 类型 %s", desc.MediaType)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return nil, fmt.Errorf("解析 manifest 失败: %v", err)
+	}
+	var blobs []Descriptor
+	for _, blob := range append(append([]Descriptor{manifest.Config}, manifest.Layers...), manifest.Blobs...) {
+		if len(blob.Digest) != 0 && !isForeignLayer(blob) {
+			blobs = append(blobs, blob)
+		}
+	}
+	tracker.addManifest(blobs)
+	for _, blob := range blobs {
+		if err := a.writeBlob(ctx, src, blob, tracker); err != nil {
+			return nil, fmt.Errorf("写入 blob %s 失败: %v", blob.Digest, err)
+		}
+	}
+
+	if err := a.writeContent(Digest(content), content); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// writeBlob 从源仓库读取 blob 写入离线包，读取结束时校验 digest
+func (a *Archive) writeBlob(ctx context.Context, src Reference, blob Descriptor, tracker *progressTracker) error {
+	if a.blobs[blob.Digest] {
+		tracker.blobDone(blob.Size)
+		return nil
+	}
+
+	reader, size, err := a.c.GetBlob(ctx, src, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if blob.Size == 0 {
+		blob.Size = size
+	}
+
+	var r io.Reader = &digestVerifier{r: reader, digest: blob.Digest}
+	if a.c.limiter != nil {
+		r = &limitedReader{ctx: ctx, r: r, limiter: a.c.limiter}
+	}
+	if tracker != nil {
+		r = &progressReader{r: r, tracker: tracker}
+	}
+	if err = a.writeFile(blobPath(blob.Digest), blob.Size, r); err != nil {
+		return err
+	}
+	a.blobs[blob.Digest] = true
+	tracker.blobDone(0)
+	return nil
+}
+
+// writeContent 写入 manifest 或 index 等已在内存中的内容
+func (a *Archive) writeContent(digest string, content []byte) error {
+	if a.blobs[digest] {
+		return nil
+	}
+	if err := a.writeFile(blobPath(digest), int64(len(content)), bytes.NewReader(content)); err != nil {
+		return err
+	}
+	a.blobs[digest] = true
+	return nil
+}
+
+func (a *Archive) writeFile(name string, size int64, r io.Reader) error {
+	if err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	n, err := io.Copy(a.tw, r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("%s 的大小不一致, 期望 %d, 实际为 %d", name, size, n)
+	}
+	return nil
+}
+
+func (a *Archive) addDockerManifest(manifest *Manifest, name Reference) {
+	m := dockerManifest{
+		Config:   blobPath(manifest.Config.Digest),
+		RepoTags: []string{name.Registry + "/" + name.Repository + ":" + name.Tag},
+	}
+	for _, layer := range manifest.Layers {
+		m.Layers = append(m.Layers, blobPath(layer.Digest))
+	}
+	a.dockerManifests = append(a.dockerManifests, m)
+}
+
+// Close 写入 oci-layout、index.json，docker 格式时同时写入 manifest.json
+func (a *Archive) Close() error {
+	if err := a.writeJSON(ociLayoutFile, map[string]string{"imageLayoutVersion": "1.0.0"}); err != nil {
+		return err
+	}
+	if err := a.writeJSON(ociIndexFile, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: a.index}); err != nil {
+		return err
+	}
+	if a.format == ArchiveDocker {
+		if err := a.writeJSON(dockerManifestFile, a.dockerManifests); err != nil {
+			return err
+		}
+	}
+	return a.tw.Close()
+}
+
+func (a *Archive) writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return a.writeFile(name, int64(len(data)), bytes.NewReader(data))
+}
+
+// Images 返回已写入离线包的镜像数量
+func (a *Archive) Images() int {
+	return len(a.index)
+}
+
+func blobPath(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
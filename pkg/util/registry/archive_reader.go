@@ -0,0 +1,418 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// 不含 index.json 的 docker save 离线包中，未压缩的层和镜像配置使用的类型
+	mediaTypeOCIConfig    = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayer     = "application/vnd.oci.image.layer.v1.tar"
+	mediaTypeOCILayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	// maxArchiveMetadataSize 离线包中 manifest、index 和镜像配置等元数据文件的最大长度
+	maxArchiveMetadataSize = 8 << 20
+)
+
+// ArchiveImage 离线包中的一个镜像
+type ArchiveImage struct {
+	// Name 镜像名称，格式为 仓库/镜像:版本，如 docker.io/library/nginx:1.25
+	Name string
+
+	// desc OCI image layout 中 index.json 记录的 manifest 或 index
+	desc *Descriptor
+	// docker 不含 index.json 的 docker save 离线包中 manifest.json 的一项
+	docker *dockerManifest
+}
+
+type archiveEntry struct {
+	offset int64
+	size   int64
+}
+
+// ArchiveReader 读取 OCI image layout 或 docker save 格式的离线包
+// 打开时记录每个文件在 tar 包中的位置，推送时按需读取，不解压到磁盘
+type ArchiveReader struct {
+	f       *os.File
+	entries map[string]archiveEntry
+	images  []ArchiveImage
+}
+
+// OpenArchive 打开离线包，包含 index.json 时按 OCI image layout 解析，否则按 docker save 的 manifest.json 解析
+func OpenArchive(name string) (*ArchiveReader, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ArchiveReader{f: f, entries: make(map[string]archiveEntry)}
+	if err = r.scan(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err = r.loadImages(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// scan 遍历 tar 包，记录普通文件数据的起始位置和长度
+func (r *ArchiveReader) scan() error {
+	tr := tar.NewReader(r.f)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("解析离线包失败: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := r.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		r.entries[cleanArchivePath(header.Name)] = archiveEntry{offset: offset, size: header.Size}
+	}
+}
+
+func (r *ArchiveReader) loadImages() error {
+	if _, ok := r.entries[ociIndexFile]; ok {
+		var index Index
+		if err := r.readJSON(ociIndexFile, &index); err != nil {
+			return err
+		}
+		for i := range index.Manifests {
+			desc := index.Manifests[i]
+			r.images = append(r.images, ArchiveImage{Name: archiveImageName(desc), desc: &desc})
+		}
+		return nil
+	}
+
+	if _, ok := r.entries[dockerManifestFile]; ok {
+		var manifests []dockerManifest
+		if err := r.readJSON(dockerManifestFile, &manifests); err != nil {
+			return err
+		}
+		for i := range manifests {
+			m := manifests[i]
+			if len(m.RepoTags) == 0 {
+				r.images = append(r.images, ArchiveImage{docker: &m})
+				continue
+			}
+			for _, name := range m.RepoTags {
+				r.images = append(r.images, ArchiveImage{Name: name, docker: &m})
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("离线包中不存在 %s 或 %s，不是 OCI image layout 或 docker save 格式", ociIndexFile, dockerManifestFile)
+}
+
+// archiveImageName 从 index.json 的注解中获取镜像名称，ref.name 仅为版本时无法确定镜像名称，返回空
+func archiveImageName(desc Descriptor) string {
+	if name := desc.Annotations[annotationImageName]; len(name) != 0 {
+		return name
+	}
+	name := desc.Annotations[annotationRefName]
+	if ref, err := ParseReference(name); err == nil && len(ref.Tag) != 0 && strings.Contains(name, ":") {
+		return name
+	}
+	return ""
+}
+
+// Images 返回离线包中的镜像，未记录名称的镜像 Name 为空
+func (r *ArchiveReader) Images() []ArchiveImage {
+	return r.images
+}
+
+func (r *ArchiveReader) Close() error {
+	return r.f.Close()
+}
+
+func (r *ArchiveReader) open(name string) (io.Reader, int64, error) {
+	entry, ok := r.entries[cleanArchivePath(name)]
+	if !ok {
+		return nil, 0, fmt.Errorf("离线包中不存在 %s", name)
+	}
+	return io.NewSectionReader(r.f, entry.offset, entry.size), entry.size, nil
+}
+
+func (r *ArchiveReader) has(name string) bool {
+	_, ok := r.entries[cleanArchivePath(name)]
+	return ok
+}
+
+func (r *ArchiveReader) readFile(name string) ([]byte, error) {
+	reader, size, err := r.open(name)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxArchiveMetadataSize {
+		return nil, fmt.Errorf("离线包中的 %s 超过 %d 字节", name, maxArchiveMetadataSize)
+	}
+	return io.ReadAll(reader)
+}
+
+func (r *ArchiveReader) readJSON(name string, v interface{}) error {
+	data, err := r.readFile(name)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("解析离线包中的 %s 失败: %v", name, err)
+	}
+	return nil
+}
+
+// PushArchiveImage 将离线包中的镜像推送到目标镜像，多架构 index 中离线包未包含的平台会被移除
+func (c *Client) PushArchiveImage(ctx context.Context, r *ArchiveReader, img ArchiveImage, dst string, progress ProgressFunc) (*CopyResult, error) {
+	dstRef, err := ParseReference(dst)
+	if err != nil {
+		return nil, err
+	}
+	tracker := newProgressTracker(progress)
+
+	var content []byte
+	var mediaType string
+	result := &CopyResult{}
+	if img.docker != nil {
+		if content, err = r.dockerManifestContent(img.docker); err != nil {
+			return nil, err
+		}
+		mediaType = MediaTypeOCIManifest
+		result.SourceDigest = Digest(content)
+		if err = c.pushArchiveManifest(ctx, r, dstRef, content, tracker); err != nil {
+			return nil, err
+		}
+	} else {
+		if content, err = r.readFile(blobPath(img.desc.Digest)); err != nil {
+			return nil, err
+		}
+		mediaType = img.desc.MediaType
+		if len(mediaType) == 0 {
+			mediaType = detectMediaType(content)
+		}
+		result.SourceDigest = img.desc.Digest
+		if IsIndex(mediaType) {
+			if content, result.Manifests, err = c.pushArchiveIndex(ctx, r, dstRef, content, tracker); err != nil {
+				return nil, err
+			}
+		} else if err = c.pushArchiveManifest(ctx, r, dstRef, content, tracker); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.TargetDigest, err = c.PutManifest(ctx, dstRef, content, mediaType); err != nil {
+		return nil, fmt.Errorf("推送镜像 %s 的 manifest 失败: %v", dst, err)
+	}
+	result.MediaType = mediaType
+	result.ArtifactType = GetArtifactType(content)
+	klog.V(1).Infof("离线包中的镜像 %s 已推送到 %s(%s)", img.Name, dst, result.TargetDigest)
+	return result, nil
+}
+
+// pushArchiveIndex 推送 index 引用的各平台 manifest，离线包中缺少的平台从 index 中移除，返回需要推送的 index 内容
+func (c *Client) pushArchiveIndex(ctx context.Context, r *ArchiveReader, dst Reference, content []byte, tracker *progressTracker) ([]byte, []Descriptor, error) {
+	var index Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, nil, fmt.Errorf("解析 index 失败: %v", err)
+	}
+
+	var manifests []Descriptor
+	for _, m := range index.Manifests {
+		if !r.has(blobPath(m.Digest)) {
+			klog.Warningf("离线包中不存在平台 %s 的 manifest %s，跳过", m.Platform, m.Digest)
+			continue
+		}
+		childContent, err := r.readFile(blobPath(m.Digest))
+		if err != nil {
+			return nil, nil, err
+		}
+		child := dst.WithDigest(m.Digest)
+		if IsIndex(m.MediaType) {
+			if childContent, _, err = c.pushArchiveIndex(ctx, r, child, childContent, tracker); err != nil {
+				return nil, nil, err
+			}
+		} else if err = c.pushArchiveManifest(ctx, r, child, childContent, tracker); err != nil {
+			return nil, nil, fmt.Errorf("推送平台 %s 失败: %v", m.Platform, err)
+		}
+		if _, err = c.PutManifest(ctx, child, childContent, m.MediaType); err != nil {
+			return nil, nil, fmt.Errorf("推送平台 %s 的 manifest 失败: %v", m.Platform, err)
+		}
+		manifests = append(manifests, m)
+	}
+	if len(manifests) == 0 {
+		return nil, nil, fmt.Errorf("离线包中不存在 index 引用的任何平台")
+	}
+
+	if len(manifests) != len(index.Manifests) {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(content, &raw); err != nil {
+			return nil, nil, fmt.Errorf("解析 index 失败: %v", err)
+		}
+		data, err := json.Marshal(manifests)
+		if err != nil {
+			return nil, nil, err
+		}
+		raw["manifests"] = data
+		if content, err = json.Marshal(raw); err != nil {
+			return nil, nil, err
+		}
+	}
+	return content, manifests, nil
+}
+
+// pushArchiveManifest 推送单个 manifest 引用的 config、layers 和 blobs，manifest 本身由调用方推送
+func (c *Client) pushArchiveManifest(ctx context.Context, r *ArchiveReader, dst Reference, content []byte, tracker *progressTracker) error {
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("解析 manifest 失败: %v", err)
+	}
+	var blobs []Descriptor
+	for _, blob := range append(append([]Descriptor{manifest.Config}, manifest.Layers...), manifest.Blobs...) {
+		if len(blob.Digest) != 0 && !isForeignLayer(blob) {
+			blobs = append(blobs, blob)
+		}
+	}
+
+	tracker.addManifest(blobs)
+	for _, blob := range blobs {
+		if err := c.pushArchiveBlob(ctx, r, dst, blob, blobPath(blob.Digest), tracker); err != nil {
+			return fmt.Errorf("推送 blob %s 失败: %v", blob.Digest, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) pushArchiveBlob(ctx context.Context, r *ArchiveReader, dst Reference, blob Descriptor, name string, tracker *progressTracker) error {
+	exists, err := c.BlobExists(ctx, dst, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		tracker.blobDone(blob.Size)
+		return nil
+	}
+
+	reader, size, err := r.open(name)
+	if err != nil {
+		return err
+	}
+	if blob.Size == 0 {
+		blob.Size = size
+	}
+	if c.limiter != nil {
+		reader = &limitedReader{ctx: ctx, r: reader, limiter: c.limiter}
+	}
+	if tracker != nil {
+		reader = &progressReader{r: reader, tracker: tracker}
+	}
+	if err = c.UploadBlob(ctx, dst, "", blob, reader); err != nil {
+		return err
+	}
+	tracker.blobDone(0)
+	return nil
+}
+
+// dockerManifestContent 为 docker save 离线包中的镜像生成 OCI manifest，层按文件内容计算 digest
+// 层和配置以 blobs/sha256/<digest> 存放时直接使用路径中的 digest
+func (r *ArchiveReader) dockerManifestContent(m *dockerManifest) ([]byte, error) {
+	config, err := r.readFile(m.Config)
+	if err != nil {
+		return nil, err
+	}
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config: Descriptor{
+			MediaType: mediaTypeOCIConfig,
+			Digest:    Digest(config),
+			Size:      int64(len(config)),
+		},
+	}
+	for _, layer := range m.Layers {
+		desc, err := r.dockerLayer(layer)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+
+	// 推送时按生成的 manifest 从对应的路径读取 blob
+	if err = r.aliasBlob(manifest.Config.Digest, m.Config); err != nil {
+		return nil, err
+	}
+	for i, layer := range m.Layers {
+		if err = r.aliasBlob(manifest.Layers[i].Digest, layer); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(manifest)
+}
+
+func (r *ArchiveReader) dockerLayer(name string) (Descriptor, error) {
+	reader, size, err := r.open(name)
+	if err != nil {
+		return Descriptor{}, err
+	}
+
+	// 读取文件头判断是否为 gzip 压缩的层，docker save 导出的层通常未压缩
+	head := make([]byte, 2)
+	n, _ := io.ReadFull(reader, head)
+	mediaType := mediaTypeOCILayer
+	if n == 2 && bytes.Equal(head, []byte{0x1f, 0x8b}) {
+		mediaType = mediaTypeOCILayerGzip
+	}
+
+	digest := digestFromPath(name)
+	if len(digest) == 0 {
+		hash := sha256.New()
+		hash.Write(head[:n])
+		if _, err = io.Copy(hash, reader); err != nil {
+			return Descriptor{}, err
+		}
+		digest = "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	}
+	return Descriptor{MediaType: mediaType, Digest: digest, Size: size}, nil
+}
+
+// aliasBlob 使 blobs/sha256/<digest> 指向离线包中的原始文件
+func (r *ArchiveReader) aliasBlob(digest string, name string) error {
+	entry, ok := r.entries[cleanArchivePath(name)]
+	if !ok {
+		return fmt.Errorf("离线包中不存在 %s", name)
+	}
+	r.entries[blobPath(digest)] = entry
+	return nil
+}
+
+// digestFromPath 从 blobs/sha256/<hex> 格式的路径中获取 digest
+func digestFromPath(name string) string {
+	parts := strings.Split(cleanArchivePath(name), "/")
+	if len(parts) == 3 && parts[0] == "blobs" && parts[1] == "sha256" && len(parts[2]) == 64 {
+		return "sha256:" + parts[2]
+	}
+	return ""
+}
+
+func cleanArchivePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,303 @@
+package registry
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTar 将 files 按文件名顺序写入临时 tar 包，返回 tar 包路径
+func writeTar(t *testing.T, files map[string][]byte) string {
+	name := filepath.Join(t.TempDir(), "archive.tar")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var names []string
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	tw := tar.NewWriter(f)
+	for _, n := range names {
+		if err = tw.WriteHeader(&tar.Header{Name: n, Mode: 0644, Size: int64(len(files[n])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write(files[n]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func imageNames(images []ArchiveImage) []string {
+	var names []string
+	for _, img := range images {
+		names = append(names, img.Name)
+	}
+	return names
+}
+
+func TestOpenArchive(t *testing.T) {
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("layer")
+	manifest := mustJSON(t, Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        Descriptor{MediaType: mediaTypeOCIConfig, Digest: Digest(config), Size: int64(len(config))},
+		Layers:        []Descriptor{{MediaType: mediaTypeOCILayer, Digest: Digest(layer), Size: int64(len(layer))}},
+	})
+	ociBlobs := map[string][]byte{
+		ociLayoutFile:              []byte(`{"imageLayoutVersion":"1.0.0"}`),
+		blobPath(Digest(config)):   config,
+		blobPath(Digest(layer)):    layer,
+		blobPath(Digest(manifest)): manifest,
+	}
+	ociIndex := func(annotations map[string]string) map[string][]byte {
+		files := map[string][]byte{
+			ociIndexFile: mustJSON(t, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{{
+				MediaType:   MediaTypeOCIManifest,
+				Digest:      Digest(manifest),
+				Size:        int64(len(manifest)),
+				Annotations: annotations,
+			}}}),
+		}
+		for k, v := range ociBlobs {
+			files[k] = v
+		}
+		return files
+	}
+	dockerSave := func(repoTags []string) map[string][]byte {
+		return map[string][]byte{
+			dockerManifestFile: mustJSON(t, []dockerManifest{{Config: "abc.json", RepoTags: repoTags, Layers: []string{"abc/layer.tar"}}}),
+			"abc.json":         config,
+			"abc/layer.tar":    layer,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		files     map[string][]byte
+		raw       []byte
+		wantNames []string
+		wantErr   string
+		// pushable 离线包中的镜像可以推送，推送后的 manifest digest 为 wantDigest，为空时不校验
+		pushable   bool
+		wantDigest string
+	}{
+		{
+			name:       "oci layout with image name annotation",
+			files:      ociIndex(map[string]string{annotationImageName: "docker.io/library/nginx:1.25", annotationRefName: "1.25"}),
+			wantNames:  []string{"docker.io/library/nginx:1.25"},
+			pushable:   true,
+			wantDigest: Digest(manifest),
+		},
+		{
+			name:      "oci layout with full ref name",
+			files:     ociIndex(map[string]string{annotationRefName: "harbor.example.com:5000/library/nginx:1.25"}),
+			wantNames: []string{"harbor.example.com:5000/library/nginx:1.25"},
+		},
+		{
+			name:      "oci layout with tag only ref name is unnamed",
+			files:     ociIndex(map[string]string{annotationRefName: "1.25"}),
+			wantNames: []string{""},
+			pushable:  true,
+		},
+		{
+			name:      "docker save without index",
+			files:     dockerSave([]string{"nginx:1.25", "harbor.example.com/library/nginx:1.25"}),
+			wantNames: []string{"nginx:1.25", "harbor.example.com/library/nginx:1.25"},
+			pushable:  true,
+		},
+		{
+			name:      "docker save without repo tags is unnamed",
+			files:     dockerSave(nil),
+			wantNames: []string{""},
+		},
+		{
+			name:    "neither index nor docker manifest",
+			files:   map[string][]byte{"README": []byte("hello")},
+			wantErr: "不是 OCI image layout 或 docker save 格式",
+		},
+		{
+			name:    "not a tar file",
+			raw:     []byte(strings.Repeat("not a tar file", 64)),
+			wantErr: "解析离线包失败",
+		},
+		{
+			name:    "broken index",
+			files:   map[string][]byte{ociIndexFile: []byte("{")},
+			wantErr: "解析离线包中的 index.json 失败",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "archive.tar")
+			if tc.raw != nil {
+				if err := os.WriteFile(name, tc.raw, 0644); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				name = writeTar(t, tc.files)
+			}
+
+			r, err := OpenArchive(name)
+			if len(tc.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("open archive failed: %v", err)
+			}
+			defer r.Close()
+
+			images := r.Images()
+			if got := imageNames(images); strings.Join(got, ",") != strings.Join(tc.wantNames, ",") {
+				t.Fatalf("expected images %q, got %q", tc.wantNames, got)
+			}
+			if !tc.pushable {
+				return
+			}
+
+			f := newFakeRegistry(t, "", "")
+			result, err := f.client().PushArchiveImage(context.TODO(), r, images[0], f.host()+"/mirror/nginx:1.25", nil)
+			if err != nil {
+				t.Fatalf("push archive image failed: %v", err)
+			}
+			if len(tc.wantDigest) != 0 && result.TargetDigest != tc.wantDigest {
+				t.Errorf("expected digest %s, got %s", tc.wantDigest, result.TargetDigest)
+			}
+			if m, ok := f.getManifest("mirror/nginx", "1.25"); !ok || Digest(m.content) != result.TargetDigest {
+				t.Fatalf("target manifest missing or changed")
+			}
+			for _, blob := range [][]byte{config, layer} {
+				if !f.hasBlob("mirror/nginx", Digest(blob)) {
+					t.Errorf("blob %s missing", Digest(blob))
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := newFakeRegistry(t, "", "")
+	amd64 := src.putImage(t, "library/app", "", "amd64-layer")
+	arm64 := src.putImage(t, "library/app", "", "arm64-layer")
+	amd64.Platform = &Platform{OS: "linux", Architecture: "amd64"}
+	arm64.Platform = &Platform{OS: "linux", Architecture: "arm64"}
+	index := src.putManifest("library/app", "v1", MediaTypeOCIIndex, mustJSON(t, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{amd64, arm64}}))
+
+	tests := []struct {
+		name       string
+		format     string
+		opts       CopyOptions
+		wantDigest string
+		wantBlobs  []string
+		wantErr    string
+	}{
+		{
+			name:       "oci single platform",
+			format:     ArchiveOCI,
+			opts:       CopyOptions{Platform: &Platform{OS: "linux", Architecture: "arm64"}},
+			wantDigest: arm64.Digest,
+			wantBlobs:  []string{"arm64-layer"},
+		},
+		{
+			name:       "oci multi arch index",
+			format:     ArchiveOCI,
+			opts:       CopyOptions{MultiArch: true},
+			wantDigest: index.Digest,
+			wantBlobs:  []string{"amd64-layer", "arm64-layer"},
+		},
+		{
+			name:       "docker single platform",
+			format:     ArchiveDocker,
+			opts:       CopyOptions{Platform: &Platform{OS: "linux", Architecture: "amd64"}},
+			wantDigest: amd64.Digest,
+			wantBlobs:  []string{"amd64-layer"},
+		},
+		{
+			name:    "docker rejects multi arch index",
+			format:  ArchiveDocker,
+			opts:    CopyOptions{MultiArch: true},
+			wantErr: "不支持多架构镜像",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "archive.tar")
+			file, err := os.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			archive, err := src.client().NewArchive(file, tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = archive.Add(context.TODO(), src.host()+"/library/app:v1", "harbor.example.com/mirror/app:v1", tc.opts)
+			if len(tc.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("add image failed: %v", err)
+			}
+			if err = archive.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := OpenArchive(name)
+			if err != nil {
+				t.Fatalf("open archive failed: %v", err)
+			}
+			defer r.Close()
+			images := r.Images()
+			if got := imageNames(images); len(got) != 1 || got[0] != "harbor.example.com/mirror/app:v1" {
+				t.Fatalf("unexpected images %q", got)
+			}
+			if tc.format == ArchiveDocker && !r.has(dockerManifestFile) {
+				t.Errorf("docker archive should contain %s", dockerManifestFile)
+			}
+
+			dst := newFakeRegistry(t, "", "")
+			result, err := dst.client().PushArchiveImage(context.TODO(), r, images[0], dst.host()+"/mirror/app:v1", nil)
+			if err != nil {
+				t.Fatalf("push archive image failed: %v", err)
+			}
+			if result.TargetDigest != tc.wantDigest {
+				t.Errorf("expected digest %s, got %s", tc.wantDigest, result.TargetDigest)
+			}
+			for _, layer := range tc.wantBlobs {
+				if !dst.hasBlob("mirror/app", Digest([]byte(layer))) {
+					t.Errorf("blob of %s missing", layer)
+				}
+			}
+		})
+	}
+}
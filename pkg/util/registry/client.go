@@ -0,0 +1,567 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+// Client 基于 OCI distribution 协议的镜像仓库客户端，不依赖 docker 或 skopeo
+type Client struct {
+	client    *http.Client
+	plainHTTP map[string]bool
+	auths     map[string]Auth
+
+	lock sync.RWMutex
+	// 缓存的认证头，key 为 仓库地址 + scope
+	tokens map[string]string
+
+	// parallelLayers 单个 manifest 同时复制的 blob 数量
+	parallelLayers int
+	// limiter 复制 blob 的带宽限制，同一客户端的所有复制共享
+	limiter *rate.Limiter
+}
+
+type Auth struct {
+	Username string
+	Password string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient 指定使用的 http 客户端，可用于接入进程内的测试仓库
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithPlainHTTP 指定使用 http 访问的镜像仓库
+func WithPlainHTTP(registries ...string) Option {
+	return func(c *Client) {
+		for _, registry := range registries {
+			c.plainHTTP[registryHost(registry)] = true
+		}
+	}
+}
+
+// WithAuth 指定镜像仓库的用户名和密码
+func WithAuth(registry, username, password string) Option {
+	return func(c *Client) {
+		if len(username) == 0 {
+			return
+		}
+		c.auths[registryHost(registry)] = Auth{Username: username, Password: password}
+	}
+}
+
+// WithDockerConfig 从 docker 的配置文件加载镜像仓库的认证信息，与 docker 和 skopeo 使用相同的凭据访问私有的源仓库
+// 已通过 WithAuth 指定的仓库不会被覆盖，文件不存在或无法解析时忽略，不支持 credsStore 等凭据助手
+func WithDockerConfig(path string) Option {
+	return func(c *Client) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		var cfg struct {
+			Auths map[string]struct {
+				Auth     string `json:"auth"`
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"auths"`
+		}
+		if err = json.Unmarshal(data, &cfg); err != nil {
+			klog.Warningf("解析 docker 配置文件 %s 失败 %v", path, err)
+			return
+		}
+
+		for server, entry := range cfg.Auths {
+			auth := Auth{Username: entry.Username, Password: entry.Password}
+			if len(entry.Auth) != 0 {
+				decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+				if err != nil {
+					continue
+				}
+				auth.Username, auth.Password, _ = strings.Cut(string(decoded), ":")
+			}
+			if len(auth.Username) == 0 {
+				continue
+			}
+			// docker hub 的地址为 https://index.docker.io/v1/，只保留仓库地址
+			host := strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+			host, _, _ = strings.Cut(host, "/")
+			host = registryHost(host)
+			if _, ok := c.auths[host]; !ok {
+				c.auths[host] = auth
+			}
+		}
+	}
+}
+
+// DefaultDockerConfig 返回 docker 配置文件的默认路径，优先使用 DOCKER_CONFIG 环境变量
+func DefaultDockerConfig() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); len(dir) != 0 {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// WithParallelLayers 指定单个 manifest 同时复制的 blob 数量，默认逐个复制
+func WithParallelLayers(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.parallelLayers = n
+		}
+	}
+}
+
+// WithBandwidth 指定复制 blob 的带宽上限，单位为字节每秒，小于等于 0 时不限速
+func WithBandwidth(bytesPerSecond int64) Option {
+	return func(c *Client) {
+		c.limiter = newBandwidthLimiter(bytesPerSecond)
+	}
+}
+
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		client:    &http.Client{Timeout: 30 * time.Minute},
+		plainHTTP: make(map[string]bool),
+		auths:     make(map[string]Auth),
+		tokens:    make(map[string]string),
+
+		parallelLayers: 1,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error 镜像仓库返回的错误
+type Error struct {
+	StatusCode int
+	Method     string
+	URL        string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s 失败, 状态码 %d: %s", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+// GetManifest 获取 manifest 或 index 的原始内容
+func (c *Client) GetManifest(ctx context.Context, ref Reference) ([]byte, Descriptor, error) {
+	header := http.Header{"Accept": []string{strings.Join(manifestMediaTypes, ", ")}}
+	resp, err := c.do(ctx, ref.Host(), http.MethodGet, c.url(ref, "manifests/"+ref.Reference()), header, nil, pullScope(ref.Repository))
+	if err != nil {
+		return nil, Descriptor{}, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, Descriptor{}, err
+	}
+	desc := Descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    Digest(content),
+		Size:      int64(len(content)),
+	}
+	if i := strings.Index(desc.MediaType, ";"); i >= 0 {
+		desc.MediaType = strings.TrimSpace(desc.MediaType[:i])
+	}
+	if len(desc.MediaType) == 0 || desc.MediaType == "application/json" || desc.MediaType == "text/plain" {
+		desc.MediaType = detectMediaType(content)
+	}
+	if len(ref.Digest) != 0 && ref.Digest != desc.Digest {
+		return nil, Descriptor{}, fmt.Errorf("manifest %s digest 校验失败, 实际为 %s", ref, desc.Digest)
+	}
+
+	return content, desc, nil
+}
+
+// PutManifest 推送 manifest，返回仓库计算的 digest
+func (c *Client) PutManifest(ctx context.Context, ref Reference, content []byte, mediaType string) (string, error) {
+	header := http.Header{"Content-Type": []string{mediaType}}
+	resp, err := c.do(ctx, ref.Host(), http.MethodPut, c.url(ref, "manifests/"+ref.Reference()), header, content, pushScope(ref.Repository))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if digest := resp.Header.Get("Docker-Content-Digest"); len(digest) != 0 {
+		return digest, nil
+	}
+	return Digest(content), nil
+}
+
+// ListTags 获取 repository 下全部的 tag，仓库分页返回时依次获取后续页
+func (c *Client) ListTags(ctx context.Context, ref Reference) ([]string, error) {
+	var tags []string
+	next := c.url(ref, "tags/list")
+	for len(next) != 0 {
+		resp, err := c.do(ctx, ref.Host(), http.MethodGet, next, nil, nil, pullScope(ref.Repository))
+		if err != nil {
+			return nil, err
+		}
+		var list struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析 %s 的 tag 列表失败: %v", ref.Repository, err)
+		}
+		tags = append(tags, list.Tags...)
+
+		if next, err = nextLink(resp); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// nextLink 解析分页的 Link 头，如 </v2/nginx/tags/list?last=1.25&n=100>; rel="next"
+func nextLink(resp *http.Response) (string, error) {
+	link := resp.Header.Get("Link")
+	if len(link) == 0 || !strings.Contains(link, `rel="next"`) {
+		return "", nil
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("不合法的 Link 头 %s", link)
+	}
+	u, err := resp.Request.URL.Parse(link[start+1 : end])
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// BlobExists 判断 blob 是否已存在于仓库中
+func (c *Client) BlobExists(ctx context.Context, ref Reference, digest string) (bool, error) {
+	resp, err := c.do(ctx, ref.Host(), http.MethodHead, c.url(ref, "blobs/"+digest), nil, nil, pushScope(ref.Repository))
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// GetBlob 获取 blob 的数据流，调用方负责关闭
+func (c *Client) GetBlob(ctx context.Context, ref Reference, digest string) (io.ReadCloser, int64, error) {
+	resp, err := c.do(ctx, ref.Host(), http.MethodGet, c.url(ref, "blobs/"+digest), nil, nil, pullScope(ref.Repository))
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// MountBlob 尝试从同一仓库的其他 repository 挂载 blob，挂载失败时返回用于上传的地址
+func (c *Client) MountBlob(ctx context.Context, ref Reference, from string, digest string) (bool, string, error) {
+	query := url.Values{"mount": []string{digest}, "from": []string{from}}
+	resp, err := c.do(ctx, ref.Host(), http.MethodPost, c.url(ref, "blobs/uploads/")+"?"+query.Encode(), nil, []byte{}, pushScope(ref.Repository), pullScope(from))
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusCreated {
+		return true, "", nil
+	}
+	location, err := c.location(resp)
+	return false, location, err
+}
+
+// UploadBlob 以单次请求的方式上传 blob，location 为空时先发起上传
+func (c *Client) UploadBlob(ctx context.Context, ref Reference, location string, desc Descriptor, r io.Reader) error {
+	if len(location) == 0 {
+		resp, err := c.do(ctx, ref.Host(), http.MethodPost, c.url(ref, "blobs/uploads/"), nil, []byte{}, pushScope(ref.Repository))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if location, err = c.location(resp); err != nil {
+			return err
+		}
+	}
+
+	// 流式上传的请求体无法重放，上传前先刷新认证信息，同时避免重复上传已存在的 blob
+	exists, err := c.BlobExists(ctx, ref, desc.Digest)
+	if err != nil || exists {
+		return err
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	query := u.Query()
+	query.Set("digest", desc.Digest)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), &digestVerifier{r: r, digest: desc.Digest})
+	if err != nil {
+		return err
+	}
+	req.ContentLength = desc.Size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.send(req, ref.Host(), pushScope(ref.Repository))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *Client) url(ref Reference, path string) string {
+	scheme := "https"
+	if c.plainHTTP[ref.Host()] {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, ref.Host(), ref.Repository, path)
+}
+
+// location 获取上传地址，仓库可能返回相对地址
+func (c *Client) location(resp *http.Response) (string, error) {
+	location := resp.Header.Get("Location")
+	if len(location) == 0 {
+		return "", fmt.Errorf("镜像仓库未返回上传地址")
+	}
+	u, err := resp.Request.URL.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// do 发送可以重放的请求，遇到 401 时根据 WWW-Authenticate 完成认证后重试
+func (c *Client) do(ctx context.Context, host, method, rawURL string, header http.Header, body []byte, scopes ...string) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, r)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		return req, nil
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	key := host + " " + strings.Join(scopes, " ")
+	if auth := c.getToken(key); len(auth) != 0 {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		drain(resp)
+
+		auth, err := c.authorize(ctx, host, challenge, scopes)
+		if err != nil {
+			return nil, err
+		}
+		c.setToken(key, auth)
+
+		if req, err = newRequest(); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", auth)
+		if resp, err = c.client.Do(req); err != nil {
+			return nil, err
+		}
+	}
+
+	return checkResponse(resp)
+}
+
+// send 发送不可重放的请求
+func (c *Client) send(req *http.Request, host string, scopes ...string) (*http.Response, error) {
+	if auth := c.getToken(host + " " + strings.Join(scopes, " ")); len(auth) != 0 {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return checkResponse(resp)
+}
+
+func (c *Client) getToken(key string) string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.tokens[key]
+}
+
+func (c *Client) setToken(key string, auth string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.tokens[key] = auth
+}
+
+// authorize 根据仓库的认证要求获取 Authorization 请求头
+func (c *Client) authorize(ctx context.Context, host string, challenge string, scopes []string) (string, error) {
+	auth, hasAuth := c.auths[host]
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasAuth {
+			return "", fmt.Errorf("镜像仓库 %s 需要用户名和密码", host)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+auth.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("镜像仓库 %s 返回了不支持的认证方式 %q", host, challenge)
+	}
+
+	realm := params["realm"]
+	if len(realm) == 0 {
+		return "", fmt.Errorf("镜像仓库 %s 未返回认证地址", host)
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	if service := params["service"]; len(service) != 0 {
+		query.Set("service", service)
+	}
+	if len(scopes) == 0 && len(params["scope"]) != 0 {
+		scopes = []string{params["scope"]}
+	}
+	for _, scope := range scopes {
+		query.Add("scope", scope)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasAuth {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	if resp, err = checkResponse(resp); err != nil {
+		return "", fmt.Errorf("获取镜像仓库 %s 的 token 失败: %v", host, err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("解析镜像仓库 %s 的 token 失败: %v", host, err)
+	}
+	if len(token.Token) == 0 {
+		token.Token = token.AccessToken
+	}
+	if len(token.Token) == 0 {
+		return "", fmt.Errorf("镜像仓库 %s 返回的 token 为空", host)
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge 解析 WWW-Authenticate，如 Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return challenge, params
+	}
+	scheme, rest := challenge[:i], challenge[i+1:]
+
+	for len(rest) != 0 {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end+1:]
+			}
+		}
+		params[key] = strings.TrimSpace(value)
+	}
+
+	return scheme, params
+}
+
+func pullScope(repository string) string {
+	return fmt.Sprintf("repository:%s:pull", repository)
+}
+
+func pushScope(repository string) string {
+	return fmt.Sprintf("repository:%s:pull,push", repository)
+}
+
+func checkResponse(resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return nil, &Error{
+		StatusCode: resp.StatusCode,
+		Method:     resp.Request.Method,
+		URL:        resp.Request.URL.Redacted(),
+		Message:    strings.TrimSpace(string(message)),
+	}
+}
+
+func drain(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
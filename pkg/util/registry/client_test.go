@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		challenge  string
+		wantScheme string
+		wantParams map[string]string
+	}{
+		{
+			challenge:  `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`,
+			wantScheme: "Bearer",
+			wantParams: map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io", "scope": "repository:library/nginx:pull"},
+		},
+		{
+			challenge:  `Basic realm=harbor`,
+			wantScheme: "Basic",
+			wantParams: map[string]string{"realm": "harbor"},
+		},
+		{
+			challenge:  "Bearer",
+			wantScheme: "Bearer",
+			wantParams: map[string]string{},
+		},
+	}
+
+	for _, tc := range tests {
+		scheme, params := parseChallenge(tc.challenge)
+		if scheme != tc.wantScheme || !reflect.DeepEqual(params, tc.wantParams) {
+			t.Errorf("parseChallenge(%q) = %s %v, want %s %v", tc.challenge, scheme, params, tc.wantScheme, tc.wantParams)
+		}
+	}
+}
+
+func TestWithDockerConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"auths": {
+		"https://index.docker.io/v1/": {"auth": "dXNlcjpwYXNzOndvcmQ="},
+		"ghcr.io": {"username": "ghcr-user", "password": "ghcr-password"},
+		"harbor.example.com": {"auth": "aW52YWxpZA=="},
+		"quay.io": {"auth": "not-base64!"}
+	}}`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(WithAuth("ghcr.io", "explicit", "secret"), WithDockerConfig(path), WithDockerConfig(filepath.Join(t.TempDir(), "missing.json")))
+	want := map[string]Auth{
+		// docker hub 的地址转换为 API 地址，密码中可以包含冒号
+		"registry-1.docker.io": {Username: "user", Password: "pass:word"},
+		// 已经指定的认证信息不会被覆盖
+		"ghcr.io": {Username: "explicit", Password: "secret"},
+		// 没有冒号时只有用户名
+		"harbor.example.com": {Username: "invalid"},
+	}
+	if !reflect.DeepEqual(c.auths, want) {
+		t.Errorf("auths = %v, want %v", c.auths, want)
+	}
+}
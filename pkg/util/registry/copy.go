@@ -0,0 +1,312 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"runtime"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// CopyOptions 镜像复制的选项
+type CopyOptions struct {
+	// Platform 源镜像为多架构 index 时选择的平台，为空时使用当前运行平台
+	Platform *Platform
+
+	// MultiArch 同步整个 index，Platforms 为空时同步全部平台并保持 index digest 不变，否则仅同步指定的平台
+	MultiArch bool
+	Platforms []*Platform
+
+	// Artifact 按原样同步任意 OCI artifact，源为 index 时同步整个 index，不做平台选择
+	Artifact bool
+
+	// Progress 不为空时，复制过程中回调字节和层的进度
+	Progress ProgressFunc
+}
+
+// CopyResult 镜像复制的结果
+type CopyResult struct {
+	SourceDigest string
+	TargetDigest string
+	MediaType    string
+	ArtifactType string
+	// Manifests 多架构同步时，index 中各平台的 manifest
+	Manifests []Descriptor
+}
+
+// Copy 将源镜像复制到目标镜像，同一仓库内优先通过 mount 复用已存在的 blob
+func (c *Client) Copy(ctx context.Context, src, dst string, opts CopyOptions) (*CopyResult, error) {
+	srcRef, err := ParseReference(src)
+	if err != nil {
+		return nil, err
+	}
+	dstRef, err := ParseReference(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	content, desc, err := c.GetManifest(ctx, srcRef)
+	if err != nil {
+		return nil, fmt.Errorf("获取镜像 %s 的 manifest 失败: %v", src, err)
+	}
+	tracker := newProgressTracker(opts.Progress)
+	if IsIndex(desc.MediaType) && opts.Artifact {
+		return c.copyIndex(ctx, srcRef, dstRef, content, desc, nil, tracker)
+	}
+	if IsIndex(desc.MediaType) && opts.MultiArch {
+		return c.copyIndex(ctx, srcRef, dstRef, content, desc, opts.Platforms, tracker)
+	}
+	if IsIndex(desc.MediaType) {
+		platform := opts.Platform
+		if platform == nil {
+			platform = &Platform{OS: "linux", Architecture: runtime.GOARCH}
+		}
+		child, err := selectPlatform(content, platform)
+		if err != nil {
+			return nil, fmt.Errorf("镜像 %s %v", src, err)
+		}
+		klog.V(1).Infof("镜像 %s 为多架构镜像，选择平台 %s(%s)", src, platform, child.Digest)
+		if content, desc, err = c.GetManifest(ctx, srcRef.WithDigest(child.Digest)); err != nil {
+			return nil, fmt.Errorf("获取镜像 %s 平台 %s 的 manifest 失败: %v", src, platform, err)
+		}
+	}
+
+	targetDigest, err := c.copyManifest(ctx, srcRef, dstRef, content, desc, tracker)
+	if err != nil {
+		return nil, err
+	}
+	return &CopyResult{SourceDigest: desc.Digest, TargetDigest: targetDigest, MediaType: desc.MediaType, ArtifactType: GetArtifactType(content)}, nil
+}
+
+// copyIndex 复制 index 及其引用的各平台 manifest，仅同步部分平台时会重写 index
+func (c *Client) copyIndex(ctx context.Context, src, dst Reference, content []byte, desc Descriptor, platforms []*Platform, tracker *progressTracker) (*CopyResult, error) {
+	var index Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, fmt.Errorf("解析 index 失败: %v", err)
+	}
+
+	manifests := filterPlatforms(index.Manifests, platforms)
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("镜像 %s 不存在平台 %v 的镜像", src, platforms)
+	}
+	for _, m := range manifests {
+		childContent, childDesc, err := c.GetManifest(ctx, src.WithDigest(m.Digest))
+		if err != nil {
+			return nil, fmt.Errorf("获取镜像 %s 平台 %s 的 manifest 失败: %v", src, m.Platform, err)
+		}
+		if IsIndex(childDesc.MediaType) {
+			if _, err = c.copyIndex(ctx, src.WithDigest(m.Digest), dst.WithDigest(m.Digest), childContent, childDesc, nil, tracker); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err = c.copyManifest(ctx, src, dst.WithDigest(m.Digest), childContent, childDesc, tracker); err != nil {
+			return nil, fmt.Errorf("同步平台 %s 失败: %v", m.Platform, err)
+		}
+		klog.V(1).Infof("镜像 %s 平台 %s(%s) 同步完成", dst, m.Platform, m.Digest)
+	}
+
+	// 同步部分平台时，index 的 digest 会发生变化
+	if len(manifests) != len(index.Manifests) {
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(content, &raw); err != nil {
+			return nil, fmt.Errorf("解析 index 失败: %v", err)
+		}
+		data, err := json.Marshal(manifests)
+		if err != nil {
+			return nil, err
+		}
+		raw["manifests"] = data
+		if content, err = json.Marshal(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	targetDigest, err := c.PutManifest(ctx, dst, content, desc.MediaType)
+	if err != nil {
+		return nil, err
+	}
+	return &CopyResult{SourceDigest: desc.Digest, TargetDigest: targetDigest, MediaType: desc.MediaType, ArtifactType: GetArtifactType(content), Manifests: manifests}, nil
+}
+
+// filterPlatforms 选择指定平台的 manifest，同时保留这些平台关联的 attestation manifest
+func filterPlatforms(manifests []Descriptor, platforms []*Platform) []Descriptor {
+	if len(platforms) == 0 {
+		return manifests
+	}
+
+	selected := make(map[string]bool)
+	for _, m := range manifests {
+		for _, platform := range platforms {
+			if platform.Match(m.Platform) {
+				selected[m.Digest] = true
+				break
+			}
+		}
+	}
+
+	var result []Descriptor
+	for _, m := range manifests {
+		if selected[m.Digest] || selected[m.Annotations[attestationReferenceAnnotation]] {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// copyManifest 复制单个 manifest 引用的 config、layers 和 blobs，最后按原有的类型推送 manifest
+func (c *Client) copyManifest(ctx context.Context, src, dst Reference, content []byte, desc Descriptor, tracker *progressTracker) (string, error) {
+	switch desc.MediaType {
+	case MediaTypeDockerManifest, MediaTypeOCIManifest, MediaTypeOCIArtifactManifest:
+	default:
+		return "", fmt.Errorf("不支持的 manifest 类型 %s", desc.MediaType)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return "", fmt.Errorf("解析 manifest 失败: %v", err)
+	}
+	var blobs []Descriptor
+	for _, blob := range append(append([]Descriptor{manifest.Config}, manifest.Layers...), manifest.Blobs...) {
+		if len(blob.Digest) != 0 && !isForeignLayer(blob) {
+			blobs = append(blobs, blob)
+		}
+	}
+	tracker.addManifest(blobs)
+	if err := c.copyBlobs(ctx, src, dst, blobs, tracker); err != nil {
+		return "", err
+	}
+
+	return c.PutManifest(ctx, dst, content, desc.MediaType)
+}
+
+// copyBlobs 按 parallelLayers 并发复制 blob，任意一个失败时取消其余的复制
+func (c *Client) copyBlobs(ctx context.Context, src, dst Reference, blobs []Descriptor, tracker *progressTracker) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, c.parallelLayers)
+	for _, blob := range blobs {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+		go func(blob Descriptor) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := c.copyBlob(ctx, src, dst, blob, tracker); err != nil {
+				lock.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("同步 blob %s 失败: %v", blob.Digest, err)
+				}
+				lock.Unlock()
+				cancel()
+			}
+		}(blob)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+func (c *Client) copyBlob(ctx context.Context, src, dst Reference, blob Descriptor, tracker *progressTracker) error {
+	exists, err := c.BlobExists(ctx, dst, blob.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		klog.V(2).Infof("blob %s 已存在于 %s，跳过", blob.Digest, dst.Repository)
+		tracker.blobDone(blob.Size)
+		return nil
+	}
+
+	// 源和目标在同一个仓库时，尝试跨 repository 挂载
+	var location string
+	if src.Host() == dst.Host() && src.Repository != dst.Repository {
+		mounted, loc, err := c.MountBlob(ctx, dst, src.Repository, blob.Digest)
+		if err != nil {
+			klog.Warningf("挂载 blob %s 失败 %v，改为上传", blob.Digest, err)
+		}
+		if mounted {
+			klog.V(2).Infof("blob %s 已从 %s 挂载到 %s", blob.Digest, src.Repository, dst.Repository)
+			tracker.blobDone(blob.Size)
+			return nil
+		}
+		location = loc
+	}
+
+	reader, size, err := c.GetBlob(ctx, src, blob.Digest)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	if blob.Size == 0 {
+		blob.Size = size
+	}
+
+	var r io.Reader = reader
+	if c.limiter != nil {
+		r = &limitedReader{ctx: ctx, r: r, limiter: c.limiter}
+	}
+	if tracker != nil {
+		r = &progressReader{r: r, tracker: tracker}
+	}
+	if err = c.UploadBlob(ctx, dst, location, blob, r); err != nil {
+		return err
+	}
+	tracker.blobDone(0)
+	return nil
+}
+
+// selectPlatform 从 index 中选择指定平台的 manifest
+func selectPlatform(content []byte, platform *Platform) (*Descriptor, error) {
+	var index Index
+	if err := json.Unmarshal(content, &index); err != nil {
+		return nil, fmt.Errorf("解析 index 失败: %v", err)
+	}
+	for i, m := range index.Manifests {
+		if platform.Match(m.Platform) {
+			return &index.Manifests[i], nil
+		}
+	}
+	return nil, fmt.Errorf("不存在平台 %s 的镜像", platform)
+}
+
+// attestationReferenceAnnotation buildx 生成的 attestation manifest 通过该注解关联对应平台的 manifest
+const attestationReferenceAnnotation = "vnd.docker.reference.digest"
+
+// digestVerifier 在读取结束时校验数据的 digest，不一致时返回错误中断上传
+type digestVerifier struct {
+	r      io.Reader
+	digest string
+	hash   hash.Hash
+}
+
+func (v *digestVerifier) Read(p []byte) (int, error) {
+	if v.hash == nil {
+		v.hash = sha256.New()
+	}
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := "sha256:" + hex.EncodeToString(v.hash.Sum(nil)); actual != v.digest {
+			return n, fmt.Errorf("blob digest 校验失败, 期望 %s, 实际为 %s", v.digest, actual)
+		}
+	}
+	return n, err
+}
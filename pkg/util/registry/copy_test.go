@@ -0,0 +1,227 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	tests := []struct {
+		name string
+		// sameRegistry 源和目标使用同一个仓库
+		sameRegistry bool
+		// noLength 源 manifest 未记录 layer 大小，且源仓库返回 blob 时不设置 Content-Length
+		noLength bool
+		// corrupt 源仓库返回的 layer 内容与 digest 不一致
+		corrupt bool
+		wantErr string
+		check   func(t *testing.T, src, dst *fakeRegistry, result *CopyResult)
+	}{
+		{
+			name: "bearer token auth and blob upload",
+			check: func(t *testing.T, src, dst *fakeRegistry, result *CopyResult) {
+				if src.tokens == 0 || dst.tokens == 0 {
+					t.Errorf("expected tokens issued by both registries, got src %d dst %d", src.tokens, dst.tokens)
+				}
+				if n := dst.countRequests("PUT", "/blobs/uploads/"); n != 3 {
+					t.Errorf("expected 3 blob uploads, got %d", n)
+				}
+			},
+		},
+		{
+			name:         "cross repository mount",
+			sameRegistry: true,
+			check: func(t *testing.T, src, dst *fakeRegistry, result *CopyResult) {
+				if n := dst.countRequests("GET", "/blobs/sha256:"); n != 0 {
+					t.Errorf("expected blobs to be mounted without download, got %d blob downloads", n)
+				}
+				if n := dst.countRequests("PUT", "/blobs/uploads/"); n != 0 {
+					t.Errorf("expected no blob uploads, got %d", n)
+				}
+			},
+		},
+		{
+			name:     "chunked upload without content length",
+			noLength: true,
+			check: func(t *testing.T, src, dst *fakeRegistry, result *CopyResult) {
+				// config 记录了大小，仅 layer 使用 chunked 编码上传
+				if dst.chunked != 2 {
+					t.Errorf("expected 2 chunked uploads, got %d", dst.chunked)
+				}
+			},
+		},
+		{
+			name:    "blob digest mismatch",
+			corrupt: true,
+			wantErr: "digest 校验失败",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := newFakeRegistry(t, "src-user", "src-password")
+			dst := src
+			if !tc.sameRegistry {
+				dst = newFakeRegistry(t, "dst-user", "dst-password")
+			}
+			src.noLength = tc.noLength
+
+			desc := src.putImage(t, "library/app", "v1", "layer-1", "layer-2")
+			if tc.noLength {
+				m, _ := src.getManifest("library/app", "v1")
+				var manifest Manifest
+				if err := json.Unmarshal(m.content, &manifest); err != nil {
+					t.Fatal(err)
+				}
+				for i := range manifest.Layers {
+					manifest.Layers[i].Size = 0
+				}
+				content, err := json.Marshal(manifest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				desc = src.putManifest("library/app", "v1", MediaTypeOCIManifest, content)
+			}
+			if tc.corrupt {
+				src.blobs["library/app@"+Digest([]byte("layer-2"))] = []byte("corrupted")
+			}
+
+			c := src.client(
+				WithPlainHTTP(dst.host()),
+				WithAuth(src.host(), src.username, src.password),
+				WithAuth(dst.host(), dst.username, dst.password),
+				WithParallelLayers(2),
+			)
+			result, err := c.Copy(context.TODO(), src.host()+"/library/app:v1", dst.host()+"/mirror/app:v1", CopyOptions{})
+			if len(tc.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				if _, ok := dst.getManifest("mirror/app", "v1"); ok {
+					t.Errorf("manifest should not be pushed when blob copy fails")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("copy failed: %v", err)
+			}
+
+			if result.SourceDigest != desc.Digest || result.TargetDigest != desc.Digest {
+				t.Errorf("expected digest %s, got source %s target %s", desc.Digest, result.SourceDigest, result.TargetDigest)
+			}
+			m, ok := dst.getManifest("mirror/app", "v1")
+			if !ok || Digest(m.content) != desc.Digest {
+				t.Fatalf("target manifest missing or changed")
+			}
+			for _, layer := range []string{"layer-1", "layer-2"} {
+				if !dst.hasBlob("mirror/app", Digest([]byte(layer))) {
+					t.Errorf("target blob of %s missing", layer)
+				}
+			}
+			if _, err = c.Verify(context.TODO(), src.host()+"/library/app:v1", dst.host()+"/mirror/app:v1"); err != nil {
+				t.Errorf("verify failed: %v", err)
+			}
+			if tc.check != nil {
+				tc.check(t, src, dst, result)
+			}
+		})
+	}
+}
+
+func TestCopyIndex(t *testing.T) {
+	f := newFakeRegistry(t, "", "")
+	amd64 := f.putImage(t, "library/app", "", "amd64-layer")
+	arm64 := f.putImage(t, "library/app", "", "arm64-layer")
+	amd64.Platform = &Platform{OS: "linux", Architecture: "amd64"}
+	arm64.Platform = &Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	content, err := json.Marshal(Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{amd64, arm64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := f.putManifest("library/app", "v1", MediaTypeOCIIndex, content)
+
+	tests := []struct {
+		name       string
+		opts       CopyOptions
+		wantDigest string
+		wantBlobs  []string
+		skipBlobs  []string
+	}{
+		{
+			name:       "select single platform",
+			opts:       CopyOptions{Platform: &Platform{OS: "linux", Architecture: "arm64"}},
+			wantDigest: arm64.Digest,
+			wantBlobs:  []string{"arm64-layer"},
+			skipBlobs:  []string{"amd64-layer"},
+		},
+		{
+			name:       "mirror whole index",
+			opts:       CopyOptions{MultiArch: true},
+			wantDigest: index.Digest,
+			wantBlobs:  []string{"amd64-layer", "arm64-layer"},
+		},
+		{
+			name:      "mirror part of index",
+			opts:      CopyOptions{MultiArch: true, Platforms: []*Platform{{OS: "linux", Architecture: "amd64"}}},
+			wantBlobs: []string{"amd64-layer"},
+			skipBlobs: []string{"arm64-layer"},
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := "mirror/app" + strings.Repeat("x", i)
+			c := f.client()
+			result, err := c.Copy(context.TODO(), f.host()+"/library/app:v1", f.host()+"/"+repo+":v1", tc.opts)
+			if err != nil {
+				t.Fatalf("copy failed: %v", err)
+			}
+			if len(tc.wantDigest) != 0 && result.TargetDigest != tc.wantDigest {
+				t.Errorf("expected target digest %s, got %s", tc.wantDigest, result.TargetDigest)
+			}
+			for _, layer := range tc.wantBlobs {
+				if !f.hasBlob(repo, Digest([]byte(layer))) {
+					t.Errorf("blob of %s missing", layer)
+				}
+			}
+			for _, layer := range tc.skipBlobs {
+				if f.hasBlob(repo, Digest([]byte(layer))) {
+					t.Errorf("blob of %s should not be copied", layer)
+				}
+			}
+		})
+	}
+}
+
+func TestGetManifestDigestMismatch(t *testing.T) {
+	f := newFakeRegistry(t, "", "")
+	f.putImage(t, "library/app", "v1", "layer")
+	other := f.putImage(t, "library/other", "v1", "other-layer")
+	// 使用其他镜像的 digest 作为 tag，模拟仓库返回的内容与请求的 digest 不一致
+	m, _ := f.getManifest("library/app", "v1")
+	f.manifests["library/app@"+other.Digest] = m
+
+	ref, err := ParseReference(f.host() + "/library/app@" + other.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = f.client().GetManifest(context.TODO(), ref); err == nil || !strings.Contains(err.Error(), "digest 校验失败") {
+		t.Fatalf("expected digest mismatch error, got %v", err)
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	f := newFakeRegistry(t, "user", "password")
+	f.putImage(t, "library/app", "v1", "layer")
+
+	c := f.client(WithAuth(f.host(), "user", "wrong"))
+	ref, err := ParseReference(f.host() + "/library/app:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = c.GetManifest(context.TODO(), ref); err == nil || !strings.Contains(err.Error(), "token") {
+		t.Fatalf("expected token error, got %v", err)
+	}
+}
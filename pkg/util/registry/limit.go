@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// maxBandwidthBurst 限速器单次放行的最大字节数，读取时按该大小分段等待
+const maxBandwidthBurst = 1 << 20
+
+// ParseBandwidth 解析带宽上限，格式同 kubernetes 的资源数量，如 10Mi 表示每秒 10MiB，为空时不限速
+func ParseBandwidth(s string) (int64, error) {
+	if len(s) == 0 {
+		return 0, nil
+	}
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return 0, fmt.Errorf("带宽上限 %s 不合法，应为每秒的字节数，如 10Mi", s)
+	}
+	if q.Sign() <= 0 {
+		return 0, fmt.Errorf("带宽上限 %s 需要大于 0", s)
+	}
+	return q.Value(), nil
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	burst := bytesPerSecond
+	if burst > maxBandwidthBurst {
+		burst = maxBandwidthBurst
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(burst))
+}
+
+// limitedReader 读取数据时按带宽上限等待，单次读取不超过限速器的 burst
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
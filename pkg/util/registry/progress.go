@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"io"
+	"sync"
+)
+
+// Progress 复制的字节和层进度，源为 index 时随着各平台 manifest 的解析逐步累加总量
+type Progress struct {
+	BytesDone   int64
+	BytesTotal  int64
+	LayersDone  int
+	LayersTotal int
+}
+
+// ProgressFunc 进度变化时的回调，调用频繁，需要调用方自行节流
+type ProgressFunc func(Progress)
+
+type progressTracker struct {
+	lock     sync.Mutex
+	progress Progress
+	fn       ProgressFunc
+}
+
+func newProgressTracker(fn ProgressFunc) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	return &progressTracker{fn: fn}
+}
+
+func (t *progressTracker) update(f func(p *Progress)) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	f(&t.progress)
+	progress := t.progress
+	t.lock.Unlock()
+
+	t.fn(progress)
+}
+
+// addManifest 累加 manifest 引用的 blob 大小和层数
+func (t *progressTracker) addManifest(blobs []Descriptor) {
+	t.update(func(p *Progress) {
+		for _, blob := range blobs {
+			p.BytesTotal += blob.Size
+			p.LayersTotal++
+		}
+	})
+}
+
+func (t *progressTracker) addBytes(n int64) {
+	t.update(func(p *Progress) { p.BytesDone += n })
+}
+
+// blobDone blob 已存在或者挂载时，skipped 为未经过上传的字节数
+func (t *progressTracker) blobDone(skipped int64) {
+	t.update(func(p *Progress) {
+		p.BytesDone += skipped
+		p.LayersDone++
+	})
+}
+
+// progressReader 读取数据时更新进度
+type progressReader struct {
+	r       io.Reader
+	tracker *progressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.tracker.addBytes(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+)
+
+// BandwidthProxy 本地的 http 代理，通过该代理的流量共享同一个带宽上限
+// 用于限制 skopeo 等外部进程的带宽，https 请求通过 CONNECT 隧道转发，不解密内容
+type BandwidthProxy struct {
+	listener  net.Listener
+	server    *http.Server
+	limiter   *rate.Limiter
+	transport *http.Transport
+}
+
+// NewBandwidthProxy 在 127.0.0.1 的随机端口启动代理，bytesPerSecond 为上传和下载合计的带宽上限
+func NewBandwidthProxy(bytesPerSecond int64) (*BandwidthProxy, error) {
+	limiter := newBandwidthLimiter(bytesPerSecond)
+	if limiter == nil {
+		return nil, fmt.Errorf("带宽上限需要大于 0")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("启动限速代理失败: %v", err)
+	}
+
+	p := &BandwidthProxy{
+		listener:  listener,
+		limiter:   limiter,
+		transport: &http.Transport{Proxy: nil, ResponseHeaderTimeout: 5 * time.Minute},
+	}
+	p.server = &http.Server{Handler: p}
+	go func() {
+		if err := p.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			klog.Errorf("限速代理退出: %v", err)
+		}
+	}()
+	return p, nil
+}
+
+// URL 返回代理地址，用于设置 HTTP_PROXY 和 HTTPS_PROXY
+func (p *BandwidthProxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+func (p *BandwidthProxy) Close() error {
+	p.transport.CloseIdleConnections()
+	return p.server.Close()
+}
+
+func (p *BandwidthProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "仅支持代理请求", http.StatusBadRequest)
+		return
+	}
+	p.forward(w, r)
+}
+
+// tunnel 建立 CONNECT 隧道，双向转发的数据都计入带宽
+func (p *BandwidthProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := net.DialTimeout("tcp", r.Host, 30*time.Second)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		_ = upstream.Close()
+		http.Error(w, "不支持 CONNECT", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		return
+	}
+	if _, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		_ = upstream.Close()
+		_ = conn.Close()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		// 客户端在 CONNECT 响应前已发送的数据缓存在 buf 中
+		_, _ = io.Copy(upstream, &limitedReader{ctx: ctx, r: buf, limiter: p.limiter})
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(conn, &limitedReader{ctx: ctx, r: upstream, limiter: p.limiter})
+		closeWrite(conn)
+	}()
+	wg.Wait()
+	_ = upstream.Close()
+	_ = conn.Close()
+}
+
+// forward 转发 http 请求，用于使用 http 访问的仓库
+func (p *BandwidthProxy) forward(w http.ResponseWriter, r *http.Request) {
+	req := r.Clone(r.Context())
+	req.RequestURI = ""
+	req.Header.Del("Proxy-Connection")
+	req.Header.Del("Proxy-Authorization")
+	if r.Body != nil && r.ContentLength != 0 {
+		req.Body = io.NopCloser(&limitedReader{ctx: r.Context(), r: r.Body, limiter: p.limiter})
+	}
+
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, &limitedReader{ctx: r.Context(), r: resp.Body, limiter: p.limiter})
+}
+
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestBandwidthProxy(t *testing.T) {
+	const bandwidth = 32 << 10
+	payload := bytes.Repeat([]byte("x"), 2*bandwidth)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodPut {
+			if !bytes.Equal(body, payload) {
+				http.Error(w, "body mismatch", http.StatusBadRequest)
+			}
+			return
+		}
+		_, _ = w.Write(payload)
+	})
+
+	tests := []struct {
+		name   string
+		tls    bool
+		method string
+	}{
+		{name: "forward http download", method: http.MethodGet},
+		{name: "forward http upload", method: http.MethodPut},
+		{name: "connect tunnel download", tls: true, method: http.MethodGet},
+		{name: "connect tunnel upload", tls: true, method: http.MethodPut},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var server *httptest.Server
+			if tc.tls {
+				server = httptest.NewTLSServer(handler)
+			} else {
+				server = httptest.NewServer(handler)
+			}
+			defer server.Close()
+
+			proxy, err := NewBandwidthProxy(bandwidth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer proxy.Close()
+			proxyURL, _ := url.Parse(proxy.URL())
+
+			transport := server.Client().Transport.(*http.Transport).Clone()
+			transport.Proxy = http.ProxyURL(proxyURL)
+			client := &http.Client{Transport: transport}
+
+			var body io.Reader
+			if tc.method == http.MethodPut {
+				body = bytes.NewReader(payload)
+			}
+			req, err := http.NewRequest(tc.method, server.URL+"/v2/", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request through proxy failed: %v", err)
+			}
+			content, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusOK || (tc.method == http.MethodGet && !bytes.Equal(content, payload)) {
+				t.Fatalf("unexpected response %d with %d bytes", resp.StatusCode, len(content))
+			}
+			// 首个 burst 立即放行，其余数据需要按带宽上限等待
+			if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+				t.Errorf("expected transfer to be throttled, took %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultRegistry     = "docker.io"
+	defaultRegistryHost = "registry-1.docker.io"
+	defaultTag          = "latest"
+)
+
+// Reference 镜像地址，如 docker.io/library/nginx:latest 或 harbor.cloud.pixiuio.com/pixiuio/nginx@sha256:xxx
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference 解析镜像地址，未指定仓库时默认为 docker.io，未指定 tag 和 digest 时默认为 latest
+func ParseReference(s string) (Reference, error) {
+	name := strings.TrimPrefix(strings.TrimSpace(s), "docker://")
+	if len(name) == 0 {
+		return Reference{}, fmt.Errorf("镜像地址不能为空")
+	}
+
+	var ref Reference
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !strings.HasPrefix(ref.Digest, "sha256:") {
+			return Reference{}, fmt.Errorf("不支持的镜像 digest %s", ref.Digest)
+		}
+	}
+	// tag 只能出现在最后一个 / 之后，避免把仓库端口当做 tag
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+	}
+
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		ref.Registry, ref.Repository = parts[0], parts[1]
+	} else {
+		ref.Registry, ref.Repository = defaultRegistry, name
+	}
+	if ref.Registry == "index.docker.io" {
+		ref.Registry = defaultRegistry
+	}
+	if ref.Registry == defaultRegistry && !strings.Contains(ref.Repository, "/") {
+		ref.Repository = "library/" + ref.Repository
+	}
+	if len(ref.Repository) == 0 || ref.Repository != strings.ToLower(ref.Repository) {
+		return Reference{}, fmt.Errorf("不合法的镜像地址 %s", s)
+	}
+	if len(ref.Tag) == 0 && len(ref.Digest) == 0 {
+		ref.Tag = defaultTag
+	}
+
+	return ref, nil
+}
+
+// Host 返回镜像仓库 API 的地址
+func (r Reference) Host() string {
+	return registryHost(r.Registry)
+}
+
+// Reference 返回拉取 manifest 使用的 tag 或者 digest，digest 优先
+func (r Reference) Reference() string {
+	if len(r.Digest) != 0 {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// WithDigest 返回同一仓库下指定 digest 的镜像地址
+func (r Reference) WithDigest(digest string) Reference {
+	return Reference{Registry: r.Registry, Repository: r.Repository, Digest: digest}
+}
+
+func (r Reference) String() string {
+	name := r.Registry + "/" + r.Repository
+	if len(r.Tag) != 0 {
+		name = name + ":" + r.Tag
+	}
+	if len(r.Digest) != 0 {
+		name = name + "@" + r.Digest
+	}
+	return name
+}
+
+func registryHost(registry string) string {
+	registry = strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://"), "/")
+	if len(registry) == 0 || registry == defaultRegistry || registry == "index.docker.io" {
+		return defaultRegistryHost
+	}
+	return registry
+}
@@ -0,0 +1,47 @@
+package registry
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Reference
+		wantErr bool
+	}{
+		{input: "nginx", want: Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"}},
+		{input: "docker://nginx:1.25", want: Reference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"}},
+		{input: "index.docker.io/pixiuio/rainbow:v1", want: Reference{Registry: "docker.io", Repository: "pixiuio/rainbow", Tag: "v1"}},
+		{input: "harbor.example.com:5000/ns/app:v1", want: Reference{Registry: "harbor.example.com:5000", Repository: "ns/app", Tag: "v1"}},
+		{input: "localhost/app", want: Reference{Registry: "localhost", Repository: "app", Tag: "latest"}},
+		{input: "ghcr.io/ns/app:v1@sha256:abc", want: Reference{Registry: "ghcr.io", Repository: "ns/app", Tag: "v1", Digest: "sha256:abc"}},
+		{input: "ghcr.io/ns/app@md5:abc", wantErr: true},
+		{input: "ghcr.io/NS/app", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		ref, err := ParseReference(tc.input)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseReference(%q) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && ref != tc.want {
+			t.Errorf("ParseReference(%q) = %+v, want %+v", tc.input, ref, tc.want)
+		}
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := map[string]string{
+		"":                        "registry-1.docker.io",
+		"docker.io":               "registry-1.docker.io",
+		"https://index.docker.io": "registry-1.docker.io",
+		"http://harbor:5000/":     "harbor:5000",
+		"ghcr.io":                 "ghcr.io",
+	}
+	for input, want := range tests {
+		if got := registryHost(input); got != want {
+			t.Errorf("registryHost(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
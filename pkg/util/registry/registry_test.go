@@ -0,0 +1,284 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRegistry 进程内的 OCI distribution 仓库，支持 bearer token 认证、跨 repository 挂载和流式上传
+type fakeRegistry struct {
+	server *httptest.Server
+
+	username string
+	password string
+	token    string
+
+	// noLength 返回 blob 时不设置 Content-Length，使用 chunked 编码
+	noLength bool
+
+	lock      sync.Mutex
+	manifests map[string]fakeManifest // key 为 repository@tag 或 repository@digest
+	blobs     map[string][]byte       // key 为 repository@digest
+	uploads   map[string]*bytes.Buffer
+	requests  []string
+	chunked   int // 使用 chunked 编码上传的 blob 数量
+	tokens    int // 签发的 token 数量
+}
+
+type fakeManifest struct {
+	mediaType string
+	content   []byte
+}
+
+func newFakeRegistry(t *testing.T, username, password string) *fakeRegistry {
+	f := &fakeRegistry{
+		username:  username,
+		password:  password,
+		token:     "fake-token",
+		manifests: make(map[string]fakeManifest),
+		blobs:     make(map[string][]byte),
+		uploads:   make(map[string]*bytes.Buffer),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// host 返回仓库地址，用于拼接镜像名称
+func (f *fakeRegistry) host() string {
+	return strings.TrimPrefix(f.server.URL, "http://")
+}
+
+func (f *fakeRegistry) client(opts ...Option) *Client {
+	opts = append([]Option{WithHTTPClient(f.server.Client()), WithPlainHTTP(f.host())}, opts...)
+	return NewClient(opts...)
+}
+
+// putBlob 直接写入 blob，返回 blob 的描述
+func (f *fakeRegistry) putBlob(repo string, mediaType string, content []byte) Descriptor {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	digest := Digest(content)
+	f.blobs[repo+"@"+digest] = content
+	return Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+}
+
+// putManifest 直接写入 manifest，返回 manifest 的描述
+func (f *fakeRegistry) putManifest(repo string, tag string, mediaType string, content []byte) Descriptor {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	digest := Digest(content)
+	f.manifests[repo+"@"+digest] = fakeManifest{mediaType: mediaType, content: content}
+	if len(tag) != 0 {
+		f.manifests[repo+"@"+tag] = fakeManifest{mediaType: mediaType, content: content}
+	}
+	return Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+}
+
+// putImage 写入由 config 和 layers 组成的单平台镜像
+func (f *fakeRegistry) putImage(t *testing.T, repo string, tag string, layers ...string) Descriptor {
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        f.putBlob(repo, "application/vnd.oci.image.config.v1+json", []byte(`{"architecture":"amd64","os":"linux"}`)),
+	}
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, f.putBlob(repo, "application/vnd.oci.image.layer.v1.tar+gzip", []byte(layer)))
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.putManifest(repo, tag, MediaTypeOCIManifest, content)
+}
+
+func (f *fakeRegistry) hasBlob(repo string, digest string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	_, ok := f.blobs[repo+"@"+digest]
+	return ok
+}
+
+func (f *fakeRegistry) getManifest(repo string, reference string) (fakeManifest, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	m, ok := f.manifests[repo+"@"+reference]
+	return m, ok
+}
+
+// countRequests 返回指定方法且路径包含 pathPart 的请求数
+func (f *fakeRegistry) countRequests(method string, pathPart string) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	var n int
+	for _, r := range f.requests {
+		if strings.HasPrefix(r, method+" ") && strings.Contains(r, pathPart) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeRegistry) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lock.Lock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	f.lock.Unlock()
+
+	if r.URL.Path == "/token" {
+		f.serveToken(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v2/") {
+		http.NotFound(w, r)
+		return
+	}
+	if len(f.username) != 0 && r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:unknown:pull"`, f.server.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		i := strings.Index(path, "/blobs/uploads/")
+		f.serveUpload(w, r, path[:i], path[i+len("/blobs/uploads/"):])
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		f.serveManifest(w, r, path[:i], path[i+len("/manifests/"):])
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		f.serveBlob(w, r, path[:i], path[i+len("/blobs/"):])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeRegistry) serveToken(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || username != f.username || password != f.password {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.lock.Lock()
+	f.tokens++
+	f.lock.Unlock()
+	_ = json.NewEncoder(w).Encode(map[string]string{"token": f.token})
+}
+
+func (f *fakeRegistry) serveManifest(w http.ResponseWriter, r *http.Request, repo string, reference string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		m, ok := f.getManifest(repo, reference)
+		if !ok {
+			http.Error(w, "MANIFEST_UNKNOWN", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", Digest(m.content))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(m.content)
+		}
+	case http.MethodPut:
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		tag := reference
+		if strings.HasPrefix(reference, "sha256:") {
+			if reference != Digest(content) {
+				http.Error(w, "DIGEST_INVALID", http.StatusBadRequest)
+				return
+			}
+			tag = ""
+		}
+		desc := f.putManifest(repo, tag, r.Header.Get("Content-Type"), content)
+		w.Header().Set("Docker-Content-Digest", desc.Digest)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeRegistry) serveBlob(w http.ResponseWriter, r *http.Request, repo string, digest string) {
+	f.lock.Lock()
+	content, ok := f.blobs[repo+"@"+digest]
+	f.lock.Unlock()
+	if !ok {
+		http.Error(w, "BLOB_UNKNOWN", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(content)))
+	case http.MethodGet:
+		if f.noLength {
+			// 先刷新响应头，使响应使用 chunked 编码
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write(content)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeRegistry) serveUpload(w http.ResponseWriter, r *http.Request, repo string, id string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		query := r.URL.Query()
+		if mount, from := query.Get("mount"), query.Get("from"); len(mount) != 0 && len(from) != 0 {
+			if content, ok := f.blobs[from+"@"+mount]; ok {
+				f.blobs[repo+"@"+mount] = content
+				w.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		id = fmt.Sprintf("upload-%d", len(f.uploads))
+		f.uploads[id] = &bytes.Buffer{}
+		// 返回相对地址，客户端需要基于请求地址解析
+		w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/"+id)
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPatch, http.MethodPut:
+		buf, ok := f.uploads[id]
+		if !ok {
+			http.Error(w, "BLOB_UPLOAD_UNKNOWN", http.StatusNotFound)
+			return
+		}
+		if _, err := io.Copy(buf, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			w.Header().Set("Location", r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		digest := r.URL.Query().Get("digest")
+		if Digest(buf.Bytes()) != digest {
+			http.Error(w, "DIGEST_INVALID", http.StatusBadRequest)
+			return
+		}
+		if r.ContentLength < 0 {
+			f.chunked++
+		}
+		f.blobs[repo+"@"+digest] = buf.Bytes()
+		delete(f.uploads, id)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
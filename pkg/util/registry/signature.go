@@ -0,0 +1,240 @@
+package registry
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// cosign 签名、attestation 和 SBOM 以 sha256-<hex>.<suffix> 的 tag 保存在镜像所在的 repository
+	cosignSignatureSuffix   = ".sig"
+	cosignAttestationSuffix = ".att"
+	cosignSBOMSuffix        = ".sbom"
+
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// maxSignaturePayload 签名 payload 的最大长度
+	maxSignaturePayload = 1 << 20
+)
+
+// ParsePublicKey 解析 PEM 格式的公钥，支持 ECDSA、RSA 和 ED25519
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("公钥不是合法的 PEM 格式")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析公钥失败: %v", err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("不支持的公钥类型 %T", key)
+	}
+}
+
+// cosignTag 返回 digest 对应的 cosign tag，如 sha256-xxx.sig
+func cosignTag(digest string, suffix string) string {
+	return strings.Replace(digest, ":", "-", 1) + suffix
+}
+
+// VerifySignature 使用公钥校验镜像的 cosign 签名，至少存在一个签名校验通过时返回 nil
+func (c *Client) VerifySignature(ctx context.Context, image string, publicKey []byte) error {
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	ref, err := ParseReference(image)
+	if err != nil {
+		return err
+	}
+	_, desc, err := c.GetManifest(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("获取镜像 %s 的 manifest 失败: %v", image, err)
+	}
+
+	sigRef := Reference{Registry: ref.Registry, Repository: ref.Repository, Tag: cosignTag(desc.Digest, cosignSignatureSuffix)}
+	content, _, err := c.GetManifest(ctx, sigRef)
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("镜像 %s(%s) 不存在签名", image, desc.Digest)
+		}
+		return fmt.Errorf("获取镜像 %s 的签名失败: %v", image, err)
+	}
+	var manifest Manifest
+	if err = json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("解析镜像 %s 的签名失败: %v", image, err)
+	}
+
+	var errs []string
+	for _, layer := range manifest.Layers {
+		signature, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+		if err = c.verifyLayer(ctx, ref, layer, signature, desc.Digest, key); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		klog.V(1).Infof("镜像 %s(%s) 签名校验通过", image, desc.Digest)
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("镜像 %s(%s) 不存在签名", image, desc.Digest)
+	}
+	return fmt.Errorf("镜像 %s(%s) 签名校验失败: %s", image, desc.Digest, strings.Join(errs, "; "))
+}
+
+// verifyLayer 校验单个签名，签名的对象为 simple signing payload，payload 中记录了被签名镜像的 digest
+func (c *Client) verifyLayer(ctx context.Context, ref Reference, layer Descriptor, signature string, digest string, key crypto.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("签名不是合法的 base64 格式")
+	}
+
+	reader, _, err := c.GetBlob(ctx, ref, layer.Digest)
+	if err != nil {
+		return fmt.Errorf("获取签名 payload 失败: %v", err)
+	}
+	defer reader.Close()
+	payload, err := io.ReadAll(io.LimitReader(reader, maxSignaturePayload))
+	if err != nil {
+		return fmt.Errorf("获取签名 payload 失败: %v", err)
+	}
+	if Digest(payload) != layer.Digest {
+		return fmt.Errorf("签名 payload digest 校验失败")
+	}
+
+	if err = verifyPayload(key, payload, sig); err != nil {
+		return err
+	}
+
+	var simpleSigning struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err = json.Unmarshal(payload, &simpleSigning); err != nil {
+		return fmt.Errorf("解析签名 payload 失败: %v", err)
+	}
+	if simpleSigning.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Errorf("签名对应的镜像 digest %s 与镜像 digest 不一致", simpleSigning.Critical.Image.DockerManifestDigest)
+	}
+	return nil
+}
+
+func verifyPayload(key crypto.PublicKey, payload []byte, sig []byte) error {
+	hashed := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, hashed[:], sig) {
+			return fmt.Errorf("签名与公钥不匹配")
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, hashed[:], sig) != nil && rsa.VerifyPSS(k, crypto.SHA256, hashed[:], sig, nil) != nil {
+			return fmt.Errorf("签名与公钥不匹配")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, sig) {
+			return fmt.Errorf("签名与公钥不匹配")
+		}
+	default:
+		return fmt.Errorf("不支持的公钥类型 %T", key)
+	}
+	return nil
+}
+
+// CopyReferrers 复制镜像 digest 关联的 cosign 签名、attestation、SBOM 以及 OCI referrers，返回已复制的内容
+func (c *Client) CopyReferrers(ctx context.Context, src, dst string, digest string) ([]string, error) {
+	srcRef, err := ParseReference(src)
+	if err != nil {
+		return nil, err
+	}
+	dstRef, err := ParseReference(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	var copied []string
+	for _, suffix := range []string{cosignSignatureSuffix, cosignAttestationSuffix, cosignSBOMSuffix} {
+		tag := cosignTag(digest, suffix)
+		from := Reference{Registry: srcRef.Registry, Repository: srcRef.Repository, Tag: tag}
+		to := Reference{Registry: dstRef.Registry, Repository: dstRef.Repository, Tag: tag}
+
+		content, desc, err := c.GetManifest(ctx, from)
+		if err != nil {
+			if e, ok := err.(*Error); ok && e.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return copied, fmt.Errorf("获取 %s 失败: %v", from, err)
+		}
+		if err = c.copyContent(ctx, from, to, content, desc); err != nil {
+			return copied, fmt.Errorf("同步 %s 失败: %v", from, err)
+		}
+		copied = append(copied, tag)
+	}
+
+	referrers, err := c.ListReferrers(ctx, srcRef, digest)
+	if err != nil {
+		return copied, err
+	}
+	for _, referrer := range referrers {
+		content, desc, err := c.GetManifest(ctx, srcRef.WithDigest(referrer.Digest))
+		if err != nil {
+			return copied, fmt.Errorf("获取 referrer %s 失败: %v", referrer.Digest, err)
+		}
+		if err = c.copyContent(ctx, srcRef.WithDigest(referrer.Digest), dstRef.WithDigest(referrer.Digest), content, desc); err != nil {
+			return copied, fmt.Errorf("同步 referrer %s 失败: %v", referrer.Digest, err)
+		}
+		copied = append(copied, fmt.Sprintf("%s(%s)", referrer.Digest, referrer.ArtifactType))
+	}
+
+	return copied, nil
+}
+
+// copyContent 复制 manifest 或者 index
+func (c *Client) copyContent(ctx context.Context, src, dst Reference, content []byte, desc Descriptor) error {
+	if IsIndex(desc.MediaType) {
+		_, err := c.copyIndex(ctx, src, dst, content, desc, nil, nil)
+		return err
+	}
+	_, err := c.copyManifest(ctx, src, dst, content, desc, nil)
+	return err
+}
+
+// ListReferrers 通过 OCI referrers API 获取 digest 关联的 manifest，仓库不支持时返回空
+func (c *Client) ListReferrers(ctx context.Context, ref Reference, digest string) ([]Descriptor, error) {
+	header := http.Header{"Accept": []string{MediaTypeOCIIndex}}
+	resp, err := c.do(ctx, ref.Host(), http.MethodGet, c.url(ref, "referrers/"+digest), header, nil, pullScope(ref.Repository))
+	if err != nil {
+		if e, ok := err.(*Error); ok && (e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusMethodNotAllowed) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("获取 %s 的 referrers 失败: %v", digest, err)
+	}
+	defer resp.Body.Close()
+
+	var index Index
+	if err = json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, fmt.Errorf("解析 %s 的 referrers 失败: %v", digest, err)
+	}
+	return index.Manifests, nil
+}
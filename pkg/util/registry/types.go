@@ -0,0 +1,148 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	// MediaTypeOCIArtifactManifest OCI 1.1 草案中的 artifact manifest，部分仓库和 oras 旧版本仍在使用
+	MediaTypeOCIArtifactManifest = "application/vnd.oci.artifact.manifest.v1+json"
+)
+
+// manifestMediaTypes 拉取 manifest 时接受的类型
+var manifestMediaTypes = []string{
+	MediaTypeOCIIndex,
+	MediaTypeDockerManifestList,
+	MediaTypeOCIManifest,
+	MediaTypeDockerManifest,
+	MediaTypeOCIArtifactManifest,
+}
+
+// Platform 镜像的平台信息
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+	OSVersion    string `json:"os.version,omitempty"`
+}
+
+// ParsePlatform 解析 操作系统/架构/变体 格式的平台，如 linux/arm64/v8
+func ParsePlatform(s string) (*Platform, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) < 2 || len(parts) > 3 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return nil, fmt.Errorf("不合法的平台 %s，格式为 操作系统/架构/变体", s)
+	}
+	platform := &Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		platform.Variant = parts[2]
+	}
+	return platform, nil
+}
+
+// Match 判断平台是否匹配，未指定变体时匹配任意变体
+func (p *Platform) Match(other *Platform) bool {
+	if p == nil || other == nil {
+		return false
+	}
+	if p.OS != other.OS || p.Architecture != other.Architecture {
+		return false
+	}
+	return len(p.Variant) == 0 || p.Variant == other.Variant
+}
+
+func (p *Platform) String() string {
+	if p == nil {
+		return ""
+	}
+	if len(p.Variant) != 0 {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+// Descriptor 描述 manifest 中引用的内容
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	URLs         []string          `json:"urls,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+}
+
+// Manifest 兼容 docker v2 schema2、OCI image manifest 和 OCI artifact manifest
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Blobs         []Descriptor      `json:"blobs,omitempty"` // 仅 OCI artifact manifest 使用
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Index 兼容 docker manifest list 和 OCI image index
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// IsIndex 判断 manifest 是否为多架构的 index
+func IsIndex(mediaType string) bool {
+	return mediaType == MediaTypeOCIIndex || mediaType == MediaTypeDockerManifestList
+}
+
+// GetArtifactType 返回 manifest 或 index 的 artifact 类型，未声明 artifactType 时使用 config 的类型
+func GetArtifactType(content []byte) string {
+	var m Manifest
+	if err := json.Unmarshal(content, &m); err != nil {
+		return ""
+	}
+	if len(m.ArtifactType) != 0 {
+		return m.ArtifactType
+	}
+	return m.Config.MediaType
+}
+
+// Digest 计算内容的 sha256 digest
+func Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// detectMediaType 仓库未返回 Content-Type 时，从 manifest 内容中推断类型
+func detectMediaType(content []byte) string {
+	var m struct {
+		MediaType string            `json:"mediaType"`
+		Manifests []json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(content, &m); err != nil {
+		return ""
+	}
+	if len(m.MediaType) != 0 {
+		return m.MediaType
+	}
+	if m.Manifests != nil {
+		return MediaTypeOCIIndex
+	}
+	return MediaTypeOCIManifest
+}
+
+// isForeignLayer 不可分发的层只能从 urls 中获取，不需要同步
+func isForeignLayer(d Descriptor) bool {
+	return strings.Contains(d.MediaType, "foreign") || strings.Contains(d.MediaType, "nondistributable")
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// VerifyResult 源镜像和目标镜像的校验结果
+type VerifyResult struct {
+	SourceDigest string
+	TargetDigest string
+	// Platform 目标镜像为源 index 中单个平台的镜像时，对应的平台
+	Platform string
+}
+
+// Verify 校验目标镜像与源镜像内容一致
+// 1. digest 相同时校验通过
+// 2. 源镜像为 index，目标镜像为其中某个平台的 manifest 时校验通过
+// 3. 源和目标均为 index 时（同步部分平台会重写 index），目标 index 中每个平台的 digest 都必须存在于源 index 中
+func (c *Client) Verify(ctx context.Context, src, dst string) (*VerifyResult, error) {
+	srcRef, err := ParseReference(src)
+	if err != nil {
+		return nil, err
+	}
+	dstRef, err := ParseReference(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	srcContent, srcDesc, err := c.GetManifest(ctx, srcRef)
+	if err != nil {
+		return nil, fmt.Errorf("获取源镜像 %s 的 manifest 失败: %v", src, err)
+	}
+	dstContent, dstDesc, err := c.GetManifest(ctx, dstRef)
+	if err != nil {
+		return nil, fmt.Errorf("获取目标镜像 %s 的 manifest 失败: %v", dst, err)
+	}
+
+	result := &VerifyResult{SourceDigest: srcDesc.Digest, TargetDigest: dstDesc.Digest}
+	if srcDesc.Digest == dstDesc.Digest {
+		return result, nil
+	}
+	if !IsIndex(srcDesc.MediaType) {
+		return nil, fmt.Errorf("源镜像 digest %s 与目标镜像 digest %s 不一致", srcDesc.Digest, dstDesc.Digest)
+	}
+
+	var srcIndex Index
+	if err = json.Unmarshal(srcContent, &srcIndex); err != nil {
+		return nil, fmt.Errorf("解析源镜像 index 失败: %v", err)
+	}
+	children := make(map[string]Descriptor)
+	for _, m := range srcIndex.Manifests {
+		children[m.Digest] = m
+	}
+
+	if !IsIndex(dstDesc.MediaType) {
+		child, ok := children[dstDesc.Digest]
+		if !ok {
+			return nil, fmt.Errorf("目标镜像 digest %s 不属于源镜像 index %s 中的任何平台", dstDesc.Digest, srcDesc.Digest)
+		}
+		result.Platform = child.Platform.String()
+		return result, nil
+	}
+
+	var dstIndex Index
+	if err = json.Unmarshal(dstContent, &dstIndex); err != nil {
+		return nil, fmt.Errorf("解析目标镜像 index 失败: %v", err)
+	}
+	for _, m := range dstIndex.Manifests {
+		if _, ok := children[m.Digest]; !ok {
+			return nil, fmt.Errorf("目标镜像平台 %s 的 digest %s 不存在于源镜像 index %s 中", m.Platform, m.Digest, srcDesc.Digest)
+		}
+	}
+	return result, nil
+}